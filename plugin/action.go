@@ -1,5 +1,11 @@
 package plugin
 
+import (
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
 // Actionable must be implemented by Actions to work with Plugins
 type Actionable interface {
 	Act() error          // Act will run the action.
@@ -9,4 +15,36 @@ type Actionable interface {
 
 // Action defines a struct that should be embedded within any
 // implemented Action.
-type Action struct{}
+type Action struct {
+	warnings
+}
+
+// warnings collects the warnings an action reports while it acts
+type warnings struct {
+	mu   sync.Mutex
+	list []message.Warning
+}
+
+// Warn reports a non-fatal issue with the action's result, ie: that it was truncated, which is sent
+// with the result in its warnings
+//
+//	a.Warn(message.Truncated("results", len(results), total))
+func (w *warnings) Warn(warning message.Warning) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = append(w.list, warning)
+}
+
+// takeWarnings returns the warnings reported, and forgets them for the next run
+func (w *warnings) takeWarnings() []message.Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := w.list
+	w.list = nil
+	return list
+}
+
+// warnable is implemented by actions that compose with Action
+type warnable interface {
+	takeWarnings() []message.Warning
+}
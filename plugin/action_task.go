@@ -1,16 +1,40 @@
 package plugin
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/komand/plugin-sdk-go/plugin/artifact"
+	"github.com/komand/plugin-sdk-go/plugin/codec"
 	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/schema"
+	"github.com/komand/plugin-sdk-go/plugin/secrets"
+
+	log "github.com/Sirupsen/logrus"
 )
 
+// artifactHandoff is set by SetArtifactStore. When set, action outputs larger than the threshold
+// are stored out of band and the result carries a reference to them instead.
+var artifactHandoff *handoff
+
+type handoff struct {
+	store     artifact.Store
+	threshold int
+	ttl       time.Duration
+}
+
 // actionTask task runner
 type actionTask struct {
 	dispatcher Dispatcher
 	message    *message.ActionStart
 	action     Actionable
+	raw        json.RawMessage // raw is the start message body, as received, for dead lettering
+	replay     bool            // replay is set when re-running a recorded message, so it isn't dead lettered again
+	failure    error           // failure is the error the action failed with, if it did
+	degraded   string          // degraded is the fallback the output came from, if the action degraded
+	warnings   []message.Warning
+	rotator    *rotator
 }
 
 // Test the task
@@ -32,6 +56,9 @@ func (a *actionTask) Test() error {
 	if testable, ok := a.action.(Testable); ok {
 
 		output, err := testable.Test()
+		if warnable, ok := a.action.(warnable); ok {
+			a.warnings = append(a.warnings, warnable.takeWarnings()...)
+		}
 		if err != nil {
 			return err
 		}
@@ -54,40 +81,69 @@ func (a *actionTask) Run() error {
 		return err
 	}
 
-	// connect the connection
-	if connectable, ok := a.action.(Connectable); ok {
-		if err := connectable.Connection().Connect(); err != nil {
+	// connect the connection, unless it was connected with the same parameters ahead of time
+	if connectable, ok := a.action.(Connectable); ok && !isWarm(a.action, a.message.Connection.RawMessage) {
+		if err := a.rotator.run(connectable.Connection().Connect); err != nil {
 			return err
 		}
 	}
 
-	// perform the action
-	if err := a.action.Act(); err != nil {
-		return a.fail(err.Error())
+	// perform the action, again if it fails because the credentials expired, or degrade if its vendor is failing
+	output, degraded, err := a.act()
+	countActionRun(a.message.Action, err)
+	if warnable, ok := a.action.(warnable); ok {
+		a.warnings = append(a.warnings, warnable.takeWarnings()...)
 	}
-
-	// default output is empty
-	var output interface{} = struct{}{}
-
-	// use the output of the action as the argument to 'done'
-	if outputable, ok := a.action.(Outputable); ok {
-		output = outputable.Output()
+	if err != nil {
+		a.failure = err
+		if deadLetters != nil && !a.replay {
+			deadLetterStart(a.message.Action, err, a.raw)
+		}
+		return a.fail(err)
+	}
+	if degraded != "" {
+		warning := message.Warn(message.WarnDegraded, "The vendor of %s is unavailable, returning %s output", a.message.Action, degraded)
+		a.degraded = degraded
+		a.warnings = append(a.warnings, warning)
+		log.Warn(warning.Message)
 	}
 	return a.success(output)
 }
 
 // Success will complete the action
 func (a *actionTask) success(output Output) error {
-	return a.emit("", output)
+	return a.emit(nil, output)
 }
 
-// fail will write the error message
-func (a *actionTask) fail(err string) error {
+// fail will write the error message, and its code
+func (a *actionTask) fail(err error) error {
 	return a.emit(err, nil)
 }
 
+// flush sends part of the output ahead of the result, for a Streamable action
+func (a *actionTask) flush(out Output) error {
+	out, err := seal(out, out)
+	if err != nil {
+		return err
+	}
+	m := message.Message{
+		Header: message.Header{
+			Version: message.Version,
+			Type:    "action_event",
+		},
+	}
+	m.Body.Contents = &message.ActionResult{
+		Meta:   a.message.Meta,
+		Status: message.PARTIAL,
+		Output: message.OutputMessage{
+			Contents: out,
+		},
+	}
+	return a.dispatcher.Send(&m)
+}
+
 // emit emits a message to the dispatcher
-func (a *actionTask) emit(err string, out Output) error {
+func (a *actionTask) emit(err error, out Output) error {
 
 	m := message.Message{
 		Header: message.Header{
@@ -97,23 +153,36 @@ func (a *actionTask) emit(err string, out Output) error {
 	}
 
 	var e message.ActionResult
-	if err != "" {
+	if err != nil {
 		e = message.ActionResult{
-			Meta:   a.message.Meta,
-			Status: message.ERROR,
-			Error:  err,
+			Meta:      a.message.Meta,
+			Status:    message.ERROR,
+			Error:     err.Error(),
+			ErrorCode: ErrorCode(err),
 		}
 
 	} else {
+		out, sealErr := seal(out, out)
+		if sealErr != nil {
+			return sealErr
+		}
 		e = message.ActionResult{
 			Meta:   a.message.Meta,
 			Status: message.OK,
 			Output: message.OutputMessage{
 				Contents: out,
 			},
+			Degraded: a.degraded,
+		}
+		if artifactHandoff != nil {
+			if err := artifactHandoff.offload(&e); err != nil {
+				// the output is still there, return it inline rather than not at all
+				log.Warnf("Unable to offload the output of %s to the artifact store, returning it inline: %s", a.message.Action, err)
+			}
 		}
 	}
 
+	e.Warnings = a.warnings
 	m.Body.Contents = &e
 	return a.dispatcher.Send(&m)
 }
@@ -123,6 +192,10 @@ func (a *actionTask) unpack(ignoreInputs bool) error {
 
 	msg := a.message
 
+	if metaable, ok := a.action.(Metaable); ok {
+		metaable.SetMeta(msg.Meta)
+	}
+
 	if connectable, ok := a.action.(Connectable); ok {
 		msg.Connection.Contents = connectable.Connection()
 	}
@@ -134,6 +207,33 @@ func (a *actionTask) unpack(ignoreInputs bool) error {
 	// configure the dispatcher
 	msg.Dispatcher.Contents = a.dispatcher
 
+	// references to secrets are resolved here, so only the connection ever holds the credentials
+	a.rotator = newRotator(a.action, msg.Connection.RawMessage)
+	resolved, err := secrets.ResolveJSON(msg.Connection.RawMessage)
+	if err != nil {
+		return fmt.Errorf("Connection validation failed: %s", err)
+	}
+	msg.Connection.RawMessage = resolved
+
+	if !ignoreInputs {
+		migrated, warnings, err := migrateInput(msg.Action, a.action, msg.Input.RawMessage)
+		if err != nil {
+			return fmt.Errorf("Input validation failed: %s", err)
+		}
+		msg.Input.RawMessage = migrated
+		a.warnings = append(a.warnings, warnings...)
+	}
+
+	if schemable, ok := a.action.(InputSchemable); ok && !ignoreInputs {
+		s, err := schema.Compile(schemable.InputSchema())
+		if err != nil {
+			return fmt.Errorf("Invalid input schema: %s", err)
+		}
+		if errs := s.Validate(msg.Input.RawMessage); len(errs) > 0 {
+			return fmt.Errorf("Input validation failed: %s", joinErrors(errs))
+		}
+	}
+
 	if err := msg.Unpack(); err != nil {
 		return err
 	}
@@ -150,5 +250,28 @@ func (a *actionTask) unpack(ignoreInputs bool) error {
 		}
 	}
 
+	if !ignoreInputs {
+		a.warnings = append(a.warnings, deprecatedUses(msg.Action, a.action, msg.Input.RawMessage)...)
+	}
+	return nil
+}
+
+// offload moves the result output into the artifact store if it's over the threshold
+func (h *handoff) offload(e *message.ActionResult) error {
+	data, err := codec.Marshal(e.Output.Contents)
+	if err != nil {
+		return err
+	}
+	if len(data) <= h.threshold {
+		// reuse the bytes rather than marshal the output twice
+		e.Output.RawMessage = data
+		return nil
+	}
+	ref, err := artifact.Put(h.store, data, "application/json", h.ttl)
+	if err != nil {
+		return err
+	}
+	e.Artifact = ref
+	e.Output = message.OutputMessage{}
 	return nil
 }
@@ -1,10 +1,22 @@
 package plugin
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/komand/plugin-sdk-go/plugin/deadletter"
+	"github.com/komand/plugin-sdk-go/plugin/message"
 	"github.com/komand/plugin-sdk-go/plugin/parameter"
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+	"github.com/komand/plugin-sdk-go/plugin/transform"
 )
 
 var actionStartMessage = `
@@ -152,3 +164,303 @@ func TestGenerateSampleActionStartMessage(t *testing.T) {
 	}
 
 }
+
+// FlakyAction fails until it's fixed, like a plugin bug
+type FlakyAction struct {
+	Action
+	fixed bool
+}
+
+func (f *FlakyAction) Name() string {
+	return "flaky_action"
+}
+
+func (f *FlakyAction) Description() string {
+	return "flaky_action description"
+}
+
+func (f *FlakyAction) Act() error {
+	if !f.fixed {
+		return errors.New("flaky")
+	}
+	return nil
+}
+
+func TestFailedActionIsDeadLettered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { deadLetters = nil }()
+
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(strings.Replace(actionStartMessage, "hello_action", "flaky_action", 1)))
+	defaultActionDispatcher = &mockDispatcher{}
+	p := New()
+	flaky := &FlakyAction{}
+	p.AddAction(flaky)
+	p.SetDeadLetter(deadletter.DirStore{Dir: dir}, 0)
+
+	if err = p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := p.DeadLetters().List()
+	if len(entries) != 1 || entries[0].Name != "flaky_action" || entries[0].Error != "flaky" {
+		t.Fatalf("Expected the failed start message to be dead lettered but got %v", entries)
+	}
+
+	if err = p.Redrive(entries[0].ID); err == nil {
+		t.Fatal("Expected re-driving to fail while the action is broken")
+	}
+	flaky.fixed = true
+	if err = p.Redrive(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = p.DeadLetters().List(); len(entries) != 0 {
+		t.Fatalf("Expected the dead letter to be removed but got %v", entries)
+	}
+}
+
+// ConnectedFlakyAction is a FlakyAction that needs its connection once it's fixed
+type ConnectedFlakyAction struct {
+	FlakyAction
+	connection HelloConnection
+}
+
+func (c *ConnectedFlakyAction) Connection() Connection {
+	return &c.connection
+}
+
+func (c *ConnectedFlakyAction) Act() error {
+	if err := c.FlakyAction.Act(); err != nil {
+		return err
+	}
+	if c.connection.Thing != "one" {
+		return fmt.Errorf("Expected the connection to be re-driven, got %q", c.connection.Thing)
+	}
+	return nil
+}
+
+// deadLetterConnectedFlakyAction runs a ConnectedFlakyAction that fails, returning it and the dead letter
+func deadLetterConnectedFlakyAction(t *testing.T, dir string) (*HelloPlugin, *ConnectedFlakyAction, *deadletter.Entry) {
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(strings.Replace(actionStartMessage, "hello_action", "flaky_action", 1)))
+	defaultActionDispatcher = &mockDispatcher{}
+	p := New()
+	flaky := &ConnectedFlakyAction{}
+	p.AddAction(flaky)
+	p.SetDeadLetter(deadletter.DirStore{Dir: dir}, 0)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := p.DeadLetters().List()
+	if len(entries) != 1 {
+		t.Fatalf("Expected the failed start message to be dead lettered but got %v", entries)
+	}
+	return p, flaky, entries[0]
+}
+
+func TestDeadLetteredConnectionIsSealed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { deadLetters = nil }()
+	keys := &sealed.StaticKeys{ID: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	defer func() { encryptionKeys = nil }()
+	Plugin{}.SetEncryption(keys)
+
+	p, flaky, e := deadLetterConnectedFlakyAction(t, dir)
+	if bytes.Contains(e.Message, []byte(`"thing"`)) || !bytes.Contains(e.Message, []byte(`"$sealed"`)) {
+		t.Fatalf("Expected the connection to be sealed, got %s", e.Message)
+	}
+	if !bytes.Contains(e.Message, []byte(`"person":"Bob"`)) {
+		t.Fatalf("Expected the input to be kept as it was, got %s", e.Message)
+	}
+
+	encryptionKeys = nil
+	flaky.fixed = true
+	flaky.connection = HelloConnection{}
+	if err = p.Redrive(e.ID); err == nil {
+		t.Fatal("Expected re-driving to fail without the key the connection was sealed with")
+	}
+	encryptionKeys = keys
+	if err = p.Redrive(e.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadLetteredConnectionIsLeftOutWithoutAKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { deadLetters = nil }()
+
+	p, flaky, e := deadLetterConnectedFlakyAction(t, dir)
+	if bytes.Contains(e.Message, []byte(`"thing"`)) || bytes.Contains(e.Message, []byte(`"connection"`)) {
+		t.Fatalf("Expected the connection to be left out, got %s", e.Message)
+	}
+	flaky.fixed = true
+	flaky.connection = HelloConnection{} // as it would be in the process re-driving it
+	if err = p.Redrive(e.ID); err == nil {
+		t.Fatal("Expected re-driving to fail without the connection")
+	}
+}
+
+func TestReplayActionStartFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(actionStartMessage)
+	f.Close()
+
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	p := New()
+	if err = p.Replay(f.Name(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dispatcher.result, "good day to you") {
+		t.Fatalf("Expected the action to run again but got %s", dispatcher.result)
+	}
+}
+
+type SchemaAction struct {
+	HelloAction
+}
+
+func (s *SchemaAction) InputSchema() json.RawMessage {
+	return json.RawMessage(`{"type": "object", "properties": {"person": {"type": "string", "minLength": 5}}}`)
+}
+
+func TestActionInputIsCheckedAgainstItsSchema(t *testing.T) {
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(actionStartMessage))
+	defaultActionDispatcher = &mockDispatcher{}
+	p := New()
+	if err := p.AddAction(&SchemaAction{}); err != nil {
+		t.Fatal(err)
+	}
+	err := p.Run()
+	if err == nil || !strings.Contains(err.Error(), "person: shorter than 5 characters") {
+		t.Fatalf("Expected the input to fail its schema, got %v", err)
+	}
+}
+
+// TruncatingAction returns part of its results, with a warning
+type TruncatingAction struct {
+	HelloAction
+}
+
+func (t *TruncatingAction) Act() error {
+	t.Warn(message.Truncated("greeting", 1, 3))
+	return t.HelloAction.Act()
+}
+
+func TestActionWarningsAreSentWithTheResult(t *testing.T) {
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(actionStartMessage))
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	p := New()
+	p.AddAction(&TruncatingAction{})
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `"warnings":[{"code":"truncated","message":"Returned 1 of 3 results","field":"greeting"}]`
+	if !strings.Contains(dispatcher.result, expected) {
+		t.Fatalf("Expected the result to carry the warning, got %s", dispatcher.result)
+	}
+}
+
+type LegacyInput struct {
+	Person string `json:"person" deprecated:"people"`
+	People []string
+}
+
+func (l *LegacyInput) Validate() []error {
+	return nil
+}
+
+// LegacyAction takes a deprecated input
+type LegacyAction struct {
+	HelloAction
+	input LegacyInput
+}
+
+func (l *LegacyAction) Input() Input {
+	return &l.input
+}
+
+func TestDeprecatedInputIsWarnedAbout(t *testing.T) {
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(actionStartMessage))
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	p := New()
+	p.AddAction(&LegacyAction{})
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `"warnings":[{"code":"deprecated","message":"person is deprecated, use people instead","field":"person"}]`
+	if !strings.Contains(dispatcher.result, expected) {
+		t.Fatalf("Expected the result to warn the input is deprecated, got %s", dispatcher.result)
+	}
+	if n := RuntimeMetrics("").Deprecations["hello_action.person"]; n == 0 {
+		t.Error("Expected the deprecated input's use to be counted")
+	}
+}
+
+// RenamedAction took its person as name in earlier versions
+type RenamedAction struct {
+	HelloAction
+}
+
+func (r *RenamedAction) InputMigrations() []transform.Migration {
+	return []transform.Migration{{From: "name", To: "person"}}
+}
+
+func (r *RenamedAction) InputSchema() json.RawMessage {
+	return json.RawMessage(`{"type": "object", "required": ["person"], "additionalProperties": false, "properties": {"person": {"type": "string"}}}`)
+}
+
+func TestActionInputIsMigrated(t *testing.T) {
+	start := strings.Replace(actionStartMessage, `"person"`, `"name"`, 1)
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(start))
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	p := New()
+	p.AddAction(&RenamedAction{})
+	if err := p.Run(); err != nil {
+		t.Fatalf("Expected the old input to be migrated before it's validated, got %s", err)
+	}
+	expected := `"warnings":[{"code":"deprecated","message":"name is deprecated, use person instead","field":"name"}]`
+	if !strings.Contains(dispatcher.result, expected) {
+		t.Fatalf("Expected the result to warn the old name is deprecated, got %s", dispatcher.result)
+	}
+}
+
+// unavailableStore is an artifact store that can't be reached
+type unavailableStore struct{}
+
+func (unavailableStore) Put(string, []byte, time.Time) (string, error) {
+	return "", errors.New("connection refused")
+}
+func (unavailableStore) Open(string) (io.ReadCloser, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestOutputIsInlineWhenItCantBeOffloaded(t *testing.T) {
+	defer func() { artifactHandoff = nil }()
+	artifactHandoff = &handoff{store: unavailableStore{}, ttl: time.Hour}
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(actionStartMessage))
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	if err := New().Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dispatcher.result, `"status":"ok"`) || !strings.Contains(dispatcher.result, `"output":{"greeting":"good day to you"}`) {
+		t.Fatalf("Expected the output to be returned inline, got %s", dispatcher.result)
+	}
+}
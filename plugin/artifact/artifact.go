@@ -0,0 +1,203 @@
+// Package artifact hands large outputs between plugins by reference. Instead of carrying a big
+// payload inline through the orchestrator, the producer stores it on a shared volume or in an
+// object store and emits a message.ArtifactRef (URI, checksum and expiry). The consumer fetches
+// the content with the same Store and verifies it before use.
+package artifact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+const filePerms = 0600
+
+// ErrExpired is returned when fetching an artifact whose reference has expired
+var ErrExpired = errors.New("Artifact reference has expired")
+
+// ChecksumMismatch is returned when the fetched content does not match the reference checksum
+type ChecksumMismatch string
+
+// Error implements the error interface
+func (e ChecksumMismatch) Error() string {
+	return string(e)
+}
+
+// Store is where artifacts are kept. Put stores data under key and returns a URI the consumer
+// can pass back to Open, which is responsible for resolving it.
+type Store interface {
+	Put(key string, data []byte, expires time.Time) (string, error)
+	Open(uri string) (io.ReadCloser, error)
+}
+
+// Put stores data in the store and returns a reference to it that expires after ttl.
+// The content is stored under its own checksum, so storing the same data twice is harmless.
+func Put(store Store, data []byte, contentType string, ttl time.Duration) (*message.ArtifactRef, error) {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	expires := time.Now().Add(ttl).UTC()
+
+	uri, err := store.Put("artifacts/"+digest, data, expires)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to store artifact: %s", err)
+	}
+	return &message.ArtifactRef{
+		URI:         uri,
+		SHA256:      digest,
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		Expires:     expires,
+	}, nil
+}
+
+// PutJSON marshals v and stores it, see Put
+func PutJSON(store Store, v interface{}, ttl time.Duration) (*message.ArtifactRef, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Put(store, data, "application/json", ttl)
+}
+
+// Get fetches the content behind ref, verifying the expiry and checksum
+func Get(store Store, ref *message.ArtifactRef) ([]byte, error) {
+	if ref == nil {
+		return nil, errors.New("No artifact reference was provided")
+	}
+	if !ref.Expires.IsZero() && time.Now().After(ref.Expires) {
+		return nil, ErrExpired
+	}
+
+	r, err := store.Open(ref.URI)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if digest := hex.EncodeToString(sum[:]); digest != ref.SHA256 {
+		return nil, ChecksumMismatch(fmt.Sprintf("Artifact %s has checksum %s but expected %s", ref.URI, digest, ref.SHA256))
+	}
+	return data, nil
+}
+
+// GetJSON fetches the content behind ref and unmarshals it into v, see Get
+func GetJSON(store Store, ref *message.ArtifactRef, v interface{}) error {
+	data, err := Get(store, ref)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// VolumeStore keeps artifacts on a volume shared between the producing and consuming containers
+type VolumeStore struct {
+	Dir string // Dir is made absolute, a consumer resolves URIs from its own working directory
+}
+
+// Put writes data under Dir and returns a file:// URI. Expiry is left to whoever manages the volume.
+func (v *VolumeStore) Put(key string, data []byte, expires time.Time) (string, error) {
+	dir, err := filepath.Abs(v.Dir)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, filepath.FromSlash(key))
+	f, err := utils.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerms)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: name}).String(), nil
+}
+
+// Open opens a file:// URI, refusing anything outside Dir
+func (v *VolumeStore) Open(uri string) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("Unsupported artifact URI for a volume: %s", uri)
+	}
+	dir, err := filepath.Abs(v.Dir)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Clean(u.Path)
+	if !strings.HasPrefix(name, dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("Artifact %s is outside of %s", uri, v.Dir)
+	}
+	return os.Open(name)
+}
+
+// ObjectStore keeps artifacts in an S3-compatible bucket. When Presign is set, Put returns an
+// https URL valid until the artifact expires, so consumers don't need credentials for the bucket.
+// Otherwise it returns an s3://bucket/key URI and consumers need their own client.
+type ObjectStore struct {
+	Client  *objectstore.Client
+	Presign bool
+}
+
+// Put uploads data and returns its URI. A presigned URL must expire within 7 days, which is checked
+// before uploading so a ttl that's too long doesn't leave an object behind that nothing refers to.
+func (o *ObjectStore) Put(key string, data []byte, expires time.Time) (string, error) {
+	uri := "s3://" + o.Client.Bucket() + "/" + key
+	if o.Presign {
+		var err error
+		if uri, err = o.Client.Presign("GET", key, expires.Sub(time.Now())); err != nil {
+			return "", err
+		}
+	}
+	if err := o.Client.Put(key, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// Open fetches either an s3:// URI or a presigned URL of the configured bucket. Neither is fetched as
+// given, URIs come with messages: the key is fetched with the client, and URLs elsewhere are refused.
+func (o *ObjectStore) Open(uri string) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host != o.Client.Bucket() {
+			return nil, fmt.Errorf("Artifact %s is not in bucket %s", uri, o.Client.Bucket())
+		}
+		return o.Client.Get(strings.TrimLeft(u.Path, "/"))
+	case "http", "https":
+		key, ok := o.Client.Key(u)
+		if !ok {
+			return nil, fmt.Errorf("Artifact %s is not in bucket %s", uri, o.Client.Bucket())
+		}
+		return o.Client.Get(key)
+	default:
+		return nil, fmt.Errorf("Unsupported artifact URI for an object store: %s", uri)
+	}
+}
@@ -0,0 +1,103 @@
+package artifact
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+func TestVolumeRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &VolumeStore{Dir: dir}
+
+	ref, err := PutJSON(store, map[string]string{"report": "big"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]string
+	if err := GetJSON(store, ref, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["report"] != "big" {
+		t.Fatalf("Unexpected artifact content: %v", out)
+	}
+
+	ref.SHA256 = "nope"
+	if _, err := Get(store, ref); err == nil {
+		t.Fatal("Expected a checksum mismatch")
+	} else if _, ok := err.(ChecksumMismatch); !ok {
+		t.Fatalf("Expected ChecksumMismatch but got %T", err)
+	}
+
+	ref.Expires = time.Now().Add(-time.Minute)
+	if _, err := Get(store, ref); err != ErrExpired {
+		t.Fatalf("Expected ErrExpired but got %v", err)
+	}
+}
+
+func TestVolumeStoreWithARelativeDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Put(&VolumeStore{Dir: rel}, []byte("big"), "text/plain", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(ref.URI); !filepath.IsAbs(u.Path) {
+		t.Fatalf("Expected an absolute file:// URI, got %s", ref.URI)
+	}
+	if data, err := Get(&VolumeStore{Dir: dir}, ref); err != nil || string(data) != "big" {
+		t.Fatalf("Expected the artifact back through the absolute Dir, got %q, %v", data, err)
+	}
+}
+
+func TestObjectStoreChecksThePresignTTLFirst(t *testing.T) {
+	var puts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			atomic.AddInt32(&puts, 1)
+		}
+	}))
+	defer srv.Close()
+	client, err := objectstore.New(objectstore.Options{Endpoint: srv.URL, Bucket: "artifacts", AccessKey: "AKID", SecretKey: "secret", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &ObjectStore{Client: client, Presign: true}
+
+	if _, err = Put(store, []byte("big"), "text/plain", 8*24*time.Hour); err == nil {
+		t.Fatal("Expected a ttl over 7 days to be refused")
+	}
+	if n := atomic.LoadInt32(&puts); n != 0 {
+		t.Fatalf("Expected nothing to be uploaded, got %d uploads", n)
+	}
+	ref, err := Put(store, []byte("big"), "text/plain", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&puts); n != 1 || !strings.HasPrefix(ref.URI, srv.URL+"/artifacts/artifacts/") {
+		t.Fatalf("Expected the artifact to be uploaded and presigned, got %d uploads and %s", n, ref.URI)
+	}
+}
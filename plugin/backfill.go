@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils/window"
+)
+
+// defaultBackfillStep is the window a backfill fetches at a time, when the request doesn't say
+const defaultBackfillStep = 24 * time.Hour
+
+// Backfillable is implemented by a trigger that can fetch the events of a past window, usually by calling
+// the same code its polling loop does. When a trigger is started with a backfill request, the runtime calls
+// Backfill for each window of the requested range, in order, before running the trigger as usual. Events
+// sent while backfilling are dispatched with backfilled set, so workflows can treat them differently.
+type Backfillable interface {
+	Backfill(ctx context.Context, w window.Window) error
+}
+
+// BackfillRequest asks for a trigger to backfill a range of time before it starts polling. It's read from
+// the backfill field of the trigger start message's meta:
+//
+//	"meta": {"backfill": {"start": "2017-01-01T00:00:00Z", "step": "6h"}}
+type BackfillRequest struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`  // End defaults to when the trigger starts
+	Step  string    `json:"step,omitempty"` // Step is the window fetched at a time, defaulting to 24h
+}
+
+// backfillCheckpoint returns where a backfill's progress is kept
+var backfillCheckpoint = func(name string) window.Checkpoint {
+	return window.CacheCheckpoint(name)
+}
+
+// backfilledOutput wraps events sent while backfilling, until the collector dispatches them
+type backfilledOutput struct {
+	Output
+}
+
+// backfillMarker is implemented by triggers that embed Trigger, to mark the events they send
+type backfillMarker interface {
+	setBackfilling(bool)
+}
+
+// backfillRequest returns the backfill requested in the start message's meta, if any
+func backfillRequest(meta *json.RawMessage) (*BackfillRequest, error) {
+	if meta == nil {
+		return nil, nil
+	}
+	var m struct {
+		Backfill *BackfillRequest `json:"backfill"`
+	}
+	// Meta belongs to the orchestrator and needn't be an object, only an object with a backfill is a request
+	if json.Unmarshal(*meta, &m) != nil || m.Backfill == nil {
+		return nil, nil
+	}
+	if m.Backfill.Start.IsZero() {
+		return nil, errors.New("A backfill needs a start")
+	}
+	return m.Backfill, nil
+}
+
+// runBackfill runs a requested backfill to completion. Its progress is checkpointed in the cache, so a
+// trigger restarted with the same request carries on where it left off, or goes straight to polling.
+func runBackfill(start *message.TriggerStart, trigger Triggerable) error {
+	req, err := backfillRequest(start.Meta)
+	if err != nil || req == nil {
+		return err
+	}
+	b, ok := trigger.(Backfillable)
+	if !ok {
+		log.Warnf("Trigger %s can't backfill, ignoring the backfill request", start.Trigger)
+		return nil
+	}
+
+	step := defaultBackfillStep
+	if req.Step != "" {
+		if step, err = time.ParseDuration(req.Step); err != nil {
+			return fmt.Errorf("Invalid backfill step: %s", err)
+		}
+	}
+	end := req.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	checkpoint := backfillCheckpoint(fmt.Sprintf("backfill/%s-%d", start.Trigger, req.Start.Unix()))
+	it, err := window.NewIterator(req.Start, end, step, 0, checkpoint)
+	if err != nil {
+		return err
+	}
+	if p, ok := trigger.(interface {
+		Checkpoint(position interface{})
+	}); ok {
+		it.Report = p.Checkpoint
+	}
+
+	if m, ok := trigger.(backfillMarker); ok {
+		m.setBackfilling(true)
+		defer m.setBackfilling(false)
+	}
+	log.Infof("Backfilling %s from %s", start.Trigger, window.Window{Start: it.Position(), End: end})
+	for w, ok := it.Next(); ok; w, ok = it.Next() {
+		if err = b.Backfill(context.Background(), w); err != nil {
+			return fmt.Errorf("Backfill of %s failed: %s", w, err)
+		}
+		if err = it.Done(w); err != nil {
+			return err
+		}
+	}
+	log.Infof("Backfill of %s done, polling from now on", start.Trigger)
+	return nil
+}
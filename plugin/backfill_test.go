@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils/window"
+)
+
+type memCheckpoint struct {
+	position time.Time
+	saved    bool
+}
+
+func (m *memCheckpoint) Load() (time.Time, bool, error) { return m.position, m.saved, nil }
+func (m *memCheckpoint) Save(t time.Time) error {
+	m.position, m.saved = t, true
+	return nil
+}
+
+type BackfillTrigger struct {
+	Trigger
+}
+
+func (t *BackfillTrigger) Name() string        { return "backfill_trigger" }
+func (t *BackfillTrigger) Description() string { return "fetches days" }
+
+func (t *BackfillTrigger) Backfill(ctx context.Context, w window.Window) error {
+	return t.Send(map[string]string{"day": w.Start.Format("2006-01-02")})
+}
+
+func (t *BackfillTrigger) RunTrigger() error {
+	return t.Send(map[string]string{"day": "live"})
+}
+
+func TestTriggerBackfillsBeforePolling(t *testing.T) {
+	checkpoint := &memCheckpoint{}
+	defer func(f func(string) window.Checkpoint) { backfillCheckpoint = f }(backfillCheckpoint)
+	backfillCheckpoint = func(string) window.Checkpoint { return checkpoint }
+
+	meta := json.RawMessage(`{"channel": "abc", "backfill": {"start": "2017-01-01T00:00:00Z", "end": "2017-01-03T00:00:00Z"}}`)
+	dispatcher := &capturingDispatcher{}
+	trigger := &BackfillTrigger{}
+	task := &triggerTask{
+		message:    &message.TriggerStart{Meta: &meta, Trigger: trigger.Name()},
+		trigger:    trigger,
+		dispatcher: dispatcher,
+	}
+	if err := task.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dispatcher.messages) != 3 {
+		t.Fatalf("Expected two backfilled days and a live event, got %v", dispatcher.messages)
+	}
+	for i, day := range []string{"2017-01-01", "2017-01-02"} {
+		if m := dispatcher.messages[i]; !strings.Contains(m, day) || !strings.Contains(m, `"backfilled":true`) {
+			t.Errorf("Expected a backfilled event for %s, got %s", day, m)
+		}
+	}
+	if m := dispatcher.messages[2]; !strings.Contains(m, "live") || strings.Contains(m, "backfilled") {
+		t.Errorf("Expected a live event, got %s", m)
+	}
+	if !checkpoint.position.Equal(time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the backfill to be checkpointed as done, got %s", checkpoint.position)
+	}
+}
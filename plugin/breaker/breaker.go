@@ -0,0 +1,187 @@
+// Package breaker stops calling a vendor that keeps failing, for a while, so actions fail fast or fall
+// back to something else instead of each waiting out the outage. A Breaker opens after Failures failures
+// in a row, and stays open for Cooldown. After that calls are let through again: the first success closes
+// it, and a failure opens it for another Cooldown.
+//
+//	var vendor = &breaker.Breaker{Name: "vendor", Persist: true}
+//	...
+//	err := vendor.Do(func() error {
+//		return client.Lookup(ip)
+//	})
+//
+// Plugins that start a process per action set Persist, so the breaker's state outlives each run.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Defaults for a Breaker's options left at 0
+const (
+	DefaultFailures = 5
+	DefaultCooldown = 30 * time.Second
+)
+
+// States of a Breaker
+const (
+	Closed   = "closed"    // Closed breakers let calls through
+	Open     = "open"      // Open breakers fail calls straight away
+	HalfOpen = "half-open" // HalfOpen breakers are past their cooldown, and let calls through to see if they succeed
+)
+
+// OpenError is returned by a Breaker that's open
+type OpenError struct {
+	Name  string
+	Until time.Time
+}
+
+// Error implements the error interface
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("Circuit breaker %s is open until %s, after repeated failures", e.Name, e.Until.Format(time.RFC3339))
+}
+
+// Breaker is a circuit breaker, safe for concurrent use
+type Breaker struct {
+	Name     string
+	Failures int           // Failures in a row open the breaker, DefaultFailures if 0
+	Cooldown time.Duration // Cooldown is how long the breaker stays open, DefaultCooldown if 0
+	// Persist keeps the breaker's state in the plugin cache, under breaker/<name>, so every run of the
+	// plugin shares it
+	Persist bool
+
+	mu    sync.Mutex
+	state state
+	now   func() time.Time
+}
+
+// state is a breaker's state, as persisted
+type state struct {
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+// Allow returns an *OpenError if the breaker is open, and nil if a call may go through
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.load()
+	if b.stateOf(s) != Open {
+		return nil
+	}
+	return &OpenError{Name: b.Name, Until: s.OpenedAt.Add(b.cooldown())}
+}
+
+// Record records the result of a call, err being nil if it succeeded
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.load()
+	if err == nil {
+		if s.Failures == 0 {
+			return
+		}
+		if !s.OpenedAt.IsZero() {
+			log.Infof("Circuit breaker %s closed, a call succeeded", b.Name)
+		}
+		b.save(state{})
+		return
+	}
+	s.Failures++
+	if s.Failures >= b.failures() {
+		if s.OpenedAt.IsZero() {
+			log.Warnf("Circuit breaker %s opened after %d failures in a row, the last: %s", b.Name, s.Failures, err)
+		}
+		s.OpenedAt = b.clock()
+	}
+	b.save(s)
+}
+
+// Do calls fn if the breaker allows it, and records how it went
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// State returns whether the breaker is Closed, Open or HalfOpen
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateOf(b.load())
+}
+
+// Reset closes the breaker
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.save(state{})
+}
+
+func (b *Breaker) stateOf(s state) string {
+	switch {
+	case s.OpenedAt.IsZero():
+		return Closed
+	case b.clock().Before(s.OpenedAt.Add(b.cooldown())):
+		return Open
+	default:
+		return HalfOpen
+	}
+}
+
+// load returns the breaker's state, from the cache if it's persisted. b.mu must be held.
+func (b *Breaker) load() state {
+	if !b.Persist {
+		return b.state
+	}
+	var s state
+	if err := cache.GetJSON(b.key(), &s); err != nil && err != cache.ErrNotFound {
+		// a breaker that can't read its state lets calls through rather than blocking them
+		log.Warnf("Unable to read the state of circuit breaker %s: %s", b.Name, err)
+	}
+	return s
+}
+
+// save replaces the breaker's state. b.mu must be held.
+func (b *Breaker) save(s state) {
+	b.state = s
+	if !b.Persist {
+		return
+	}
+	if err := cache.PutJSON(b.key(), s); err != nil {
+		log.Warnf("Unable to save the state of circuit breaker %s: %s", b.Name, err)
+	}
+}
+
+func (b *Breaker) key() string {
+	return "breaker/" + b.Name
+}
+
+func (b *Breaker) failures() int {
+	if b.Failures <= 0 {
+		return DefaultFailures
+	}
+	return b.Failures
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
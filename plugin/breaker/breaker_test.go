@@ -0,0 +1,67 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &Breaker{Name: "vendor", Failures: 3, Cooldown: time.Minute, now: func() time.Time { return now }}
+	failed := errors.New("unavailable")
+
+	for i := 0; i < 2; i++ {
+		b.Do(func() error { return failed })
+	}
+	if b.State() != Closed {
+		t.Errorf("Expected the breaker closed before the threshold, got %s", b.State())
+	}
+	b.Do(func() error { return failed })
+	if b.State() != Open {
+		t.Errorf("Expected the breaker open after 3 failures, got %s", b.State())
+	}
+	called := false
+	err := b.Do(func() error {
+		called = true
+		return nil
+	})
+	if _, ok := err.(*OpenError); !ok || called {
+		t.Errorf("Expected an open breaker to fail without calling, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if b.State() != HalfOpen {
+		t.Errorf("Expected the breaker half open after the cooldown, got %s", b.State())
+	}
+	b.Do(func() error { return failed })
+	if b.State() != Open {
+		t.Errorf("Expected a failure while half open to open the breaker again, got %s", b.State())
+	}
+	now = now.Add(time.Minute)
+	if err = b.Do(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != Closed {
+		t.Errorf("Expected a success to close the breaker, got %s", b.State())
+	}
+}
+
+func TestPersist(t *testing.T) {
+	cache.SetBackend(&cache.MemoryBackend{})
+	defer cache.SetBackend(nil)
+
+	first := &Breaker{Name: "vendor", Failures: 1, Persist: true}
+	first.Record(errors.New("unavailable"))
+	// a new process starts with a new breaker
+	second := &Breaker{Name: "vendor", Failures: 1, Persist: true}
+	if second.State() != Open {
+		t.Errorf("Expected the persisted state to be shared, got %s", second.State())
+	}
+	second.Reset()
+	if first.State() != Closed {
+		t.Errorf("Expected resetting to close the breaker for everyone, got %s", first.State())
+	}
+}
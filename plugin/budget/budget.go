@@ -0,0 +1,170 @@
+// Package budget keeps a plugin within the vendor API quota a customer pays for. A Tracker counts the
+// requests made for a connection in the current hour and day, in the cache so every process running for
+// the connection shares the count, and refuses requests over the limits with a RateLimitedError saying
+// when the budget resets, rather than burning through the quota.
+//
+//	tracker := budget.New(connectionID, budget.Limits{PerHour: 500, PerDay: 5000})
+//	client := httpclient.New(httpclient.Options{Connection: connectionID})
+//	client.Transport = tracker.Transport(client.Transport)
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+// Limits are the requests allowed for a connection, a limit of 0 is no limit
+type Limits struct {
+	PerHour int `json:"per_hour"`
+	PerDay  int `json:"per_day"`
+}
+
+// RateLimitedError is returned for a request over a connection's budget
+type RateLimitedError struct {
+	Connection string
+	Window     string // Window is the budget that ran out, hourly or daily
+	Limit      int
+	Reset      time.Time // Reset is when the budget is available again
+}
+
+// Error implements error
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("The %s budget of %d requests for %s is spent, it resets at %s", e.Window, e.Limit, e.Connection, e.Reset.Format(time.RFC3339))
+}
+
+// AsRateLimited returns the RateLimitedError err is, or wraps as the error of an http.Client request
+func AsRateLimited(err error) (*RateLimitedError, bool) {
+	if u, ok := err.(*url.Error); ok {
+		err = u.Err
+	}
+	e, ok := err.(*RateLimitedError)
+	return e, ok
+}
+
+// spent is what's kept in the cache for a connection
+type spent struct {
+	Hour      time.Time `json:"hour"` // Hour is the start of the hour HourCount is for
+	HourCount int       `json:"hour_count"`
+	Day       time.Time `json:"day"`
+	DayCount  int       `json:"day_count"`
+}
+
+// Tracker tracks the budget of one connection. It's safe for concurrent use, and by several processes.
+type Tracker struct {
+	Connection string
+	Limits     Limits
+
+	now func() time.Time
+}
+
+// New returns the tracker of a connection's budget
+func New(connection string, limits Limits) *Tracker {
+	return &Tracker{Connection: connection, Limits: limits, now: time.Now}
+}
+
+// Spend counts n requests against the budget, or returns a RateLimitedError without counting them if
+// they're more than is left
+func (t *Tracker) Spend(ctx context.Context, n int) error {
+	return t.update(ctx, func(s *spent) error {
+		if t.Limits.PerHour > 0 && s.HourCount+n > t.Limits.PerHour {
+			return &RateLimitedError{Connection: t.Connection, Window: "hourly", Limit: t.Limits.PerHour, Reset: s.Hour.Add(time.Hour)}
+		}
+		if t.Limits.PerDay > 0 && s.DayCount+n > t.Limits.PerDay {
+			return &RateLimitedError{Connection: t.Connection, Window: "daily", Limit: t.Limits.PerDay, Reset: s.Day.AddDate(0, 0, 1)}
+		}
+		s.HourCount += n
+		s.DayCount += n
+		return nil
+	})
+}
+
+// Remaining returns the requests left in the hour and the day, -1 where there's no limit
+func (t *Tracker) Remaining(ctx context.Context) (hour int, day int, err error) {
+	err = t.update(ctx, func(s *spent) error {
+		hour, day = remaining(t.Limits.PerHour, s.HourCount), remaining(t.Limits.PerDay, s.DayCount)
+		return nil
+	})
+	return hour, day, err
+}
+
+func remaining(limit, count int) int {
+	if limit <= 0 {
+		return -1
+	}
+	if count > limit {
+		return 0
+	}
+	return limit - count
+}
+
+// Transport returns middleware spending a request of the budget for each request made through next. A
+// request over the budget fails with a RateLimitedError, without being sent.
+func (t *Tracker) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		if err := t.Spend(req.Context(), 1); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// update applies fn to what's spent, under the connection's cache lock, and saves it unless fn fails
+func (t *Tracker) update(ctx context.Context, fn func(*spent) error) error {
+	name := "budget/" + strings.Replace(t.Connection, "/", "_", -1)
+	lease, err := cache.AcquireLease(ctx, name, 0)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	f, err := cache.OpenCacheFile(name + ".json")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var s spent
+	if b, err := ioutil.ReadAll(f); err == nil && len(b) > 0 {
+		// an unreadable count starts over, rather than blocking the connection for good
+		json.Unmarshal(b, &s)
+	}
+
+	// the budgets are for calendar hours and days in UTC, like most vendors' quotas
+	now := t.now().UTC()
+	hour := now.Truncate(time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !s.Hour.Equal(hour) {
+		s.Hour, s.HourCount = hour, 0
+	}
+	if !s.Day.Equal(day) {
+		s.Day, s.DayCount = day, 0
+	}
+	if err = fn(&s); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(b, 0)
+	return err
+}
@@ -0,0 +1,81 @@
+package budget
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// TestMain keeps the budgets, and their lock files, in a temporary cache
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "budget")
+	if err != nil {
+		panic(err)
+	}
+	cache.SetRoot(dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func testTracker(limits Limits, now *time.Time) *Tracker {
+	connection := "test-" + utils.RandomID()
+	tracker := New(connection, limits)
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+func TestBudgetResetsEachHour(t *testing.T) {
+	now := time.Date(2017, 3, 1, 10, 30, 0, 0, time.UTC)
+	tracker := testTracker(Limits{PerHour: 2, PerDay: 3}, &now)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := tracker.Spend(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tracker.Spend(ctx, 1)
+	limited, ok := err.(*RateLimitedError)
+	if !ok || limited.Window != "hourly" || !limited.Reset.Equal(time.Date(2017, 3, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the hourly budget to run out until 11:00, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if err = tracker.Spend(ctx, 1); err != nil {
+		t.Fatalf("Expected the hourly budget to reset, got %s", err)
+	}
+	err = tracker.Spend(ctx, 1)
+	if limited, ok = err.(*RateLimitedError); !ok || limited.Window != "daily" || !limited.Reset.Equal(time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the daily budget to run out until midnight, got %v", err)
+	}
+	if hour, day, err := tracker.Remaining(ctx); err != nil || hour != 1 || day != 0 {
+		t.Errorf("Expected 1 request left in the hour and none in the day, got %d %d %v", hour, day, err)
+	}
+}
+
+func TestBudgetTransport(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { requests++ }))
+	defer srv.Close()
+	now := time.Now()
+	tracker := testTracker(Limits{PerHour: 1}, &now)
+
+	client := &http.Client{Transport: tracker.Transport(nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, err = client.Get(srv.URL)
+	if _, ok := AsRateLimited(err); !ok || requests != 1 {
+		t.Errorf("Expected the request over budget not to be sent, got %d requests and %v", requests, err)
+	}
+}
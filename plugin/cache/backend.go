@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Backend.Get when there's no entry with the name
+var ErrNotFound = errors.New("cache: entry not found")
+
+// Backend stores cache entries by name. FileBackend keeps them in /var/cache, which only lasts as long
+// as the volume; RedisBackend, S3Backend and MemoryBackend suit plugins whose filesystem is ephemeral, or shared
+// between replicas that shouldn't see each other's files.
+type Backend interface {
+	// Get returns the entry, or ErrNotFound
+	Get(name string) ([]byte, error)
+	// Put replaces the entry with data
+	Put(name string, data []byte) error
+	// Delete removes the entry, it's not an error if there isn't one
+	Delete(name string) error
+	Exists(name string) (bool, error)
+	// Lock waits until it holds the named lock or ctx is done
+	Lock(ctx context.Context, name string) error
+	// Unlock gives up a lock taken by Lock, or returns ErrLockLost if it isn't held
+	Unlock(name string) error
+}
+
+var (
+	backendMu sync.RWMutex
+	backend   Backend = FileBackend{}
+)
+
+// SetBackend makes Get, Put, Delete and Exists use b, nil restores FileBackend
+func SetBackend(b Backend) {
+	if b == nil {
+		b = FileBackend{}
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
+
+// CurrentBackend returns the backend set with SetBackend
+func CurrentBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
+
+// Get returns the named entry from the current backend, or ErrNotFound. It's counted as a hit or a miss,
+// see GetStats.
+func Get(name string) ([]byte, error) {
+	data, err := CurrentBackend().Get(name)
+	observeGet(name, err)
+	return data, err
+}
+
+// Put replaces the named entry in the current backend
+func Put(name string, data []byte) error {
+	return CurrentBackend().Put(name, data)
+}
+
+// GetJSON unmarshals the named entry from the current backend into v, or returns ErrNotFound
+func GetJSON(name string, v interface{}) error {
+	data, err := Get(name)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("Invalid JSON in cache entry %s: %s", name, err)
+	}
+	return nil
+}
+
+// PutJSON replaces the named entry in the current backend with v marshaled to JSON. Like Put, the entry is
+// never seen half written.
+func PutJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Put(name, data)
+}
+
+// Delete removes the named entry from the current backend
+func Delete(name string) error {
+	return CurrentBackend().Delete(name)
+}
+
+// Exists checks if the current backend has the named entry
+func Exists(name string) (bool, error) {
+	return CurrentBackend().Exists(name)
+}
+
+// FileBackend is a Backend keeping entries as files in /var/cache/* and locking with the files in
+// /var/cache/lock/*, the same ones OpenCacheFile and LockCacheFile use. Entries written with
+// WriteWithTTL expire as they do for OpenCacheFile.
+type FileBackend struct{}
+
+// Get implements Backend
+func (FileBackend) Get(name string) ([]byte, error) {
+	ok, err := FileBackend{}.Exists(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	b, err := ioutil.ReadFile(cacheDir + stripLeftSlash(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if discarded, err := discardIfCorrupt(name, b); err != nil {
+		return nil, err
+	} else if discarded {
+		return nil, ErrNotFound
+	}
+	used(name)
+	return b, nil
+}
+
+// Put implements Backend, see WriteAtomic
+func (FileBackend) Put(name string, data []byte) error {
+	return WriteAtomic(name, data)
+}
+
+// PutTTL implements TTLBackend, see WriteWithTTL
+func (FileBackend) PutTTL(name string, data []byte, ttl time.Duration) error {
+	return WriteWithTTL(name, data, ttl)
+}
+
+// Delete implements Backend
+func (FileBackend) Delete(name string) error {
+	if err := RemoveCacheFile(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Exists implements Backend
+func (FileBackend) Exists(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+	return CheckCacheFile(name)
+}
+
+// Lock implements Backend
+func (FileBackend) Lock(ctx context.Context, name string) error {
+	_, err := LockCacheFileContext(ctx, name)
+	return err
+}
+
+// Unlock implements Backend
+func (FileBackend) Unlock(name string) error {
+	_, err := UnlockCacheFile(name, nil)
+	return err
+}
+
+// MemoryBackend is a Backend holding entries in memory, for tests and plugins that only need a cache
+// for as long as they run. The zero value is ready to use.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	expires map[string]time.Time
+	locks   map[string]chan struct{}
+}
+
+// Get implements Backend
+func (m *MemoryBackend) Get(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.entry(stripLeftSlash(name))
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Put implements Backend
+func (m *MemoryBackend) Put(name string, data []byte) error {
+	return m.PutTTL(name, data, 0)
+}
+
+// PutTTL implements TTLBackend
+func (m *MemoryBackend) PutTTL(name string, data []byte, ttl time.Duration) error {
+	name = stripLeftSlash(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[string][]byte{}
+	}
+	m.entries[name] = append([]byte(nil), data...)
+	delete(m.expires, name)
+	if ttl > 0 {
+		if m.expires == nil {
+			m.expires = map[string]time.Time{}
+		}
+		m.expires[name] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// Delete implements Backend
+func (m *MemoryBackend) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, stripLeftSlash(name))
+	delete(m.expires, stripLeftSlash(name))
+	return nil
+}
+
+// Exists implements Backend
+func (m *MemoryBackend) Exists(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.entry(stripLeftSlash(name))
+	return ok, nil
+}
+
+// entry returns the named entry, removing it if it expired. m.mu must be held.
+func (m *MemoryBackend) entry(name string) ([]byte, bool) {
+	if expires, ok := m.expires[name]; ok && !time.Now().Before(expires) {
+		delete(m.entries, name)
+		delete(m.expires, name)
+	}
+	data, ok := m.entries[name]
+	return data, ok
+}
+
+// Lock implements Backend
+func (m *MemoryBackend) Lock(ctx context.Context, name string) error {
+	defer observeLockWait(name, time.Now())
+	name = stripLeftSlash(name)
+	for {
+		m.mu.Lock()
+		released, held := m.locks[name]
+		if !held {
+			if m.locks == nil {
+				m.locks = map[string]chan struct{}{}
+			}
+			m.locks[name] = make(chan struct{})
+			m.mu.Unlock()
+			return nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock implements Backend
+func (m *MemoryBackend) Unlock(name string) error {
+	name = stripLeftSlash(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	released, held := m.locks[name]
+	if !held {
+		return ErrLockLost
+	}
+	delete(m.locks, name)
+	close(released)
+	return nil
+}
+
+// heldLeases are the leases a Backend took through a NamedMutex, so Unlock can find them by name
+type heldLeases struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+}
+
+func (h *heldLeases) lock(ctx context.Context, m NamedMutex, name string) error {
+	l, err := m.Lock(ctx, name, 0)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.leases == nil {
+		h.leases = map[string]Lease{}
+	}
+	h.leases[name] = l
+	return nil
+}
+
+func (h *heldLeases) unlock(name string) error {
+	h.mu.Lock()
+	l, ok := h.leases[name]
+	delete(h.leases, name)
+	h.mu.Unlock()
+	if !ok {
+		return ErrLockLost
+	}
+	return l.Release()
+}
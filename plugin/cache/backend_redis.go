@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/redis"
+)
+
+// RedisBackend is a Backend keeping entries in Redis, so replicas that don't share a disk share a cache.
+// Locks are RedisMutex locks, which expire after the mutex's DefaultTTL if their holder dies.
+type RedisBackend struct {
+	Client *redis.Client
+	Prefix string // Prefix is prepended to entry names, defaults to "cache:"
+
+	held heldLeases
+}
+
+// Get implements Backend
+func (r *RedisBackend) Get(name string) ([]byte, error) {
+	b, err := r.Client.Get(r.key(name))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// Put implements Backend
+func (r *RedisBackend) Put(name string, data []byte) error {
+	return r.Client.Set(r.key(name), data, 0)
+}
+
+// PutTTL implements TTLBackend
+func (r *RedisBackend) PutTTL(name string, data []byte, ttl time.Duration) error {
+	return r.Client.Set(r.key(name), data, ttl)
+}
+
+// Delete implements Backend
+func (r *RedisBackend) Delete(name string) error {
+	_, err := r.Client.Del(r.key(name))
+	return err
+}
+
+// Exists implements Backend
+func (r *RedisBackend) Exists(name string) (bool, error) {
+	reply, err := r.Client.Do("EXISTS", r.key(name))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// Lock implements Backend
+func (r *RedisBackend) Lock(ctx context.Context, name string) error {
+	return r.held.lock(ctx, r.mutex(), name)
+}
+
+// Unlock implements Backend
+func (r *RedisBackend) Unlock(name string) error {
+	return r.held.unlock(name)
+}
+
+func (r *RedisBackend) mutex() RedisMutex {
+	return RedisMutex{Client: r.Client, Prefix: r.prefix() + "lock:"}
+}
+
+func (r *RedisBackend) key(name string) string {
+	return r.prefix() + stripLeftSlash(name)
+}
+
+func (r *RedisBackend) prefix() string {
+	if r.Prefix == "" {
+		return "cache:"
+	}
+	return r.Prefix
+}
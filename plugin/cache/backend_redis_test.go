@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/redis"
+)
+
+// redisStub answers the commands RedisBackend and RedisMutex send, keeping keys in memory
+type redisStub struct {
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+	failing bool
+}
+
+func (s *redisStub) serve(l net.Listener) {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(nc net.Conn) {
+			defer nc.Close()
+			r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+			for {
+				args, err := readStubCommand(r)
+				if err != nil {
+					return
+				}
+				w.WriteString(s.reply(args))
+				w.Flush()
+			}
+		}(nc)
+	}
+}
+
+// readStubCommand reads a command sent as an array of bulk strings
+func readStubCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (s *redisStub) reply(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return "-ERR stub is failing\r\n"
+	}
+	for key, at := range s.expires {
+		if time.Now().After(at) {
+			delete(s.data, key)
+			delete(s.expires, key)
+		}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		key := args[1]
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, ok := s.data[key]; ok {
+					return "$-1\r\n"
+				}
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(ms) * time.Millisecond
+				i++
+			}
+		}
+		s.data[key] = args[2]
+		delete(s.expires, key)
+		if ttl > 0 {
+			s.expires[key] = time.Now().Add(ttl)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		return fmt.Sprintf(":%d\r\n", s.del(args[1:]...))
+	case "EXISTS":
+		if _, ok := s.data[args[1]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "EVAL":
+		// only the lock release script is sent by the tests
+		if args[1] != redisReleaseScript || s.data[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", s.del(args[3]))
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (s *redisStub) del(keys ...string) int {
+	n := 0
+	for _, key := range keys {
+		if _, ok := s.data[key]; ok {
+			delete(s.data, key)
+			delete(s.expires, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *redisStub) value(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func testRedisBackend(t *testing.T, prefix string) (*RedisBackend, *redisStub, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &redisStub{data: map[string]string{}, expires: map[string]time.Time{}}
+	go stub.serve(l)
+	client, err := redis.New(redis.Options{Addr: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RedisBackend{Client: client, Prefix: prefix}, stub, func() {
+		client.Close()
+		l.Close()
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	b, stub, done := testRedisBackend(t, "")
+	defer done()
+	if err := b.Put("/checkpoints/feed", []byte("42")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := stub.value("cache:checkpoints/feed"); v != "42" {
+		t.Fatalf("Expected the entry to be stored under cache:, got %v", stub.data)
+	}
+	data, err := b.Get("checkpoints/feed")
+	if err != nil || string(data) != "42" {
+		t.Fatalf("Expected the entry back as it was written, got %q, %v", data, err)
+	}
+	if ok, err := b.Exists("checkpoints/feed"); !ok || err != nil {
+		t.Fatalf("Expected the entry to exist, got %v, %v", ok, err)
+	}
+
+	if err = b.Delete("checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Get("checkpoints/feed"); err != ErrNotFound {
+		t.Fatalf("Expected a deleted entry not to be found, got %v", err)
+	}
+	if ok, err := b.Exists("checkpoints/feed"); ok || err != nil {
+		t.Fatalf("Expected a deleted entry not to exist, got %v, %v", ok, err)
+	}
+	if err = b.Delete("checkpoints/feed"); err != nil {
+		t.Fatalf("Expected deleting a missing entry not to fail, got %v", err)
+	}
+}
+
+func TestRedisBackendPrefixAndTTL(t *testing.T) {
+	b, stub, done := testRedisBackend(t, "tenants/a/")
+	defer done()
+	if err := b.PutTTL("token", []byte("t"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.value("tenants/a/token"); !ok {
+		t.Fatalf("Expected the entry to be stored under the prefix, got %v", stub.data)
+	}
+	if ok, _ := b.Exists("token"); !ok {
+		t.Fatal("Expected the entry to exist until it expires")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := b.Get("token"); err != ErrNotFound {
+		t.Fatalf("Expected an expired entry not to be found, got %v", err)
+	}
+}
+
+func TestRedisBackendErrors(t *testing.T) {
+	b, stub, done := testRedisBackend(t, "")
+	defer done()
+	stub.mu.Lock()
+	stub.failing = true
+	stub.mu.Unlock()
+	if err := b.Put("a", []byte("a")); err == nil || !strings.Contains(err.Error(), "stub is failing") {
+		t.Fatalf("Expected the server's error, got %v", err)
+	}
+	if _, err := b.Get("a"); err == nil || err == ErrNotFound {
+		t.Fatalf("Expected the server's error, got %v", err)
+	}
+	if ok, err := b.Exists("a"); ok || err == nil {
+		t.Fatalf("Expected the server's error, got %v, %v", ok, err)
+	}
+	if err := b.Delete("a"); err == nil {
+		t.Fatal("Expected the server's error")
+	}
+}
+
+func TestRedisBackendLocks(t *testing.T) {
+	b, stub, done := testRedisBackend(t, "")
+	defer done()
+	if err := b.Lock(context.Background(), "checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.value("cache:lock:checkpoints/feed"); !ok {
+		t.Fatalf("Expected the lock to be a key under cache:lock:, got %v", stub.data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Lock(ctx, "checkpoints/feed"); err == nil {
+		t.Fatal("Expected the lock to be held")
+	}
+	if err := b.Unlock("checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.value("cache:lock:checkpoints/feed"); ok {
+		t.Fatal("Expected unlocking to remove the lock's key")
+	}
+	if err := b.Unlock("checkpoints/feed"); err != ErrLockLost {
+		t.Fatalf("Expected unlocking a lock that isn't held to fail, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+// S3Backend is a Backend keeping entries as objects in an S3-compatible bucket, for plugins running where
+// there's no durable disk, ie: serverless functions. The bucket's endpoint and credentials are the
+// client's, see objectstore.Options.
+//
+// Object stores can't lock, so locks are taken with Mutex, which defaults to FileMutex. That only
+// coordinates the processes of one host, set a RedisMutex or EtcdMutex to coordinate replicas.
+type S3Backend struct {
+	Client *objectstore.Client
+	Prefix string     // Prefix is prepended to entry names to make object keys, defaults to "cache/"
+	Mutex  NamedMutex // Mutex takes the backend's locks
+
+	held heldLeases
+}
+
+// NewS3Backend returns an S3Backend for the bucket opts describes, with its entries under prefix
+func NewS3Backend(opts objectstore.Options, prefix string) (*S3Backend, error) {
+	client, err := objectstore.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{Client: client, Prefix: prefix}, nil
+}
+
+// Get implements Backend
+func (s *S3Backend) Get(name string) ([]byte, error) {
+	r, err := s.Client.Get(s.key(name))
+	if err == objectstore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Put implements Backend. Objects are replaced whole, so an entry is never seen half written.
+func (s *S3Backend) Put(name string, data []byte) error {
+	return s.Client.Put(s.key(name), bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+}
+
+// Delete implements Backend
+func (s *S3Backend) Delete(name string) error {
+	return s.Client.Delete(s.key(name))
+}
+
+// Exists implements Backend
+func (s *S3Backend) Exists(name string) (bool, error) {
+	_, err := s.Client.Head(s.key(name))
+	if err == objectstore.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Lock implements Backend
+func (s *S3Backend) Lock(ctx context.Context, name string) error {
+	m := s.Mutex
+	if m == nil {
+		m = FileMutex{}
+	}
+	return s.held.lock(ctx, m, name)
+}
+
+// Unlock implements Backend
+func (s *S3Backend) Unlock(name string) error {
+	return s.held.unlock(name)
+}
+
+func (s *S3Backend) key(name string) string {
+	if s.Prefix == "" {
+		return "cache/" + stripLeftSlash(name)
+	}
+	return s.Prefix + stripLeftSlash(name)
+}
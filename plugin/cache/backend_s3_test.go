@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+// s3Stub is an S3-compatible bucket in memory, addressed path style
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	failing bool
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	if s.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<Error><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>`))
+		return
+	}
+	data, ok := s.objects[r.URL.Path]
+	switch r.Method {
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case "GET", "HEAD":
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case "DELETE":
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testS3Backend(t *testing.T, prefix string) (*S3Backend, *s3Stub, func()) {
+	stub := &s3Stub{objects: map[string][]byte{}}
+	srv := httptest.NewServer(stub)
+	b, err := NewS3Backend(objectstore.Options{Endpoint: srv.URL, Bucket: "plugins", AccessKey: "AKID", SecretKey: "secret", PathStyle: true}, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, stub, srv.Close
+}
+
+func TestS3Backend(t *testing.T) {
+	b, stub, done := testS3Backend(t, "")
+	defer done()
+	if err := b.Put("/checkpoints/feed", []byte("42")); err != nil {
+		t.Fatal(err)
+	}
+	if string(stub.objects["/plugins/cache/checkpoints/feed"]) != "42" {
+		t.Fatalf("Expected the entry to be stored under cache/, got %v", stub.objects)
+	}
+	data, err := b.Get("checkpoints/feed")
+	if err != nil || string(data) != "42" {
+		t.Fatalf("Expected the entry back as it was written, got %q, %v", data, err)
+	}
+	if ok, err := b.Exists("checkpoints/feed"); !ok || err != nil {
+		t.Fatalf("Expected the entry to exist, got %v, %v", ok, err)
+	}
+
+	if err = b.Delete("checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Get("checkpoints/feed"); err != ErrNotFound {
+		t.Fatalf("Expected a deleted entry not to be found, got %v", err)
+	}
+	if ok, err := b.Exists("checkpoints/feed"); ok || err != nil {
+		t.Fatalf("Expected a deleted entry not to exist, got %v, %v", ok, err)
+	}
+	if err = b.Delete("checkpoints/feed"); err != nil {
+		t.Fatalf("Expected deleting a missing entry not to fail, got %v", err)
+	}
+}
+
+func TestS3BackendPrefix(t *testing.T) {
+	b, stub, done := testS3Backend(t, "tenants/a/")
+	defer done()
+	if err := b.Put("token", []byte("t")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.objects["/plugins/tenants/a/token"]; !ok {
+		t.Fatalf("Expected the entry to be stored under the prefix, got %v", stub.objects)
+	}
+}
+
+func TestS3BackendErrors(t *testing.T) {
+	b, stub, done := testS3Backend(t, "")
+	defer done()
+	stub.failing = true
+	if err := b.Put("a", []byte("a")); err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Fatalf("Expected the object store's error, got %v", err)
+	}
+	if _, err := b.Get("a"); err == nil || err == ErrNotFound {
+		t.Fatalf("Expected the object store's error, got %v", err)
+	}
+	if ok, err := b.Exists("a"); ok || err == nil {
+		t.Fatalf("Expected the object store's error, got %v, %v", ok, err)
+	}
+}
+
+func TestS3BackendLocks(t *testing.T) {
+	defer tempCache(t)()
+	b, _, done := testS3Backend(t, "")
+	defer done()
+	if err := b.Lock(context.Background(), "checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := TryLease("checkpoints/feed", 0); ok {
+		t.Fatal("Expected the lock to be held")
+	}
+	if err := b.Unlock("checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Unlock("checkpoints/feed"); err != ErrLockLost {
+		t.Fatalf("Expected unlocking a lock that isn't held to fail, got %v", err)
+	}
+}
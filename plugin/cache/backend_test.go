@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestCurrentBackendHelpers(t *testing.T) {
+	defer SetBackend(CurrentBackend())
+	m := &MemoryBackend{}
+	SetBackend(m)
+	defer ResetStats()
+	ResetStats()
+
+	if err := Put("/checkpoints/feed", []byte("42")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := m.Get("checkpoints/feed"); string(data) != "42" {
+		t.Fatalf("Expected Put to write to the current backend, got %q", data)
+	}
+	if ok, err := Exists("checkpoints/feed"); !ok || err != nil {
+		t.Fatalf("Expected the entry to exist, got %v, %v", ok, err)
+	}
+	if data, err := Get("checkpoints/feed"); err != nil || string(data) != "42" {
+		t.Fatalf("Expected the entry back as it was written, got %q, %v", data, err)
+	}
+
+	if err := Delete("checkpoints/feed"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Exists("checkpoints/feed"); ok || err != nil {
+		t.Fatalf("Expected a deleted entry not to exist, got %v, %v", ok, err)
+	}
+	if _, err := Get("checkpoints/feed"); err != ErrNotFound {
+		t.Fatalf("Expected a deleted entry not to be found, got %v", err)
+	}
+	if stats := GetStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("Expected a hit and a miss to be counted, got %+v", stats)
+	}
+}
+
+func TestCurrentBackendJSON(t *testing.T) {
+	defer SetBackend(CurrentBackend())
+	SetBackend(&MemoryBackend{})
+
+	if err := PutJSON("state", map[string]int{"offset": 7}); err != nil {
+		t.Fatal(err)
+	}
+	var state struct{ Offset int }
+	if err := GetJSON("state", &state); err != nil || state.Offset != 7 {
+		t.Fatalf("Expected the entry back as it was written, got %+v, %v", state, err)
+	}
+	Put("broken", []byte("{"))
+	if err := GetJSON("broken", &state); err == nil || err == ErrNotFound {
+		t.Fatalf("Expected invalid JSON to be refused, got %v", err)
+	}
+	if err := GetJSON("missing", &state); err != ErrNotFound {
+		t.Fatalf("Expected a missing entry not to be found, got %v", err)
+	}
+}
+
+func TestSetBackendNilRestoresFiles(t *testing.T) {
+	defer SetBackend(CurrentBackend())
+	SetBackend(nil)
+	if _, ok := CurrentBackend().(FileBackend); !ok {
+		t.Fatalf("Expected FileBackend, got %T", CurrentBackend())
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// LockBackoff is how a waiter for a held lock backs off between attempts to take it. Heavily contended
+// plugins can wait longer, and longer still the longer they've waited, rather than hammering the lock:
+//
+//	cache.SetLockBackoff(&cache.LockBackoff{Initial: 10 * time.Millisecond, Multiplier: 2, Max: time.Second, Jitter: 0.2})
+//
+// It applies to every lock: file locks polled for, and RedisMutex and EtcdMutex. On Linux and macOS a file
+// lock that can't be given up on, ie: LockCacheFile's, is otherwise waited for in the kernel, which wakes
+// the waiter as soon as it's let go of, but it's polled too once a backoff is set.
+type LockBackoff struct {
+	Initial    time.Duration // Initial is the first wait, defaulting to the waiter's own
+	Multiplier float64       // Multiplier grows each wait after the first, less than 1 is taken as 1
+	Max        time.Duration // Max caps the waits, 0 is no cap
+	Jitter     float64       // Jitter adjusts each wait randomly by up to +/- this fraction, see utils.Jitter
+}
+
+// The backoffs of waiters when SetLockBackoff hasn't set one
+var (
+	fileLockBackoff   = LockBackoff{Initial: time.Millisecond, Multiplier: 2, Max: 100 * time.Millisecond, Jitter: 0.2}
+	remoteLockBackoff = LockBackoff{Initial: 100 * time.Millisecond, Jitter: 0.5} // jittered so replicas don't retry in step
+)
+
+var (
+	lockBackoffMu sync.RWMutex
+	lockBackoff   *LockBackoff
+)
+
+// SetLockBackoff sets how every waiter for a held lock backs off, nil restores the defaults: file locks are
+// polled after a millisecond, then twice as long each time up to 100ms, give or take a fifth, and Redis and
+// etcd locks every 100ms, give or take half
+func SetLockBackoff(b *LockBackoff) {
+	lockBackoffMu.Lock()
+	defer lockBackoffMu.Unlock()
+	if b == nil {
+		lockBackoff = nil
+		return
+	}
+	backoff := *b
+	lockBackoff = &backoff
+}
+
+// lockBackoffSet returns whether SetLockBackoff set a backoff
+func lockBackoffSet() bool {
+	lockBackoffMu.RLock()
+	defer lockBackoffMu.RUnlock()
+	return lockBackoff != nil
+}
+
+// lockWait is the waits of one waiter, growing from the first
+type lockWait struct {
+	LockBackoff
+	next time.Duration
+}
+
+// newLockWait returns the waits of a waiter, with the backoff set by SetLockBackoff or def
+func newLockWait(def LockBackoff) *lockWait {
+	lockBackoffMu.RLock()
+	b := def
+	if lockBackoff != nil {
+		b = *lockBackoff
+	}
+	lockBackoffMu.RUnlock()
+	if b.Initial <= 0 {
+		b.Initial = def.Initial
+	}
+	if b.Max > 0 && b.Max < b.Initial {
+		b.Max = b.Initial
+	}
+	return &lockWait{LockBackoff: b, next: b.Initial}
+}
+
+// sleep waits before the next attempt, or until ctx is done
+func (w *lockWait) sleep(ctx context.Context) error {
+	d := w.next
+	if w.Multiplier > 1 {
+		w.next = time.Duration(float64(w.next) * w.Multiplier)
+		if w.Max > 0 && w.next > w.Max {
+			w.next = w.Max
+		}
+	}
+	return utils.SleepCtx(ctx, utils.Jitter(d, w.Jitter))
+}
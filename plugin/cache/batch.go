@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Defaults for a BatchBackend's options left at 0
+const (
+	DefaultBatchEntries  = 1000
+	DefaultBatchBytes    = 1 << 20
+	DefaultBatchInterval = time.Second
+)
+
+// BatchBackend is a Backend that holds writes in memory and commits them to the backend it wraps as a
+// group, once MaxEntries or MaxBytes are pending or Interval has passed since the first was. A trigger
+// that updates its checkpoint for every event then writes it about once a second, rather than syncing a
+// file per event. Reads see the pending writes.
+//
+// A write is only durable once it's flushed, so at most Interval of updates are lost in a crash. Close
+// the backend before the plugin exits to flush the rest.
+type BatchBackend struct {
+	Backend    Backend
+	MaxEntries int
+	MaxBytes   int
+	Interval   time.Duration
+
+	mu       sync.Mutex
+	pending  map[string][]byte // pending writes, nil data deletes the entry
+	flushing map[string][]byte // flushing are the writes being flushed, read until they land
+	bytes    int
+	timer    *time.Timer
+	err      error // err is the last background flush's, returned by the next write
+	closed   bool
+
+	flushMu sync.Mutex // flushMu orders flushes, so an older write never lands after a newer one
+}
+
+// NewBatchBackend batches the writes to b with the default options
+func NewBatchBackend(b Backend) *BatchBackend {
+	return &BatchBackend{Backend: b}
+}
+
+// Get implements Backend
+func (b *BatchBackend) Get(name string) ([]byte, error) {
+	data, ok := b.unflushed(name)
+	if !ok {
+		return b.Backend.Get(name)
+	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Put implements Backend, holding the write until the batch is flushed
+func (b *BatchBackend) Put(name string, data []byte) error {
+	// copied onto a non-nil slice, as nil is a pending delete
+	return b.write(name, append([]byte{}, data...))
+}
+
+// Delete implements Backend, holding the delete until the batch is flushed
+func (b *BatchBackend) Delete(name string) error {
+	return b.write(name, nil)
+}
+
+// Exists implements Backend
+func (b *BatchBackend) Exists(name string) (bool, error) {
+	data, ok := b.unflushed(name)
+	if !ok {
+		return b.Backend.Exists(name)
+	}
+	return data != nil, nil
+}
+
+// Lock implements Backend with the wrapped backend's locks
+func (b *BatchBackend) Lock(ctx context.Context, name string) error {
+	return b.Backend.Lock(ctx, name)
+}
+
+// Unlock implements Backend. Writes made under the lock are flushed first, so whoever takes it next
+// reads them.
+func (b *BatchBackend) Unlock(name string) error {
+	if err := b.Flush(); err != nil {
+		b.Backend.Unlock(name)
+		return err
+	}
+	return b.Backend.Unlock(name)
+}
+
+// unflushed returns the named entry's latest write that's yet to land in the wrapped backend, if there is one
+func (b *BatchBackend) unflushed(name string) ([]byte, bool) {
+	name = stripLeftSlash(name)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if data, ok := b.pending[name]; ok {
+		return data, true
+	}
+	data, ok := b.flushing[name]
+	return data, ok
+}
+
+func (b *BatchBackend) write(name string, data []byte) error {
+	name = stripLeftSlash(name)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		if data == nil {
+			return b.Backend.Delete(name)
+		}
+		return b.Backend.Put(name, data)
+	}
+	err := b.err
+	b.err = nil
+	if b.pending == nil {
+		b.pending = map[string][]byte{}
+	}
+	b.bytes += len(data) - len(b.pending[name])
+	b.pending[name] = data
+	full := len(b.pending) >= orDefault(b.MaxEntries, DefaultBatchEntries) || b.bytes >= orDefault(b.MaxBytes, DefaultBatchBytes)
+	if !full {
+		b.schedule()
+	}
+	b.mu.Unlock()
+	if full {
+		return b.Flush()
+	}
+	return err
+}
+
+// schedule flushes the pending writes after Interval, if it isn't already. b.mu must be held.
+func (b *BatchBackend) schedule() {
+	if b.timer != nil {
+		return
+	}
+	interval := b.Interval
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	b.timer = time.AfterFunc(interval, b.flushInBackground)
+}
+
+func (b *BatchBackend) flushInBackground() {
+	if err := b.Flush(); err != nil {
+		log.Errorf("Unable to flush batched cache writes: %s", err)
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+}
+
+// Flush commits the pending writes to the wrapped backend. Writes that fail stay pending, to be tried
+// again by the next flush.
+func (b *BatchBackend) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending, b.flushing, b.bytes = nil, batch, 0
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	var firstErr error
+	failed := map[string][]byte{}
+	for name, data := range batch {
+		var err error
+		if data == nil {
+			err = b.Backend.Delete(name)
+		} else {
+			err = b.Backend.Put(name, data)
+		}
+		if err != nil {
+			failed[name] = data
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	// put back what failed, unless it was written again while flushing
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushing = nil
+	if len(failed) == 0 {
+		return nil
+	}
+	if b.pending == nil {
+		b.pending = map[string][]byte{}
+	}
+	for name, data := range failed {
+		if _, ok := b.pending[name]; !ok {
+			b.pending[name] = data
+			b.bytes += len(data)
+		}
+	}
+	if !b.closed {
+		b.schedule()
+	}
+	return firstErr
+}
+
+// Close flushes the pending writes. Writes after it go straight to the wrapped backend.
+func (b *BatchBackend) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return b.Flush()
+}
+
+func orDefault(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyBackend fails the writes to a MemoryBackend while failing is set, and holds them while held isn't nil
+type flakyBackend struct {
+	MemoryBackend
+	mu      sync.Mutex
+	failing bool
+	held    chan struct{}
+	writes  int
+}
+
+func (f *flakyBackend) Put(name string, data []byte) error {
+	f.mu.Lock()
+	failing, held := f.failing, f.held
+	f.writes++
+	f.mu.Unlock()
+	if held != nil {
+		<-held
+	}
+	if failing {
+		return errors.New("unavailable")
+	}
+	return f.MemoryBackend.Put(name, data)
+}
+
+func (f *flakyBackend) set(failing bool, held chan struct{}) {
+	f.mu.Lock()
+	f.failing, f.held = failing, held
+	f.mu.Unlock()
+}
+
+func expectEntry(t *testing.T, b Backend, name, expected string) {
+	data, err := b.Get(name)
+	if expected == "" {
+		if err != ErrNotFound {
+			t.Fatalf("Expected no %s, got %q, %v", name, data, err)
+		}
+		return
+	}
+	if err != nil || string(data) != expected {
+		t.Fatalf("Expected %s to be %q, got %q, %v", name, expected, data, err)
+	}
+}
+
+func TestBatchBackendHoldsWrites(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	wrapped.Put("old", []byte("old"))
+	b := &BatchBackend{Backend: wrapped, Interval: time.Hour}
+	if err := b.Put("/checkpoint", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put("checkpoint", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete("old"); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, wrapped, "checkpoint", "")
+	expectEntry(t, wrapped, "old", "old")
+
+	// reads see the pending writes
+	expectEntry(t, b, "checkpoint", "2")
+	expectEntry(t, b, "old", "")
+	if ok, err := b.Exists("old"); ok || err != nil {
+		t.Fatalf("Expected a pending delete not to exist, got %v, %v", ok, err)
+	}
+
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, wrapped, "checkpoint", "2")
+	expectEntry(t, wrapped, "old", "")
+}
+
+func TestBatchBackendFlushesWhenFull(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	b := &BatchBackend{Backend: wrapped, MaxEntries: 2, Interval: time.Hour}
+	b.Put("a", []byte("a"))
+	expectEntry(t, wrapped, "a", "")
+	b.Put("b", []byte("b"))
+	expectEntry(t, wrapped, "a", "a")
+	expectEntry(t, wrapped, "b", "b")
+
+	b = &BatchBackend{Backend: wrapped, MaxBytes: 4, Interval: time.Hour}
+	b.Put("c", []byte("cc"))
+	expectEntry(t, wrapped, "c", "")
+	b.Put("d", []byte("dd"))
+	expectEntry(t, wrapped, "c", "cc")
+	expectEntry(t, wrapped, "d", "dd")
+}
+
+func TestBatchBackendFlushesAfterInterval(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	b := &BatchBackend{Backend: wrapped, Interval: 10 * time.Millisecond}
+	b.Put("a", []byte("a"))
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if ok, _ := wrapped.Exists("a"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the write to be flushed after the interval")
+		}
+	}
+}
+
+func TestBatchBackendFlushesOnUnlock(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	b := &BatchBackend{Backend: wrapped, Interval: time.Hour}
+	if err := b.Lock(context.Background(), "checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	b.Put("checkpoint", []byte("1"))
+	if err := b.Unlock("checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, wrapped, "checkpoint", "1")
+	if err := wrapped.Lock(context.Background(), "checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchBackendRetriesFailedWrites(t *testing.T) {
+	wrapped := &flakyBackend{failing: true}
+	b := &BatchBackend{Backend: wrapped, Interval: time.Hour}
+	b.Put("a", []byte("1"))
+	if err := b.Flush(); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	expectEntry(t, b, "a", "1")
+
+	// a write made since isn't overwritten by the retry
+	b.Put("a", []byte("2"))
+	wrapped.set(false, nil)
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, &wrapped.MemoryBackend, "a", "2")
+}
+
+func TestBatchBackendReadsWritesBeingFlushed(t *testing.T) {
+	wrapped := &flakyBackend{}
+	wrapped.MemoryBackend.Put("a", []byte("stale"))
+	b := &BatchBackend{Backend: wrapped, Interval: time.Hour}
+	b.Put("a", []byte("fresh"))
+
+	held := make(chan struct{})
+	wrapped.set(false, held)
+	flushed := make(chan error)
+	go func() { flushed <- b.Flush() }()
+	for {
+		wrapped.mu.Lock()
+		writes := wrapped.writes
+		wrapped.mu.Unlock()
+		if writes > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	expectEntry(t, b, "a", "fresh")
+	if ok, err := b.Exists("a"); !ok || err != nil {
+		t.Fatalf("Expected a write being flushed to exist, got %v, %v", ok, err)
+	}
+	close(held)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, b, "a", "fresh")
+}
+
+func TestBatchBackendClose(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	b := &BatchBackend{Backend: wrapped, Interval: time.Hour}
+	b.Put("a", []byte("a"))
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(t, wrapped, "a", "a")
+
+	// writes after closing go straight through
+	b.Put("b", []byte("b"))
+	expectEntry(t, wrapped, "b", "b")
+	b.Delete("a")
+	expectEntry(t, wrapped, "a", "")
+}
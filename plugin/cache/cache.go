@@ -1,22 +1,54 @@
 // Package cache abstracts away the notion of where plugins cache information into
-// a set of simple function calls. Currently, the cache is a wrapper around the file
+// a set of simple function calls. By default, the cache is a wrapper around the file
 // system in /var/cache, however if you need to directly interact with the filesystem
 // to more easily integrate with another library, you are free to do so. You can then
 // consider this a reference for how to do so correctly.
+//
+// Get, Put, Delete and Exists go through a Backend instead, which SetBackend can swap for one that
+// doesn't need a durable local disk, ie: RedisBackend, or wrap in a BatchBackend to write frequent updates
+// in groups, or in a CompressedBackend to gzip large entries.
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/komand/plugin-sdk-go/plugin/utils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The cache, and the lock files, vars so tests can keep theirs elsewhere
+var (
+	cacheDir = "/var/cache/"
+	lockDir  = "/var/cache/lock/"
+)
+
+// SetRoot keeps the cache, and its lock, ttl and checksum files, in dir rather than /var/cache, ie: a
+// temporary directory in tests. Set it before the cache is used.
+func SetRoot(dir string) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	cacheDir, lockDir, ttlDir, sumDir = dir, dir+"lock/", dir+".ttl/", dir+".sum/"
+}
+
+// heldLocks are the leases taken by LockCacheFile, so UnlockCacheFile can find them by name
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = map[string]*LockLease{}
 )
 
-const cacheDir = "/var/cache/"
-const lockDir = "/var/cache/lock/"
-const filePerms = 0600
-const lockWaitBackoff = 1 * time.Millisecond
+// ErrLockTimeout is returned by LockCacheFileContext when its deadline passed before it got the lock
+var ErrLockTimeout = errors.New("cache: timed out waiting for the lock")
 
 // InvalidCacheFileName is returned when a cache file has an invalid name
 type InvalidCacheFileName string
@@ -30,102 +62,348 @@ func (e InvalidCacheFileName) Error() string {
 // file if found, or an error if not found / something went wrong when opening. the name
 // argument should not begin with a slash, and should assume it will be appended to /var/cache
 // The caller is responsible for closing the file. If they don't, there could be problems.
+// Names that would resolve outside /var/cache, ie: with .., are refused with an InvalidCacheFileName.
+// A file written by WriteWithTTL that has expired is removed first, and opened empty, as is a corrupt
+// file if SetDiscardCorrupt is on.
 func OpenCacheFile(name string) (*os.File, error) {
-	if err := isReservedName(name); err != nil {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := removeIfExpired(name); err != nil {
+		return nil, err
+	}
+	if _, err := discardIfCorrupt(name, nil); err != nil {
+		return nil, err
+	}
+
+	f, err := openFile(cacheDir + stripLeftSlash(name))
+	if err == nil {
+		used(name)
+	}
+	return f, err
+}
+
+// WriteAtomic replaces the named cache file with data. It's written to a temporary file in the same
+// directory that's renamed into place, so a crash part way through never leaves other readers a truncated
+// file, just the old one. A TTL the file was written with is dropped. Its checksum is kept, see Verify. The
+// name argument follows the same rules as OpenCacheFile.
+func WriteAtomic(name string, data []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := removeExpiry(name); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(cacheDir+stripLeftSlash(name), data); err != nil {
+		return err
+	}
+	if err := writeSum(name, data); err != nil {
+		return err
+	}
+	used(name)
+	return nil
+}
+
+// ReadBytes returns the content of the named cache file, opening and closing it in one call so there's no
+// file left to close. Unlike OpenCacheFile it doesn't create a missing file, it returns an error satisfying
+// os.IsNotExist, as it does for an expired file, or a corrupt one if SetDiscardCorrupt is on.
+func ReadBytes(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := removeIfExpired(name); err != nil {
 		return nil, err
 	}
+	path := cacheDir + stripLeftSlash(name)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if discarded, err := discardIfCorrupt(name, b); err != nil {
+		return nil, err
+	} else if discarded {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	used(name)
+	return b, nil
+}
 
-	return openFile(cacheDir + stripLeftSlash(name))
+// WriteBytes replaces the named cache file with data in one call, so there's no file left to close. It's
+// WriteAtomic, named to pair with ReadBytes.
+func WriteBytes(name string, data []byte) error {
+	return WriteAtomic(name, data)
 }
 
 // RemoveCacheFile will delete the provided file from /var/cache/* and an error if something went wrong
 // the name argument should not begin with a slash, and should assume it will be appended to /var/cache
 func RemoveCacheFile(name string) error {
-	if err := isReservedName(name); err != nil {
+	if err := validateName(name); err != nil {
 		return err
 	}
 
+	if err := removeSidecars(name); err != nil {
+		return err
+	}
 	return os.Remove(cacheDir + stripLeftSlash(name))
 }
 
-// CheckCacheFile checks if the file exists in the cache or not
+// CheckCacheFile checks if the file exists in the cache or not. A file written by WriteWithTTL that has
+// expired doesn't, and is removed.
 func CheckCacheFile(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+	if err := removeIfExpired(name); err != nil {
+		return false, err
+	}
 	return utils.DoesFileExist(cacheDir + stripLeftSlash(name))
 }
 
-// LockCacheFile will lock the provided file from /var/cache/lock/* and return a boolean if the operation
-// was successful or not. In the event it was not, an error may or may not be returned (always check the value first
-// to know if it worked)
+// LockCacheFile will lock the provided file from /var/cache/lock/*, waiting until it's free, and return the
+// lock held. Unlock it once done:
+//
+//	lock, err := cache.LockCacheFile("token")
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Unlock()
+//
 // the name argument should not begin with a slash, and should assume it will be appended to /var/cache
-func LockCacheFile(name string) (bool, error) {
-	name = lockDir + stripLeftSlash(name)
-	var ok bool
-	var err error
-	for {
-		// Spin wait until something errors, or the file becomes free
-		if ok, err = utils.DoesFileExist(name); err != nil {
-			// If anything went wrong checking for the file, bail out
-			return false, err
-		}
-		// If the file did exist, we want to try again until it doesn't
-		if ok {
-			// Let's give the thread a nap while we wait, instead of pegging the CPU
-			time.Sleep(lockWaitBackoff) // TODO should this be configurable?
-			continue                    // loop back to the top, try again
-		}
-		// attempt an exclusive lock - if something already grabbed the file out from under us, we simply go back to waiting
-		var f *os.File
-		if f, err = openExclusiveFile(name); err != nil {
-			if os.IsExist(err) {
-				continue // The error was that the file existed - so we just keep on a'rollin
-			}
-			// This was another error, some legitimate problem went wrong
-			return false, err
-		}
-		f.Close()
-		break // if it ever actually gets to the end of the for loop, it means we got the exclusive lock
+func LockCacheFile(name string) (*Lock, error) {
+	return LockCacheFileContext(context.Background(), name)
+}
+
+// LockCacheFileContext is LockCacheFile, but gives up waiting for the lock once ctx is done. It returns
+// ErrLockTimeout if ctx's deadline passed, so a lock held by a stuck process can be told apart from
+// other failures, or ctx.Err() if it was cancelled.
+func LockCacheFileContext(ctx context.Context, name string) (*Lock, error) {
+	l, err := AcquireLease(ctx, name, 0)
+	if err == context.DeadlineExceeded {
+		return nil, ErrLockTimeout
+	}
+	if err != nil {
+		return nil, err
 	}
 	// If we got here, we got the lock
-	return true, nil
+	return holdLock(l), nil
+}
+
+// TryLockCacheFile is LockCacheFile without the waiting, it returns false straight away if the lock is already held
+func TryLockCacheFile(name string) (*Lock, bool, error) {
+	l, ok, err := TryLease(name, 0)
+	if !ok {
+		return nil, false, err
+	}
+	return holdLock(l), true, nil
+}
+
+// LockCacheFileTTL is LockCacheFileContext for a lock that expires ttl after it was last renewed. It's
+// renewed in the background until it's unlocked, so it only expires if its holder dies or hangs, and a lock
+// left behind then, ie: a held marker on Windows or a lock file a child process inherited, is broken by
+// whoever waits for it next rather than blocking them forever. If renewing fails until the lock expires
+// it's logged, and Lease().Check returns ErrLockLost. ttl must be positive, a lock that doesn't expire is
+// LockCacheFileContext's.
+func LockCacheFileTTL(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("Cache lock TTL must be positive, got %s", ttl)
+	}
+	l, err := LockCacheFileContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	l.stop = l.lease.KeepAlive(context.Background(), ttl, func(err error) {
+		l.lease.mu.Lock()
+		released := l.lease.released
+		l.lease.mu.Unlock()
+		if !released {
+			log.Warnf("Lost cache lock %s, it couldn't be renewed: %s", l.lease.Name, err)
+		}
+	})
+	return l, nil
+}
+
+// RLockCacheFile is LockCacheFile for a shared lock, held by any number of readers at once while
+// LockCacheFile waits for them all to unlock, like sync.RWMutex.RLock, see AcquireSharedLease:
+//
+//	lock, err := cache.RLockCacheFile("feed")
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Unlock()
+func RLockCacheFile(name string) (*Lock, error) {
+	return RLockCacheFileContext(context.Background(), name)
+}
+
+// RLockCacheFileContext is RLockCacheFile, but gives up waiting for the lock once ctx is done, see
+// LockCacheFileContext
+func RLockCacheFileContext(ctx context.Context, name string) (*Lock, error) {
+	l, err := AcquireSharedLease(ctx, name)
+	if err == context.DeadlineExceeded {
+		return nil, ErrLockTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{lease: l}, nil
+}
+
+// TryRLockCacheFile is RLockCacheFile without the waiting, it returns false straight away if the lock is
+// held exclusively
+func TryRLockCacheFile(name string) (*Lock, bool, error) {
+	l, ok, err := TrySharedLease(name)
+	if !ok {
+		return nil, false, err
+	}
+	return &Lock{lease: l}, true, nil
+}
+
+// holdLock keeps an exclusive lock for UnlockCacheFile, shared locks can only be unlocked through their Lock
+func holdLock(l *LockLease) *Lock {
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+	heldLocks[l.path] = l
+	return &Lock{lease: l}
+}
+
+// Lock is a lock on a cache file held by LockCacheFile, or RLockCacheFile
+type Lock struct {
+	lease *LockLease
+	stop  func() // stop stops the renewal of a lock taken by LockCacheFileTTL
+}
+
+// Name returns the name of the locked file, relative to /var/cache
+func (l *Lock) Name() string {
+	return l.lease.Name
+}
+
+// Unlock gives up the lock. Unlocking twice is a no-op.
+func (l *Lock) Unlock() error {
+	return l.UnlockAfter(0)
+}
+
+// UnlockAfter gives up the lock, but keeps anyone else from taking it until hold has passed since now,
+// to rate limit other processes without blocking this one, see AcquireLease. A shared lock has no hold.
+func (l *Lock) UnlockAfter(hold time.Duration) error {
+	// It's forgotten before it's released, or whoever takes the lock next could be forgotten instead
+	heldLocksMu.Lock()
+	if heldLocks[l.lease.path] == l.lease {
+		delete(heldLocks, l.lease.path)
+	}
+	heldLocksMu.Unlock()
+	if l.stop != nil {
+		l.stop()
+	}
+	if hold > 0 {
+		l.lease.extendHold(time.Now().Add(hold))
+	}
+	return l.lease.Release()
+}
+
+// Lease returns the lease the lock is held with, to renew it or check it's still held
+func (l *Lock) Lease() *LockLease {
+	return l.lease
+}
+
+// UnlockWhenCollected has the lock given up once it's garbage collected, if it wasn't unlocked, so a lock
+// a caller forgot about isn't held until the process exits. It's a safety net rather than a way to unlock,
+// collection can be far off, so a lock given up this way is logged.
+func (l *Lock) UnlockWhenCollected() {
+	runtime.SetFinalizer(l, func(l *Lock) {
+		if l.lease.Check() == nil {
+			log.Warnf("Unlocking cache lock %s, it was garbage collected without being unlocked", l.lease.Name)
+			l.Unlock()
+		}
+	})
 }
 
 // UnlockCacheFile will unlock the provided file from /var/cache/lock/* and return a boolean if the operation
 // was successful or not. In the event it was not, an error may or may not be returned (always check the value first
 // to know if it worked)
 // the name argument should not begin with a slash, and should assume it will be appended to /var/cache
-// the timeout is used to mimic rate limiting - you can put an artificial pause on the current thread before it unlocks
-// this will also keep any invocations of the process from obtaining the lock until it expires.
+// the timeout is used to mimic rate limiting - it will keep any invocations of the process from obtaining the lock
+// until it expires. It no longer pauses the current thread, the lock file records how long it's held for instead.
+// Prefer Lock.Unlock or Lock.UnlockAfter for new code.
+// Only locks taken by this process can be unlocked.
 func UnlockCacheFile(name string, timeout *time.Duration) (bool, error) {
-	// If a timeout was provided, we'll sleep for that long before unlocking the file
-	// this is a very rudimentary rate-limiting mechanism
+	path := lockDir + stripLeftSlash(name)
+	// It's forgotten before it's released, or whoever takes the lock next could be forgotten instead
+	heldLocksMu.Lock()
+	l, ok := heldLocks[path]
+	delete(heldLocks, path)
+	heldLocksMu.Unlock()
+	if !ok {
+		return false, ErrLockLost
+	}
 	if timeout != nil {
-		time.Sleep(*timeout)
+		l.extendHold(time.Now().Add(*timeout))
 	}
-	if err := os.Remove(lockDir + stripLeftSlash(name)); err != nil {
+	if err := l.Release(); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// We told them not to, but just incase they did, strip any leading slashes from the name arguments
+// UnlockCacheFileContext is UnlockCacheFile. The context is no longer used, since unlocking doesn't block.
+//
+// Deprecated: use UnlockCacheFile or LockLease.Release
+func UnlockCacheFileContext(ctx context.Context, name string, timeout *time.Duration) (bool, error) {
+	return UnlockCacheFile(name, timeout)
+}
+
+// We told them not to, but just incase they did, strip any leading slashes from the name arguments. The
+// name is made canonical too, and .. can't climb above the cache, so even a name that wasn't validated
+// can't reach outside it.
 func stripLeftSlash(name string) string {
-	return strings.TrimLeft(name, "/")
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// validateName checks name can be used as a cache file name, returning an InvalidCacheFileName if it's
+// reserved, or isn't a valid path, see validatePath
+func validateName(name string) error {
+	if err := validatePath(name); err != nil {
+		return err
+	}
+	return isReservedName(name)
+}
+
+// validatePath checks name is a path that can be used in the cache, returning an InvalidCacheFileName if
+// it would resolve outside /var/cache, or is otherwise unusable
+func validatePath(name string) error {
+	invalid := func(reason string) error {
+		return InvalidCacheFileName(fmt.Sprintf("%q isn't a valid cache file name, %s", name, reason))
+	}
+	rel := strings.TrimLeft(filepath.ToSlash(name), "/")
+	if rel == "" {
+		return invalid("it's empty")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return invalid("it holds control characters")
+	}
+	if runtime.GOOS == "windows" && (filepath.VolumeName(rel) != "" || strings.Contains(rel, ":")) {
+		return invalid("it names a drive")
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".." {
+			return invalid("it can't climb out of the cache with ..")
+		}
+	}
+	return nil
 }
 
 // Makes sure you don't use any reserved terms in a name, for example a file simply called "lock" in the /var/cache directory
 func isReservedName(name string) error {
-	if strings.HasSuffix(name, "/lock") {
+	if strings.HasSuffix(name, "/lock") || stripLeftSlash(name) == "lock" {
 		return InvalidCacheFileName("'lock' is a reserved name in the cache, please choose a different file name")
 	}
 	return nil
 }
 
-// Wrapper around utils.OpenFile to bake in the right perms/flags
+// Wrapper around createFile to bake in the right flags
 func openFile(name string) (*os.File, error) {
-	return utils.OpenFile(name, os.O_RDWR|os.O_CREATE, filePerms)
+	return createFile(name, os.O_RDWR|os.O_CREATE)
 }
 
-// Wrapper around utils.OpenFile to bake in the right perms/flags for exclusive file locks
+// Wrapper around createFile to bake in the right flags for exclusive file locks
 func openExclusiveFile(name string) (*os.File, error) {
-	return utils.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, filePerms)
+	return createFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL)
 }
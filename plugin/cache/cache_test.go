@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tempCache keeps the cache in a temporary directory until the returned function is called
+func tempCache(t *testing.T) (cleanup func()) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := []string{cacheDir, lockDir, ttlDir, sumDir}
+	SetRoot(dir)
+	return func() {
+		cacheDir, lockDir, ttlDir, sumDir = saved[0], saved[1], saved[2], saved[3]
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReadWriteBytes(t *testing.T) {
+	defer tempCache(t)()
+	if err := WriteBytes("feeds/a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBytes("/feeds/a")
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", b, err)
+	}
+	if _, err = ReadBytes("feeds/missing"); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing file not to exist, got %v", err)
+	}
+	if ok, _ := CheckCacheFile("feeds/missing"); ok {
+		t.Fatal("Expected ReadBytes not to create a missing file")
+	}
+	for _, name := range []string{"../etc/passwd", "a/../../b", "lock", "feeds/lock", ""} {
+		if err = WriteBytes(name, nil); err == nil {
+			t.Errorf("Expected %q to be refused", name)
+		} else if _, ok := err.(InvalidCacheFileName); !ok {
+			t.Errorf("Expected %q to be refused with an InvalidCacheFileName, got %v", name, err)
+		}
+	}
+}
+
+func TestWriteWithTTL(t *testing.T) {
+	defer tempCache(t)()
+	if err := WriteWithTTL("token", []byte("secret"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if expires, ok, err := Expires("token"); err != nil || !ok || expires.Sub(time.Now()) > 20*time.Millisecond {
+		t.Fatalf("Expected the token to expire within 20ms, got %s, %v, %v", expires, ok, err)
+	}
+	if ok, err := CheckCacheFile("token"); !ok || err != nil {
+		t.Fatalf("Expected the token to exist until it expires, got %v, %v", ok, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, err := CheckCacheFile("token"); ok || err != nil {
+		t.Fatalf("Expected the token not to exist once it expired, got %v, %v", ok, err)
+	}
+	if _, err := os.Stat(ttlDir + "token"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the token's expiry to be removed with it, got %v", err)
+	}
+
+	// Rewriting a file without a TTL drops it
+	WriteWithTTL("token", []byte("secret"), time.Hour)
+	if err := WriteAtomic("token", []byte("forever")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := Expires("token"); ok {
+		t.Fatal("Expected WriteAtomic to drop the TTL")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	defer tempCache(t)()
+	if err := WriteAtomic("state", []byte("checkpoint=10")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify("state"); err != nil {
+		t.Fatalf("Expected the file to verify, got %v", err)
+	}
+
+	// Corrupt it on disk, leaving it looking as it was written
+	fi, _ := os.Stat(cacheDir + "state")
+	ioutil.WriteFile(cacheDir+"state", []byte("checkpoint=99"), 0600)
+	os.Chtimes(cacheDir+"state", fi.ModTime(), fi.ModTime())
+	if _, ok := Verify("state").(*CorruptError); !ok {
+		t.Fatalf("Expected the changed file to be corrupt, got %v", Verify("state"))
+	}
+	ioutil.WriteFile(cacheDir+"state", []byte("check"), 0600)
+	os.Chtimes(cacheDir+"state", fi.ModTime(), fi.ModTime())
+	if _, ok := Verify("state").(*CorruptError); !ok {
+		t.Fatalf("Expected the truncated file to be corrupt, got %v", Verify("state"))
+	}
+
+	SetDiscardCorrupt(true)
+	defer SetDiscardCorrupt(false)
+	if _, err := ReadBytes("state"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the corrupt file to be discarded, got %v", err)
+	}
+
+	// A file written some other way since has nothing to verify it with
+	WriteAtomic("state", []byte("checkpoint=10"))
+	os.Chtimes(cacheDir+"state", time.Now(), time.Now().Add(time.Hour))
+	if err := Verify("state"); err != ErrUnverified {
+		t.Fatalf("Expected a file written since to be unverified, got %v", err)
+	}
+}
+
+func TestCopyRenameMove(t *testing.T) {
+	defer tempCache(t)()
+	if err := WriteWithTTL("pending/batch", []byte("events"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy("pending/batch", "backup/batch"); err != nil {
+		t.Fatal(err)
+	}
+	expect := func(name string) {
+		b, err := ReadBytes(name)
+		if err != nil || string(b) != "events" {
+			t.Fatalf("Expected %s to hold events, got %q, %v", name, b, err)
+		}
+		if err = Verify(name); err != nil {
+			t.Fatalf("Expected %s to verify, got %v", name, err)
+		}
+		if _, ok, _ := Expires(name); !ok {
+			t.Fatalf("Expected %s to keep its expiry", name)
+		}
+	}
+	expect("pending/batch")
+	expect("backup/batch")
+
+	if err := Rename("pending/batch", "committed/batch"); err != nil {
+		t.Fatal(err)
+	}
+	expect("committed/batch")
+	if ok, _ := CheckCacheFile("pending/batch"); ok {
+		t.Fatal("Expected the renamed file to be gone")
+	}
+	if err := Move("committed/batch", "archive/batch"); err != nil {
+		t.Fatal(err)
+	}
+	expect("archive/batch")
+	if err := Rename("missing", "elsewhere"); !os.IsNotExist(err) {
+		t.Fatalf("Expected renaming a missing file to fail, got %v", err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	defer tempCache(t)()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := Increment("requests", 1); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := Increment("requests", 0); n != 100 || err != nil {
+		t.Fatalf("Expected 100 increments, got %d, %v", n, err)
+	}
+	WriteAtomic("not-a-counter", []byte("hello"))
+	if _, err := Increment("not-a-counter", 1); err == nil {
+		t.Fatal("Expected a file that isn't a counter to be refused")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	defer tempCache(t)()
+	SetLimits(&Limits{MaxEntries: 2})
+	defer SetLimits(nil)
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"a", "b", "c", "deadletter/x"} {
+		WriteAtomic(name, []byte(name))
+		used := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(cacheDir+name, used, used)
+	}
+	removed, err := Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "a" {
+		t.Fatalf("Expected the least recently used file to be evicted, got %v", removed)
+	}
+	if ok, _ := CheckCacheFile("deadletter/x"); !ok {
+		t.Fatal("Expected a kept file not to count, or be evicted")
+	}
+
+	// A file that's locked is being updated, the next least recently used goes instead
+	SetLimits(&Limits{MaxEntries: 1})
+	for _, name := range []string{"outbox/hello/state.json", "queue/hello/1", "shared/run/key"} {
+		WriteAtomic(name, []byte(name))
+	}
+	l, err := LockCacheFile("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock()
+	if removed, err = Evict(); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "c" {
+		t.Fatalf("Expected the locked file to be skipped, got %v", removed)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no file modes to speak of")
+	}
+	defer tempCache(t)()
+	SetPermissions(&Permissions{FileMode: 0640, DirMode: 0750})
+	defer SetPermissions(nil)
+	if err := WriteAtomic("shared/feed", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenCacheFile("shared/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for path, mode := range map[string]os.FileMode{
+		cacheDir + "shared/feed":  0640,
+		cacheDir + "shared/other": 0640,
+		cacheDir + "shared":       0750 | os.ModeDir,
+	} {
+		if fi, err := os.Stat(path); err != nil {
+			t.Error(err)
+		} else if fi.Mode() != mode {
+			t.Errorf("Expected %s to be %s, got %s", path, mode, fi.Mode())
+		}
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	defer tempCache(t)()
+	var loaded int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := GetOrLoad("profiles/1", time.Hour, func() ([]byte, error) {
+				mu.Lock()
+				loaded++
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				return []byte("profile"), nil
+			})
+			if err != nil || !bytes.Equal(data, []byte("profile")) {
+				t.Errorf("Expected the profile, got %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loaded != 1 {
+		t.Fatalf("Expected one load, got %d", loaded)
+	}
+	if _, ok, _ := Expires("profiles/1"); !ok {
+		t.Fatal("Expected the loaded entry to expire")
+	}
+}
+
+// foreverBackend is a backend that can't expire entries
+type foreverBackend struct {
+	Backend
+}
+
+func TestGetOrLoadWithoutTTLs(t *testing.T) {
+	SetBackend(foreverBackend{&MemoryBackend{}})
+	defer SetBackend(nil)
+	loaded := false
+	if _, err := GetOrLoad("profiles/1", time.Hour, func() ([]byte, error) {
+		loaded = true
+		return []byte("profile"), nil
+	}); err == nil {
+		t.Fatal("Expected a ttl to be refused by a backend that can't expire entries")
+	}
+	if loaded {
+		t.Fatal("Expected nothing to be loaded for a ttl that can't be kept")
+	}
+	if data, err := GetOrLoad("profiles/1", 0, func() ([]byte, error) { return []byte("profile"), nil }); err != nil || string(data) != "profile" {
+		t.Fatalf("Expected the profile to be loaded without a ttl, got %q, %v", data, err)
+	}
+}
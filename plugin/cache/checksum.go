@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// sumDir holds the SHA-256 of each cache file written by WriteAtomic or WriteWithTTL, under the file's name
+var sumDir = "/var/cache/.sum/"
+
+// ErrUnverified is returned by Verify for a cache file it has no checksum for, as it wasn't written by
+// WriteAtomic or WriteWithTTL, or was written through OpenCacheFile since
+var ErrUnverified = errors.New("cache: no checksum to verify the entry with")
+
+// CorruptError is returned by Verify for a cache file whose content doesn't match its checksum
+type CorruptError struct {
+	Name   string
+	Reason string
+}
+
+// Error implements the error interface
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("Cache file %s is corrupt: %s", e.Name, e.Reason)
+}
+
+var (
+	discardMu      sync.Mutex
+	discardCorrupt bool
+)
+
+// SetDiscardCorrupt has OpenCacheFile and FileBackend verify cache files before they're read, and remove
+// those that are corrupt, so they're opened empty or not found rather than failing in confusing ways
+// downstream. Verifying reads the whole file, so it's off by default.
+func SetDiscardCorrupt(discard bool) {
+	discardMu.Lock()
+	defer discardMu.Unlock()
+	discardCorrupt = discard
+}
+
+// Verify checks the named cache file against the checksum it was written with. It returns a *CorruptError
+// if the file was truncated or changed on disk since, ErrUnverified if there's no checksum for it, and an
+// error satisfying os.IsNotExist if there's no file.
+func Verify(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	name = stripLeftSlash(name)
+	f, err := os.Open(cacheDir + name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return verifySum(name, h.Sum(nil), fi)
+}
+
+// checksum is what's recorded of a cache file when it's written. The size and modification time tell a
+// file rewritten through OpenCacheFile, which the checksum no longer applies to, from a corrupt one.
+type checksum struct {
+	sum     string
+	size    int64
+	modTime int64
+}
+
+func (c checksum) String() string {
+	return fmt.Sprintf("%s %d %d", c.sum, c.size, c.modTime)
+}
+
+// writeSum records the checksum of the named cache file, just written with data. It's written after the
+// file, so a crash in between leaves a checksum that no longer applies rather than a wrong one.
+func writeSum(name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	return recordSum(name, sum[:])
+}
+
+// recordSum records sum, the SHA-256 of the named cache file, just written, as its checksum
+func recordSum(name string, sum []byte) error {
+	name = stripLeftSlash(name)
+	fi, err := os.Stat(cacheDir + name)
+	if err != nil {
+		return err
+	}
+	c := checksum{sum: hex.EncodeToString(sum), size: fi.Size(), modTime: fi.ModTime().UnixNano()}
+	return writeFileAtomic(sumDir+name, []byte(c.String()))
+}
+
+// readSum returns the checksum recorded for the named cache file, and false if there isn't one
+func readSum(name string) (checksum, bool, error) {
+	b, err := ioutil.ReadFile(sumDir + stripLeftSlash(name))
+	if os.IsNotExist(err) {
+		return checksum{}, false, nil
+	}
+	if err != nil {
+		return checksum{}, false, err
+	}
+	var c checksum
+	fields := strings.Fields(string(b))
+	if len(fields) != 3 {
+		return checksum{}, false, nil
+	}
+	c.sum = fields[0]
+	c.size, err = strconv.ParseInt(fields[1], 10, 64)
+	if err == nil {
+		c.modTime, err = strconv.ParseInt(fields[2], 10, 64)
+	}
+	if err != nil {
+		return checksum{}, false, nil
+	}
+	return c, true, nil
+}
+
+// verifySum checks sum, the SHA-256 of the named cache file with info fi, against its checksum
+func verifySum(name string, sum []byte, fi os.FileInfo) error {
+	c, ok, err := readSum(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUnverified
+	}
+	if fi.ModTime().UnixNano() != c.modTime {
+		// written since, and not by WriteAtomic or WriteWithTTL
+		return ErrUnverified
+	}
+	if fi.Size() != c.size {
+		return &CorruptError{Name: name, Reason: fmt.Sprintf("expected %d bytes, found %d", c.size, fi.Size())}
+	}
+	if hex.EncodeToString(sum) != c.sum {
+		return &CorruptError{Name: name, Reason: "its content doesn't match its checksum"}
+	}
+	return nil
+}
+
+// discardIfCorrupt removes the named cache file if it's corrupt and SetDiscardCorrupt is on. data is the
+// file's content, if it was read already.
+func discardIfCorrupt(name string, data []byte) (bool, error) {
+	discardMu.Lock()
+	discard := discardCorrupt
+	discardMu.Unlock()
+	if !discard {
+		return false, nil
+	}
+	var err error
+	if data == nil {
+		err = Verify(name)
+	} else if fi, statErr := os.Stat(cacheDir + stripLeftSlash(name)); statErr != nil {
+		err = statErr
+	} else {
+		sum := sha256.Sum256(data)
+		err = verifySum(stripLeftSlash(name), sum[:], fi)
+	}
+	corrupt, ok := err.(*CorruptError)
+	if !ok {
+		if err == ErrUnverified || os.IsNotExist(err) {
+			err = nil
+		}
+		return false, err
+	}
+	log.Warnf("Discarding corrupt cache file %s: %s", name, corrupt.Reason)
+	if err = os.Remove(cacheDir + stripLeftSlash(name)); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, removeSidecars(name)
+}
+
+// removeSum forgets the checksum of the named cache file
+func removeSum(name string) error {
+	if err := os.Remove(sumDir + stripLeftSlash(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeSidecars forgets what's kept alongside the named cache file, once it's removed
+func removeSidecars(name string) error {
+	if err := removeExpiry(name); err != nil {
+		return err
+	}
+	return removeSum(name)
+}
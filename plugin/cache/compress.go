@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// DefaultCompressMin is the size entries are compressed from, if a CompressedBackend doesn't say.
+// Smaller entries gain little, and gzip's header and footer alone are 18 bytes.
+const DefaultCompressMin = 1024
+
+// DefaultDecompressMax bounds the size an entry decompresses to, if a CompressedBackend doesn't say, so
+// a small corrupt or hostile entry can't decompress to fill the memory.
+const DefaultDecompressMax = 512 << 20
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressedBackend is a Backend that gzips entries before they're stored in the backend it wraps, for
+// plugins caching large API responses or threat intelligence feeds, which compress well. Compressed
+// entries are told apart by gzip's magic bytes when they're read, so entries written before compression
+// was turned on, or too small to compress, are read as they are. To encrypt entries too, have it wrap the
+// EncryptedBackend rather than the other way around, so entries are compressed before they're encrypted,
+// as encrypted entries don't compress:
+//
+//	cache.SetBackend(cache.CompressedBackend{Backend: cache.EncryptedBackend{Backend: cache.FileBackend{}}})
+type CompressedBackend struct {
+	Backend
+	MinSize int   // MinSize is the size entries are compressed from, DefaultCompressMin if 0
+	Level   int   // Level is the gzip compression level, gzip.DefaultCompression if 0
+	MaxSize int64 // MaxSize bounds the size an entry decompresses to, DefaultDecompressMax if 0
+}
+
+// Get implements Backend, decompressing the entry if it's compressed
+func (c CompressedBackend) Get(name string) ([]byte, error) {
+	data, err := c.Backend.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	max := c.MaxSize
+	if max <= 0 {
+		max = DefaultDecompressMax
+	}
+	return decompress(name, data, max)
+}
+
+// Put implements Backend, compressing data if it's large enough
+func (c CompressedBackend) Put(name string, data []byte) error {
+	compressed, err := c.compress(data)
+	if err != nil {
+		return err
+	}
+	return c.Backend.Put(name, compressed)
+}
+
+// PutTTL implements TTLBackend, if the backend it wraps does
+func (c CompressedBackend) PutTTL(name string, data []byte, ttl time.Duration) error {
+	t, ok := c.Backend.(TTLBackend)
+	if !ok {
+		return fmt.Errorf("The %T cache backend can't expire entries", c.Backend)
+	}
+	compressed, err := c.compress(data)
+	if err != nil {
+		return err
+	}
+	return t.PutTTL(name, compressed, ttl)
+}
+
+// compress returns data gzipped, or as is if it's too small. Data that starts like a gzip stream is
+// always compressed, so reading it back doesn't take off a layer it was written with.
+func (c CompressedBackend) compress(data []byte) ([]byte, error) {
+	min := c.MinSize
+	if min <= 0 {
+		min = DefaultCompressMin
+	}
+	if len(data) < min && !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns data gunzipped if it's compressed, or as is. It fails if data decompresses to more
+// than max bytes.
+func decompress(name string, data []byte, max int64) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid compressed cache entry %s: %s", name, err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid compressed cache entry %s: %s", name, err)
+	}
+	if int64(len(b)) > max {
+		return nil, fmt.Errorf("Compressed cache entry %s decompresses to more than %d bytes", name, max)
+	}
+	return b, nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCompressedBackendRoundTrip(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	c := CompressedBackend{Backend: wrapped}
+	feed := bytes.Repeat([]byte(`{"indicator":"198.51.100.7","type":"ip"},`), 100)
+	if err := c.Put("feeds/ips", feed); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := wrapped.Get("feeds/ips")
+	if !bytes.HasPrefix(stored, gzipMagic) || len(stored) >= len(feed) {
+		t.Fatalf("Expected the entry to be stored compressed, got %d bytes of %d", len(stored), len(feed))
+	}
+	data, err := c.Get("feeds/ips")
+	if err != nil || !bytes.Equal(data, feed) {
+		t.Fatalf("Expected the entry back as it was written, got %d bytes, %v", len(data), err)
+	}
+
+	if err = c.PutTTL("feeds/ttl", feed, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = c.Get("feeds/ttl"); err != nil || !bytes.Equal(data, feed) {
+		t.Fatalf("Expected the entry written with a ttl back as it was written, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestCompressedBackendMinSize(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	c := CompressedBackend{Backend: wrapped, MinSize: 64}
+	small := []byte("checkpoint 42")
+	c.Put("small", small)
+	if stored, _ := wrapped.Get("small"); !bytes.Equal(stored, small) {
+		t.Fatalf("Expected a small entry to be stored as it is, got %q", stored)
+	}
+
+	// small, but it would be mistaken for a compressed entry if it was stored as it is
+	magic := append(append([]byte{}, gzipMagic...), "not gzip"...)
+	c.Put("magic", magic)
+	if stored, _ := wrapped.Get("magic"); bytes.Equal(stored, magic) {
+		t.Fatal("Expected an entry that starts like gzip to be compressed")
+	}
+	if data, err := c.Get("magic"); err != nil || !bytes.Equal(data, magic) {
+		t.Fatalf("Expected the entry back as it was written, got %q, %v", data, err)
+	}
+}
+
+func TestCompressedBackendReadsLegacyEntries(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	legacy := bytes.Repeat([]byte("written before compression was on "), 100)
+	wrapped.Put("legacy", legacy)
+	data, err := CompressedBackend{Backend: wrapped}.Get("legacy")
+	if err != nil || !bytes.Equal(data, legacy) {
+		t.Fatalf("Expected an uncompressed entry to be read as it is, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestCompressedBackendMaxSize(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	c := CompressedBackend{Backend: wrapped}
+	if err := c.Put("zeros", make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	c.MaxSize = 1 << 19
+	if _, err := c.Get("zeros"); err == nil {
+		t.Fatal("Expected an entry that decompresses to more than MaxSize to be refused")
+	}
+	c.MaxSize = 1 << 20
+	if data, err := c.Get("zeros"); err != nil || len(data) != 1<<20 {
+		t.Fatalf("Expected an entry of exactly MaxSize to be read, got %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Increment adds delta to the counter kept in the named cache file, and returns its new value, so a count
+// like the requests made to a rate limited API survives restarts and is shared by every process. A missing
+// file is a counter at 0, and an Increment of 0 reads it. The file is held with its lock while it's updated,
+// see LockCacheFile, so don't call it holding the lock. The counter is kept as decimal text, and keeps the
+// expiry it was written with, so one written by WriteWithTTL(name, []byte("0"), time.Hour) counts for an
+// hour. The name argument follows the same rules as OpenCacheFile.
+func Increment(name string, delta int64) (int64, error) {
+	if err := validateName(name); err != nil {
+		return 0, err
+	}
+	name = stripLeftSlash(name)
+	lease, err := AcquireLease(context.Background(), name, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer lease.Release()
+
+	if err = removeIfExpired(name); err != nil {
+		return 0, err
+	}
+	var n int64
+	b, err := ioutil.ReadFile(cacheDir + name)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if s := strings.TrimSpace(string(b)); s != "" {
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, fmt.Errorf("Cache file %s isn't a counter: %s", name, err)
+		}
+	}
+	if delta == 0 {
+		return n, nil
+	}
+	n += delta
+	data := []byte(strconv.FormatInt(n, 10))
+	if err = writeFileAtomic(cacheDir+name, data); err != nil {
+		return 0, err
+	}
+	if err = writeSum(name, data); err != nil {
+		return 0, err
+	}
+	used(name)
+	return n, nil
+}
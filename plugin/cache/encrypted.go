@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+)
+
+// Environment variables the cache's encryption key is read from, if SetEncryptionKeys isn't called.
+// Without them, the key in PLUGIN_ENCRYPTION_KEY that seals events is used.
+const (
+	KeyEnv   = "PLUGIN_CACHE_KEY"    // KeyEnv holds the 32 byte key, base64 encoded
+	KeyIDEnv = "PLUGIN_CACHE_KEY_ID" // KeyIDEnv optionally names the key, defaulting to a digest of it
+)
+
+var (
+	encryptionMu   sync.Mutex
+	encryptionKeys sealed.Keys
+)
+
+// SetEncryptionKeys sets the keys WriteEncrypted and OpenEncrypted use, ie: a sealed.KMS so the key
+// never touches the disk. nil goes back to the key in the environment.
+func SetEncryptionKeys(keys sealed.Keys) {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	encryptionKeys = keys
+}
+
+// currentKeys returns the keys set with SetEncryptionKeys, or those in the environment
+func currentKeys() (sealed.Keys, error) {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	if encryptionKeys != nil {
+		return encryptionKeys, nil
+	}
+	keys, err := sealed.EnvKeysFrom(KeyEnv, KeyIDEnv)
+	if err == sealed.ErrNoKey {
+		keys, err = sealed.EnvKeys()
+	}
+	if err == sealed.ErrNoKey {
+		return nil, fmt.Errorf("No key to encrypt the cache with, set %s or call SetEncryptionKeys", KeyEnv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	encryptionKeys = keys
+	return keys, nil
+}
+
+// WriteEncrypted replaces the named cache file with data encrypted with AES-256-GCM, for what shouldn't
+// sit on the disk in the clear, like OAuth tokens and session cookies. Like WriteAtomic, it's never seen
+// half written. The name argument follows the same rules as OpenCacheFile.
+func WriteEncrypted(name string, data []byte) error {
+	return EncryptedBackend{Backend: FileBackend{}}.Put(name, data)
+}
+
+// OpenEncrypted returns the decrypted content of a cache file written by WriteEncrypted, or ErrNotFound
+// if there isn't one. It fails if the file was written with a key it doesn't have, or was tampered with.
+func OpenEncrypted(name string) ([]byte, error) {
+	return EncryptedBackend{Backend: FileBackend{}}.Get(name)
+}
+
+// EncryptedBackend is a Backend that encrypts entries before they're stored in the backend it wraps. The
+// entry's name is sealed with its data, so an entry copied over another is refused rather than read.
+// Keys defaults to the cache's keys, see SetEncryptionKeys.
+type EncryptedBackend struct {
+	Backend
+	Keys sealed.Keys
+}
+
+// encryptedEntry is what's sealed into an entry's envelope
+type encryptedEntry struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// Get implements Backend
+func (e EncryptedBackend) Get(name string) ([]byte, error) {
+	b, err := e.Backend.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := e.keys()
+	if err != nil {
+		return nil, err
+	}
+	var envelope sealed.Envelope
+	if err = json.Unmarshal(b, &envelope); err != nil {
+		return nil, fmt.Errorf("Cache entry %s isn't encrypted: %s", name, err)
+	}
+	opened, err := sealed.Open(keys, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	var entry encryptedEntry
+	if err = json.Unmarshal(opened, &entry); err != nil {
+		return nil, err
+	}
+	if entry.Name != stripLeftSlash(name) {
+		return nil, fmt.Errorf("Cache entry %s was encrypted as %s", name, entry.Name)
+	}
+	return entry.Data, nil
+}
+
+// Put implements Backend
+func (e EncryptedBackend) Put(name string, data []byte) error {
+	keys, err := e.keys()
+	if err != nil {
+		return err
+	}
+	b, err := sealed.SealBody(keys, encryptedEntry{Name: stripLeftSlash(name), Data: data})
+	if err != nil {
+		return err
+	}
+	return e.Backend.Put(name, b)
+}
+
+func (e EncryptedBackend) keys() (sealed.Keys, error) {
+	if e.Keys != nil {
+		return e.Keys, nil
+	}
+	return currentKeys()
+}
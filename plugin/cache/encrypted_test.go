@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+)
+
+func testKeys(id string, b byte) *sealed.StaticKeys {
+	return &sealed.StaticKeys{ID: id, Keys: map[string][]byte{id: bytes.Repeat([]byte{b}, 32)}}
+}
+
+func TestEncryptedBackendRoundTrip(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	e := EncryptedBackend{Backend: wrapped, Keys: testKeys("k1", 1)}
+	if err := e.Put("/tokens/oauth", []byte("s3cr3t")); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := wrapped.Get("tokens/oauth")
+	if bytes.Contains(stored, []byte("s3cr3t")) || bytes.Contains(stored, []byte("czNjcjN0")) {
+		t.Fatalf("Expected the entry to be stored encrypted, got %s", stored)
+	}
+	data, err := e.Get("tokens/oauth")
+	if err != nil || string(data) != "s3cr3t" {
+		t.Fatalf("Expected the entry back as it was written, got %q, %v", data, err)
+	}
+}
+
+func TestEncryptedBackendWithTheWrongKey(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	if err := (EncryptedBackend{Backend: wrapped, Keys: testKeys("k1", 1)}).Put("token", []byte("s3cr3t")); err != nil {
+		t.Fatal(err)
+	}
+	for _, keys := range []*sealed.StaticKeys{testKeys("k1", 2), testKeys("k2", 1)} {
+		if data, err := (EncryptedBackend{Backend: wrapped, Keys: keys}).Get("token"); err == nil {
+			t.Errorf("Expected the entry not to open with key %s, got %q", keys.ID, data)
+		}
+	}
+}
+
+func TestEncryptedBackendRefusesTamperedEntries(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	e := EncryptedBackend{Backend: wrapped, Keys: testKeys("k1", 1)}
+	e.Put("token", []byte("s3cr3t"))
+	stored, _ := wrapped.Get("token")
+	var envelope sealed.Envelope
+	if err := json.Unmarshal(stored, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	envelope.Data[0] ^= 1
+	tampered, _ := json.Marshal(&envelope)
+	wrapped.Put("token", tampered)
+	if data, err := e.Get("token"); err == nil {
+		t.Fatalf("Expected a tampered entry to be refused, got %q", data)
+	}
+
+	wrapped.Put("plain", []byte("s3cr3t"))
+	if data, err := e.Get("plain"); err == nil {
+		t.Fatalf("Expected an entry that isn't encrypted to be refused, got %q", data)
+	}
+}
+
+func TestEncryptedBackendRefusesEntriesCopiedUnderAnotherName(t *testing.T) {
+	wrapped := &MemoryBackend{}
+	e := EncryptedBackend{Backend: wrapped, Keys: testKeys("k1", 1)}
+	e.Put("tenants/a/token", []byte("a's token"))
+	stored, _ := wrapped.Get("tenants/a/token")
+	wrapped.Put("tenants/b/token", stored)
+	if data, err := e.Get("tenants/b/token"); err == nil || !strings.Contains(err.Error(), "encrypted as tenants/a/token") {
+		t.Fatalf("Expected an entry copied under another name to be refused, got %q, %v", data, err)
+	}
+}
+
+func TestWriteEncrypted(t *testing.T) {
+	defer tempCache(t)()
+	SetEncryptionKeys(testKeys("k1", 1))
+	defer SetEncryptionKeys(nil)
+	if err := WriteEncrypted("session", []byte("cookie")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ReadBytes("session"); bytes.Contains(b, []byte("cookie")) {
+		t.Fatal("Expected the file to be encrypted")
+	}
+	data, err := OpenEncrypted("session")
+	if err != nil || string(data) != "cookie" {
+		t.Fatalf("Expected the file back as it was written, got %q, %v", data, err)
+	}
+	if _, err = OpenEncrypted("missing"); err != ErrNotFound {
+		t.Fatalf("Expected a missing file not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// evictInterval is the least time between evictions run by writes, as each walks the whole cache
+const evictInterval = 5 * time.Second
+
+// DefaultKeep are the directories the SDK keeps state in that mustn't be evicted: dead letters, metrics,
+// budgets, outboxes and disk queues, workflow runs' shared state, backfill progress and circuit breakers
+var DefaultKeep = []string{"deadletter/", "health/", "budget/", "outbox/", "queue/", "shared/", "backfill/", "breaker/"}
+
+// Limits cap the size of /var/cache. Once a write takes the cache over a limit, the least recently used
+// files are removed until it's back under. A limit of 0 is no limit.
+type Limits struct {
+	MaxBytes   int64
+	MaxEntries int
+	// Keep are the prefixes of names never evicted, ie: checkpoints. It defaults to DefaultKeep, list
+	// those too when setting it.
+	Keep []string
+}
+
+var (
+	limitsMu  sync.Mutex
+	limits    *Limits
+	lastEvict time.Time
+)
+
+// SetLimits caps the size of the cache, for long running plugins that cache something per event and
+// would otherwise fill the disk. Files are used when they're opened, read through FileBackend, or
+// written, so the least recently used go first. Every file under /var/cache counts and may be evicted
+// bar those under Limits.Keep, as the cache volume is the plugin's own. Pass nil to lift the limits.
+func SetLimits(l *Limits) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	if l != nil && l.Keep == nil {
+		withDefaults := *l
+		withDefaults.Keep = DefaultKeep
+		l = &withDefaults
+	}
+	limits = l
+}
+
+// Evict removes the least recently used cache files until the cache is within the limits set with
+// SetLimits, returning the names of those it removed. A file is removed holding its lock, see LockCacheFile,
+// and one whose lock is held is skipped, as its holder may be part way through updating it.
+func Evict() ([]string, error) {
+	limitsMu.Lock()
+	l := limits
+	lastEvict = time.Now()
+	limitsMu.Unlock()
+	if l == nil {
+		return nil, nil
+	}
+
+	var entries byUse
+	var total int64
+	err := filepath.Walk(cacheDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name := strings.TrimPrefix(path, cacheDir)
+		if fi.IsDir() {
+			if path+"/" == lockDir || path+"/" == ttlDir || path+"/" == sumDir || keep(l, name+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || strings.Contains(name, tempInfix) || keep(l, name) {
+			return nil
+		}
+		e := entry{name: name, size: fi.Size(), used: fi.ModTime()}
+		if _, accessed := fileTimes(fi); accessed.After(e.used) {
+			e.used = accessed
+		}
+		entries = append(entries, e)
+		total += e.size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(entries)
+	var removed []string
+	for _, e := range entries {
+		over := (l.MaxBytes > 0 && total > l.MaxBytes) || (l.MaxEntries > 0 && len(entries)-len(removed) > l.MaxEntries)
+		if !over {
+			break
+		}
+		ok, err := evict(e.name)
+		if err != nil {
+			return removed, err
+		}
+		if !ok {
+			continue
+		}
+		removed = append(removed, e.name)
+		total -= e.size
+	}
+	return removed, nil
+}
+
+// evict removes the named file, unless its lock is held
+func evict(name string) (bool, error) {
+	lease, ok, err := TryLease(name, 0)
+	if !ok {
+		return false, err
+	}
+	defer lease.Release()
+	if err = os.Remove(cacheDir + name); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, removeSidecars(name)
+}
+
+// entry is a cache file that may be evicted
+type entry struct {
+	name string
+	size int64
+	used time.Time
+}
+
+// byUse sorts entries least recently used first
+type byUse []entry
+
+func (b byUse) Len() int           { return len(b) }
+func (b byUse) Less(i, j int) bool { return b[i].used.Before(b[j].used) }
+func (b byUse) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// keep checks name is under one of the prefixes never evicted
+func keep(l *Limits, name string) bool {
+	for _, prefix := range l.Keep {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// used marks the named file as just used and evicts if it's time to, when limits are set
+func used(name string) {
+	limitsMu.Lock()
+	due := limits != nil && time.Since(lastEvict) >= evictInterval
+	set := limits != nil
+	limitsMu.Unlock()
+	if !set {
+		return
+	}
+	// reads don't reliably update the access time, relatime only does once a day. The modification time
+	// is left, as checksums are only trusted for files it hasn't changed for.
+	path := cacheDir + stripLeftSlash(name)
+	if fi, err := os.Stat(path); err == nil {
+		os.Chtimes(path, time.Now(), fi.ModTime())
+	}
+	if !due {
+		return
+	}
+	removed, err := Evict()
+	if err != nil {
+		log.Errorf("Unable to evict from the cache: %s", err)
+	} else if len(removed) > 0 {
+		log.Infof("Evicted %d least recently used cache files: %s", len(removed), strings.Join(removed, ", "))
+	}
+}
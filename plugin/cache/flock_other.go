@@ -0,0 +1,72 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package cache
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// heldSuffix is added to a lock file's name for the marker that it's held, created exclusively. Unlike an
+// advisory lock, a marker outlives a holder that crashed, and has to be removed by hand.
+const heldSuffix = ".held"
+
+// lockFile opens the lock file and waits until it holds it, polling as SetLockBackoff says, until ctx is done
+func lockFile(ctx context.Context, path string, shared bool) (*os.File, error) {
+	wait := newLockWait(fileLockBackoff)
+	for {
+		f, ok, err := tryLockFile(path, shared)
+		if ok || err != nil {
+			return f, err
+		}
+		// the holder may have crashed while it was waited for, leaving its marker behind
+		if _, err = breakExpired(path); err != nil {
+			return nil, err
+		}
+		if err = wait.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryLockFile opens the lock file and creates its held marker, or returns false if it's held. A marker
+// can't be shared, so neither can the lock.
+func tryLockFile(path string, shared bool) (*os.File, bool, error) {
+	marker, err := openExclusiveFile(path + heldSuffix)
+	if os.IsExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	marker.Close()
+	f, err := openLockFile(path)
+	if err != nil {
+		os.Remove(path + heldSuffix)
+		return nil, false, err
+	}
+	return f, true, nil
+}
+
+// unlockFile closes the lock file and removes its held marker
+func unlockFile(f *os.File) error {
+	err := os.Remove(f.Name() + heldSuffix)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// breakLock removes the held marker of a lock, if neither were written since cutoff. Whether the holder is
+// still running isn't known here, so its age alone says it crashed.
+func breakLock(path string, cutoff time.Time) (bool, error) {
+	for _, p := range []string{path + heldSuffix, path} {
+		fi, err := os.Stat(p)
+		if err != nil || fi.ModTime().After(cutoff) {
+			return false, ignoreNotExist(err)
+		}
+	}
+	return true, ignoreNotExist(os.Remove(path + heldSuffix))
+}
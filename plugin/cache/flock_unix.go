@@ -0,0 +1,134 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package cache
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// heldSuffix is only used where there are no advisory locks, see flock_other.go
+const heldSuffix = ".held"
+
+// lockFile opens the lock file and waits for an exclusive lock on it, or a shared one, until ctx is done.
+// Without a ctx that can be done, it's waited for blocked in the kernel. A waiting flock can't be
+// interrupted though, and one left behind when ctx is done would hold a thread and a descriptor until the
+// lock is let go of, which a stuck holder never does, so a wait that can be given up on polls instead, as
+// does every wait once SetLockBackoff sets how.
+func lockFile(ctx context.Context, path string, shared bool) (*os.File, error) {
+	if ctx.Done() == nil && !lockBackoffSet() {
+		return lockCurrent(path, lockHow(shared))
+	}
+	wait := newLockWait(fileLockBackoff)
+	for {
+		f, ok, err := tryLockFile(path, shared)
+		if ok || err != nil {
+			return f, err
+		}
+		if err = wait.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lockCurrent opens the lock file and waits for a lock on it, then again on the new file if it was
+// replaced while it was waited for
+func lockCurrent(path string, how int) (*os.File, error) {
+	for {
+		f, err := openLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = flock(f, how); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current(f, path) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// tryLockFile opens the lock file and takes an exclusive lock on it, or a shared one, or returns false if
+// it's held exclusively, or at all for an exclusive lock
+func tryLockFile(path string, shared bool) (*os.File, bool, error) {
+	for {
+		f, err := openLockFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+		if err = flock(f, lockHow(shared)|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		if current(f, path) {
+			return f, true, nil
+		}
+		f.Close()
+	}
+}
+
+// current returns whether f, just locked, is still the lock file at path. Breaking a lock removes its
+// file, and whoever opens the path next creates and locks a new one, while a waiter that opened the old
+// file before it was removed still gets its lock once it's let go of. That lock is no lock at all.
+func current(f *os.File, path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	held, err := f.Stat()
+	return err == nil && os.SameFile(fi, held)
+}
+
+// unlockFile lets go of the lock, closing the file would too but an explicit unlock says what's meant
+func unlockFile(f *os.File) error {
+	err := flock(f, syscall.LOCK_UN)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func lockHow(shared bool) int {
+	if shared {
+		return syscall.LOCK_SH
+	}
+	return syscall.LOCK_EX
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// breakLock breaks a held lock that was last written before cutoff, by a process that's gone. A flock is
+// let go of when its holder exits, so one held after that is held through a descriptor a child inherited.
+// Removing the file breaks it, whoever locks it next creates a new one.
+func breakLock(path string, cutoff time.Time) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.ModTime().After(cutoff) {
+		return false, ignoreNotExist(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, ignoreNotExist(err)
+	}
+	info, ok := readLockInfo(f)
+	f.Close()
+	// PIDs are reused, so a running one is taken as the holder rather than breaking a lock it holds
+	if !ok || info.PID == os.Getpid() || syscall.Kill(info.PID, 0) != syscall.ESRCH {
+		return false, nil
+	}
+	return true, ignoreNotExist(os.Remove(path))
+}
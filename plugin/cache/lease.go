@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ErrLockLost is returned when renewing or releasing a lease that no longer holds its lock
+var ErrLockLost = errors.New("cache: lock was lost, it expired and was taken by another holder")
+
+// lockInfo is written into every lock file by its holder, so the next holder knows whether the last one
+// is still throttling it, and whoever looks at a lock file can see who holds it.
+type lockInfo struct {
+	ID        string    `json:"id"`
+	PID       int       `json:"pid"`
+	Acquired  time.Time `json:"acquired"`
+	HoldUntil time.Time `json:"hold_until"`
+	Expires   time.Time `json:"expires,omitempty"` // Expires is when the holder last said it would be done by
+	Released  bool      `json:"released,omitempty"`
+}
+
+// LockLease is a held lock on a cache file, see AcquireLease
+type LockLease struct {
+	Name string // Name of the locked file, relative to /var/cache
+
+	mu       sync.Mutex
+	path     string
+	info     lockInfo
+	f        *os.File
+	shared   bool // shared leases don't write the lock file, it's their exclusive holders'
+	released bool
+}
+
+// AcquireLease waits for the lock on the provided file from /var/cache/lock/*, until ctx is done.
+// The lock is an advisory lock on the lock file, let go of when its holder exits, however it exits. It's
+// waited for in the kernel, or polled for if ctx can be done, see SetLockBackoff.
+//
+// minHold is the minimum time the lock is held for, even if the lease is released earlier. It replaces
+// the sleep in UnlockCacheFile as a way to rate limit other processes: Release returns straight away
+// and the remainder of the hold is enforced by the next holder reading it out of the lock file, so the
+// caller doesn't have to block its own goroutine to throttle everyone else.
+//
+// A lock renewed with a TTL expires once it's not renewed in time, and a waiter finding it held past its
+// expiry by a holder that's gone breaks it, see LockCacheFileTTL.
+func AcquireLease(ctx context.Context, name string, minHold time.Duration) (*LockLease, error) {
+	if err := validatePath(name); err != nil {
+		return nil, err
+	}
+	defer observeLockWait(name, time.Now())
+	l := newLease(name, minHold)
+	if _, err := breakExpired(l.path); err != nil {
+		return nil, err
+	}
+	f, err := lockFile(ctx, l.path, false)
+	if err != nil {
+		return nil, err
+	}
+	// The last holder may have released early, but asked for everyone to wait out its hold
+	if last, ok := readLockInfo(f); ok {
+		if err = utils.SleepCtx(ctx, last.HoldUntil.Sub(time.Now())); err != nil {
+			unlockFile(f)
+			return nil, err
+		}
+	}
+	if err = l.take(f); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// TryLease is AcquireLease without the waiting, it returns false if the lock is already held, or the
+// last holder's hold hasn't passed
+func TryLease(name string, minHold time.Duration) (*LockLease, bool, error) {
+	if err := validatePath(name); err != nil {
+		return nil, false, err
+	}
+	l := newLease(name, minHold)
+	if _, err := breakExpired(l.path); err != nil {
+		return nil, false, err
+	}
+	f, ok, err := tryLockFile(l.path, false)
+	if !ok {
+		return nil, false, err
+	}
+	if last, ok := readLockInfo(f); ok && time.Now().Before(last.HoldUntil) {
+		unlockFile(f)
+		return nil, false, nil
+	}
+	if err = l.take(f); err != nil {
+		return nil, false, err
+	}
+	return l, true, nil
+}
+
+// AcquireSharedLease is AcquireLease for a shared lock, the cache's equivalent of sync.RWMutex.RLock. Any
+// number of shared leases on a file are held at once, by goroutines of any process, while an exclusive lease
+// waits for all of them to be released, and they wait for it. Readers of a cached feed take shared leases,
+// and its writer an exclusive one.
+//
+// A shared lease doesn't wait out the minimum hold of the last exclusive one, which rate limits writers, and
+// has none of its own. The kernel doesn't favour waiting writers, so readers that never let go of a file
+// starve them. Where there are no advisory locks, ie: on Windows, a shared lease is exclusive.
+func AcquireSharedLease(ctx context.Context, name string) (*LockLease, error) {
+	if err := validatePath(name); err != nil {
+		return nil, err
+	}
+	defer observeLockWait(name, time.Now())
+	l := newLease(name, 0)
+	if _, err := breakExpired(l.path); err != nil {
+		return nil, err
+	}
+	f, err := lockFile(ctx, l.path, true)
+	if err != nil {
+		return nil, err
+	}
+	return l, l.takeShared(f)
+}
+
+// TrySharedLease is AcquireSharedLease without the waiting, it returns false if the lock is held exclusively
+func TrySharedLease(name string) (*LockLease, bool, error) {
+	if err := validatePath(name); err != nil {
+		return nil, false, err
+	}
+	l := newLease(name, 0)
+	if _, err := breakExpired(l.path); err != nil {
+		return nil, false, err
+	}
+	f, ok, err := tryLockFile(l.path, true)
+	if !ok {
+		return nil, false, err
+	}
+	if err = l.takeShared(f); err != nil {
+		return nil, false, err
+	}
+	return l, true, nil
+}
+
+func newLease(name string, minHold time.Duration) *LockLease {
+	now := time.Now()
+	return &LockLease{
+		Name: stripLeftSlash(name),
+		path: lockDir + stripLeftSlash(name),
+		info: lockInfo{
+			ID:        utils.UniqueID(),
+			PID:       os.Getpid(),
+			Acquired:  now,
+			HoldUntil: now.Add(minHold),
+		},
+	}
+}
+
+// take records the lease in the lock file it locked
+func (l *LockLease) take(f *os.File) error {
+	if err := writeLockInfo(f, l.info); err != nil {
+		unlockFile(f)
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+// takeShared holds the shared lock on f. The lock file's modification time is what ReapStaleLocks goes by
+// when its last writer is gone, so it's touched to keep the lock from being broken under its readers.
+func (l *LockLease) takeShared(f *os.File) error {
+	if err := touch(l.path); err != nil {
+		unlockFile(f)
+		return err
+	}
+	l.shared = true
+	l.f = f
+	return nil
+}
+
+func touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// Shared returns whether the lease is on a shared lock, see AcquireSharedLease
+func (l *LockLease) Shared() bool {
+	return l.shared
+}
+
+// HoldUntil returns the time the lock is held until, regardless of when it's released
+func (l *LockLease) HoldUntil() time.Time {
+	return l.info.HoldUntil
+}
+
+// Renew records that the lease is expected to be done ttl from now. Past that the lock has expired, and
+// is broken by whoever waits for it next if its holder has exited, or on Windows if it was left behind.
+// Renew returns ErrLockLost once the lease was released, or its lock broken.
+func (l *LockLease) Renew(ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released || l.broken() {
+		return ErrLockLost
+	}
+	info := l.info
+	info.Expires = time.Now().Add(ttl)
+	var err error
+	if l.shared {
+		err = touch(l.path)
+	} else {
+		err = writeLockInfo(l.f, info)
+	}
+	if err != nil {
+		return err
+	}
+	l.info = info
+	return nil
+}
+
+// Check returns ErrLockLost if the lock is no longer held by this lease, as it was released or broken.
+// Long critical sections can call it before committing their work.
+func (l *LockLease) Check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released || l.broken() {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// broken returns whether the lease's lock was broken, its lock file removed or taken over by another holder
+func (l *LockLease) broken() bool {
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	held, err := l.f.Stat()
+	if err != nil || !os.SameFile(fi, held) {
+		return true
+	}
+	if l.shared {
+		return false
+	}
+	info, ok := readLockInfo(l.f)
+	return ok && info.ID != l.info.ID
+}
+
+// breakExpired breaks the lock at path if it's held past the expiry its holder last renewed it with. The
+// expiry is the cutoff breakLock goes by, so a holder that's still there, or took the lock since, keeps it.
+func breakExpired(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, ignoreNotExist(err)
+	}
+	info, ok := readLockInfo(f)
+	f.Close()
+	if !ok || info.Released || info.Expires.IsZero() || time.Now().Before(info.Expires) {
+		return false, nil
+	}
+	// nobody holds it, the kernel let go of it when its holder exited
+	if f, ok, err := tryLockFile(path, false); err != nil || ok {
+		if ok {
+			err = unlockFile(f)
+		}
+		return false, err
+	}
+	broken, err := breakLock(path, info.Expires)
+	if broken {
+		log.Warnf("Broke cache lock %s, it expired at %s", strings.TrimPrefix(path, lockDir), info.Expires)
+	}
+	return broken, err
+}
+
+// minRenewInterval is the least time between KeepAlive's renewals, however short the ttl
+const minRenewInterval = time.Millisecond
+
+// KeepAlive renews the lease every third of ttl until the returned function is called or ctx is done,
+// for operations that outlive a single ttl. If the lock is lost anyway, because a renewal failed until
+// the lease expired or the lock was broken, onLost is called once with the reason and renewal stops. A
+// lease that's never renewed never expires, so with a ttl that isn't positive there's nothing to renew.
+func (l *LockLease) KeepAlive(ctx context.Context, ttl time.Duration, onLost func(error)) (stop func()) {
+	if ttl <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if err := l.Renew(ttl); err == ErrLockLost {
+		cancel()
+		onLost(err)
+		return cancel
+	}
+	go func() {
+		interval := ttl / 3
+		if interval < minRenewInterval {
+			interval = minRenewInterval
+		}
+		ticker := utils.NewTicker(ctx, interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := l.Renew(ttl)
+			if err == nil {
+				continue
+			}
+			l.mu.Lock()
+			expired := !time.Now().Before(l.info.Expires)
+			l.mu.Unlock()
+			// Other errors are retried on the next tick, unless we've run out of time
+			if err == ErrLockLost || expired {
+				onLost(err)
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// Release gives up the lease. If the minimum hold hasn't passed yet, the lock file is marked released
+// with the hold, for the next holder to wait out. Releasing twice is a no-op, releasing a lease whose lock
+// was broken returns ErrLockLost.
+func (l *LockLease) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return nil
+	}
+	l.released = true
+	if l.broken() {
+		// the lock file, or its marker, is someone else's now
+		l.f.Close()
+		return ErrLockLost
+	}
+	if l.shared {
+		return unlockFile(l.f)
+	}
+	info := l.info
+	info.Released = true
+	err := writeLockInfo(l.f, info)
+	if unlockErr := unlockFile(l.f); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// extendHold holds the lock until at least holdUntil, once it's released
+func (l *LockLease) extendHold(holdUntil time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holdUntil.After(l.info.HoldUntil) {
+		l.info.HoldUntil = holdUntil
+	}
+}
+
+// readLockInfo returns what the last holder wrote in a lock file, and false if it's empty or unreadable,
+// as the lock files of older SDKs are
+func readLockInfo(f *os.File) (lockInfo, bool) {
+	var info lockInfo
+	stat, err := f.Stat()
+	if err != nil || stat.Size() == 0 {
+		return info, false
+	}
+	b := make([]byte, stat.Size())
+	if _, err = f.ReadAt(b, 0); err != nil || json.Unmarshal(b, &info) != nil {
+		return info, false
+	}
+	return info, true
+}
+
+// writeLockInfo replaces the contents of a locked lock file. Only its holder reads or writes it.
+func writeLockInfo(f *os.File, info lockInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(b, 0)
+	return err
+}
+
+// openLockFile opens a lock file, creating it if it's new. Lock files are left in place once created,
+// the lock is on the file, not its existence.
+func openLockFile(path string) (*os.File, error) {
+	return openFile(path)
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess isn't a test, it's another process taking a lock for the tests, see lockInProcess
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("CACHE_HELPER_ROOT") == "" {
+		return
+	}
+	SetRoot(os.Getenv("CACHE_HELPER_ROOT"))
+	name := os.Getenv("CACHE_HELPER_LOCK")
+	var l *LockLease
+	var err error
+	switch os.Getenv("CACHE_HELPER_MODE") {
+	case "shared":
+		l, err = AcquireSharedLease(context.Background(), name)
+	default:
+		l, err = AcquireLease(context.Background(), name, 0)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if os.Getenv("CACHE_HELPER_MODE") == "crash" {
+		// renewed to expire soon, then gone without releasing it
+		l.Renew(10 * time.Millisecond)
+		fmt.Println("locked")
+		os.Exit(0)
+	}
+	fmt.Println("locked")
+	ioutil.ReadAll(os.Stdin)
+	l.Release()
+	os.Exit(0)
+}
+
+// lockInProcess has another process take the named lock, with mode "exclusive", "shared", or "crash" to
+// exit holding it, and returns once it holds it. The returned function has it release the lock and exit.
+func lockInProcess(t *testing.T, name, mode string) (release func()) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "CACHE_HELPER_ROOT="+cacheDir, "CACHE_HELPER_LOCK="+name, "CACHE_HELPER_MODE="+mode)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if strings.TrimSpace(line) != "locked" {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("Expected the other process to take the lock, got %q, %v", line, err)
+	}
+	go io.Copy(ioutil.Discard, stdout)
+	return func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+}
+
+func TestLeaseExcludes(t *testing.T) {
+	defer tempCache(t)()
+	l, err := AcquireLease(context.Background(), "token", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := TryLease("token", 0); ok || err != nil {
+		t.Fatalf("Expected a held lock not to be taken, got %v, %v", ok, err)
+	}
+	if err = l.Check(); err != nil {
+		t.Fatalf("Expected the lease to hold its lock, got %v", err)
+	}
+	if err = l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Check(); err != ErrLockLost {
+		t.Fatalf("Expected a released lease not to hold its lock, got %v", err)
+	}
+	other, ok, err := TryLease("token", 0)
+	if !ok || err != nil {
+		t.Fatalf("Expected a released lock to be taken, got %v, %v", ok, err)
+	}
+	other.Release()
+}
+
+func TestLeaseExcludesOtherProcesses(t *testing.T) {
+	defer tempCache(t)()
+	release := lockInProcess(t, "token", "exclusive")
+	if _, ok, err := TryLease("token", 0); ok || err != nil {
+		t.Fatalf("Expected a lock held by another process not to be taken, got %v, %v", ok, err)
+	}
+	got := make(chan error, 1)
+	go func() {
+		l, err := AcquireLease(context.Background(), "token", 0)
+		if err == nil {
+			err = l.Release()
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Fatalf("Expected to wait for the other process, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the lock once the other process released it")
+	}
+}
+
+func TestLockLetGoOfWhenHolderExits(t *testing.T) {
+	defer tempCache(t)()
+	lockInProcess(t, "token", "crash")()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := AcquireLease(ctx, "token", 0)
+	if err != nil {
+		t.Fatalf("Expected the lock of a holder that exited, got %v", err)
+	}
+	l.Release()
+}
+
+func TestSharedLeases(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("Shared locks are exclusive without advisory locks")
+	}
+	defer tempCache(t)()
+	release := lockInProcess(t, "feed", "shared")
+	r, ok, err := TrySharedLease("feed")
+	if !ok || err != nil {
+		t.Fatalf("Expected a shared lock to be shared, got %v, %v", ok, err)
+	}
+	if _, ok, _ = TryLease("feed", 0); ok {
+		t.Fatal("Expected a lock held shared not to be taken exclusively")
+	}
+	r.Release()
+	if _, ok, _ = TryLease("feed", 0); ok {
+		t.Fatal("Expected a lock held shared by another process not to be taken exclusively")
+	}
+	release()
+	w, ok, err := TryLease("feed", 0)
+	if !ok || err != nil {
+		t.Fatalf("Expected the lock once every reader released it, got %v, %v", ok, err)
+	}
+	if _, ok, _ = TrySharedLease("feed"); ok {
+		t.Fatal("Expected a lock held exclusively not to be shared")
+	}
+	w.Release()
+}
+
+func TestMinHold(t *testing.T) {
+	defer tempCache(t)()
+	l, err := AcquireLease(context.Background(), "api", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+	if _, ok, _ := TryLease("api", 0); ok {
+		t.Fatal("Expected the lock to be held out its minimum hold")
+	}
+	start := time.Now()
+	if l, err = AcquireLease(context.Background(), "api", 0); err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+	if waited := time.Since(start); waited < 30*time.Millisecond {
+		t.Fatalf("Expected to wait out the hold, waited %s", waited)
+	}
+}
+
+func TestLockCacheFileContextTimesOut(t *testing.T) {
+	defer tempCache(t)()
+	held, err := LockCacheFile("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = LockCacheFileContext(ctx, "token"); err != ErrLockTimeout {
+		t.Fatalf("Expected ErrLockTimeout, got %v", err)
+	}
+}
+
+func TestLockCacheFileTTL(t *testing.T) {
+	defer tempCache(t)()
+	if _, err := LockCacheFileTTL(context.Background(), "token", 0); err == nil {
+		t.Fatal("Expected a lock without a TTL to be refused")
+	}
+	l, err := LockCacheFileTTL(context.Background(), "token", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err = l.Lease().Check(); err != nil {
+		t.Fatalf("Expected the lock to be kept alive, got %v", err)
+	}
+	f, _ := os.Open(lockDir + "token")
+	info, ok := readLockInfo(f)
+	f.Close()
+	if !ok || !info.Expires.After(time.Now()) {
+		t.Fatalf("Expected the lock's expiry to be renewed, got %+v", info)
+	}
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A ttl too short to divide doesn't stop renewals
+	l2, _ := AcquireLease(context.Background(), "other", 0)
+	defer l2.Release()
+	l2.KeepAlive(context.Background(), time.Nanosecond, func(error) {})()
+}
+
+func TestLockWaitBacksOff(t *testing.T) {
+	SetLockBackoff(&LockBackoff{Initial: time.Millisecond, Multiplier: 2, Max: 4 * time.Millisecond})
+	defer SetLockBackoff(nil)
+	w := newLockWait(fileLockBackoff)
+	var waits []time.Duration
+	for i := 0; i < 4; i++ {
+		waits = append(waits, w.next)
+		w.sleep(context.Background())
+	}
+	if fmt.Sprint(waits) != "[1ms 2ms 4ms 4ms]" {
+		t.Fatalf("Expected the waits to double up to the max, got %v", waits)
+	}
+	if w = newLockWait(remoteLockBackoff); w.Initial != time.Millisecond {
+		t.Fatalf("Expected the backoff set to apply to every waiter, got %+v", w.LockBackoff)
+	}
+}
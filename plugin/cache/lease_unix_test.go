@@ -0,0 +1,133 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// holdOrphaned holds the named lock as a child that outlived the process that took it would: through a
+// descriptor of its own, with the lock info of a holder that's gone, expiring ttl from now if ttl is set
+func holdOrphaned(t *testing.T, name string, ttl time.Duration) *os.File {
+	gone := exec.Command(os.Args[0], "-test.run=^$")
+	if err := gone.Run(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openLockFile(lockDir + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = flock(f, syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	info := lockInfo{ID: "orphan", PID: gone.Process.Pid, Acquired: time.Now(), HoldUntil: time.Now()}
+	if ttl > 0 {
+		info.Expires = time.Now().Add(ttl)
+	}
+	if err = writeLockInfo(f, info); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestExpiredLockIsBroken(t *testing.T) {
+	defer tempCache(t)()
+	orphan := holdOrphaned(t, "token", 200*time.Millisecond)
+	defer orphan.Close()
+	if _, ok, _ := TryLease("token", 0); ok {
+		t.Fatal("Expected a lock that hasn't expired not to be broken")
+	}
+	time.Sleep(250 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := AcquireLease(ctx, "token", 0)
+	if err != nil {
+		t.Fatalf("Expected the expired lock to be broken, got %v", err)
+	}
+	defer l.Release()
+	if err = l.Check(); err != nil {
+		t.Fatalf("Expected the lease to hold the lock it broke, got %v", err)
+	}
+}
+
+func TestBrokenLeaseIsLost(t *testing.T) {
+	defer tempCache(t)()
+	l, err := AcquireLease(context.Background(), "token", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(lockDir + "token")
+	if err = l.Renew(time.Minute); err != ErrLockLost {
+		t.Fatalf("Expected a broken lease not to renew, got %v", err)
+	}
+	if err = l.Release(); err != ErrLockLost {
+		t.Fatalf("Expected releasing a broken lease to say so, got %v", err)
+	}
+}
+
+func TestReapStaleLocks(t *testing.T) {
+	defer tempCache(t)()
+	orphan := holdOrphaned(t, "stale", 0)
+	defer orphan.Close()
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lockDir+"stale", old, old)
+	fresh, err := AcquireLease(context.Background(), "fresh", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Release()
+
+	broken, err := ReapStaleLocks(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0] != "stale" {
+		t.Fatalf("Expected only the stale lock to be broken, got %v", broken)
+	}
+	if err = fresh.Check(); err != nil {
+		t.Fatalf("Expected a held lock to be left alone, got %v", err)
+	}
+}
+
+func TestWaiterOnBrokenLockFile(t *testing.T) {
+	defer tempCache(t)()
+	first, err := AcquireLease(context.Background(), "token", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan *LockLease, 1)
+	go func() {
+		l, err := AcquireLease(context.Background(), "token", 0)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- l
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Broken while it was waited for, and taken by someone else through the new file
+	os.Remove(lockDir + "token")
+	second, ok, err := TryLease("token", 0)
+	if !ok || err != nil {
+		t.Fatalf("Expected the lock to be taken once broken, got %v, %v", ok, err)
+	}
+	first.Release()
+	select {
+	case <-got:
+		t.Fatal("Expected the waiter not to hold the lock of the file that was removed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	second.Release()
+	select {
+	case l := <-got:
+		l.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the waiter to get the lock of the new file")
+	}
+}
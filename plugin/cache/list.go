@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Lister is implemented by backends that can list their entries
+type Lister interface {
+	// List returns the entries whose names match pattern, sorted by name
+	List(pattern string) ([]Info, error)
+}
+
+// List returns the entries of the current backend whose names match pattern, sorted by name, ie: the
+// checkpoints a trigger wrote with events/*.json. The pattern is matched as by path.Match, so a * doesn't
+// match across a /. Backends that can't list their entries return an error.
+func List(pattern string) ([]Info, error) {
+	b := CurrentBackend()
+	l, ok := b.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("The %T cache backend can't list entries", b)
+	}
+	return l.List(pattern)
+}
+
+// List implements Lister. The SDK's own files under /var/cache, like locks and expiries, aren't entries,
+// and files written by WriteWithTTL that have expired aren't there, and are removed.
+func (FileBackend) List(pattern string) ([]Info, error) {
+	pattern = stripLeftSlash(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(cacheDir + pattern)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Info
+	for _, match := range matches {
+		name := strings.TrimPrefix(filepath.ToSlash(match), cacheDir)
+		if fi, err := os.Lstat(match); err != nil || !fi.Mode().IsRegular() || !isEntry(name) {
+			continue
+		}
+		info, err := Stat(name)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *info)
+	}
+	return entries, nil
+}
+
+// isEntry checks the named file under /var/cache is an entry, rather than one of the SDK's own
+func isEntry(name string) bool {
+	for _, dir := range []string{lockDir, ttlDir, sumDir} {
+		dir = strings.TrimPrefix(dir, cacheDir)
+		if name+"/" == dir || strings.HasPrefix(name, dir) {
+			return false
+		}
+	}
+	return !strings.Contains(name, tempInfix) && isReservedName(name) == nil
+}
+
+// List implements Lister
+func (m *MemoryBackend) List(pattern string) ([]Info, error) {
+	pattern = stripLeftSlash(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []Info
+	for name := range m.entries {
+		data, ok := m.entry(name)
+		if !ok {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			entries = append(entries, Info{Name: name, Size: int64(len(data))})
+		}
+	}
+	sort.Sort(byName(entries))
+	return entries, nil
+}
+
+// byName sorts entries by name
+type byName []Info
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
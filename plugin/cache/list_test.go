@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func listedNames(t *testing.T, l Lister, pattern string) []string {
+	entries, err := l.List(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestFileBackendList(t *testing.T) {
+	defer tempCache(t)()
+	for _, name := range []string{"top", "feeds/b.json", "feeds/a.json", "feeds/c.txt", "feeds/sub/d.json"} {
+		if err := WriteAtomic(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteWithTTL("feeds/expired.json", []byte("old"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteWithTTL("feeds/fresh.json", []byte("new"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockCacheFile("feeds/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	defer UnlockCacheFile("feeds/a.json", nil)
+	if err := ioutil.WriteFile(cacheDir+"feeds/e.json"+tempInfix+"123", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	expected := []string{"feeds/a.json", "feeds/b.json", "feeds/fresh.json"}
+	if names := listedNames(t, FileBackend{}, "/feeds/*.json"); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	if ok, _ := CheckCacheFile("feeds/expired.json"); ok {
+		t.Fatal("Expected the expired entry to be removed")
+	}
+
+	// the SDK's own lock, ttl and checksum files aren't entries
+	if names := listedNames(t, FileBackend{}, "*"); !reflect.DeepEqual(names, []string{"top"}) {
+		t.Fatalf("Expected only the top level entry, got %v", names)
+	}
+	for _, dir := range []string{lockDir, ttlDir, sumDir} {
+		if _, err := os.Stat(dir + "feeds"); err != nil {
+			t.Fatalf("Expected the test to have written to %s: %s", dir, err)
+		}
+	}
+	for _, pattern := range []string{"lock/feeds/*", ".ttl/feeds/*", ".sum/feeds/*", "feeds/*" + tempInfix + "*"} {
+		if names := listedNames(t, FileBackend{}, pattern); len(names) > 0 {
+			t.Errorf("Expected %s not to list entries, got %v", pattern, names)
+		}
+	}
+
+	if _, err := (FileBackend{}).List("feeds/["); err == nil {
+		t.Fatal("Expected an invalid pattern to be refused")
+	}
+}
+
+func TestMemoryBackendList(t *testing.T) {
+	m := &MemoryBackend{}
+	m.Put("feeds/b.json", []byte("bb"))
+	m.Put("feeds/a.json", []byte("a"))
+	m.Put("feeds/sub/c.json", []byte("c"))
+	m.PutTTL("feeds/expired.json", []byte("old"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	entries, err := m.List("feeds/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Info{{Name: "feeds/a.json", Size: 1}, {Name: "feeds/b.json", Size: 2}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("Expected %v, got %v", expected, entries)
+	}
+	if _, err = m.List("["); err == nil {
+		t.Fatal("Expected an invalid pattern to be refused")
+	}
+}
+
+func TestList(t *testing.T) {
+	defer SetBackend(nil)
+	SetBackend(&MemoryBackend{})
+	Put("a", []byte("a"))
+	if names, err := List("*"); err != nil || len(names) != 1 || names[0].Name != "a" {
+		t.Fatalf("Expected the current backend's entries, got %v, %v", names, err)
+	}
+	SetBackend(foreverBackend{&MemoryBackend{}})
+	if _, err := List("*"); err == nil {
+		t.Fatal("Expected a backend that can't list entries to be refused")
+	}
+}
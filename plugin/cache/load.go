@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/singleflight"
+)
+
+// TTLBackend is implemented by backends that can expire entries
+type TTLBackend interface {
+	// PutTTL replaces the entry with data, which expires after ttl
+	PutTTL(name string, data []byte, ttl time.Duration) error
+}
+
+// PutTTL replaces the named entry in the current backend with data that expires after ttl. Backends that
+// can't expire entries return an error.
+func PutTTL(name string, data []byte, ttl time.Duration) error {
+	b := CurrentBackend()
+	t, ok := b.(TTLBackend)
+	if !ok {
+		return fmt.Errorf("The %T cache backend can't expire entries", b)
+	}
+	return t.PutTTL(name, data, ttl)
+}
+
+// loads coalesces the loads of GetOrLoad in this process
+var loads singleflight.Group
+
+// GetOrLoad returns the named entry from the current backend, or if there isn't one, calls loader and
+// stores what it returns for ttl, 0 being until it's replaced. Concurrent calls for the same name share
+// one load, and so do other processes sharing the backend, as loading holds the entry's lock: whoever
+// gets it second finds the entry already loaded. Errors from loader are returned, not stored. A ttl
+// on a backend that can't expire entries is an error, and loader isn't called.
+func GetOrLoad(name string, ttl time.Duration, loader func() ([]byte, error)) ([]byte, error) {
+	if data, err := Get(name); err != ErrNotFound {
+		return data, err
+	}
+	v, _, err := loads.Do(context.Background(), stripLeftSlash(name), func(ctx context.Context) (interface{}, error) {
+		return load(CurrentBackend(), name, ttl, loader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func load(b Backend, name string, ttl time.Duration, loader func() ([]byte, error)) (data []byte, err error) {
+	// refused before it's loaded, rather than loaded and then thrown away
+	t, ok := b.(TTLBackend)
+	if ttl > 0 && !ok {
+		return nil, fmt.Errorf("The %T cache backend can't expire entries", b)
+	}
+	if err = b.Lock(context.Background(), name); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if unlockErr := b.Unlock(name); err == nil {
+			err = unlockErr
+		}
+	}()
+	// another process may have loaded it while we waited for the lock
+	if data, err = b.Get(name); err != ErrNotFound {
+		return data, err
+	}
+	if data, err = loader(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return data, b.Put(name, data)
+	}
+	return data, t.PutTTL(name, data, ttl)
+}
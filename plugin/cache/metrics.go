@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats count how the cache was used by this process, to tune what's cached and for how long
+type Stats struct {
+	Hits   int64 `json:"hits"`   // Hits are reads through Get that found the entry
+	Misses int64 `json:"misses"` // Misses are reads through Get that didn't
+	// LockWaits are the waits for a lock, whether or not someone else held it
+	LockWaits    int64         `json:"lock_waits"`
+	LockWaitTime time.Duration `json:"lock_wait_ns"` // LockWaitTime is the time spent in them
+}
+
+// Observer is told as the cache is used, ie: to feed the plugin's own metrics
+type Observer interface {
+	Hit(name string)
+	Miss(name string)
+	LockWaited(name string, wait time.Duration)
+}
+
+// Counters of cache use, updated atomically
+var (
+	hits         int64
+	misses       int64
+	lockWaits    int64
+	lockWaitTime int64
+)
+
+var (
+	observerMu sync.RWMutex
+	observer   Observer
+)
+
+// SetObserver has o told of every hit, miss and lock wait, nil stops telling one
+func SetObserver(o Observer) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	observer = o
+}
+
+// GetStats returns the cache use of this process so far
+func GetStats() Stats {
+	return Stats{
+		Hits:         atomic.LoadInt64(&hits),
+		Misses:       atomic.LoadInt64(&misses),
+		LockWaits:    atomic.LoadInt64(&lockWaits),
+		LockWaitTime: time.Duration(atomic.LoadInt64(&lockWaitTime)),
+	}
+}
+
+// ResetStats clears the cache use counted, ie: once it's been reported
+func ResetStats() {
+	atomic.StoreInt64(&hits, 0)
+	atomic.StoreInt64(&misses, 0)
+	atomic.StoreInt64(&lockWaits, 0)
+	atomic.StoreInt64(&lockWaitTime, 0)
+}
+
+func currentObserver() Observer {
+	observerMu.RLock()
+	defer observerMu.RUnlock()
+	return observer
+}
+
+// observeGet counts a read of the named entry that returned err
+func observeGet(name string, err error) {
+	o := currentObserver()
+	switch err {
+	case nil:
+		atomic.AddInt64(&hits, 1)
+		if o != nil {
+			o.Hit(stripLeftSlash(name))
+		}
+	case ErrNotFound:
+		atomic.AddInt64(&misses, 1)
+		if o != nil {
+			o.Miss(stripLeftSlash(name))
+		}
+	}
+}
+
+// observeLockWait counts a wait for the named lock that started at start, deferred by the locks
+func observeLockWait(name string, start time.Time) {
+	wait := time.Since(start)
+	atomic.AddInt64(&lockWaits, 1)
+	atomic.AddInt64(&lockWaitTime, int64(wait))
+	if o := currentObserver(); o != nil {
+		o.LockWaited(stripLeftSlash(name), wait)
+	}
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Copy copies the named cache file src to dst, replacing it. It's streamed, so the content is never held in
+// memory, into a temporary file renamed into place as with WriteAtomic. dst gets src's expiry, if it has
+// one, and a checksum of what was copied. A src that's corrupt isn't copied, Copy returns its *CorruptError.
+//
+// src is held with a shared lock, and dst an exclusive one, while it's copied, see RLockCacheFile. Don't
+// call it holding either lock. Both names follow the same rules as OpenCacheFile.
+func Copy(src, dst string) error {
+	if err := validatePair(src, dst); err != nil {
+		return err
+	}
+	src, dst = stripLeftSlash(src), stripLeftSlash(dst)
+	if src == dst {
+		return nil
+	}
+	unlock, err := lockPair(src, dst, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return copyFile(src, dst)
+}
+
+// Rename renames the named cache file src to dst, replacing it, along with its expiry and checksum. The
+// rename is atomic, readers of dst see its old content or src's, never neither. It's how a pending entry is
+// promoted to committed:
+//
+//	if err := cache.WriteAtomic("pending/batch", data); err != nil {
+//		return err
+//	}
+//	...
+//	return cache.Rename("pending/batch", "committed/batch")
+//
+// Both are held with an exclusive lock while they're renamed, see LockCacheFile. Don't call it holding
+// either lock. Both names follow the same rules as OpenCacheFile.
+func Rename(src, dst string) error {
+	if err := validatePair(src, dst); err != nil {
+		return err
+	}
+	src, dst = stripLeftSlash(src), stripLeftSlash(dst)
+	if src == dst {
+		return nil
+	}
+	unlock, err := lockPair(src, dst, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return renameFile(src, dst)
+}
+
+// Move is Rename, but where src and dst are on different file systems, ie: a directory under /var/cache is a
+// volume of its own, src is copied to dst then removed. Readers of dst still never see it half written, but
+// a crash part way through can leave both.
+func Move(src, dst string) error {
+	if err := validatePair(src, dst); err != nil {
+		return err
+	}
+	src, dst = stripLeftSlash(src), stripLeftSlash(dst)
+	if src == dst {
+		return nil
+	}
+	unlock, err := lockPair(src, dst, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = renameFile(src, dst)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+	if err = copyFile(src, dst); err != nil {
+		return err
+	}
+	if err = removeSidecars(src); err != nil {
+		return err
+	}
+	return os.Remove(cacheDir + src)
+}
+
+func validatePair(src, dst string) error {
+	if err := validateName(src); err != nil {
+		return err
+	}
+	return validateName(dst)
+}
+
+// lockPair locks src and dst, src's lock being shared if srcShared, in the order of their names so two calls
+// the other way round can't deadlock. It returns a function releasing the locks.
+func lockPair(src, dst string, srcShared bool) (unlock func(), err error) {
+	first, second := src, dst
+	if dst < src {
+		first, second = dst, src
+	}
+	var held []*LockLease
+	unlock = func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Release()
+		}
+	}
+	for _, name := range []string{first, second} {
+		var l *LockLease
+		if name == src && srcShared {
+			l, err = AcquireSharedLease(context.Background(), name)
+		} else {
+			l, err = AcquireLease(context.Background(), name, 0)
+		}
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		held = append(held, l)
+	}
+	return unlock, nil
+}
+
+// copyFile copies src to dst, both locked
+func copyFile(src, dst string) error {
+	if err := removeIfExpired(src); err != nil {
+		return err
+	}
+	in, err := os.Open(cacheDir + src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := createTemp(cacheDir + dst)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), in)
+	sum := h.Sum(nil)
+	if err == nil {
+		err = verifyCopied(src, in, sum)
+	}
+	// The expiry goes first, as with WriteWithTTL
+	if err == nil {
+		err = copyExpiry(src, dst)
+	}
+	if err = commitTemp(f, cacheDir+dst, err); err != nil {
+		return err
+	}
+	if err = recordSum(dst, sum); err != nil {
+		return err
+	}
+	used(dst)
+	return nil
+}
+
+// verifyCopied checks sum, the SHA-256 of what was copied from src, against src's checksum
+func verifyCopied(src string, in *os.File, sum []byte) error {
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err = verifySum(src, sum, fi); err == ErrUnverified {
+		return nil
+	}
+	return err
+}
+
+// copyExpiry gives dst the expiry of src, or none if it has none
+func copyExpiry(src, dst string) error {
+	b, err := ioutil.ReadFile(ttlDir + src)
+	if os.IsNotExist(err) {
+		return removeExpiry(dst)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ttlDir+dst, b)
+}
+
+// renameFile renames src to dst, both locked
+func renameFile(src, dst string) error {
+	if err := removeIfExpired(src); err != nil {
+		return err
+	}
+	if _, err := os.Stat(cacheDir + src); err != nil {
+		return err
+	}
+	// The expiry goes first, as with WriteWithTTL, and the checksum last, as with WriteAtomic
+	if err := copyExpiry(src, dst); err != nil {
+		return err
+	}
+	if err := mkdirAll(filepath.Dir(cacheDir + dst)); err != nil {
+		return err
+	}
+	if err := os.Rename(cacheDir+src, cacheDir+dst); err != nil {
+		return err
+	}
+	if err := removeExpiry(src); err != nil {
+		return err
+	}
+	if err := renameSidecar(sumDir, src, dst); err != nil {
+		return err
+	}
+	used(dst)
+	return nil
+}
+
+// renameSidecar renames the sidecar of src in dir to dst's, or removes dst's if src has none
+func renameSidecar(dir, src, dst string) error {
+	if _, err := os.Stat(dir + src); os.IsNotExist(err) {
+		if err = os.Remove(dir + dst); os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := mkdirAll(filepath.Dir(dir + dst)); err != nil {
+		return err
+	}
+	return os.Rename(dir+src, dir+dst)
+}
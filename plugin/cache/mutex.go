@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+const defaultRemoteLockTTL = 30 * time.Second
+
+// NamedMutex is a lock keyed by name. FileMutex coordinates processes sharing /var/cache, which is
+// all a plugin running as one container needs; RedisMutex and EtcdMutex coordinate replicas spread
+// over several nodes, like an HTTP-mode plugin behind a load balancer.
+type NamedMutex interface {
+	// Lock waits until it holds name or ctx is done. A lock expires after ttl unless renewed, so a
+	// crashed holder can't block everyone forever. The kernel lets go of file locks when their holder
+	// exits, an expired one is only broken if it outlived its holder, see AcquireLease.
+	Lock(ctx context.Context, name string, ttl time.Duration) (Lease, error)
+	// TryLock is Lock without the waiting, it returns false if name is already held
+	TryLock(name string, ttl time.Duration) (Lease, bool, error)
+}
+
+// Lease is a lock held through a NamedMutex
+type Lease interface {
+	// Renew extends the lock to expire ttl from now, or returns ErrLockLost if it already expired
+	// and was taken by someone else
+	Renew(ttl time.Duration) error
+	// Release gives up the lock
+	Release() error
+}
+
+// FileMutex is a NamedMutex backed by lock files in /var/cache/lock/*, see AcquireLease
+type FileMutex struct{}
+
+// Lock implements NamedMutex
+func (FileMutex) Lock(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	l, err := AcquireLease(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return l, renewNew(l, ttl)
+}
+
+// TryLock implements NamedMutex
+func (FileMutex) TryLock(name string, ttl time.Duration) (Lease, bool, error) {
+	l, ok, err := TryLease(name, 0)
+	if !ok {
+		return nil, false, err
+	}
+	return l, true, renewNew(l, ttl)
+}
+
+// renewNew gives a freshly acquired lease its expiry, releasing it if that fails
+func renewNew(l *LockLease, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if err := l.Renew(ttl); err != nil {
+		l.Release()
+		return err
+	}
+	return nil
+}
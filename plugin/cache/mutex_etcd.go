@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/etcd"
+)
+
+// EtcdMutex is a NamedMutex backed by etcd keys attached to leases, so a lock disappears with its lease
+// when the holder stops renewing it. etcd leases have whole second ttls and always expire, a ttl of 0
+// uses DefaultTTL.
+type EtcdMutex struct {
+	Client     *etcd.Client
+	Prefix     string        // Prefix is prepended to lock names, defaults to "/locks/"
+	DefaultTTL time.Duration // DefaultTTL defaults to 30s
+}
+
+// Lock implements NamedMutex
+func (m EtcdMutex) Lock(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	defer observeLockWait(name, time.Now())
+	wait := newLockWait(remoteLockBackoff)
+	for {
+		l, ok, err := m.TryLock(name, ttl)
+		if ok || err != nil {
+			return l, err
+		}
+		if err = wait.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TryLock implements NamedMutex
+func (m EtcdMutex) TryLock(name string, ttl time.Duration) (Lease, bool, error) {
+	if ttl <= 0 {
+		ttl = m.DefaultTTL
+	}
+	if ttl <= 0 {
+		ttl = defaultRemoteLockTTL
+	}
+	lease, err := m.Client.Grant(ttl)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := m.Client.PutIfAbsent(m.key(name), []byte(utils.UniqueID()), lease)
+	if !ok {
+		m.Client.Revoke(lease)
+		return nil, false, err
+	}
+	return &etcdLease{client: m.Client, lease: lease}, true, nil
+}
+
+func (m EtcdMutex) key(name string) string {
+	if m.Prefix == "" {
+		return "/locks/" + name
+	}
+	return m.Prefix + name
+}
+
+type etcdLease struct {
+	client *etcd.Client
+	lease  int64
+}
+
+// Renew keeps the etcd lease alive. etcd refreshes a lease to the ttl it was granted with, so ttl is ignored.
+func (l *etcdLease) Renew(ttl time.Duration) error {
+	_, err := l.client.KeepAlive(l.lease)
+	if err == etcd.ErrLeaseNotFound {
+		return ErrLockLost
+	}
+	return err
+}
+
+// Release revokes the lease, which deletes the lock key with it
+func (l *etcdLease) Release() error {
+	if err := l.client.Revoke(l.lease); err != nil && err != etcd.ErrLeaseNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/redis"
+)
+
+// Renewing and releasing compare the token first, so a holder whose lock expired can't touch the next holder's
+const redisRenewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+const redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// RedisMutex is a NamedMutex backed by Redis keys set with SET NX PX. Redis locks always expire, a ttl
+// of 0 uses DefaultTTL.
+type RedisMutex struct {
+	Client     *redis.Client
+	Prefix     string        // Prefix is prepended to lock names, defaults to "lock:"
+	DefaultTTL time.Duration // DefaultTTL defaults to 30s
+}
+
+// Lock implements NamedMutex
+func (m RedisMutex) Lock(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	defer observeLockWait(name, time.Now())
+	wait := newLockWait(remoteLockBackoff)
+	for {
+		l, ok, err := m.TryLock(name, ttl)
+		if ok || err != nil {
+			return l, err
+		}
+		if err = wait.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TryLock implements NamedMutex
+func (m RedisMutex) TryLock(name string, ttl time.Duration) (Lease, bool, error) {
+	l := &redisLease{client: m.Client, key: m.key(name), token: utils.UniqueID()}
+	ok, err := m.Client.SetNX(l.key, []byte(l.token), m.ttl(ttl))
+	if !ok {
+		return nil, false, err
+	}
+	return l, true, nil
+}
+
+func (m RedisMutex) key(name string) string {
+	if m.Prefix == "" {
+		return "lock:" + name
+	}
+	return m.Prefix + name
+}
+
+func (m RedisMutex) ttl(ttl time.Duration) time.Duration {
+	switch {
+	case ttl > 0:
+		return ttl
+	case m.DefaultTTL > 0:
+		return m.DefaultTTL
+	default:
+		return defaultRemoteLockTTL
+	}
+}
+
+type redisLease struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+func (l *redisLease) Renew(ttl time.Duration) error {
+	reply, err := l.client.Eval(redisRenewScript, []string{l.key}, l.token, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *redisLease) Release() error {
+	_, err := l.client.Eval(redisReleaseScript, []string{l.key}, l.token)
+	return err
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultFileMode is the mode cache files are created with, unless SetPermissions says otherwise
+const DefaultFileMode os.FileMode = 0600
+
+// Permissions are the modes and owner of the files and directories the cache creates, for cache content
+// shared between the plugin's user and a sidecar, ie: a group readable cache:
+//
+//	cache.SetPermissions(&cache.Permissions{FileMode: 0640, DirMode: 0750, Chown: true, UID: -1, GID: 1001})
+//
+// Modes that are set are applied as they are, regardless of the umask. Files and directories that already
+// exist are left alone.
+type Permissions struct {
+	FileMode os.FileMode // FileMode defaults to DefaultFileMode, less the umask
+	DirMode  os.FileMode // DirMode defaults to os.ModePerm, less the umask
+	// Chown has new files and directories owned by UID and GID, -1 leaving either as it is. It needs the
+	// privileges to, and isn't supported on Windows.
+	Chown    bool
+	UID, GID int
+}
+
+var (
+	permissionsMu sync.RWMutex
+	permissions   Permissions
+)
+
+// SetPermissions sets the modes and owner the cache creates files and directories with, nil restores the
+// defaults
+func SetPermissions(p *Permissions) {
+	permissionsMu.Lock()
+	defer permissionsMu.Unlock()
+	if p == nil {
+		permissions = Permissions{}
+		return
+	}
+	permissions = *p
+}
+
+func currentPermissions() Permissions {
+	permissionsMu.RLock()
+	defer permissionsMu.RUnlock()
+	return permissions
+}
+
+func (p Permissions) fileMode() os.FileMode {
+	if p.FileMode == 0 {
+		return DefaultFileMode
+	}
+	return p.FileMode
+}
+
+func (p Permissions) dirMode() os.FileMode {
+	if p.DirMode == 0 {
+		return os.ModePerm
+	}
+	return p.DirMode
+}
+
+// apply sets the mode and owner of path, just created. mode is only applied if it was set, as the umask
+// is respected otherwise.
+func (p Permissions) apply(path string, mode os.FileMode) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if p.Chown {
+		return os.Chown(path, p.UID, p.GID)
+	}
+	return nil
+}
+
+// mkdirAll creates dir and any of its parents that are missing, with the cache's permissions
+func mkdirAll(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	p := currentPermissions()
+	if err := os.Mkdir(dir, p.dirMode()); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return p.apply(dir, p.DirMode)
+}
+
+// createFile opens the file at path with flags, creating it and its directory with the cache's
+// permissions if it's missing
+func createFile(path string, flags int) (*os.File, error) {
+	if err := mkdirAll(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	p := currentPermissions()
+	f, err := os.OpenFile(path, flags|os.O_CREATE|os.O_EXCL, p.fileMode())
+	if os.IsExist(err) && flags&os.O_EXCL == 0 {
+		return os.OpenFile(path, flags, p.fileMode())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = p.apply(path, p.FileMode); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ReapStaleLocks breaks the locks under /var/cache/lock/* left behind by holders that crashed, which
+// would otherwise block every later run, and returns the names of those it broke. A lock is stale once
+// it was last taken or renewed more than maxAge ago and its holder is gone, or it was released with a
+// minimum hold that runs past maxAge since it was taken. maxAge should be well past the longest a lock
+// is held without being renewed.
+func ReapStaleLocks(maxAge time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-maxAge)
+	var broken []string
+	err := filepath.Walk(lockDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasSuffix(path, heldSuffix) {
+			return nil
+		}
+		name := strings.TrimPrefix(path, lockDir)
+		ok, err := reapLock(path, cutoff)
+		if err != nil {
+			return err
+		}
+		if ok {
+			log.Warnf("Broke stale cache lock %s", name)
+			broken = append(broken, name)
+		}
+		return nil
+	})
+	return broken, err
+}
+
+// ReapStaleLocksEvery runs ReapStaleLocks every interval until ctx is done, for plugins that run long
+// enough to outlive the processes they share /var/cache with
+func ReapStaleLocksEvery(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := utils.NewTicker(ctx, interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := ReapStaleLocks(maxAge); err != nil {
+			log.Errorf("Unable to reap stale cache locks: %s", err)
+		}
+	}
+}
+
+// reapLock breaks the lock at path if it's stale
+func reapLock(path string, cutoff time.Time) (bool, error) {
+	f, ok, err := tryLockFile(path, false)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return breakLock(path, cutoff)
+	}
+	// Nobody holds it, but the last holder may have left a hold that's still being waited out
+	info, ok := readLockInfo(f)
+	if !ok || !info.HoldUntil.After(time.Now()) || info.Acquired.After(cutoff) {
+		return false, unlockFile(f)
+	}
+	info.HoldUntil = info.Acquired
+	info.Released = true
+	err = writeLockInfo(f, info)
+	if unlockErr := unlockFile(f); err == nil {
+		err = unlockErr
+	}
+	return err == nil, err
+}
+
+func ignoreNotExist(err error) error {
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"os"
+	"time"
+)
+
+// Info describes a cache file
+type Info struct {
+	Name     string
+	Size     int64
+	Created  time.Time // Created is zero where the filesystem doesn't record it, as on Linux
+	Modified time.Time
+	// Accessed is when the file was last read, as far as the filesystem keeps track: with the relatime
+	// mount option most Linux hosts use, it's only updated once a day, or when the file is written
+	Accessed time.Time
+	Expires  time.Time // Expires is zero for a file written without a TTL, see WriteWithTTL
+}
+
+// Stat describes the named cache file, or returns ErrNotFound if there isn't one. A file written by
+// WriteWithTTL that has expired isn't there, and is removed. The name argument follows the same rules
+// as OpenCacheFile.
+func Stat(name string) (*Info, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := removeIfExpired(name); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(cacheDir + stripLeftSlash(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Name: stripLeftSlash(name), Size: fi.Size(), Modified: fi.ModTime()}
+	info.Created, info.Accessed = fileTimes(fi)
+	if expires, ok, err := Expires(name); err != nil {
+		return nil, err
+	} else if ok {
+		info.Expires = expires
+	}
+	return info, nil
+}
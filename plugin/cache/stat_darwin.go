@@ -0,0 +1,19 @@
+//go:build darwin
+// +build darwin
+
+package cache
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns when a file was created and last accessed
+func fileTimes(fi os.FileInfo) (created, accessed time.Time) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		created = time.Unix(int64(st.Birthtimespec.Sec), int64(st.Birthtimespec.Nsec))
+		accessed = time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec))
+	}
+	return
+}
@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package cache
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns when a file was created and last accessed. Linux's stat doesn't say when a file was
+// created.
+func fileTimes(fi os.FileInfo) (created, accessed time.Time) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		accessed = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	}
+	return
+}
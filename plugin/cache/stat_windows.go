@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package cache
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns when a file was created and last accessed
+func fileTimes(fi os.FileInfo) (created, accessed time.Time) {
+	if attrs, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		created = time.Unix(0, attrs.CreationTime.Nanoseconds())
+		accessed = time.Unix(0, attrs.LastAccessTime.Nanoseconds())
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// ttlDir holds the expiry of each cache file written with a TTL, under the file's name
+var ttlDir = "/var/cache/.ttl/"
+
+// WriteWithTTL replaces the named cache file with data, and has it expire after ttl. Once it has,
+// OpenCacheFile and CheckCacheFile treat the file as missing, and remove it. The name argument follows the
+// same rules as OpenCacheFile.
+func WriteWithTTL(name string, data []byte, ttl time.Duration) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	name = stripLeftSlash(name)
+	// The expiry goes first, so a crash in between leaves the old content expiring early rather than the
+	// new content never expiring
+	expires := time.Now().Add(ttl).Format(time.RFC3339Nano)
+	if err := writeFileAtomic(ttlDir+name, []byte(expires)); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(cacheDir+name, data); err != nil {
+		return err
+	}
+	if err := writeSum(name, data); err != nil {
+		return err
+	}
+	used(name)
+	return nil
+}
+
+// Expires returns when the named cache file expires, and false if it was written without a TTL
+func Expires(name string) (time.Time, bool, error) {
+	if err := validateName(name); err != nil {
+		return time.Time{}, false, err
+	}
+	b, err := ioutil.ReadFile(ttlDir + stripLeftSlash(name))
+	if os.IsNotExist(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
+
+// removeIfExpired removes the named cache file, and its expiry and checksum, once it has expired
+func removeIfExpired(name string) error {
+	expires, ok, err := Expires(name)
+	if err != nil || !ok || time.Now().Before(expires) {
+		return err
+	}
+	if err = os.Remove(cacheDir + stripLeftSlash(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return removeSidecars(name)
+}
+
+// removeExpiry forgets the expiry of the named cache file
+func removeExpiry(name string) error {
+	if err := os.Remove(ttlDir + stripLeftSlash(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// tempInfix is in the names of the temporary files writeFileAtomic writes, which aren't entries yet
+const tempInfix = ".tmp-"
+
+// writeFileAtomic writes a new file in path's directory and renames it over path, so readers never see it
+// half written. The file is synced first, or a crash could leave the rename done but the content not.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return commitTemp(f, path, err)
+}
+
+// createTemp creates a temporary file in path's directory, with the cache's permissions, to be renamed over
+// path by commitTemp once it's written
+func createTemp(path string) (*os.File, error) {
+	if err := mkdirAll(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	p := currentPermissions()
+	tmp := path + tempInfix + utils.UniqueID()
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, p.fileMode())
+	if err != nil {
+		return nil, err
+	}
+	if err = p.apply(tmp, p.FileMode); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return f, nil
+}
+
+// commitTemp syncs and closes f, from createTemp, and renames it over path. It's removed instead if err,
+// the error writing it, is set, or any of that fails.
+func commitTemp(f *os.File, path string, err error) error {
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
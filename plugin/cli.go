@@ -2,9 +2,14 @@ package plugin
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/komand/plugin-sdk-go/plugin/deadletter"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
 	ansi "github.com/mgutz/ansi"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -26,6 +31,23 @@ type sampleable interface {
 	SampleStartMessage(string) (string, error)
 }
 
+type deadletterable interface {
+	DeadLetters() deadletter.Store
+	Redrive(id string) error
+}
+
+type replayable interface {
+	Replay(source string, dispatcher string) error
+}
+
+type keepaliveable interface {
+	RunKeepAlive(in io.Reader, out io.Writer, idle time.Duration) error
+}
+
+type servable interface {
+	Serve(addr string) error
+}
+
 type cli struct {
 	Args   []string
 	Plugin Pluginable
@@ -52,6 +74,9 @@ func (c *cli) description() string {
 		result += fmt.Sprintf("Triggers (%s%d%s): \n", green, len(c.Plugin.Triggers()), reset)
 		for name, item := range c.Plugin.Triggers() {
 			result += fmt.Sprintf("└── %s%s%s (%s%s)\n", green, name, reset, item.Description(), reset)
+			if t, err := LoadTotals(name); err == nil && t.EventsDispatched+t.Errors > 0 {
+				result += fmt.Sprintf("    %d events dispatched, %d errors, last at %s\n", t.EventsDispatched, t.Errors, t.LastEvent.Format(time.RFC3339))
+			}
 		}
 	}
 
@@ -77,6 +102,52 @@ func (c *cli) sample(name string) {
 	}
 }
 
+func (c *cli) listDeadLetters() {
+	dl, ok := c.Plugin.(deadletterable)
+	if !ok {
+		log.Fatal("This plugin does not support dead letters")
+	}
+	entries, err := dl.DeadLetters().List()
+	if err != nil {
+		log.Fatalf("Unable to list dead letters: %s", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No dead letters")
+		return
+	}
+	for _, e := range entries {
+		fmt.Printf("%s%s%s  %s  %s %s (%d attempts): %s\n", green, e.ID, reset, e.Failed.Format("2006-01-02 15:04:05"), e.Kind, e.Name, e.Attempts, e.Error)
+	}
+}
+
+func (c *cli) redrive(ids []string) {
+	dl, ok := c.Plugin.(deadletterable)
+	if !ok {
+		log.Fatal("This plugin does not support dead letters")
+	}
+	if len(ids) == 0 {
+		entries, err := dl.DeadLetters().List()
+		if err != nil {
+			log.Fatalf("Unable to list dead letters: %s", err)
+		}
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+	}
+	failed := 0
+	for _, id := range ids {
+		if err := dl.Redrive(id); err != nil {
+			fmt.Printf("%s%s%s  failed again: %s\n", red, id, reset, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s%s%s  re-driven\n", green, id, reset)
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d dead letters failed to re-drive", failed, len(ids))
+	}
+}
+
 // Run the CLI
 func (c *cli) Run() {
 
@@ -91,6 +162,17 @@ func (c *cli) Run() {
 	sample := app.Command("sample", "Show a sample start message for the provided trigger or action.")
 	sampleOpt := sample.Arg("trigger or action", "Trigger or action name to generate sample message for.").Required().String()
 	run := app.Command("run", "Run the plugin (default command). You must supply the start message on stdin.")
+	keepAlive := run.Flag("keep-alive", "Run an action for each start message on stdin until it's closed, writing each result on a line of stdout.").Bool()
+	idleTimeout := run.Flag("idle-timeout", "Exit once no start message has arrived for this long in keep-alive mode, 0 never does.").Default("5m").Duration()
+	deadLetters := app.Command("deadletter", "List or re-drive failed events and start messages.")
+	deadLettersList := deadLetters.Command("list", "List dead letters, oldest first.")
+	deadLettersRedrive := deadLetters.Command("redrive", "Process dead letters again with the current plugin, removing those that succeed.")
+	redriveIDs := deadLettersRedrive.Arg("ids", "Dead letters to re-drive, all of them if none are given.").Strings()
+	replay := app.Command("replay", "Re-execute a recorded start message or trigger event with the current plugin.")
+	replaySource := replay.Arg("file or dead letter id", "File holding a start message, trigger event or dead letter, or a dead letter ID.").Required().String()
+	replayDispatcher := replay.Flag("dispatcher", "URL to send replayed trigger events to, when the dead letter didn't record one.").String()
+	serve := app.Command("serve", "Run actions for the start messages POSTed over HTTP.")
+	serveAddr := serve.Flag("addr", "Address to listen on.").Default(":10001").String()
 
 	for i, argv := range c.Args {
 		if argv == "--" {
@@ -105,6 +187,9 @@ func (c *cli) Run() {
 
 	args, err := app.Parse(c.Args)
 
+	// state held in memory, like checkpoints saved in the background, is persisted when the plugin is stopped
+	defer shutdown.HandleSignals()()
+
 	if *debug {
 		if dbgable, ok := plugin.(debuggable); ok {
 			dbgable.SetDebug()
@@ -117,7 +202,37 @@ func (c *cli) Run() {
 		c.sample(*sampleOpt)
 	case info.FullCommand():
 		c.info()
+	case deadLettersList.FullCommand():
+		c.listDeadLetters()
+	case deadLettersRedrive.FullCommand():
+		c.redrive(*redriveIDs)
+	case replay.FullCommand():
+		r, ok := plugin.(replayable)
+		if !ok {
+			log.Fatal("This plugin does not support replay")
+		}
+		if err := r.Replay(*replaySource, *replayDispatcher); err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+	case serve.FullCommand():
+		s, ok := plugin.(servable)
+		if !ok {
+			log.Fatal("This plugin does not support HTTP mode")
+		}
+		if err := s.Serve(*serveAddr); err != nil {
+			log.Fatalf("Serve failed: %v", err)
+		}
 	case run.FullCommand():
+		if *keepAlive {
+			k, ok := plugin.(keepaliveable)
+			if !ok {
+				log.Fatal("This plugin does not support keep-alive mode")
+			}
+			if err := k.RunKeepAlive(os.Stdin, os.Stdout, *idleTimeout); err != nil {
+				log.Fatalf("Run failed: %v", err)
+			}
+			return
+		}
 		if err := plugin.Run(); err != nil {
 			log.Fatalf("Run failed: %v", err)
 		}
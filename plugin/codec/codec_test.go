@@ -0,0 +1,175 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	ID int `json:"id"`
+}
+
+type event struct {
+	inner
+	Name     string            `json:"name"`
+	Optional string            `json:"optional,omitempty"`
+	Skipped  string            `json:"-"`
+	Raw      json.RawMessage   `json:"raw"`
+	Tags     map[string]string `json:"tags"`
+	Nested   *inner            `json:"nested"`
+	Numbers  []float64         `json:"numbers"`
+	When     time.Time         `json:"when"`
+	Bytes    []byte            `json:"bytes"`
+	Custom   upper             `json:"custom"`
+	Any      interface{}       `json:"any"`
+}
+
+// upper has its own marshaling, which codecs must call
+type upper string
+
+func (u upper) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(bytes.ToUpper([]byte(u))))
+}
+
+var compatible = []interface{}{
+	nil,
+	true,
+	42,
+	-1.5,
+	1e21,
+	int64(math.MaxInt64),
+	"plain",
+	"<script>&amp;</script>",
+	"unicode     é 😀",
+	[]int{},
+	[]string(nil),
+	map[string]int{"b": 2, "a": 1, "c": 3},
+	map[int]string{2: "two", 1: "one"},
+	json.RawMessage(`{"kept":"as is"}`),
+	json.RawMessage(`{ "indented": [1, 2],
+	  "html": "<b>" }`),
+	&event{
+		inner:    inner{ID: 7},
+		Name:     "alert",
+		Skipped:  "secret",
+		Raw:      json.RawMessage(`[1,2,3]`),
+		Tags:     map[string]string{"z": "last", "a": "first"},
+		Nested:   &inner{ID: 8},
+		Numbers:  []float64{0, 0.1, 2.5, 123456789},
+		When:     time.Date(2017, 3, 4, 5, 6, 7, 8, time.UTC),
+		Bytes:    []byte("binary\x00"),
+		Custom:   "shout",
+		Any:      map[string]interface{}{"list": []interface{}{"x", 1.0, nil}},
+		Optional: "",
+	},
+}
+
+// equivalent are encoded differently by encoding/json's own releases, ie: 1e-07 was 1e-7 from Go 1.8, so
+// only have to decode to the same
+var equivalent = []interface{}{
+	"invalid \xff utf-8",
+	[]float64{1e-7, 1e21, -1e-10, 5e300},
+}
+
+// TestMarshalCompatible checks the codec in use encodes exactly like encoding/json, as the orchestrator
+// and tests compare the output byte for byte. Run with -tags jsoniter to check json-iterator.
+func TestMarshalCompatible(t *testing.T) {
+	c := Current()
+	for _, v := range compatible {
+		want, wantErr := json.Marshal(v)
+		got, err := c.Marshal(v)
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%s: marshaling %#v errored with %v, encoding/json with %v", c.Name(), v, err, wantErr)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: marshaled %#v to\n%s\nencoding/json to\n%s", c.Name(), v, got, want)
+		}
+
+		var b bytes.Buffer
+		if err = c.NewEncoder(&b).Encode(v); err != nil {
+			t.Errorf("%s: encoding %#v: %s", c.Name(), v, err)
+		} else if !bytes.Equal(b.Bytes(), append(want, '\n')) {
+			t.Errorf("%s: encoded %#v to %q, expected %q", c.Name(), v, b.Bytes(), append(want, '\n'))
+		}
+	}
+}
+
+func TestMarshalEquivalent(t *testing.T) {
+	c := Current()
+	for _, v := range equivalent {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: marshaling %#v: %s", c.Name(), v, err)
+			continue
+		}
+		var decodedWant, decodedGot interface{}
+		if err = json.Unmarshal(want, &decodedWant); err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(got, &decodedGot); err != nil {
+			t.Errorf("%s: marshaled %#v to invalid JSON %s: %s", c.Name(), v, got, err)
+		} else if !reflect.DeepEqual(decodedGot, decodedWant) {
+			t.Errorf("%s: marshaled %#v to %s, which doesn't decode like %s", c.Name(), v, got, want)
+		}
+	}
+}
+
+func TestUnmarshalCompatible(t *testing.T) {
+	c := Current()
+	docs := []string{
+		`{"id":7,"name":"alert","optional":"set","raw":{"a":[1,2]},"tags":{"k":"v"},"nested":{"id":8},"numbers":[1,2.5,-3e2],"when":"2017-03-04T05:06:07.000000008Z","bytes":"YmluYXJ5AA==","any":{"list":["x",1,null]}}`,
+		`{"ID":9,"NAME":"case insensitive","unknown":"ignored"}`,
+		`{"nested":null,"numbers":null,"tags":{}}`,
+	}
+	for _, doc := range docs {
+		var want, got event
+		wantErr := json.Unmarshal([]byte(doc), &want)
+		err := c.Unmarshal([]byte(doc), &got)
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("%s: unmarshaling %s errored with %v, encoding/json with %v", c.Name(), doc, err, wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: unmarshaled %s to\n%#v\nencoding/json to\n%#v", c.Name(), doc, got, want)
+		}
+	}
+
+	for _, doc := range []string{`{"id":"not a number"}`, `{"name":`, `[1,2]`} {
+		var v event
+		if err := c.Unmarshal([]byte(doc), &v); err == nil {
+			t.Errorf("%s: expected an error unmarshaling %s", c.Name(), doc)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	defer Set(nil)
+	Set(Std)
+	if Current().Name() != "encoding/json" {
+		t.Errorf("Expected encoding/json to be set, got %s", Current().Name())
+	}
+	Set(nil)
+	if Current() != defaultCodec {
+		t.Errorf("Expected nil to restore %s, got %s", defaultCodec.Name(), Current().Name())
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	v := compatible[len(compatible)-1]
+	c := Current()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build jsoniter
+// +build jsoniter
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSONIter is json-iterator configured to behave like encoding/json: map keys sorted, HTML escaped and
+// invalid UTF-8 replaced. json-iterator writes a json.RawMessage as it is, where encoding/json compacts
+// and escapes it, so its output is too.
+var JSONIter Codec = jsonIter{jsoniter.ConfigCompatibleWithStandardLibrary}
+
+// defaultCodec is json-iterator in builds with the jsoniter tag
+var defaultCodec = JSONIter
+
+type jsonIter struct {
+	api jsoniter.API
+}
+
+func (j jsonIter) Name() string                               { return "jsoniter" }
+func (j jsonIter) Unmarshal(data []byte, v interface{}) error { return j.api.Unmarshal(data, v) }
+func (j jsonIter) NewEncoder(w io.Writer) Encoder             { return jsonIterEncoder{j, w} }
+
+func (j jsonIter) Marshal(v interface{}) ([]byte, error) {
+	b, err := j.api.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var compacted, escaped bytes.Buffer
+	if err = json.Compact(&compacted, b); err != nil {
+		return nil, err
+	}
+	json.HTMLEscape(&escaped, compacted.Bytes())
+	return escaped.Bytes(), nil
+}
+
+// jsonIterEncoder encodes with jsonIter's Marshal, as json-iterator's own encoder writes raw messages as they are
+type jsonIterEncoder struct {
+	j jsonIter
+	w io.Writer
+}
+
+func (e jsonIterEncoder) Encode(v interface{}) error {
+	b, err := e.j.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
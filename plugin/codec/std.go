@@ -0,0 +1,7 @@
+//go:build !jsoniter
+// +build !jsoniter
+
+package codec
+
+// defaultCodec is encoding/json in builds without the jsoniter tag
+var defaultCodec = Std
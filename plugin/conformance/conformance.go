@@ -0,0 +1,253 @@
+// Package conformance checks that a plugin speaks the plugin protocol correctly. It drives a plugin
+// binary (or an HTTP endpoint) with canonical start messages and validates what comes back against
+// the message formats in the message package. It's used by this SDK's own CI, and is meant to be
+// just as useful to anyone building an alternative runtime or orchestrator for these plugins.
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+const defaultTriggerTimeout = 30 * time.Second
+
+// ErrUnsupported is returned by a Target that can't run a kind of check
+var ErrUnsupported = errors.New("Not supported by this target")
+
+// Rejected is the error a Target returns when the plugin ran and refused a start message, ie: a binary
+// that started and exited non-zero. Any other error, like a binary that couldn't be run, is a problem
+// with the target rather than the plugin rejecting anything.
+type Rejected struct {
+	Reason string
+}
+
+// Error implements the error interface
+func (r *Rejected) Error() string {
+	return r.Reason
+}
+
+// Target is something that runs start messages: a plugin binary, or an HTTP endpoint
+type Target interface {
+	// Action runs an action start message to completion and returns what it emitted, or a *Rejected
+	// with whatever it did emit if the plugin refused it
+	Action(start []byte) ([]byte, error)
+	// StartTrigger starts a trigger, which will post its events to the dispatcher in the start message
+	StartTrigger(start []byte) (stop func(), err error)
+}
+
+// Sample is the input and connection to start an action or trigger with
+type Sample struct {
+	Input      interface{}
+	Connection interface{}
+	// ExpectError is set when the sample should produce an action result with an error status
+	ExpectError bool
+}
+
+// Result is the outcome of a single conformance check
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Suite is the set of checks to run against a Target
+type Suite struct {
+	Target   Target
+	Actions  map[string]Sample
+	Triggers map[string]Sample
+	// TriggerTimeout is how long to wait for a trigger's first event, defaults to 30s
+	TriggerTimeout time.Duration
+}
+
+// Run runs every check and returns the results, in order
+func (s *Suite) Run() []Result {
+	var results []Result
+	check := func(name string, err error) {
+		results = append(results, Result{Name: name, Err: err})
+	}
+
+	check("rejects an unknown message version", s.expectFailure(startMessage("v0", ActionStartType, map[string]interface{}{"action": "conformance"})))
+	check("rejects an unknown message type", s.expectFailure(startMessage(message.Version, "conformance_start", map[string]interface{}{})))
+	check("rejects an unknown action", s.expectFailure(ActionStartMessage("conformance_no_such_action", newMeta(), Sample{})))
+
+	for name, sample := range s.Actions {
+		check("action "+name, s.checkAction(name, sample))
+	}
+	for name, sample := range s.Triggers {
+		check("trigger "+name, s.checkTrigger(name, sample))
+	}
+	return results
+}
+
+// Test runs the suite as subtests of t
+func (s *Suite) Test(t *testing.T) {
+	for _, r := range s.Run() {
+		r := r
+		t.Run(r.Name, func(t *testing.T) {
+			if r.Err == ErrUnsupported {
+				t.Skip(r.Err)
+			}
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+		})
+	}
+}
+
+func (s *Suite) expectFailure(start []byte) error {
+	out, err := s.Target.Action(start)
+	if _, ok := err.(*Rejected); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to run the start message: %s", err)
+	}
+	// A runtime may also report the failure as an action result with an error status
+	var result message.ActionResult
+	if m, perr := parse(out, ActionEventType, &result); perr == nil && m != nil && result.Status == message.ERROR {
+		return nil
+	}
+	return fmt.Errorf("Expected the start message to be rejected, but got: %s", out)
+}
+
+func (s *Suite) checkAction(name string, sample Sample) error {
+	meta := newMeta()
+	out, err := s.Target.Action(ActionStartMessage(name, meta, sample))
+	if err != nil {
+		return err
+	}
+	events, err := ValidateActionStream(out)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := sameMeta(meta, event.Meta); err != nil {
+			return err
+		}
+	}
+	result := events[len(events)-1]
+	if sample.ExpectError && result.Status != message.ERROR {
+		return fmt.Errorf("Expected an error status but got %s", result.Status)
+	}
+	if !sample.ExpectError && result.Status != message.OK {
+		return fmt.Errorf("Expected an ok status but got %s: %s", result.Status, result.Error)
+	}
+	return nil
+}
+
+func (s *Suite) checkTrigger(name string, sample Sample) error {
+	events := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		select {
+		case events <- body:
+		default:
+		}
+	}))
+	defer server.Close()
+
+	meta := newMeta()
+	stop, err := s.Target.StartTrigger(TriggerStartMessage(name, meta, server.URL, sample))
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	timeout := s.TriggerTimeout
+	if timeout == 0 {
+		timeout = defaultTriggerTimeout
+	}
+	select {
+	case body := <-events:
+		event, err := ValidateTriggerEvent(body)
+		if err != nil {
+			return err
+		}
+		return sameMeta(meta, event.Meta)
+	case <-time.After(timeout):
+		return fmt.Errorf("No trigger event was dispatched within %s", timeout)
+	}
+}
+
+// Binary runs a plugin executable, passing start messages on stdin to its run command
+type Binary struct {
+	Path string
+	Env  []string // Env is added to the plugin's environment
+}
+
+// Action runs the plugin and returns its stdout, with a *Rejected if it exits non-zero
+func (b *Binary) Action(start []byte) ([]byte, error) {
+	cmd := exec.Command(b.Path, "run")
+	cmd.Env = append(os.Environ(), b.Env...)
+	cmd.Stdin = bytes.NewReader(start)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return stdout.Bytes(), &Rejected{Reason: fmt.Sprintf("Plugin failed: %s: %s", err, stderr.String())}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to run %s: %s", b.Path, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// StartTrigger starts the plugin in the background; stop kills it
+func (b *Binary) StartTrigger(start []byte) (func(), error) {
+	cmd := exec.Command(b.Path, "run")
+	cmd.Env = append(os.Environ(), b.Env...)
+	cmd.Stdin = bytes.NewReader(start)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}, nil
+}
+
+// HTTPEndpoint posts start messages to a plugin running in HTTP mode
+type HTTPEndpoint struct {
+	URL    string
+	Client *http.Client
+}
+
+// Action posts the start message and returns the response body, with a *Rejected if the plugin responded
+// 400 Bad Request and an error for any other status but 200
+func (h *HTTPEndpoint) Action(start []byte) ([]byte, error) {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(h.URL, "application/json", bytes.NewReader(start))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		return body, &Rejected{Reason: fmt.Sprintf("Plugin responded with %s: %s", resp.Status, bytes.TrimSpace(body))}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("Plugin responded with %s", resp.Status)
+	}
+	return body, nil
+}
+
+// StartTrigger is not supported, triggers don't run in HTTP mode
+func (h *HTTPEndpoint) StartTrigger(start []byte) (func(), error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,84 @@
+package conformance
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBinaryKeepsTheEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The plugin is a shell script")
+	}
+	path, done := script(t, "echo \"$CONFORMANCE_INHERITED $CONFORMANCE_ADDED\"\n")
+	defer done()
+
+	os.Setenv("CONFORMANCE_INHERITED", "inherited")
+	defer os.Unsetenv("CONFORMANCE_INHERITED")
+	b := &Binary{Path: path, Env: []string{"CONFORMANCE_ADDED=added"}}
+	out, err := b.Action(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "inherited added" {
+		t.Fatalf("Expected the plugin to get the environment and Env, got %q", out)
+	}
+}
+
+// script writes a plugin binary that's a shell script, returning it and a function removing it
+func script(t *testing.T, body string) (string, func()) {
+	f, err := ioutil.TempFile("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("#!/bin/sh\n" + body)
+	f.Close()
+	os.Chmod(f.Name(), 0700)
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+func TestOnlyARealRejectionPasses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The plugin is a shell script")
+	}
+	refuses, done := script(t, "echo 'Unknown action' >&2\nexit 1\n")
+	defer done()
+	accepts, done := script(t, "exit 0\n")
+	defer done()
+
+	start := ActionStartMessage("conformance_no_such_action", newMeta(), Sample{})
+	if err := (&Suite{Target: &Binary{Path: refuses}}).expectFailure(start); err != nil {
+		t.Fatalf("Expected a plugin exiting non-zero to have rejected the message, got %v", err)
+	}
+	for _, path := range []string{accepts, refuses + ".missing"} {
+		if err := (&Suite{Target: &Binary{Path: path}}).expectFailure(start); err == nil {
+			t.Errorf("Expected %s not to have rejected the message", path)
+		}
+	}
+}
+
+func TestHTTPEndpointRejections(t *testing.T) {
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unknown action", status)
+	}))
+	defer srv.Close()
+
+	s := &Suite{Target: &HTTPEndpoint{URL: srv.URL}}
+	start := ActionStartMessage("conformance_no_such_action", newMeta(), Sample{})
+	if err := s.expectFailure(start); err != nil {
+		t.Fatalf("Expected a 400 to be a rejection, got %v", err)
+	}
+	status = http.StatusBadGateway
+	if err := s.expectFailure(start); err == nil {
+		t.Fatal("Expected a 502 not to be a rejection")
+	}
+	srv.Close()
+	if err := s.expectFailure(start); err == nil {
+		t.Fatal("Expected an unreachable endpoint not to be a rejection")
+	}
+}
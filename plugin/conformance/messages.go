@@ -0,0 +1,165 @@
+package conformance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// Message types defined by the protocol
+const (
+	ActionStartType  = "action_start"
+	ActionEventType  = "action_event"
+	TriggerStartType = "trigger_start"
+	TriggerEventType = "trigger_event"
+)
+
+// ActionStartMessage builds a canonical action start message
+func ActionStartMessage(action string, meta json.RawMessage, sample Sample) []byte {
+	return startMessage(message.Version, ActionStartType, map[string]interface{}{
+		"meta":       meta,
+		"action":     action,
+		"connection": orEmpty(sample.Connection),
+		"input":      orEmpty(sample.Input),
+	})
+}
+
+// TriggerStartMessage builds a canonical trigger start message dispatching to dispatcherURL
+func TriggerStartMessage(trigger string, meta json.RawMessage, dispatcherURL string, sample Sample) []byte {
+	return startMessage(message.Version, TriggerStartType, map[string]interface{}{
+		"meta":       meta,
+		"trigger":    trigger,
+		"dispatcher": map[string]string{"url": dispatcherURL},
+		"connection": orEmpty(sample.Connection),
+		"input":      orEmpty(sample.Input),
+	})
+}
+
+// ValidateActionEvent checks b is a single well formed action event and returns it
+func ValidateActionEvent(b []byte) (*message.ActionResult, error) {
+	var result message.ActionResult
+	if _, err := parse(b, ActionEventType, &result); err != nil {
+		return nil, err
+	}
+	switch result.Status {
+	case message.OK, message.PARTIAL:
+		if result.Error != "" {
+			return nil, fmt.Errorf("Action event has an %s status but an error: %s", result.Status, result.Error)
+		}
+	case message.ERROR:
+		if result.Error == "" {
+			return nil, errors.New("Action event has an error status but no error message")
+		}
+	default:
+		return nil, fmt.Errorf("Action event has an unknown status: %q", result.Status)
+	}
+	return &result, nil
+}
+
+// ValidateActionStream checks b is the output of a streamed action, newline delimited action events each
+// with a partial status and then its result, and returns them in order. An action that isn't streamed is a
+// stream of just its result.
+func ValidateActionStream(b []byte) ([]*message.ActionResult, error) {
+	var events []*message.ActionResult
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if n := len(events); n > 0 && events[n-1].Status != message.PARTIAL {
+			return nil, fmt.Errorf("Action event follows the result: %q", line)
+		}
+		event, err := ValidateActionEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("Action emitted no events")
+	}
+	if events[len(events)-1].Status == message.PARTIAL {
+		return nil, errors.New("Action stream ended without a result")
+	}
+	return events, nil
+}
+
+// ValidateTriggerEvent checks b is a single well formed trigger event and returns it
+func ValidateTriggerEvent(b []byte) (*message.TriggerEvent, error) {
+	var event message.TriggerEvent
+	if _, err := parse(b, TriggerEventType, &event); err != nil {
+		return nil, err
+	}
+	if len(event.Output.RawMessage) == 0 {
+		return nil, errors.New("Trigger event has no output")
+	}
+	return &event, nil
+}
+
+// parse decodes the envelope, checks its version and type, and decodes the body into v.
+// Exactly one JSON value is allowed.
+func parse(b []byte, kind string, v interface{}) (*message.Message, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	var envelope struct {
+		message.Header
+		Body json.RawMessage `json:"body"`
+	}
+	if err := dec.Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("Unable to parse message: %s: %q", err, b)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("Expected a single message but got more: %q", b)
+	}
+	if envelope.Version != message.Version {
+		return nil, fmt.Errorf("Expected version %s but got %q", message.Version, envelope.Version)
+	}
+	if envelope.Type != kind {
+		return nil, fmt.Errorf("Expected a %s message but got %q", kind, envelope.Type)
+	}
+	if len(envelope.Body) == 0 {
+		return nil, errors.New("Message has no body")
+	}
+	if err := json.Unmarshal(envelope.Body, v); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s body: %s", kind, err)
+	}
+	return &message.Message{Header: envelope.Header, Body: message.Body{RawMessage: envelope.Body}}, nil
+}
+
+// sameMeta checks the meta sent in the start message came back unchanged
+func sameMeta(sent json.RawMessage, got *json.RawMessage) error {
+	if got == nil {
+		return errors.New("Meta from the start message was not passed through")
+	}
+	var a, b interface{}
+	json.Unmarshal(sent, &a)
+	if err := json.Unmarshal(*got, &b); err != nil {
+		return fmt.Errorf("Unable to parse meta: %s", err)
+	}
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		return fmt.Errorf("Expected meta %s to be passed through, but got %s", sent, *got)
+	}
+	return nil
+}
+
+func startMessage(version, kind string, body interface{}) []byte {
+	b, _ := json.Marshal(map[string]interface{}{"version": version, "type": kind, "body": body})
+	return b
+}
+
+func newMeta() json.RawMessage {
+	id := make([]byte, 8)
+	rand.Read(id)
+	b, _ := json.Marshal(map[string]string{"conformance_id": hex.EncodeToString(id)})
+	return b
+}
+
+func orEmpty(v interface{}) interface{} {
+	if v == nil {
+		return map[string]interface{}{}
+	}
+	return v
+}
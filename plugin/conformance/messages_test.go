@@ -0,0 +1,51 @@
+package conformance
+
+import "testing"
+
+func TestValidateActionEvent(t *testing.T) {
+	good := `{"version":"v1","type":"action_event","body":{"meta":{"action_id":14},"status":"ok","error":"","output":{"greeting":"hi"}}}`
+	if _, err := ValidateActionEvent([]byte(good)); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := map[string]string{
+		"wrong type":        `{"version":"v1","type":"trigger_event","body":{}}`,
+		"error without msg": `{"version":"v1","type":"action_event","body":{"status":"error","error":""}}`,
+		"two messages":      good + good,
+		"unknown status":    `{"version":"v1","type":"action_event","body":{"status":"maybe"}}`,
+	}
+	for name, msg := range bad {
+		if _, err := ValidateActionEvent([]byte(msg)); err == nil {
+			t.Fatalf("Expected %s to fail validation", name)
+		}
+	}
+}
+
+func TestValidateActionStream(t *testing.T) {
+	partial := `{"version":"v1","type":"action_event","body":{"meta":{"action_id":14},"status":"partial","error":"","output":{"page":1}}}`
+	result := `{"version":"v1","type":"action_event","body":{"meta":{"action_id":14},"status":"ok","error":"","output":{"pages":2}}}`
+	events, err := ValidateActionStream([]byte(partial + "\n" + partial + "\n" + result + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[2].Status != "ok" {
+		t.Fatalf("Expected two partial events and the result, got %v", events)
+	}
+	if events, err = ValidateActionStream([]byte(result)); err != nil || len(events) != 1 {
+		t.Fatalf("Expected a result on its own to be a stream, got %v, %v", events, err)
+	}
+
+	bad := map[string]string{
+		"no result":           partial + "\n" + partial + "\n",
+		"event after result":  result + "\n" + partial + "\n",
+		"two results":         result + "\n" + result + "\n",
+		"nothing":             "\n",
+		"partial with error":  `{"version":"v1","type":"action_event","body":{"status":"partial","error":"oops"}}` + "\n" + result,
+		"two events per line": partial + partial + "\n" + result,
+	}
+	for name, stream := range bad {
+		if _, err := ValidateActionStream([]byte(stream)); err == nil {
+			t.Errorf("Expected %s to fail validation", name)
+		}
+	}
+}
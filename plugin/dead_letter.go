@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/deadletter"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// deadLetters is set by SetDeadLetter. When set, failed actions and trigger events that couldn't be
+// dispatched after retrying are kept in the store instead of being lost.
+var deadLetters *deadLetterConfig
+
+// deadLetterBackoff is the wait before the first retry of a trigger event, doubling for each retry after
+var deadLetterBackoff = time.Second
+
+type deadLetterConfig struct {
+	store   deadletter.Store
+	retries int
+}
+
+// SetDeadLetter keeps what the plugin permanently failed to process in store: the start message of
+// an action that failed, and trigger events the dispatcher still refused after retries attempts.
+// A trigger carries on with its next event instead of stopping. Use the deadletter command to list
+// and re-drive them once the cause is fixed.
+//
+// A start message's connection holds credentials, so it's sealed with the keys set by SetEncryption
+// before it's stored, and opened again to re-drive it. Without keys it isn't stored at all, and an
+// action that needs it can't be re-driven.
+func (p Plugin) SetDeadLetter(store deadletter.Store, retries int) {
+	deadLetters = &deadLetterConfig{store: store, retries: retries}
+}
+
+// DeadLetters returns the store set by SetDeadLetter, or the default directory in the plugin cache
+func (p Plugin) DeadLetters() deadletter.Store {
+	if deadLetters != nil {
+		return deadLetters.store
+	}
+	return deadletter.DirStore{}
+}
+
+// Redrive processes a dead letter again with the current code, and removes it if it succeeds this time
+func (p *Plugin) Redrive(id string) error {
+	store := p.DeadLetters()
+	e, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err = p.replay(e.Message, e.Dispatcher); err != nil {
+		return err
+	}
+	return store.Delete(id)
+}
+
+// deadLetter stores a failed message, logging rather than failing if that doesn't work either
+func deadLetter(kind, name string, cause error, attempts int, msg interface{}, dispatcher json.RawMessage) {
+	e, err := deadletter.New(kind, name, cause, attempts, msg)
+	if err == nil {
+		e.Dispatcher = dispatcher
+		err = deadLetters.store.Put(e)
+	}
+	if err != nil {
+		log.Errorf("Unable to dead letter %s for %s, it's lost: %s", kind, name, err)
+		return
+	}
+	atomic.AddInt64(&deadLettered, 1)
+	log.Warnf("Dead lettered %s for %s as %s: %s", kind, name, e.ID, cause)
+}
+
+// deadLetterStart dead letters the start message body of an action that failed, with its connection
+// sealed or left out, see SetDeadLetter
+func deadLetterStart(name string, cause error, body json.RawMessage) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		log.Errorf("Unable to dead letter %s for %s, it's lost: %s", deadletter.ActionStart, name, err)
+		return
+	}
+	if connection, ok := fields["connection"]; ok && string(connection) != "null" {
+		if encryptionKeys == nil {
+			log.Warnf("Dead lettering %s for %s without its connection, set an encryption key to keep it sealed", deadletter.ActionStart, name)
+			delete(fields, "connection")
+		} else {
+			e, err := sealed.Seal(encryptionKeys, connection)
+			if err != nil {
+				log.Errorf("Unable to dead letter %s for %s, it's lost: %s", deadletter.ActionStart, name, err)
+				return
+			}
+			fields["connection"], _ = json.Marshal(e)
+		}
+	}
+	sealedBody, _ := json.Marshal(fields)
+	start := &message.Message{
+		Header: message.Header{Version: message.Version, Type: ActionStart},
+		Body:   message.Body{RawMessage: sealedBody},
+	}
+	deadLetter(deadletter.ActionStart, name, cause, 1, start, nil)
+}
+
+// openConnection returns the start message data with the connection deadLetterStart sealed opened again,
+// or as it is if it isn't sealed
+func openConnection(data []byte) ([]byte, error) {
+	var start struct {
+		message.Header
+		Body map[string]json.RawMessage `json:"body"`
+	}
+	if json.Unmarshal(data, &start) != nil {
+		return data, nil
+	}
+	var e sealed.Envelope
+	if json.Unmarshal(start.Body["connection"], &e) != nil {
+		return data, nil
+	}
+	if encryptionKeys == nil {
+		return nil, errors.New("The connection was sealed, set the encryption key it was sealed with to open it")
+	}
+	connection, err := sealed.Open(encryptionKeys, &e)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open the connection: %s", err)
+	}
+	start.Body["connection"] = connection
+	return json.Marshal(&start)
+}
+
+// sendWithRetry dispatches m, retrying with backoff when dead lettering is on
+func sendWithRetry(d Dispatcher, m *message.Message) (int, error) {
+	err := d.Send(m)
+	attempts := 1
+	if deadLetters == nil {
+		return attempts, err
+	}
+	backoff := deadLetterBackoff
+	for ; err != nil && attempts <= deadLetters.retries; attempts++ {
+		log.Warnf("Sending trigger event failed, retrying in %s: %s", backoff, err)
+		time.Sleep(utils.Jitter(backoff, 0.2))
+		backoff *= 2
+		err = d.Send(m)
+	}
+	return attempts, err
+}
@@ -0,0 +1,234 @@
+// Package deadletter keeps the events and start messages a plugin failed to process for good, so
+// they can be inspected and re-driven once the cause is fixed instead of being lost. Entries hold the
+// whole message, connection included, so they're written with owner-only permissions.
+package deadletter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+const filePerms = 0600
+
+// DefaultDir is where dead letters are kept in the plugin cache
+const DefaultDir = "/var/cache/deadletter"
+
+// Kinds of dead letter
+const (
+	ActionStart  = "action_start"  // ActionStart is an action start message whose action failed
+	TriggerEvent = "trigger_event" // TriggerEvent is a trigger event that couldn't be dispatched
+)
+
+// ErrNotFound is returned when a dead letter doesn't exist
+var ErrNotFound = errors.New("Dead letter not found")
+
+// Entry is a dead letter
+type Entry struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Name     string          `json:"name"` // Name of the action or trigger
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	Failed   time.Time       `json:"failed"`
+	Message  json.RawMessage `json:"message"` // Message is the start message or event, as it would've been sent
+	// Dispatcher is the dispatcher configuration of the trigger, so events can be re-sent to it
+	Dispatcher json.RawMessage `json:"dispatcher,omitempty"`
+}
+
+// New returns an entry with a fresh ID, failed now
+func New(kind, name string, err error, attempts int, msg interface{}) (*Entry, error) {
+	b, merr := json.Marshal(msg)
+	if merr != nil {
+		return nil, merr
+	}
+	now := time.Now().UTC()
+	return &Entry{
+		ID:       now.Format("20060102T150405") + "-" + utils.UniqueID()[:8],
+		Kind:     kind,
+		Name:     name,
+		Error:    err.Error(),
+		Attempts: attempts,
+		Failed:   now,
+		Message:  b,
+	}, nil
+}
+
+// Store keeps dead letters
+type Store interface {
+	Put(e *Entry) error
+	Get(id string) (*Entry, error)
+	List() ([]*Entry, error) // List returns every entry, oldest first
+	Delete(id string) error
+}
+
+// DirStore keeps each dead letter as a JSON file in a directory, by default DefaultDir
+type DirStore struct {
+	Dir string
+}
+
+func (d DirStore) dir() string {
+	if d.Dir == "" {
+		return DefaultDir
+	}
+	return d.Dir
+}
+
+// Put implements Store
+func (d DirStore) Put(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := utils.OpenFile(filepath.Join(d.dir(), e.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerms)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	return err
+}
+
+// Get implements Store
+func (d DirStore) Get(id string) (*Entry, error) {
+	if err := validID(id); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(d.dir(), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	return e, json.Unmarshal(b, e)
+}
+
+// List implements Store
+func (d DirStore) List() ([]*Entry, error) {
+	files, err := ioutil.ReadDir(d.dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		e, err := d.Get(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Delete implements Store
+func (d DirStore) Delete(id string) error {
+	if err := validID(id); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(d.dir(), id+".json"))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ObjectStore keeps dead letters in an S3-compatible bucket under Prefix, by default "deadletter/"
+type ObjectStore struct {
+	Client *objectstore.Client
+	Prefix string
+}
+
+func (o ObjectStore) key(id string) string {
+	if o.Prefix == "" {
+		return "deadletter/" + id + ".json"
+	}
+	return o.Prefix + id + ".json"
+}
+
+// Put implements Store
+func (o ObjectStore) Put(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return o.Client.Put(o.key(e.ID), bytes.NewReader(b), int64(len(b)), "application/json")
+}
+
+// Get implements Store
+func (o ObjectStore) Get(id string) (*Entry, error) {
+	if err := validID(id); err != nil {
+		return nil, err
+	}
+	r, err := o.Client.Get(o.key(id))
+	if err == objectstore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	e := &Entry{}
+	return e, json.NewDecoder(r).Decode(e)
+}
+
+// List implements Store
+func (o ObjectStore) List() ([]*Entry, error) {
+	prefix := strings.TrimSuffix(o.key(""), ".json")
+	objects, err := o.Client.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, obj := range objects {
+		e, err := o.Get(strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Delete implements Store
+func (o ObjectStore) Delete(id string) error {
+	if err := validID(id); err != nil {
+		return err
+	}
+	return o.Client.Delete(o.key(id))
+}
+
+func validID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Sort(byFailed(entries))
+}
+
+type byFailed []*Entry
+
+func (b byFailed) Len() int           { return len(b) }
+func (b byFailed) Less(i, j int) bool { return b[i].Failed.Before(b[j].Failed) }
+func (b byFailed) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,38 @@
+package deadletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := DirStore{Dir: dir}
+
+	e, err := New(TriggerEvent, "new_alert", errors.New("dispatcher unavailable"), 3, map[string]string{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(e); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := store.List()
+	if err != nil || len(entries) != 1 || entries[0].ID != e.ID || string(entries[0].Message) != `{"id":"1"}` {
+		t.Fatalf("Expected the entry back but got %v, %v", entries, err)
+	}
+	if _, err = store.Get("../" + e.ID); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a path outside the store but got %v", err)
+	}
+	if err = store.Delete(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get(e.ID); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound after deleting but got %v", err)
+	}
+}
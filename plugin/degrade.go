@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/breaker"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Fallbacks of a Degradation, what an action does while its vendor's breaker is open
+const (
+	FallbackFail    = "fail"    // FallbackFail fails the action straight away, rather than waiting on the vendor
+	FallbackCache   = "cache"   // FallbackCache returns the last output the action had for the same input
+	FallbackPartial = "partial" // FallbackPartial returns what the action's Partial function makes without the vendor
+)
+
+// DefaultDegradedTTL is how long outputs are kept for FallbackCache, if the Degradation doesn't say
+const DefaultDegradedTTL = 24 * time.Hour
+
+// Degradation declares how an action degrades when the vendor it calls is failing, so a workflow enriching
+// events carries on with less rather than stopping. Results produced by a fallback succeed with Degraded set
+// to the fallback, and a message.WarnDegraded warning.
+type Degradation struct {
+	Breaker  *breaker.Breaker // Breaker guards the vendor, every Act is recorded with it
+	Fallback string           // Fallback is one of FallbackFail, FallbackCache or FallbackPartial
+	// CacheTTL is how long outputs are kept in the plugin cache for FallbackCache, DefaultDegradedTTL if 0
+	CacheTTL time.Duration
+	// Partial makes the output of FallbackPartial, err being why the vendor wasn't called
+	Partial func(err error) (Output, error)
+}
+
+// act performs the action, through its breaker and fallback if it's Degradable. degraded is the fallback
+// out came from, if one was used.
+func (a *actionTask) act() (out Output, degraded string, err error) {
+	degradable, ok := a.action.(Degradable)
+	if !ok || degradable.Degradation().Breaker == nil {
+		if err = a.rotator.run(a.action.Act); err != nil {
+			return nil, "", err
+		}
+		return a.output(), "", nil
+	}
+	d := degradable.Degradation()
+	if open := d.Breaker.Allow(); open != nil {
+		return d.fallback(a.degradedKey(), open)
+	}
+	err = a.rotator.run(a.action.Act)
+	d.Breaker.Record(err)
+	if err != nil {
+		return nil, "", err
+	}
+	out = a.output()
+	if d.Fallback == FallbackCache {
+		if err := d.remember(a.degradedKey(), out); err != nil {
+			log.Warnf("Unable to keep the output of %s for while its vendor is unavailable: %s", a.message.Action, err)
+		}
+	}
+	return out, "", nil
+}
+
+// output returns the output of the action, empty unless it's Outputable
+func (a *actionTask) output() Output {
+	if outputable, ok := a.action.(Outputable); ok {
+		return outputable.Output()
+	}
+	return struct{}{}
+}
+
+// degradedKey is the cache entry the output of the action for its input is kept in
+func (a *actionTask) degradedKey() string {
+	sum := sha256.Sum256(a.message.Input.RawMessage)
+	return "degraded/" + a.message.Action + "/" + hex.EncodeToString(sum[:])
+}
+
+// fallback returns the output of the fallback, or open if there isn't one
+func (d Degradation) fallback(key string, open error) (Output, string, error) {
+	switch d.Fallback {
+	case FallbackCache:
+		data, err := cache.Get(key)
+		if err == cache.ErrNotFound {
+			return nil, "", fmt.Errorf("%s, and there's no earlier output to return", open)
+		} else if err != nil {
+			return nil, "", fmt.Errorf("%s, and the earlier output couldn't be read: %s", open, err)
+		}
+		return json.RawMessage(data), FallbackCache, nil
+	case FallbackPartial:
+		if d.Partial == nil {
+			return nil, "", fmt.Errorf("%s, and the action has no partial output", open)
+		}
+		out, err := d.Partial(open)
+		if err != nil {
+			return nil, "", err
+		}
+		return out, FallbackPartial, nil
+	default:
+		return nil, "", open
+	}
+}
+
+// remember keeps out for FallbackCache, sealed as it would be sent so the cache holds nothing sensitive in
+// the clear
+func (d Degradation) remember(key string, out Output) error {
+	sealedOut, err := seal(out, out)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sealedOut)
+	if err != nil {
+		return err
+	}
+	ttl := d.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultDegradedTTL
+	}
+	return cache.PutTTL(key, data, ttl)
+}
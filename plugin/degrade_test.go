@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/breaker"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+)
+
+// EnrichAction greets through a vendor that's down when it says so
+type EnrichAction struct {
+	HelloAction
+	down        bool
+	degradation Degradation
+}
+
+func (e *EnrichAction) Act() error {
+	if e.down {
+		return errors.New("vendor unavailable")
+	}
+	return e.HelloAction.Act()
+}
+
+func (e *EnrichAction) Degradation() Degradation {
+	return e.degradation
+}
+
+func runEnrich(t *testing.T, action *EnrichAction) string {
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(actionStartMessage))
+	dispatcher := &mockDispatcher{}
+	defaultActionDispatcher = dispatcher
+	p := New()
+	p.AddAction(action)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return dispatcher.result
+}
+
+func TestActionDegradesToCachedOutput(t *testing.T) {
+	defer cache.SetBackend(cache.CurrentBackend())
+	cache.SetBackend(&cache.MemoryBackend{})
+	action := &EnrichAction{degradation: Degradation{
+		Breaker:  &breaker.Breaker{Name: "vendor", Failures: 1},
+		Fallback: FallbackCache,
+	}}
+
+	if result := runEnrich(t, action); strings.Contains(result, "degraded") {
+		t.Fatalf("Expected the action to run normally, got %s", result)
+	}
+	action.down = true
+	if result := runEnrich(t, action); !strings.Contains(result, `"status":"error"`) {
+		t.Fatalf("Expected the action to fail while the breaker is closed, got %s", result)
+	}
+	result := runEnrich(t, action)
+	if !strings.Contains(result, `"output":{"greeting":"good day to you"}`) || !strings.Contains(result, `"degraded":"cache"`) {
+		t.Fatalf("Expected the cached output once the breaker opened, got %s", result)
+	}
+}
+
+func TestActionDegradesToPartialOutput(t *testing.T) {
+	action := &EnrichAction{down: true}
+	action.degradation = Degradation{
+		Breaker:  &breaker.Breaker{Name: "vendor", Failures: 1},
+		Fallback: FallbackPartial,
+		Partial: func(err error) (Output, error) {
+			return &HelloActionOutput{Greeting: "hello"}, nil
+		},
+	}
+	runEnrich(t, action)
+	result := runEnrich(t, action)
+	if !strings.Contains(result, `"output":{"greeting":"hello"}`) || !strings.Contains(result, `"degraded":"partial"`) {
+		t.Fatalf("Expected the partial output once the breaker opened, got %s", result)
+	}
+
+	action.degradation.Fallback = FallbackFail
+	result = runEnrich(t, action)
+	if !strings.Contains(result, "Circuit breaker vendor is open") {
+		t.Fatalf("Expected the action to fail fast once the breaker opened, got %s", result)
+	}
+}
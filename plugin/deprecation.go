@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/schema"
+)
+
+var (
+	deprecationsMu sync.Mutex
+	deprecations   = map[string]int64{}
+)
+
+// deprecatedUses returns warnings for what's deprecated that the start of the named trigger or action
+// uses, v being it and input its raw input, and counts them
+func deprecatedUses(name string, v interface{}, input json.RawMessage) []message.Warning {
+	var warnings []message.Warning
+	if d, ok := v.(Deprecatable); ok && d.Deprecated() != "" {
+		warnings = append(warnings, message.Warn(message.WarnDeprecated, "%s is deprecated: %s", name, d.Deprecated()))
+		countDeprecation(name)
+	}
+	for _, field := range deprecatedFields(v, input) {
+		warnings = append(warnings, message.Deprecated(field.name, field.instead))
+		countDeprecation(name + "." + field.name)
+	}
+	return warnings
+}
+
+// deprecatedField is a deprecated input field that was used
+type deprecatedField struct {
+	name    string
+	instead string
+}
+
+// deprecatedFields returns the deprecated fields in input, those its schema marks and those tagged in its
+// input struct
+func deprecatedFields(v interface{}, input json.RawMessage) []deprecatedField {
+	if len(input) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var fields []deprecatedField
+	if schemable, ok := v.(InputSchemable); ok {
+		if s, err := schema.Compile(schemable.InputSchema()); err == nil {
+			paths, _ := s.Deprecated(input)
+			for _, path := range paths {
+				seen[path] = true
+				fields = append(fields, deprecatedField{name: path})
+			}
+		}
+	}
+	if inputable, ok := v.(Inputable); ok {
+		var present map[string]json.RawMessage
+		if err := json.Unmarshal(input, &present); err != nil {
+			return fields
+		}
+		for _, field := range taggedDeprecated(inputable.Input()) {
+			if _, ok := present[field.name]; ok && !seen[field.name] {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// taggedDeprecated returns the fields of v's struct with a deprecated tag, by JSON name
+func taggedDeprecated(v interface{}) []deprecatedField {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []deprecatedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		instead, ok := f.Tag.Lookup("deprecated")
+		if !ok {
+			continue
+		}
+		if instead == "true" {
+			instead = ""
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, deprecatedField{name: name, instead: instead})
+	}
+	return fields
+}
+
+func countDeprecation(name string) {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+	deprecations[name]++
+}
+
+// deprecatedUsage returns how often each deprecated trigger, action or field was used, nil if none were
+func deprecatedUsage() map[string]int64 {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+	if len(deprecations) == 0 {
+		return nil
+	}
+	usage := make(map[string]int64, len(deprecations))
+	for name, n := range deprecations {
+		usage[name] = n
+	}
+	return usage
+}
@@ -1,13 +1,14 @@
 package plugin
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
 	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils/bufpool"
 )
 
 // the default dispatcher for a trigger is HTTP, and for actions is Stdout.
@@ -44,40 +45,58 @@ type StdoutDispatcher struct{}
 
 // Send dispatches a trigger event
 func (d *StdoutDispatcher) Send(event *message.Message) error {
-	messageBytes, err := json.Marshal(event)
+	buf, err := bufpool.Marshal(event)
 
 	if err != nil {
 		return err
 	}
+	defer bufpool.Put(buf)
 
-	_, err = os.Stdout.Write(messageBytes)
+	_, err = os.Stdout.Write(buf.Bytes())
 	return err
 }
 
 // HTTPDispatcher will dispatch via HTTP
 type HTTPDispatcher struct {
-	URL    string `json:"url"`
-	client http.Client
+	URL string `json:"url"`
+}
+
+// dispatchClient is shared by HTTP dispatchers, made on first use so it follows the httpclient policy set
+// by then
+var (
+	dispatchClientOnce sync.Once
+	dispatchClient     *http.Client
+)
+
+func httpDispatchClient() *http.Client {
+	dispatchClientOnce.Do(func() {
+		dispatchClient = httpclient.New(httpclient.Options{Internal: true})
+	})
+	return dispatchClient
 }
 
 // Send dispatches a trigger event
 func (d *HTTPDispatcher) Send(event *message.Message) error {
-	messageBytes, err := json.Marshal(event)
+	buf, err := bufpool.Marshal(event)
 
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", d.URL, bytes.NewBuffer(messageBytes))
+	// the body puts the buffer back once the request is sent, which may be after Do returns
+	body := bufpool.NewBody(buf)
+	req, err := http.NewRequest("POST", d.URL, body)
 
 	if err != nil {
+		body.Close()
 		err = fmt.Errorf("Unable to POST to dispatcher: %+v", err)
 		return err
 	}
+	req.ContentLength = int64(buf.Len())
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := d.client.Do(req)
+	resp, err := httpDispatchClient().Do(req)
 	if err != nil {
 		err = fmt.Errorf("Unable to send event to http dispatcher: %+v", err)
 		return err
@@ -107,13 +126,14 @@ func NewFileDispatcher(filename string) (*FileDispatcher, error) {
 
 // Send dispatches a trigger event
 func (d *FileDispatcher) Send(event *message.Message) error {
-	messageBytes, err := json.Marshal(event)
+	buf, err := bufpool.Marshal(event)
 
 	if err != nil {
 		return err
 	}
+	defer bufpool.Put(buf)
 
-	if _, err = d.fd.Write(messageBytes); err != nil {
+	if _, err = d.fd.Write(buf.Bytes()); err != nil {
 		return err
 	}
 
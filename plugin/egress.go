@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+// airGapped is set by SetAirGapped, with the hosts configured on top of those the plugin declares
+var (
+	airGapped   bool
+	egressHosts []string
+)
+
+// SetAirGapped turns on air-gapped mode: the plugin only connects to the hosts declared in its Meta's
+// Egress, and any given here, ie: a customer's on-premise server. Any other connection made through the
+// httpclient package fails with a policy error, which is logged. It's turned on by PLUGIN_AIRGAPPED, with
+// more hosts comma separated in PLUGIN_EGRESS_ALLOW.
+func (p Plugin) SetAirGapped(hosts ...string) {
+	airGapped = true
+	egressHosts = append(egressHosts, hosts...)
+}
+
+// declareEgress holds connections to the plugin's declared hosts, in air-gapped mode
+func (p *Plugin) declareEgress() {
+	if !airGapped {
+		return
+	}
+	hosts := append([]string{}, p.Meta.Egress...)
+	httpclient.SetEgress(append(hosts, egressHosts...))
+}
+
+// splitHosts splits a comma separated list of hosts
+func splitHosts(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+)
+
+// encryptionKeys is set by SetEncryption. When set, sensitive trigger events and action outputs are sealed
+// before they're dispatched.
+var encryptionKeys sealed.Keys
+
+// Sensitive is implemented by an output that should be sealed whole. Outputs that only have some sensitive
+// fields tag them sensitive:"true" instead, and have just those sealed:
+//
+//	type Output struct {
+//		Username string `json:"username"`
+//		Password string `json:"password" sensitive:"true"`
+//	}
+type Sensitive interface {
+	Sensitive() bool
+}
+
+// SetEncryption seals the sensitive parts of trigger events and action outputs with keys, see the sealed
+// package, so intermediaries that relay them can't read them. It's turned on with the key in
+// PLUGIN_ENCRYPTION_KEY when that's set.
+func (p Plugin) SetEncryption(keys sealed.Keys) {
+	encryptionKeys = keys
+}
+
+// seal returns out with the parts marked sensitive on marked sealed, or out as is if encryption is off
+// or nothing is marked. marked is the output as the plugin produced it, before a transform could drop
+// the marks.
+func seal(marked, out Output) (Output, error) {
+	if encryptionKeys == nil || out == nil {
+		return out, nil
+	}
+	if s, ok := marked.(Sensitive); ok && s.Sensitive() {
+		sealedOut, err := sealed.SealBody(encryptionKeys, out)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to seal sensitive output: %s", err)
+		}
+		return sealedOut, nil
+	}
+	if fields := sealed.Fields(marked); len(fields) > 0 {
+		sealedOut, err := sealed.SealFields(encryptionKeys, out, fields)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to seal sensitive output fields: %s", err)
+		}
+		return sealedOut, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+)
+
+type credentialOutput struct {
+	Username string `json:"username"`
+	Password string `json:"password" sensitive:"true"`
+}
+
+type CredentialTrigger struct {
+	Trigger
+}
+
+func (t *CredentialTrigger) Name() string        { return "credential_trigger" }
+func (t *CredentialTrigger) Description() string { return "emits credentials" }
+func (t *CredentialTrigger) RunTrigger() error {
+	return t.Send(&credentialOutput{Username: "bob", Password: "hunter2"})
+}
+
+func TestTriggerSealsSensitiveFields(t *testing.T) {
+	keys := &sealed.StaticKeys{ID: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	defer func() { encryptionKeys = nil }()
+	Plugin{}.SetEncryption(keys)
+
+	dispatcher := &capturingDispatcher{}
+	trigger := &CredentialTrigger{}
+	task := &triggerTask{
+		message:    &message.TriggerStart{Trigger: trigger.Name()},
+		trigger:    trigger,
+		dispatcher: dispatcher,
+	}
+	if err := task.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dispatcher.messages) != 1 {
+		t.Fatalf("Expected one event, got %v", dispatcher.messages)
+	}
+	m := dispatcher.messages[0]
+	if strings.Contains(m, "hunter2") || !strings.Contains(m, `"password":{"$sealed"`) || !strings.Contains(m, `"username":"bob"`) {
+		t.Errorf("Expected only the password sealed, got %s", m)
+	}
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/komand/plugin-sdk-go/plugin/breaker"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// CodedError is an error marked with a code from the catalog, see message.ErrorCode
+type CodedError struct {
+	Code message.ErrorCode
+	Err  error
+}
+
+// Error implements error
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+// WithCode marks err with the code, which an action failing with it is sent with, ie:
+//
+//	if resp.StatusCode == http.StatusTooManyRequests {
+//		return plugin.WithCode(message.CodeRateLimited, err)
+//	}
+func WithCode(code message.ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// ErrorCode returns the code of err: the one it was marked with by WithCode, or its ErrorCode method
+// returns, or the code of the errors the SDK knows, ie: message.CodeAuthExpired for an AuthExpired error.
+// Anything else is message.CodeInternal.
+func ErrorCode(err error) message.ErrorCode {
+	switch e := err.(type) {
+	case *CodedError:
+		return e.Code
+	case interface {
+		ErrorCode() message.ErrorCode
+	}:
+		return e.ErrorCode()
+	case *breaker.OpenError:
+		return message.CodeVendorUnavailable
+	}
+	if IsAuthExpired(err) {
+		return message.CodeAuthExpired
+	}
+	if err == context.DeadlineExceeded {
+		return message.CodeTimeout
+	}
+	return message.CodeInternal
+}
@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/breaker"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected message.ErrorCode
+	}{
+		{errors.New("boom"), message.CodeInternal},
+		{WithCode(message.CodeRateLimited, errors.New("429")), message.CodeRateLimited},
+		{AuthExpired(errors.New("401")), message.CodeAuthExpired},
+		{&breaker.OpenError{Name: "vendor"}, message.CodeVendorUnavailable},
+		{context.DeadlineExceeded, message.CodeTimeout},
+	}
+	for _, test := range tests {
+		if code := ErrorCode(test.err); code != test.expected {
+			t.Errorf("Expected %q to have code %s, got %s", test.err, test.expected, code)
+		}
+	}
+	if WithCode(message.CodeNotFound, nil) != nil {
+		t.Error("Expected no error to stay nil")
+	}
+	if !message.CodeAuthExpired.Known() || message.CodeAuthExpired.Description() != "Authentication expired" {
+		t.Error("Expected E2003 in the catalog")
+	}
+}
+
+func TestFailedActionSendsErrorCode(t *testing.T) {
+	action := &EnrichAction{down: true}
+	if result := runEnrich(t, action); !strings.Contains(result, `"error_code":"E5001"`) {
+		t.Fatalf("Expected the result to carry the internal error code, got %s", result)
+	}
+	if result := runEnrich(t, &EnrichAction{}); strings.Contains(result, "error_code") {
+		t.Fatalf("Expected no error code on success, got %s", result)
+	}
+}
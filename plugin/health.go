@@ -0,0 +1,234 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/leakcheck"
+)
+
+// HealthTriggerName is the name of the trigger added by NewHealthTrigger
+const HealthTriggerName = "plugin_health"
+
+// healthDir is where running triggers publish their metrics for the health trigger to collect
+var healthDir = "/var/cache/health"
+
+// healthPublishInterval is how often running triggers publish their metrics, once a health trigger is added
+var healthPublishInterval = 15 * time.Second
+
+// healthExpiry is how long metrics from a trigger that stopped publishing are kept before they're removed
+var healthExpiry = 24 * time.Hour
+
+// publishHealth is set when the plugin has a health trigger, so its other triggers know to publish
+var publishHealth bool
+
+// Counters of what this process did, updated atomically
+var (
+	eventsDispatched int64
+	eventsFiltered   int64
+	eventsFailed     int64
+	deadLettered     int64
+	lastEvent        int64 // lastEvent is the unix time in nanoseconds the last event was dispatched
+)
+
+var processStarted = time.Now()
+
+// Metrics are the runtime metrics of one running trigger
+type Metrics struct {
+	Component string    `json:"component"` // Component is the trigger name
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+	Updated   time.Time `json:"updated"`
+	// Stale is set when the trigger hasn't published its metrics for a few intervals, it's likely stuck or gone
+	Stale bool `json:"stale"`
+
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	FDs        int    `json:"fds"` // FDs open, -1 where they can't be counted
+
+	EventsDispatched int64     `json:"events_dispatched"`
+	EventsFiltered   int64     `json:"events_filtered"` // EventsFiltered were dropped by the trigger's filter or transform
+	EventsSampledOut int64     `json:"sampled_out"`     // EventsSampledOut were dropped by sampling, see Sampling
+	EventsFailed     int64     `json:"events_failed"`   // EventsFailed couldn't be dispatched, including those dead lettered
+	DeadLettered     int64     `json:"dead_lettered"`
+	LastEvent        time.Time `json:"last_event"`
+	// Totals are what the trigger did across restarts, see Totals
+	Totals *Totals `json:"totals,omitempty"`
+
+	// HTTPUsage are the outbound requests made per connection, see httpclient.GetUsage
+	HTTPUsage map[string]httpclient.Usage `json:"http_usage,omitempty"`
+	// Cache is how the plugin cache was used, see cache.GetStats
+	Cache cache.Stats `json:"cache"`
+	// Deprecations are how often each deprecated trigger, action or input field was used, see Deprecatable
+	Deprecations map[string]int64 `json:"deprecations,omitempty"`
+}
+
+// HealthEvent is the output of the health trigger
+type HealthEvent struct {
+	Time       time.Time `json:"time"`
+	Healthy    bool      `json:"healthy"` // Healthy is false if any component is stale
+	Components []Metrics `json:"components"`
+}
+
+// RuntimeMetrics returns the metrics of this process
+func RuntimeMetrics(component string) Metrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	host, _ := os.Hostname()
+	m := Metrics{
+		Component:        component,
+		Host:             host,
+		PID:              os.Getpid(),
+		Started:          processStarted,
+		Updated:          time.Now(),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapAlloc:        mem.HeapAlloc,
+		FDs:              leakcheck.CountFDs(),
+		EventsDispatched: atomic.LoadInt64(&eventsDispatched),
+		EventsFiltered:   atomic.LoadInt64(&eventsFiltered),
+		EventsSampledOut: atomic.LoadInt64(&eventsSampledOut),
+		EventsFailed:     atomic.LoadInt64(&eventsFailed),
+		DeadLettered:     atomic.LoadInt64(&deadLettered),
+		HTTPUsage:        httpclient.AllUsage(),
+		Cache:            cache.GetStats(),
+		Deprecations:     deprecatedUsage(),
+	}
+	if last := atomic.LoadInt64(&lastEvent); last != 0 {
+		m.LastEvent = time.Unix(0, last)
+	}
+	if r := currentTotals(); r != nil && r.trigger == component {
+		t := r.current()
+		m.Totals = &t
+	}
+	return m
+}
+
+// HealthTrigger emits the metrics of the plugin's running triggers as trigger events, so plugin health can
+// be routed into workflows like any other event. Every trigger in a plugin with a health trigger publishes
+// its metrics to the cache, where the health trigger collects them.
+type HealthTrigger struct {
+	Trigger
+	input HealthInput
+}
+
+// HealthInput is the input of the health trigger
+type HealthInput struct {
+	Interval int `json:"interval"` // Interval is how often to emit, in seconds, defaulting to 60
+}
+
+// Validate implements the Input interface
+func (i *HealthInput) Validate() []error {
+	if i.Interval < 0 {
+		return []error{fmt.Errorf("interval must be positive, got %d", i.Interval)}
+	}
+	return nil
+}
+
+// NewHealthTrigger returns the health trigger, to be added to a plugin with AddTrigger
+func NewHealthTrigger() *HealthTrigger {
+	return &HealthTrigger{}
+}
+
+// Name implements Triggerable
+func (h *HealthTrigger) Name() string {
+	return HealthTriggerName
+}
+
+// Description implements Triggerable
+func (h *HealthTrigger) Description() string {
+	return "Periodically emits the runtime metrics of the plugin's triggers"
+}
+
+// Input implements Inputable
+func (h *HealthTrigger) Input() Input {
+	return &h.input
+}
+
+// RunTrigger implements Triggerable
+func (h *HealthTrigger) RunTrigger() error {
+	interval := time.Duration(h.input.Interval) * time.Second
+	if interval == 0 {
+		interval = time.Minute
+	}
+	for {
+		if err := h.Send(collectHealth()); err != nil {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// collectHealth reads the metrics every trigger published, clearing out those long gone
+func collectHealth() *HealthEvent {
+	now := time.Now()
+	e := &HealthEvent{Time: now, Healthy: true, Components: []Metrics{}}
+	files, _ := filepath.Glob(filepath.Join(healthDir, "*.json"))
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var m Metrics
+		if err = json.Unmarshal(b, &m); err != nil {
+			continue
+		}
+		age := now.Sub(m.Updated)
+		if age > healthExpiry {
+			os.Remove(name)
+			continue
+		}
+		if age > 3*healthPublishInterval {
+			m.Stale = true
+			e.Healthy = false
+		}
+		e.Components = append(e.Components, m)
+	}
+	return e
+}
+
+// publishMetrics writes this process's metrics for the health trigger every healthPublishInterval,
+// until the returned function is called
+func publishMetrics(component string) (stop func()) {
+	if err := os.MkdirAll(healthDir, 0700); err != nil {
+		log.Warnf("Unable to publish metrics for the health trigger: %s", err)
+		return func() {}
+	}
+	name := filepath.Join(healthDir, fmt.Sprintf("%s-%d.json", strings.Replace(component, string(filepath.Separator), "_", -1), os.Getpid()))
+	publish := func() {
+		b, err := json.Marshal(RuntimeMetrics(component))
+		if err == nil {
+			tmp := name + ".tmp"
+			if err = ioutil.WriteFile(tmp, b, 0600); err == nil {
+				err = os.Rename(tmp, name)
+			}
+		}
+		if err != nil {
+			log.Warnf("Unable to publish metrics for the health trigger: %s", err)
+		}
+	}
+	publish()
+	sup := supervisor.New(context.Background())
+	sup.Go(supervisor.Spec{Name: "health metrics publisher"}, func(ctx context.Context) error {
+		ticker := utils.NewTicker(ctx, healthPublishInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			publish()
+		}
+		return nil
+	})
+	return sup.Stop
+}
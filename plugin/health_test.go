@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthCollectsPublishedMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { healthDir = d }(healthDir)
+	healthDir = dir
+
+	// A trigger that stopped publishing a while ago, and one that's long gone
+	for name, age := range map[string]time.Duration{"stuck": time.Hour, "gone": 48 * time.Hour} {
+		m := Metrics{Component: name, Updated: time.Now().Add(-age)}
+		b, _ := json.Marshal(m)
+		ioutil.WriteFile(filepath.Join(dir, name+".json"), b, 0600)
+	}
+	stop := publishMetrics("hello_trigger")
+	defer stop()
+
+	e := collectHealth()
+	if len(e.Components) != 2 || e.Healthy {
+		t.Fatalf("Expected a healthy and a stale component, got %+v", e)
+	}
+	for _, m := range e.Components {
+		if m.Stale != (m.Component == "stuck") {
+			t.Errorf("Unexpected staleness of %s: %v", m.Component, m.Stale)
+		}
+		if m.Component == "hello_trigger" && m.Goroutines == 0 {
+			t.Errorf("Expected runtime metrics to be published, got %+v", m)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.json")); !os.IsNotExist(err) {
+		t.Error("Expected metrics that expired to be removed")
+	}
+}
@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// Where heartbeats are sent
+const (
+	HeartbeatStderr     = "stderr"     // HeartbeatStderr writes heartbeats to stderr as JSON lines
+	HeartbeatDispatcher = "dispatcher" // HeartbeatDispatcher sends heartbeats to the trigger's dispatcher
+)
+
+// heartbeat is set by SetHeartbeat, or the PLUGIN_HEARTBEAT_INTERVAL environment variable
+var heartbeat *heartbeatConfig
+
+type heartbeatConfig struct {
+	interval time.Duration
+	mode     string
+}
+
+// SetHeartbeat makes running triggers send a heartbeat every interval, to stderr or to their dispatcher.
+// Heartbeats carry when the trigger last polled its source and its checkpoint, as reported with
+// Trigger.Polled and Trigger.Checkpoint, so orchestrators can spot a collector that's silently stuck.
+func (p Plugin) SetHeartbeat(interval time.Duration, mode string) error {
+	if mode != HeartbeatStderr && mode != HeartbeatDispatcher {
+		return fmt.Errorf("Unknown heartbeat mode %q, expected %s or %s", mode, HeartbeatStderr, HeartbeatDispatcher)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("Heartbeat interval must be positive, got %s", interval)
+	}
+	heartbeat = &heartbeatConfig{interval: interval, mode: mode}
+	return nil
+}
+
+// progress records how far a trigger got, for heartbeats and the watchdog. It's embedded in Trigger.
+type progress struct {
+	mu         sync.Mutex
+	lastPoll   time.Time
+	checkpoint interface{}
+	active     time.Time // active is when the trigger last reported any progress
+}
+
+// Progress records that the trigger is alive and working, for triggers that neither poll nor checkpoint
+func (p *progress) Progress() {
+	p.mu.Lock()
+	p.active = time.Now()
+	p.mu.Unlock()
+}
+
+// Polled records that the trigger polled its source successfully, whether or not it found any events
+func (p *progress) Polled() {
+	p.mu.Lock()
+	p.lastPoll = time.Now()
+	p.active = p.lastPoll
+	p.mu.Unlock()
+}
+
+// Checkpoint records the trigger's position in its source, ie: a cursor or the time of the last event read.
+// It's reported as is in heartbeats, so it should marshal to JSON.
+func (p *progress) Checkpoint(position interface{}) {
+	p.mu.Lock()
+	p.checkpoint = position
+	p.active = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *progress) lastProgress() (time.Time, interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastPoll, p.checkpoint
+}
+
+func (p *progress) lastActive() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// progressable is implemented by triggers that embed Trigger
+type progressable interface {
+	lastProgress() (time.Time, interface{})
+	lastActive() time.Time
+}
+
+// startHeartbeat sends heartbeats for a running trigger until the returned function is called
+func startHeartbeat(start *message.TriggerStart, trigger Triggerable, dispatcher Dispatcher) (stop func()) {
+	if heartbeat == nil {
+		return func() {}
+	}
+	config := *heartbeat
+	sup := supervisor.New(context.Background())
+	sup.Go(supervisor.Spec{Name: "heartbeat"}, func(ctx context.Context) error {
+		ticker := utils.NewTicker(ctx, config.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m := makeHeartbeat(start, trigger)
+			var err error
+			if config.mode == HeartbeatDispatcher {
+				err = dispatcher.Send(m)
+			} else {
+				var b []byte
+				if b, err = json.Marshal(m); err == nil {
+					_, err = os.Stderr.Write(append(b, '\n'))
+				}
+			}
+			if err != nil {
+				log.Warnf("Unable to send heartbeat: %s", err)
+			}
+		}
+		return nil
+	})
+	return sup.Stop
+}
+
+func makeHeartbeat(start *message.TriggerStart, trigger Triggerable) *message.Message {
+	h := message.TriggerHeartbeat{
+		Meta:             start.Meta,
+		Trigger:          start.Trigger,
+		Time:             time.Now(),
+		Started:          processStarted,
+		EventsDispatched: atomic.LoadInt64(&eventsDispatched),
+	}
+	if p, ok := trigger.(progressable); ok {
+		lastPoll, checkpoint := p.lastProgress()
+		if !lastPoll.IsZero() {
+			h.LastPoll = &lastPoll
+		}
+		h.Checkpoint = checkpoint
+	}
+	if last := atomic.LoadInt64(&lastEvent); last != 0 {
+		t := time.Unix(0, last)
+		h.LastEvent = &t
+	}
+	m := &message.Message{
+		Header: message.Header{
+			Version: message.Version,
+			Type:    "trigger_heartbeat",
+		},
+	}
+	m.Body.Contents = &h
+	return m
+}
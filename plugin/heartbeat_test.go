@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+type capturingDispatcher struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (d *capturingDispatcher) Send(m *message.Message) error {
+	b, err := json.Marshal(m)
+	d.mu.Lock()
+	d.messages = append(d.messages, string(b))
+	d.mu.Unlock()
+	return err
+}
+
+func TestHeartbeatReportsProgress(t *testing.T) {
+	defer func() { heartbeat = nil }()
+	p := Plugin{}
+	if err := p.SetHeartbeat(time.Second, "carrier pigeon"); err == nil {
+		t.Error("Expected an unknown heartbeat mode to fail")
+	}
+	if err := p.SetHeartbeat(10*time.Millisecond, HeartbeatDispatcher); err != nil {
+		t.Fatal(err)
+	}
+
+	trigger := &HelloTrigger{}
+	trigger.Polled()
+	trigger.Checkpoint(map[string]string{"cursor": "abc"})
+	meta := json.RawMessage(`{"channel":"xyz"}`)
+	dispatcher := &capturingDispatcher{}
+	stop := startHeartbeat(&message.TriggerStart{Meta: &meta, Trigger: "hello_trigger"}, trigger, dispatcher)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	if len(dispatcher.messages) == 0 {
+		t.Fatal("Expected heartbeats to be dispatched")
+	}
+	hb := dispatcher.messages[0]
+	for _, want := range []string{`"type":"trigger_heartbeat"`, `"trigger":"hello_trigger"`, `"last_poll":`, `"checkpoint":{"cursor":"abc"}`, `"meta":{"channel":"xyz"}`} {
+		if !strings.Contains(hb, want) {
+			t.Errorf("Expected %s in heartbeat %s", want, hb)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package httpcache caches HTTP responses in the plugin cache and revalidates them with the ETag and
+// Last-Modified the server sent, so enrichment lookups whose data changes slowly cost a 304 rather than a
+// full response, across workflow runs and the processes sharing the cache.
+//
+//	client := httpclient.New(httpclient.Options{Connection: connectionID})
+//	client.Transport = httpcache.New(client.Transport)
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Header is set on responses served from the cache, to HIT when the server wasn't asked and REVALIDATED when
+// it answered 304 Not Modified
+const Header = "X-Plugin-Cache"
+
+// defaultMaxBody is the largest body stored, larger ones are passed through
+const defaultMaxBody = 10 << 20
+
+// Transport is a RoundTripper caching the responses to GET requests. Only responses with an ETag or
+// Last-Modified are stored, unless MaxAge is set, and never ones marked no-store. A request is answered
+// from the cache without asking the server while the stored response is younger than MaxAge, and with a
+// conditional request after that.
+//
+// Responses are stored under the URL and the Authorization header, so connections with different
+// credentials never see each other's responses.
+type Transport struct {
+	Next    http.RoundTripper // Next sends requests, defaults to http.DefaultTransport
+	Backend cache.Backend     // Backend stores responses, defaults to the cache's current backend
+	Prefix  string            // Prefix is prepended to the names entries are stored under, defaults to "httpcache/"
+	MaxAge  time.Duration     // MaxAge is how long a response is used without revalidating, 0 always revalidates
+	MaxBody int64             // MaxBody is the largest body stored, defaults to 10MB
+}
+
+// New returns a Transport caching the responses of next
+func New(next http.RoundTripper) *Transport {
+	return &Transport{Next: next}
+}
+
+// entry is what's stored for a response
+type entry struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Stored       time.Time   `json:"stored"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.next().RoundTrip(req)
+	}
+	name := t.name(req)
+	e := t.load(name)
+	if e != nil && t.MaxAge > 0 && time.Since(e.Stored) < t.MaxAge {
+		return e.response(req, "HIT"), nil
+	}
+
+	out := req
+	if e != nil {
+		out = conditional(req, e)
+	}
+	resp, err := t.next().RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && e != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		e.Stored = time.Now()
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			e.ETag = etag
+		}
+		t.save(name, e)
+		return e.response(req, "REVALIDATED"), nil
+	}
+	if !t.storable(resp) {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, t.maxBody()+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > t.maxBody() {
+		// too large to keep, hand back what was read followed by the rest
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.save(name, &entry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Stored:       time.Now(),
+	})
+	return resp, nil
+}
+
+// Forget removes the response stored for req, ie: after a change the server won't have told the cache about
+func (t *Transport) Forget(req *http.Request) error {
+	return t.backend().Delete(t.name(req))
+}
+
+// cacheable checks req is a plain GET, without conditions of its own the cache would answer wrongly
+func cacheable(req *http.Request) bool {
+	if req.Method != "" && req.Method != "GET" {
+		return false
+	}
+	for _, h := range []string{"Range", "If-None-Match", "If-Modified-Since"} {
+		if req.Header.Get(h) != "" {
+			return false
+		}
+	}
+	return !hasDirective(req.Header, "no-store")
+}
+
+func (t *Transport) storable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || hasDirective(resp.Header, "no-store") {
+		return false
+	}
+	return t.MaxAge > 0 || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func hasDirective(h http.Header, directive string) bool {
+	for _, v := range h["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conditional returns a copy of req asking the server for the response only if it changed since e
+func conditional(req *http.Request, e *entry) *http.Request {
+	out := req.WithContext(req.Context())
+	out.Header = http.Header{}
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+	if e.ETag != "" {
+		out.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		out.Header.Set("If-Modified-Since", e.LastModified)
+	}
+	return out
+}
+
+// response rebuilds the stored response as the answer to req
+func (e *entry) response(req *http.Request, status string) *http.Response {
+	header := http.Header{}
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	header.Set(Header, status)
+	return &http.Response{
+		Status:        http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// load returns the entry stored under name, or nil. The cache is only an optimisation, so failing to read
+// it is logged and the request sent.
+func (t *Transport) load(name string) *entry {
+	b, err := t.backend().Get(name)
+	if err == cache.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Unable to read cached response %s: %s", name, err)
+		return nil
+	}
+	var e entry
+	if err = json.Unmarshal(b, &e); err != nil {
+		log.Warnf("Ignoring invalid cached response %s: %s", name, err)
+		return nil
+	}
+	return &e
+}
+
+func (t *Transport) save(name string, e *entry) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = t.backend().Put(name, b)
+	}
+	if err != nil {
+		log.Warnf("Unable to cache response %s: %s", name, err)
+	}
+}
+
+// name is where the response to req is stored, a digest so URLs and credentials never appear in it
+func (t *Transport) name(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Authorization")))
+	prefix := t.Prefix
+	if prefix == "" {
+		prefix = "httpcache/"
+	}
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+func (t *Transport) next() http.RoundTripper {
+	if t.Next == nil {
+		return http.DefaultTransport
+	}
+	return t.Next
+}
+
+func (t *Transport) backend() cache.Backend {
+	if t.Backend == nil {
+		return cache.CurrentBackend()
+	}
+	return t.Backend
+}
+
+func (t *Transport) maxBody() int64 {
+	if t.MaxBody <= 0 {
+		return defaultMaxBody
+	}
+	return t.MaxBody
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
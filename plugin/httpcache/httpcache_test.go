@@ -0,0 +1,117 @@
+package httpcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+func get(t *testing.T, client *http.Client, url string) (string, *http.Response) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), resp
+}
+
+func TestRevalidatesWithETag(t *testing.T) {
+	full, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("reputation: clean"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Backend: &cache.MemoryBackend{}}}
+	body, resp := get(t, client, srv.URL)
+	if body != "reputation: clean" || resp.Header.Get(Header) != "" {
+		t.Fatalf("Expected the first response from the server, got %q %v", body, resp.Header)
+	}
+	body, resp = get(t, client, srv.URL)
+	if body != "reputation: clean" || resp.Header.Get(Header) != "REVALIDATED" {
+		t.Fatalf("Expected the second response revalidated from the cache, got %q %v", body, resp.Header)
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("Expected 1 full response and 1 not modified, got %d and %d", full, notModified)
+	}
+}
+
+func TestMaxAgeSkipsTheServer(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Backend: &cache.MemoryBackend{}, MaxAge: time.Hour}}
+	get(t, client, srv.URL)
+	body, resp := get(t, client, srv.URL)
+	if body != "ok" || resp.Header.Get(Header) != "HIT" || requests != 1 {
+		t.Errorf("Expected the second request answered from the cache, got %q %v after %d requests", body, resp.Header, requests)
+	}
+}
+
+func TestNotStored(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer srv.Close()
+
+	backend := &cache.MemoryBackend{}
+	client := &http.Client{Transport: &Transport{Backend: backend, MaxAge: time.Hour, MaxBody: 5}}
+	for _, path := range []string{"/private", "/large"} {
+		for i := 0; i < 2; i++ {
+			if body, _ := get(t, client, srv.URL+path); body != "0123456789" {
+				t.Fatalf("Expected the whole body of %s, got %q", path, body)
+			}
+		}
+	}
+	if requests != 4 {
+		t.Errorf("Expected every request sent, got %d", requests)
+	}
+}
+
+func TestCredentialsAreKeptApart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+r.Header.Get("Authorization")+`"`)
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Backend: &cache.MemoryBackend{}, MaxAge: time.Hour}}
+	for _, key := range []string{"a", "b"} {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set("Authorization", key)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != key {
+			t.Errorf("Expected the response for %s, got %q", key, b)
+		}
+	}
+}
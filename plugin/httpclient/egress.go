@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EgressError is the policy error for a connection to a host that wasn't declared, in air-gapped mode
+type EgressError struct {
+	Addr string
+}
+
+// Error implements error
+func (e *EgressError) Error() string {
+	return fmt.Sprintf("Egress to %s refused, it isn't declared in the plugin's allowed hosts", e.Addr)
+}
+
+var (
+	egressMu  sync.RWMutex
+	airGapped bool
+	egress    []string
+)
+
+// SetEgress turns on air-gapped mode, where clients made here only connect to the hosts declared. A host
+// is a name or IP, which allows any port, a host:port, a *.domain wildcard matching its subdomains, or a
+// CIDR. Connections anywhere else fail with an EgressError, and are logged for auditing.
+func SetEgress(hosts []string) {
+	egressMu.Lock()
+	defer egressMu.Unlock()
+	airGapped = true
+	egress = nil
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			egress = append(egress, h)
+		}
+	}
+}
+
+// CheckEgress returns an EgressError if air-gapped mode is on and addr, a host or host:port, wasn't
+// declared. Code that connects without a client made here, ie: with a raw TCP connection, checks its
+// address with it first.
+func CheckEgress(addr string) error {
+	egressMu.RLock()
+	defer egressMu.RUnlock()
+	if !airGapped {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	for _, allowed := range egress {
+		if egressMatches(allowed, host, port, ip) {
+			return nil
+		}
+	}
+	log.Errorf("Refused undeclared egress to %s", addr)
+	return &EgressError{Addr: addr}
+}
+
+func egressMatches(allowed, host, port string, ip net.IP) bool {
+	if _, network, err := net.ParseCIDR(allowed); err == nil {
+		return ip != nil && network.Contains(ip)
+	}
+	if h, p, err := net.SplitHostPort(allowed); err == nil {
+		return p == port && egressMatches(h, host, "", ip)
+	}
+	if strings.HasPrefix(allowed, "*.") {
+		return strings.HasSuffix(host, allowed[1:])
+	}
+	return host == strings.Trim(allowed, "[]")
+}
+
+// DialContext connects like net.Dialer's DialContext, after checking the address is allowed
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return dialer(&net.Dialer{})(ctx, network, addr)
+}
+
+// dialer checks the address is allowed before dialing with d
+func dialer(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if err := CheckEgress(addr); err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
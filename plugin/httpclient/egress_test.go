@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func resetEgress() {
+	egressMu.Lock()
+	defer egressMu.Unlock()
+	airGapped, egress = false, nil
+}
+
+func TestCheckEgress(t *testing.T) {
+	defer resetEgress()
+	if err := CheckEgress("anywhere.example.com:443"); err != nil {
+		t.Fatalf("Expected egress to be open until declared, got %s", err)
+	}
+
+	SetEgress([]string{"api.example.com", "*.corp.example", "db.local:5432", "10.0.0.0/8"})
+	for addr, allowed := range map[string]bool{
+		"api.example.com:443":   true,
+		"API.example.com":       true,
+		"other.example.com:443": false,
+		"vault.corp.example:80": true,
+		"corp.example:80":       false,
+		"db.local:5432":         true,
+		"db.local:5433":         false,
+		"10.1.2.3:22":           true,
+		"192.168.0.1:22":        false,
+	} {
+		err := CheckEgress(addr)
+		if allowed != (err == nil) {
+			t.Errorf("Expected %s allowed to be %v, got %v", addr, allowed, err)
+		}
+		if _, ok := err.(*EgressError); err != nil && !ok {
+			t.Errorf("Expected a policy error for %s, got %T", addr, err)
+		}
+	}
+}
+
+func TestClientRefusesUndeclaredEgress(t *testing.T) {
+	defer resetEgress()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	SetEgress([]string{"api.example.com"})
+	if _, err := New(Options{}).Get(srv.URL); err == nil {
+		t.Error("Expected an undeclared host to be refused")
+	}
+	if _, err := New(Options{Internal: true}).Get(srv.URL); err != nil {
+		t.Errorf("Expected an internal client to connect, got %s", err)
+	}
+
+	SetEgress([]string{"127.0.0.1"})
+	if _, err := New(Options{}).Get(srv.URL); err != nil {
+		t.Errorf("Expected a declared host to connect, got %s", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build fips
+// +build fips
+
+package httpclient
+
+// FIPS is set in builds with the fips tag, which restrict outbound TLS to FIPSPolicy
+const FIPS = true
+
+var defaultPolicy = FIPSPolicy
@@ -0,0 +1,8 @@
+//go:build fips && boringcrypto
+// +build fips,boringcrypto
+
+package httpclient
+
+// With a BoringCrypto toolchain, crypto/tls is held to the FIPS approved settings everywhere in the
+// process, not only in the clients made here
+import _ "crypto/tls/fipsonly"
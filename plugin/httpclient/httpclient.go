@@ -0,0 +1,93 @@
+// Package httpclient makes the HTTP clients plugins and the SDK use for outbound connections, so the
+// policies that apply to them are enforced in one place. Every client's TLS is held to the active Policy:
+// TLS 1.2 or later by default, and only FIPS approved cipher suites and curves in builds with the fips
+// tag:
+//
+//	go build -tags fips ./...
+//
+// Adding the boringcrypto tag, with a BoringCrypto Go toolchain, also puts crypto/tls in FIPS only mode.
+//
+// In air-gapped mode, turned on by SetEgress, clients only connect to hosts the plugin declared. The
+// requests made for each connection are counted, and reported by GetUsage.
+package httpclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/bufpool"
+)
+
+// Options configures a client made by New
+type Options struct {
+	// Timeout bounds each request, including reading the response body, defaults to no timeout
+	Timeout time.Duration
+	// TLS is the client's TLS config, restricted to the active policy. Leave it nil for the defaults.
+	TLS *tls.Config
+	// Proxy defaults to the proxy in the environment, ie: HTTPS_PROXY
+	Proxy func(*http.Request) (*url.URL, error)
+	// Connection names the connection requests are counted under, see GetUsage, ie: the connection's ID
+	// in the orchestrator. It defaults to DefaultConnection.
+	Connection string
+	// Internal clients talk to the orchestrator running the plugin, ie: to dispatch events, so they're
+	// not held to the declared egress
+	Internal bool
+}
+
+// New returns a client with its own transport, made by Transport, that counts its requests under the
+// connection. Internal clients aren't counted.
+func New(opts Options) *http.Client {
+	var transport http.RoundTripper = Transport(opts)
+	if !opts.Internal {
+		connection := opts.Connection
+		if connection == "" {
+			connection = DefaultConnection
+		}
+		transport = &accountingTransport{connection: connection, next: transport}
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
+
+// Transport returns a transport with the settings of http.DefaultTransport, TLS held to the active
+// policy, and unless it's internal, connections held to the declared egress
+func Transport(opts Options) *http.Transport {
+	proxy := opts.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := d.DialContext
+	if !opts.Internal {
+		dial = dialer(d)
+		// the dial only sees the proxy, so the host behind it is checked here, as every request is proxied
+		next := proxy
+		proxy = func(req *http.Request) (*url.URL, error) {
+			if err := CheckEgress(req.URL.Host); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       Active().Apply(opts.TLS),
+	}
+}
+
+// ReadBody reads and closes a response body. It reads into a pooled buffer, so the body's bytes are only
+// allocated once, at their final size.
+func ReadBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return bufpool.ReadAll(resp.Body)
+}
@@ -0,0 +1,44 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyOnlyRestricts(t *testing.T) {
+	c := FIPSPolicy.Apply(&tls.Config{
+		MinVersion: tls.VersionTLS10,
+		CipherSuites: []uint16{
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	})
+	if c.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected the minimum version raised to TLS 1.2, got %x", c.MinVersion)
+	}
+	if len(c.CipherSuites) != 1 || c.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("Expected only the approved suite kept, got %v", c.CipherSuites)
+	}
+	if len(c.CurvePreferences) != 2 {
+		t.Errorf("Expected the NIST curves, got %v", c.CurvePreferences)
+	}
+
+	c = DefaultPolicy.Apply(&tls.Config{MinVersion: tls.VersionTLS12, ServerName: "example.com"})
+	if c.MinVersion != tls.VersionTLS12 || c.ServerName != "example.com" || c.CipherSuites != nil {
+		t.Errorf("Expected the settings the policy allows kept, got %+v", c)
+	}
+}
+
+func TestNewEnforcesThePolicy(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS11}
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := New(Options{TLS: &tls.Config{InsecureSkipVerify: true}})
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("Expected a server only speaking TLS 1.1 to be refused")
+	}
+}
@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Policy is the TLS a plugin's outbound connections may use
+type Policy struct {
+	Name         string
+	MinVersion   uint16   // MinVersion is the oldest TLS version allowed
+	CipherSuites []uint16 // CipherSuites allowed for TLS 1.2, or any of Go's defaults if empty
+	Curves       []tls.CurveID
+}
+
+// DefaultPolicy refuses TLS versions older than 1.2, and leaves the rest to Go's defaults
+var DefaultPolicy = Policy{Name: "default", MinVersion: tls.VersionTLS12}
+
+// FIPSPolicy only allows what FIPS 140-2 approves: TLS 1.2 or later with ECDHE key exchange over the
+// NIST curves and AES-GCM
+var FIPSPolicy = Policy{
+	Name:       "fips",
+	MinVersion: tls.VersionTLS12,
+	CipherSuites: []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	},
+	Curves: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+}
+
+// active is the policy in force, FIPSPolicy in builds with the fips tag
+var active = defaultPolicy
+
+// Active returns the policy in force
+func Active() Policy {
+	return active
+}
+
+// SetPolicy replaces the policy in force. It's refused in FIPS builds, whose policy can't be relaxed.
+func SetPolicy(p Policy) error {
+	if FIPS {
+		return fmt.Errorf("The %s policy can't be replaced in a FIPS build", active.Name)
+	}
+	active = p
+	return nil
+}
+
+// Apply restricts c to the policy, and returns it, or a new config if c is nil. Settings of c the policy
+// allows are kept, so a config can only be made stricter.
+func (p Policy) Apply(c *tls.Config) *tls.Config {
+	if c == nil {
+		c = &tls.Config{}
+	}
+	if c.MinVersion < p.MinVersion {
+		c.MinVersion = p.MinVersion
+	}
+	if len(p.CipherSuites) > 0 {
+		c.CipherSuites = intersect(c.CipherSuites, p.CipherSuites)
+	}
+	if len(p.Curves) > 0 {
+		curves := make([]uint16, len(c.CurvePreferences))
+		for i, curve := range c.CurvePreferences {
+			curves[i] = uint16(curve)
+		}
+		allowed := make([]uint16, len(p.Curves))
+		for i, curve := range p.Curves {
+			allowed[i] = uint16(curve)
+		}
+		c.CurvePreferences = nil
+		for _, curve := range intersect(curves, allowed) {
+			c.CurvePreferences = append(c.CurvePreferences, tls.CurveID(curve))
+		}
+	}
+	return c
+}
+
+// intersect returns those of want that are allowed, or all those allowed if want is empty
+func intersect(want, allowed []uint16) []uint16 {
+	if len(want) == 0 {
+		return append([]uint16(nil), allowed...)
+	}
+	var kept []uint16
+	for _, w := range want {
+		for _, a := range allowed {
+			if w == a {
+				kept = append(kept, w)
+				break
+			}
+		}
+	}
+	return kept
+}
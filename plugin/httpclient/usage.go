@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultConnection is the connection requests are counted under when a client doesn't name one
+const DefaultConnection = "default"
+
+// Usage counts the requests made for a connection, so vendor API quota can be attributed to the workflows
+// using it. Bytes are those of the request and response bodies.
+type Usage struct {
+	Requests      int64 `json:"requests"`
+	Errors        int64 `json:"errors"` // Errors are requests that failed without a response
+	BytesSent     int64 `json:"bytes_sent"`
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+var (
+	usageMu sync.Mutex
+	usage   = map[string]*Usage{}
+)
+
+// GetUsage returns the usage of the connection so far
+func GetUsage(connection string) Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	return load(usage[connection])
+}
+
+// AllUsage returns the usage of every connection requests were made for
+func AllUsage() map[string]Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	all := make(map[string]Usage, len(usage))
+	for connection, u := range usage {
+		all[connection] = load(u)
+	}
+	return all
+}
+
+// ResetUsage clears the usage of every connection, ie: once it's been reported
+func ResetUsage() {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	usage = map[string]*Usage{}
+}
+
+func load(u *Usage) Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		Requests:      atomic.LoadInt64(&u.Requests),
+		Errors:        atomic.LoadInt64(&u.Errors),
+		BytesSent:     atomic.LoadInt64(&u.BytesSent),
+		BytesReceived: atomic.LoadInt64(&u.BytesReceived),
+	}
+}
+
+// usageOf returns the counters of the connection, adding them if they're new
+func usageOf(connection string) *Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u, ok := usage[connection]
+	if !ok {
+		u = &Usage{}
+		usage[connection] = u
+	}
+	return u
+}
+
+// accountingTransport counts the requests it makes under a connection
+type accountingTransport struct {
+	connection string
+	next       http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *accountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := usageOf(t.connection)
+	atomic.AddInt64(&u.Requests, 1)
+	if req.Body != nil {
+		// a RoundTripper mustn't modify the request, so the body is counted on a shallow copy
+		counted := *req
+		counted.Body = &countingBody{ReadCloser: req.Body, n: &u.BytesSent}
+		req = &counted
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		atomic.AddInt64(&u.Errors, 1)
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &u.BytesReceived}
+	return resp, nil
+}
+
+// countingBody adds the bytes read through it to n
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,51 @@
+package httpclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUsageIsCountedPerConnection(t *testing.T) {
+	ResetUsage()
+	defer ResetUsage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte("0123456789"))
+	}))
+	defer srv.Close()
+
+	tenant := New(Options{Connection: "tenant-a"})
+	for i := 0; i < 2; i++ {
+		resp, err := tenant.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	resp, err := New(Options{}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	New(Options{Connection: "tenant-a"}).Get("http://127.0.0.1:0")
+	internal, err := New(Options{Internal: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal.Body.Close()
+
+	want := Usage{Requests: 3, Errors: 1, BytesSent: 10, BytesReceived: 20}
+	if got := GetUsage("tenant-a"); got != want {
+		t.Errorf("Expected %+v for tenant-a, got %+v", want, got)
+	}
+	if got := GetUsage(DefaultConnection); got.Requests != 1 || got.BytesReceived != 0 {
+		t.Errorf("Expected one request with its body unread by default, got %+v", got)
+	}
+	if all := AllUsage(); len(all) != 2 {
+		t.Errorf("Expected internal requests not to be counted, got %v", all)
+	}
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+	"github.com/komand/plugin-sdk-go/plugin/utils/bufpool"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var errTriggerKeepAlive = errors.New("Triggers don't run in keep-alive mode, they never finish")
+
+// RunKeepAlive runs an action for each start message read from in, one after another, so a burst of actions
+// is served by one process rather than a process each. Start messages are JSON documents, one after the
+// other, and each result is written to out as a line of JSON. It returns when in ends, or once no start
+// message has arrived for idle, if idle is positive.
+//
+// A start message that can't be run is logged and skipped, the process carries on with the next.
+func (p *Plugin) RunKeepAlive(in io.Reader, out io.Writer, idle time.Duration) error {
+	defer shutdown.Run()
+	p.startTelemetry()
+	p.warm()
+	starts := make(chan json.RawMessage)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		dec := json.NewDecoder(in)
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case starts <- raw:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	d := &lineDispatcher{w: out}
+	for {
+		var timeout <-chan time.Time
+		if idle > 0 {
+			timeout = time.After(idle)
+		}
+		select {
+		case raw := <-starts:
+			if err := p.runStart(raw, d); err != nil {
+				log.Errorf("Unable to run start message: %s", err)
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-timeout:
+			log.Infof("No start message for %s, exiting", idle)
+			return nil
+		}
+	}
+}
+
+// runStart runs the action raw starts, sending its result to d
+func (p *Plugin) runStart(raw json.RawMessage, d Dispatcher) error {
+	t, err := p.setupFrom(parameter.NewParamSet(bytes.NewReader(raw)))
+	if err != nil {
+		return err
+	}
+	a, ok := t.(*actionTask)
+	if !ok {
+		return errTriggerKeepAlive
+	}
+	a.dispatcher = d
+	return a.Run()
+}
+
+// lineDispatcher writes each message to w as a line of JSON
+type lineDispatcher struct {
+	w io.Writer
+}
+
+// Send implements Dispatcher
+func (d *lineDispatcher) Send(m *message.Message) error {
+	buf, err := bufpool.Marshal(m)
+	if err != nil {
+		return err
+	}
+	defer bufpool.Put(buf)
+	buf.WriteByte('\n')
+	_, err = d.w.Write(buf.Bytes())
+	return err
+}
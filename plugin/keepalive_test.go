@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveRunsEachStartMessage(t *testing.T) {
+	p := New()
+	in := strings.NewReader(actionStartMessage + triggerStartMessage + actionStartMessage)
+	var out bytes.Buffer
+	if err := p.RunKeepAlive(in, &out, 0); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := `{"version":"v1","type":"action_event","body":{"meta":{"action_id":14},"status":"ok","error":"","output":{"greeting":"good day to you"}}}`
+	if len(lines) != 2 || lines[0] != expected || lines[1] != expected {
+		t.Fatalf("Expected a result for each action, skipping the trigger, got %q", out.String())
+	}
+}
+
+func TestKeepAliveExitsWhenIdle(t *testing.T) {
+	p := New()
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte(actionStartMessage))
+
+	var out bytes.Buffer
+	started := time.Now()
+	if err := p.RunKeepAlive(r, &out, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected to exit once idle, took %s", elapsed)
+	}
+	if !strings.Contains(out.String(), "good day to you") {
+		t.Errorf("Expected the action to run before going idle, got %q", out.String())
+	}
+}
@@ -0,0 +1,183 @@
+// Package leaders elects one leader among the replicas of a trigger, so only one of them polls while
+// the others stand by, ready to take over when the leader's lease is lost. Elections are built on a
+// cache.NamedMutex: FileMutex for replicas on one host, RedisMutex or EtcdMutex across nodes.
+package leaders
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+const defaultTTL = 15 * time.Second
+
+// Elector campaigns to lead an election by holding its lock
+type Elector struct {
+	Mutex cache.NamedMutex
+	Name  string        // Name of the election, replicas of the same trigger should share it
+	TTL   time.Duration // TTL of the leader's lease, defaults to 15s. It's renewed every third of it.
+	// RetryInterval is how often a standby tries to take over, defaults to a third of TTL
+	RetryInterval time.Duration
+
+	// OnElected and OnDemoted, if set, are called as this replica gains and loses leadership
+	OnElected func()
+	OnDemoted func()
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// IsLeader returns whether this replica currently leads
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns until ctx is done, calling lead each time this replica is elected. The context lead is
+// given is canceled when leadership is lost, and lead should return promptly when it is; the replica
+// then goes back to standing by. Run returns nil once lead returns nil while still leading, lead's error
+// if it returns one while still leading, or ctx.Err() when ctx is done.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context) error) error {
+	if e.Mutex == nil || e.Name == "" {
+		return errors.New("leaders: an Elector needs a Mutex and a Name")
+	}
+	for {
+		lease, err := e.campaign(ctx)
+		if err != nil {
+			return err
+		}
+		lost, err := e.leadWith(ctx, lease, lead)
+		if !lost {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warnf("leaders: lost leadership of %s, standing by", e.Name)
+	}
+}
+
+// Start runs the election in the background for triggers that poll: they check IsLeader at the top of
+// each poll and skip it when standing by. Call the returned function to stop and step down.
+func (e *Elector) Start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := e.Run(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if err != nil && err != context.Canceled {
+			log.Errorf("leaders: election for %s stopped: %s", e.Name, err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// campaign waits until this replica holds the election's lock
+func (e *Elector) campaign(ctx context.Context) (cache.Lease, error) {
+	for {
+		lease, ok, err := e.Mutex.TryLock(e.Name, e.ttl())
+		if ok {
+			return lease, nil
+		}
+		if err != nil {
+			log.Warnf("leaders: campaigning for %s failed: %s", e.Name, err)
+		}
+		if err = utils.SleepCtx(ctx, utils.Jitter(e.retryInterval(), 0.2)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// leadWith runs lead while renewing lease, and reports whether it returned because leadership was lost
+func (e *Elector) leadWith(ctx context.Context, lease cache.Lease, lead func(ctx context.Context) error) (bool, error) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.setLeader(true)
+	lostc := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		e.renew(leadCtx, lease, cancel, lostc)
+	}()
+
+	err := lead(leadCtx)
+	cancel()
+	<-renewed
+	lease.Release()
+	e.setLeader(false)
+
+	select {
+	case <-lostc:
+		return true, err
+	default:
+	}
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+	return false, err
+}
+
+// renew keeps the lease alive until ctx is done, canceling it and closing lost if the lease is lost
+func (e *Elector) renew(ctx context.Context, lease cache.Lease, cancel func(), lost chan struct{}) {
+	ttl := e.ttl()
+	expires := time.Now().Add(ttl)
+	ticker := utils.NewTicker(ctx, ttl/3)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := lease.Renew(ttl)
+		if err == nil {
+			expires = time.Now().Add(ttl)
+			continue
+		}
+		// Other errors are retried on the next tick, unless the lease has run out in the meantime
+		if err == cache.ErrLockLost || time.Now().After(expires) {
+			close(lost)
+			cancel()
+			return
+		}
+		log.Warnf("leaders: renewing leadership of %s failed: %s", e.Name, err)
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.mu.Unlock()
+	if !changed {
+		return
+	}
+	if leader && e.OnElected != nil {
+		e.OnElected()
+	}
+	if !leader && e.OnDemoted != nil {
+		e.OnDemoted()
+	}
+}
+
+func (e *Elector) ttl() time.Duration {
+	if e.TTL > 0 {
+		return e.TTL
+	}
+	return defaultTTL
+}
+
+func (e *Elector) retryInterval() time.Duration {
+	if e.RetryInterval > 0 {
+		return e.RetryInterval
+	}
+	return e.ttl() / 3
+}
@@ -0,0 +1,101 @@
+package leaders
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+// memMutex is an in memory NamedMutex whose leases can be revoked, to simulate losing them
+type memMutex struct {
+	mu   sync.Mutex
+	held map[string]*memLease
+}
+
+type memLease struct {
+	m       *memMutex
+	name    string
+	revoked bool
+}
+
+func (m *memMutex) Lock(ctx context.Context, name string, ttl time.Duration) (cache.Lease, error) {
+	panic("campaigns should use TryLock")
+}
+
+func (m *memMutex) TryLock(name string, ttl time.Duration) (cache.Lease, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held[name] != nil {
+		return nil, false, nil
+	}
+	l := &memLease{m: m, name: name}
+	m.held[name] = l
+	return l, true, nil
+}
+
+func (m *memMutex) revoke(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.held[name].revoked = true
+	delete(m.held, name)
+}
+
+func (l *memLease) Renew(ttl time.Duration) error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if l.revoked {
+		return cache.ErrLockLost
+	}
+	return nil
+}
+
+func (l *memLease) Release() error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	if !l.revoked {
+		delete(l.m.held, l.name)
+	}
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	mutex := &memMutex{held: map[string]*memLease{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var demoted int32
+	a := &Elector{Mutex: mutex, Name: "poller", TTL: 30 * time.Millisecond, OnDemoted: func() { atomic.AddInt32(&demoted, 1) }}
+	b := &Elector{Mutex: mutex, Name: "poller", TTL: 30 * time.Millisecond}
+	stopA := a.Start(ctx)
+	defer stopA()
+	waitFor(t, a.IsLeader)
+
+	stopB := b.Start(ctx)
+	defer stopB()
+	time.Sleep(50 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("Expected only one leader")
+	}
+
+	// When a loses its lease it steps down, and one of them is elected again
+	mutex.revoke("poller")
+	waitFor(t, func() bool { return atomic.LoadInt32(&demoted) > 0 && a.IsLeader() != b.IsLeader() })
+
+	// When a stops altogether, b should take over
+	stopA()
+	waitFor(t, b.IsLeader)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the election")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
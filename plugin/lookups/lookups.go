@@ -0,0 +1,391 @@
+// Package lookups loads lookup tables for enrichment: mapping codes to names, assets to owners, and so on.
+// Tables are CSV or JSON, read from the plugin cache, a mounted path or a URL, and can be refreshed
+// periodically while the plugin runs. A refresh parses the new table in full before swapping it in, so
+// lookups never see half a table, and a bad refresh leaves the previous one in place.
+//
+//	owners, err := lookups.Load(lookups.Source{URL: "https://cmdb.example.com/owners.csv", Key: "asset"})
+//	...
+//	defer owners.Watch(ctx, 10*time.Minute)()
+//	owner, ok := owners.Lookup(asset)
+//
+// Tables implement transform.Lookup, so Register makes them available to enrich steps by name.
+package lookups
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+	"github.com/komand/plugin-sdk-go/plugin/transform"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// Formats of lookup tables
+const (
+	CSV  = "csv"
+	JSON = "json"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Source describes where a table comes from and how to read it. Exactly one of Cache, Path or URL is set.
+type Source struct {
+	Cache string // Cache is a file name in the plugin cache
+	Path  string // Path is a file on a mounted volume
+	URL   string // URL is fetched with a GET
+
+	// Format is csv or json, guessed from the file extension when empty
+	Format string
+	// Key is the column, or field of each object in a JSON list, holding the key. It defaults to the
+	// first column of a CSV table, and is not needed for a JSON object of keys to values.
+	Key string
+	// Value is the column or field returned for a key. When empty, the whole row is returned as an
+	// object, unless a CSV table only has two columns, in which case it's the second.
+	Value string
+	// IgnoreCase makes lookups case insensitive
+	IgnoreCase bool
+
+	// Header is sent with requests to URL, ie: for an Authorization token
+	Header http.Header
+	// Client is used to fetch URL, defaults to a client with a 30 second timeout
+	Client *http.Client
+}
+
+// Table is a loaded lookup table, safe for concurrent lookups while it's refreshed
+type Table struct {
+	src Source
+
+	mu      sync.RWMutex
+	rows    map[string]interface{}
+	loaded  time.Time
+	version string // version identifies what was loaded, an ETag or modification time, to skip unchanged reloads
+}
+
+// Load reads a table from src
+func Load(src Source) (*Table, error) {
+	if err := src.validate(); err != nil {
+		return nil, err
+	}
+	t := &Table{src: src}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Register loads a table from src and registers it under name for enrich steps, see transform.RegisterLookup
+func Register(name string, src Source) (*Table, error) {
+	t, err := Load(src)
+	if err != nil {
+		return nil, err
+	}
+	transform.RegisterLookup(name, t)
+	return t, nil
+}
+
+// Lookup returns the value for key
+func (t *Table) Lookup(key string) (interface{}, bool) {
+	if t.src.IgnoreCase {
+		key = strings.ToLower(key)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	v, ok := t.rows[key]
+	return v, ok
+}
+
+// Len returns the number of keys in the table
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.rows)
+}
+
+// Loaded returns when the table last changed
+func (t *Table) Loaded() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.loaded
+}
+
+// Reload reads the table again, and swaps it in if it parses. If the source hasn't changed since the last
+// load, by its ETag or Last-Modified header or its file's modification time, it isn't parsed again.
+func (t *Table) Reload() error {
+	t.mu.RLock()
+	version := t.version
+	t.mu.RUnlock()
+
+	r, newVersion, err := t.src.open(version)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return nil // unchanged
+	}
+	defer r.Close()
+
+	rows, err := t.src.parse(r)
+	if err != nil {
+		return fmt.Errorf("Unable to load lookup table %s: %s", t.src, err)
+	}
+	t.mu.Lock()
+	t.rows = rows
+	t.version = newVersion
+	t.loaded = time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the table every interval until the returned function is called or ctx is done. Failed
+// reloads are logged, and lookups carry on with the table from the last successful one.
+func (t *Table) Watch(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := utils.NewTicker(ctx, interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := t.Reload(); err != nil {
+				log.Warnf("Keeping the previous lookup table: %s", err)
+			}
+		}
+	}()
+	return cancel
+}
+
+// String describes where the table comes from
+func (s Source) String() string {
+	switch {
+	case s.Cache != "":
+		return "cache:" + s.Cache
+	case s.Path != "":
+		return s.Path
+	}
+	return s.URL
+}
+
+func (s Source) validate() error {
+	n := 0
+	for _, set := range []bool{s.Cache != "", s.Path != "", s.URL != ""} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("A lookup table needs exactly one of a cache file, path or URL")
+	}
+	if f := s.format(); f != CSV && f != JSON {
+		return fmt.Errorf("Unknown lookup table format %q for %s, expected csv or json", f, s)
+	}
+	return nil
+}
+
+func (s Source) format() string {
+	if s.Format != "" {
+		return strings.ToLower(s.Format)
+	}
+	name := s.String()
+	if s.URL != "" {
+		name = strings.SplitN(name, "?", 2)[0]
+	}
+	return strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+}
+
+// open returns the table's contents, or nil if they are still at version
+func (s Source) open(version string) (io.ReadCloser, string, error) {
+	if s.URL != "" {
+		return s.fetch(version)
+	}
+	var f *os.File
+	var err error
+	if s.Cache != "" {
+		f, err = cache.OpenCacheFile(s.Cache)
+	} else {
+		f, err = os.Open(s.Path)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	current := fmt.Sprintf("%d-%d", stat.ModTime().UnixNano(), stat.Size())
+	if current == version {
+		f.Close()
+		return nil, version, nil
+	}
+	return f, current, nil
+}
+
+func (s Source) fetch(version string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	// The version is whichever validator the server sent last time, prefixed with which it is
+	switch {
+	case strings.HasPrefix(version, "etag:"):
+		req.Header.Set("If-None-Match", strings.TrimPrefix(version, "etag:"))
+	case strings.HasPrefix(version, "modified:"):
+		req.Header.Set("If-Modified-Since", strings.TrimPrefix(version, "modified:"))
+	}
+	client := s.Client
+	if client == nil {
+		client = httpclient.New(httpclient.Options{Timeout: defaultTimeout})
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, version, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("Unable to fetch lookup table %s: %s %s", s.URL, resp.Status, bytes.TrimSpace(body))
+	}
+	current := ""
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		current = "etag:" + etag
+	} else if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		current = "modified:" + modified
+	}
+	return resp.Body, current, nil
+}
+
+func (s Source) parse(r io.Reader) (map[string]interface{}, error) {
+	var rows map[string]interface{}
+	var err error
+	if s.format() == CSV {
+		rows, err = s.parseCSV(r)
+	} else {
+		rows, err = s.parseJSON(r)
+	}
+	if err != nil || !s.IgnoreCase {
+		return rows, err
+	}
+	folded := make(map[string]interface{}, len(rows))
+	for k, v := range rows {
+		folded[strings.ToLower(k)] = v
+	}
+	return folded, nil
+}
+
+// parseCSV reads a table with a header row naming its columns
+func (s Source) parseCSV(r io.Reader) (map[string]interface{}, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header row: %s", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	keyCol, valueCol := 0, -1
+	if s.Key != "" {
+		if keyCol = indexOf(header, s.Key); keyCol < 0 {
+			return nil, fmt.Errorf("no %s column", s.Key)
+		}
+	}
+	if s.Value != "" {
+		if valueCol = indexOf(header, s.Value); valueCol < 0 {
+			return nil, fmt.Errorf("no %s column", s.Value)
+		}
+	} else if len(header) == 2 {
+		valueCol = 1 - keyCol
+	}
+
+	rows := map[string]interface{}{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := strings.TrimSpace(record[keyCol])
+		if valueCol >= 0 {
+			rows[key] = strings.TrimSpace(record[valueCol])
+			continue
+		}
+		row := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			row[name] = strings.TrimSpace(record[i])
+		}
+		rows[key] = row
+	}
+}
+
+// parseJSON reads either an object of keys to values, or a list of objects with a key field
+func (s Source) parseJSON(r io.Reader) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	switch t := doc.(type) {
+	case map[string]interface{}:
+		if s.Value == "" {
+			return t, nil
+		}
+		rows := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			if obj, ok := v.(map[string]interface{}); ok {
+				rows[k] = obj[s.Value]
+			}
+		}
+		return rows, nil
+	case []interface{}:
+		if s.Key == "" {
+			return nil, errors.New("a key field is needed for a list of objects")
+		}
+		rows := make(map[string]interface{}, len(t))
+		for i, item := range t {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("item %d is not an object", i)
+			}
+			key, ok := obj[s.Key]
+			if !ok || key == nil {
+				return nil, fmt.Errorf("item %d has no %s", i, s.Key)
+			}
+			var v interface{} = obj
+			if s.Value != "" {
+				v = obj[s.Value]
+			}
+			rows[fmt.Sprint(key)] = v
+		}
+		return rows, nil
+	}
+	return nil, errors.New("expected an object or a list of objects")
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,101 @@
+package lookups
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/transform"
+)
+
+func TestLoadCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "owners.csv")
+	if err = ioutil.WriteFile(name, []byte("asset,owner,team\nweb-1,alice,web\ndb-1,bob,data\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := Load(Source{Path: name, Value: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := table.Lookup("db-1"); !ok || v != "bob" {
+		t.Errorf("Expected bob, got %v", v)
+	}
+
+	rows, err := Load(Source{Path: name, Key: "owner", IgnoreCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := rows.Lookup("ALICE"); !ok || v.(map[string]interface{})["team"] != "web" {
+		t.Errorf("Expected alice's row, got %v", v)
+	}
+
+	// A bad reload keeps the previous table, a good one swaps it
+	time.Sleep(10 * time.Millisecond)
+	ioutil.WriteFile(name, []byte("asset,owner,team\n\"unterminated\n"), 0600)
+	if err = table.Reload(); err == nil {
+		t.Error("Expected the bad table to fail to load")
+	}
+	if v, _ := table.Lookup("db-1"); v != "bob" {
+		t.Errorf("Expected the previous table to be kept, got %v", v)
+	}
+	ioutil.WriteFile(name, []byte("asset,owner,team\ndb-1,carol,data\n"), 0600)
+	if err = table.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := table.Lookup("db-1"); v != "carol" || table.Len() != 1 {
+		t.Errorf("Expected the new table, got %v", v)
+	}
+}
+
+func TestLoadURL(t *testing.T) {
+	fetches := 0
+	body := `[{"code": "US", "name": "United States"}, {"code": "FR", "name": "France"}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetches++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	table, err := Register("countries", Source{URL: server.URL + "/countries?full=1", Format: JSON, Key: "code", Value: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = table.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 {
+		t.Errorf("Expected an unchanged table not to be fetched again, got %d fetches", fetches)
+	}
+
+	pipeline := transform.Pipeline{{Enrich: &transform.Enrich{Field: "country_code", Target: "country", Lookup: "countries"}}}
+	event, _, err := pipeline.Apply(map[string]interface{}{"country_code": "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event["country"] != "France" {
+		t.Errorf("Expected the registered table to enrich the event, got %v", event)
+	}
+}
+
+func TestSourceValidation(t *testing.T) {
+	for _, src := range []Source{{}, {Path: "a.csv", URL: "http://example.com/a.csv"}, {Path: "a.txt"}} {
+		if _, err := Load(src); err == nil {
+			t.Errorf("Expected %+v to be invalid", src)
+		}
+	}
+}
@@ -11,8 +11,12 @@ type ActionStart struct {
 
 // ActionResult is the format of the message from an Actions result
 type ActionResult struct {
-	Meta   *json.RawMessage `json:"meta"`
-	Status StatusType       `json:"status"` // Status identifies the result status from the Action
-	Error  string           `json:"error"`  // Error identifies any error that occured during the Action
-	Output OutputMessage    `json:"output"` // Output contains the output of the Action
+	Meta      *json.RawMessage `json:"meta"`
+	Status    StatusType       `json:"status"`               // Status identifies the result status from the Action
+	Error     string           `json:"error"`                // Error identifies any error that occured during the Action
+	ErrorCode ErrorCode        `json:"error_code,omitempty"` // ErrorCode is the kind of error Error is, from the catalog
+	Output    OutputMessage    `json:"output"`               // Output contains the output of the Action
+	Artifact  *ArtifactRef     `json:"artifact,omitempty"`   // Artifact replaces Output when it was too large to send inline
+	Degraded  string           `json:"degraded,omitempty"`   // Degraded names the fallback Output came from, when the action's vendor was unavailable
+	Warnings  []Warning        `json:"warnings,omitempty"`   // Warnings are non-fatal issues the action reported, kept apart from Error
 }
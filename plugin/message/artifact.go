@@ -0,0 +1,14 @@
+package message
+
+import "time"
+
+// ArtifactRef points at output content that was stored out of band, on a shared volume or in an
+// object store, instead of being carried inline in the message. Consumers must check the checksum
+// and expiry before trusting the content.
+type ArtifactRef struct {
+	URI         string    `json:"uri"`                    // URI is where the content can be fetched from
+	SHA256      string    `json:"sha256"`                 // SHA256 is the hex digest of the stored content
+	Size        int64     `json:"size"`                   // Size of the stored content in bytes
+	ContentType string    `json:"content_type,omitempty"` // ContentType of the stored content
+	Expires     time.Time `json:"expires"`                // Expires is when the stored content may be deleted
+}
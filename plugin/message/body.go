@@ -1,6 +1,10 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
 
 // Body holds the message body
 type Body struct {
@@ -14,7 +18,7 @@ func (b Body) MarshalJSON() ([]byte, error) {
 		return []byte(b.RawMessage), nil
 	}
 
-	bodyBytes, err := json.Marshal(b.Contents)
+	bodyBytes, err := codec.Marshal(b.Contents)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,10 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
 
 // Connection is implemented by any connection
 // A connection must be able to connect, and validate the supplied config
@@ -20,7 +24,7 @@ type ConnectionConfig struct {
 func (c ConnectionConfig) MarshalJSON() ([]byte, error) {
 
 	if c.RawMessage == nil || len(c.RawMessage) == 0 {
-		msg, err := json.Marshal(&c.Contents)
+		msg, err := codec.Marshal(&c.Contents)
 		if err != nil {
 			return nil, err
 		}
@@ -1,6 +1,10 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
 
 // Dispatcher defines a dispatcher.
 type Dispatcher interface {
@@ -16,7 +20,7 @@ type DispatcherConfig struct {
 // MarshalJSON implmenents custom json.Marshal logic
 func (i *DispatcherConfig) MarshalJSON() ([]byte, error) {
 	if i.RawMessage == nil || len(i.RawMessage) == 0 {
-		msg, err := json.Marshal(&i.Contents)
+		msg, err := codec.Marshal(&i.Contents)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,54 @@
+package message
+
+// ErrorCode is a stable, numbered code for the kind of error an action failed with, sent alongside the error
+// so support and automated remediation can key off it rather than the error's wording. Codes are grouped
+// by the thousand: E1xxx the input, E2xxx the connection and credentials, E3xxx the vendor, E4xxx limits
+// and E5xxx the plugin itself. Once published a code is never renumbered or reused.
+type ErrorCode string
+
+// The catalog of error codes
+const (
+	CodeInvalidInput        ErrorCode = "E1001" // CodeInvalidInput is an input that isn't valid
+	CodeMissingInput        ErrorCode = "E1002" // CodeMissingInput is a required input that's missing
+	CodeConnectionFailed    ErrorCode = "E2001" // CodeConnectionFailed is a connection to the vendor that couldn't be made
+	CodeAuthFailed          ErrorCode = "E2002" // CodeAuthFailed is credentials the vendor refused
+	CodeAuthExpired         ErrorCode = "E2003" // CodeAuthExpired is credentials that expired or were revoked
+	CodePermissionDenied    ErrorCode = "E2004" // CodePermissionDenied is credentials without the permission needed
+	CodeVendorUnavailable   ErrorCode = "E3001" // CodeVendorUnavailable is a vendor that's down or failing
+	CodeVendorError         ErrorCode = "E3002" // CodeVendorError is a vendor answering with an error or something unexpected
+	CodeNotFound            ErrorCode = "E3003" // CodeNotFound is something looked up that the vendor doesn't have
+	CodeRateLimited         ErrorCode = "E4001" // CodeRateLimited is a vendor refusing calls over its rate limit
+	CodeTimeout             ErrorCode = "E4002" // CodeTimeout is a call that took too long
+	CodeQuotaExceeded       ErrorCode = "E4003" // CodeQuotaExceeded is a budget or quota that ran out
+	CodeInternal            ErrorCode = "E5001" // CodeInternal is any other error, the default
+	CodeUnsupportedFunction ErrorCode = "E5002" // CodeUnsupportedFunction is something the plugin doesn't do
+)
+
+// errorCodes describes each code in the catalog
+var errorCodes = map[ErrorCode]string{
+	CodeInvalidInput:        "Invalid input",
+	CodeMissingInput:        "Missing required input",
+	CodeConnectionFailed:    "Connection failed",
+	CodeAuthFailed:          "Authentication failed",
+	CodeAuthExpired:         "Authentication expired",
+	CodePermissionDenied:    "Permission denied",
+	CodeVendorUnavailable:   "Vendor unavailable",
+	CodeVendorError:         "Vendor error",
+	CodeNotFound:            "Not found",
+	CodeRateLimited:         "Rate limited",
+	CodeTimeout:             "Timed out",
+	CodeQuotaExceeded:       "Quota exceeded",
+	CodeInternal:            "Internal error",
+	CodeUnsupportedFunction: "Unsupported function",
+}
+
+// Description returns what the code stands for, and "" if it isn't in the catalog
+func (c ErrorCode) Description() string {
+	return errorCodes[c]
+}
+
+// Known returns whether the code is in the catalog
+func (c ErrorCode) Known() bool {
+	_, ok := errorCodes[c]
+	return ok
+}
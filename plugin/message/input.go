@@ -1,6 +1,10 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
 
 // Input define inputs for a trigger or action.
 // Input fields must supply a validation function.
@@ -17,7 +21,7 @@ type InputConfig struct {
 // MarshalJSON implmenents custom json.Marshal logic
 func (i *InputConfig) MarshalJSON() ([]byte, error) {
 	if i.RawMessage == nil || len(i.RawMessage) == 0 {
-		msg, err := json.Marshal(&i.Contents)
+		msg, err := codec.Marshal(&i.Contents)
 		if err != nil {
 			return nil, err
 		}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/komand/plugin-sdk-go/plugin/codec"
 	"github.com/komand/plugin-sdk-go/plugin/parameter"
 )
 
@@ -21,6 +22,8 @@ const (
 	OK = StatusType("ok")
 	// ERROR something failed
 	ERROR = StatusType("error")
+	// PARTIAL is part of the output of an action that's still running, streamed ahead of its result
+	PARTIAL = StatusType("partial")
 )
 
 // Validate the msg against the provided msgtype.
@@ -34,7 +37,7 @@ func (m *Message) Validate() error {
 // MarshalJSON marshals a Message object.
 func (m *Message) MarshalJSON() ([]byte, error) {
 
-	bodyBytes, err := json.Marshal(m.Body)
+	bodyBytes, err := codec.Marshal(m.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +48,7 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 		Header: m.Header,
 		Body:   json.RawMessage(bodyBytes),
 	}
-	return json.Marshal(&msg)
+	return codec.Marshal(&msg)
 }
 
 // MarshalBody marshals a Message object with the provided body into JSON
@@ -58,7 +61,7 @@ func (m *Message) MarshalBody(body interface{}) ([]byte, error) {
 		}
 	}
 
-	return json.Marshal(m)
+	return codec.Marshal(m)
 }
 
 // Unmarshal unmarshals a Message object
@@ -80,7 +83,7 @@ func (m *Message) Unmarshal(p *parameter.ParamSet) error {
 
 // UnmarshalBody unmarshalls a Body object
 func (m *Message) UnmarshalBody(body interface{}) error {
-	err := json.Unmarshal(m.Body.RawMessage, body)
+	err := codec.Unmarshal(m.Body.RawMessage, body)
 	if err != nil {
 		return fmt.Errorf("Unable to unmarshal Body: %+v", err)
 	}
@@ -1,6 +1,10 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
 
 // Output define outputs for a trigger or action.
 type Output interface {
@@ -16,7 +20,7 @@ type OutputMessage struct {
 // MarshalJSON implmenents custom json.Marshal logic
 func (i *OutputMessage) MarshalJSON() ([]byte, error) {
 	if i.RawMessage == nil || len(i.RawMessage) == 0 {
-		msg, err := json.Marshal(&i.Contents)
+		msg, err := codec.Marshal(&i.Contents)
 		if err != nil {
 			return nil, err
 		}
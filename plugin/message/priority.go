@@ -0,0 +1,31 @@
+package message
+
+import "strings"
+
+// Priority ranks a trigger event. While the dispatcher is behind, higher priority events are dispatched
+// ahead of lower ones sent before them, so an urgent detection isn't stuck behind a backlog of bulk ones.
+type Priority string
+
+// The priorities, from lowest to highest
+const (
+	PriorityLow    Priority = "low"    // PriorityLow is bulk traffic, ie: informational events
+	PriorityNormal Priority = "normal" // PriorityNormal is the priority of events that don't have one
+	PriorityHigh   Priority = "high"   // PriorityHigh is urgent traffic, ie: critical detections
+)
+
+// Known returns whether p is one of the priorities above
+func (p Priority) Known() bool {
+	return p == PriorityLow || p == PriorityNormal || p == PriorityHigh
+}
+
+// SeverityPriority returns the priority of an event with the given severity, as most vendors name them:
+// critical and high are PriorityHigh, low and informational PriorityLow, and anything else PriorityNormal
+func SeverityPriority(severity string) Priority {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical", "high":
+		return PriorityHigh
+	case "low", "info", "informational":
+		return PriorityLow
+	}
+	return PriorityNormal
+}
@@ -1,8 +1,9 @@
 package message
 
 import (
-	"encoding/json"
 	"fmt"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
 )
 
 // base start message
@@ -16,19 +17,19 @@ type startMessage struct {
 func (m startMessage) Unpack() error {
 
 	if m.Connection.Contents != nil && m.Connection.RawMessage != nil {
-		if err := json.Unmarshal(m.Connection.RawMessage, m.Connection.Contents); err != nil {
+		if err := codec.Unmarshal(m.Connection.RawMessage, m.Connection.Contents); err != nil {
 			return fmt.Errorf("Unable to parse connection config: %s", err)
 		}
 	}
 
 	if m.Input.Contents != nil && m.Input.RawMessage != nil {
-		if err := json.Unmarshal(m.Input.RawMessage, m.Input.Contents); err != nil {
+		if err := codec.Unmarshal(m.Input.RawMessage, m.Input.Contents); err != nil {
 			return fmt.Errorf("Unable to parse input config: %s", err)
 		}
 	}
 
 	if m.Dispatcher.Contents != nil && m.Dispatcher.RawMessage != nil {
-		if err := json.Unmarshal(m.Dispatcher.RawMessage, m.Dispatcher.Contents); err != nil {
+		if err := codec.Unmarshal(m.Dispatcher.RawMessage, m.Dispatcher.Contents); err != nil {
 			return fmt.Errorf("Unable to parse dispatcher config: %s", err)
 		}
 	}
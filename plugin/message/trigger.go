@@ -1,6 +1,9 @@
 package message
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // TriggerStart is the format of the message that starts a Trigger
 type TriggerStart struct {
@@ -15,4 +18,33 @@ type TriggerEvent struct {
 	GroupID string           `json:"group_id"` // Another application level id, this one is used internally to allow us to re-publish a job and track them under a common ID
 	Meta    *json.RawMessage `json:"meta"`
 	Output  OutputMessage    `json:"output"`
+	// Backfilled is set on events a trigger fetched from the past when asked to backfill, rather than polled
+	Backfilled bool `json:"backfilled,omitempty"`
+	// Priority is the priority the trigger sent the event with, empty for PriorityNormal
+	Priority Priority `json:"priority,omitempty"`
+}
+
+// TriggerHeartbeat messages report that a trigger is still running, and how far it got, so a collector
+// that's stuck without failing can be told apart from one with nothing to collect
+type TriggerHeartbeat struct {
+	Meta             *json.RawMessage `json:"meta"`
+	Trigger          string           `json:"trigger"` // Trigger is the name of the trigger
+	Time             time.Time        `json:"time"`
+	Started          time.Time        `json:"started"`
+	LastPoll         *time.Time       `json:"last_poll,omitempty"`  // LastPoll is when the trigger last polled its source successfully
+	LastEvent        *time.Time       `json:"last_event,omitempty"` // LastEvent is when the trigger last dispatched an event
+	Checkpoint       interface{}      `json:"checkpoint,omitempty"` // Checkpoint is the trigger's position in its source, if it reports one
+	EventsDispatched int64            `json:"events_dispatched"`
+}
+
+// TriggerDiagnostic messages report that the runtime intervened in a trigger, ie: restarted it after it
+// stopped making progress
+type TriggerDiagnostic struct {
+	Meta         *json.RawMessage `json:"meta"`
+	Trigger      string           `json:"trigger"` // Trigger is the name of the trigger
+	Time         time.Time        `json:"time"`
+	Reason       string           `json:"reason"`
+	Restarts     int              `json:"restarts"`      // Restarts is how many times the trigger was restarted before this
+	LastProgress time.Time        `json:"last_progress"` // LastProgress is when the trigger last made progress
+	Stack        string           `json:"stack,omitempty"`
 }
@@ -0,0 +1,42 @@
+package message
+
+import "fmt"
+
+// Codes of the warnings the SDK reports, plugins may use others
+const (
+	WarnTruncated  = "truncated"  // WarnTruncated is reported when only part of the results were returned
+	WarnDeprecated = "deprecated" // WarnDeprecated is reported when a deprecated parameter was used
+	WarnDegraded   = "degraded"   // WarnDegraded is reported when the output came from a fallback, see plugin.Degradation
+)
+
+// Warning is a non-fatal issue with an action's result, reported separately from its output so it can be
+// shown to the user without failing the action
+type Warning struct {
+	Code    string `json:"code"`            // Code identifies the kind of warning, ie: WarnTruncated
+	Message string `json:"message"`         // Message describes the warning to the user
+	Field   string `json:"field,omitempty"` // Field is the input or output field the warning is about, if there's one
+}
+
+// Warn returns a warning with the code and a message formatted as with fmt.Sprintf
+func Warn(code, format string, args ...interface{}) Warning {
+	return Warning{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// OnField returns the warning about the field
+func (w Warning) OnField(field string) Warning {
+	w.Field = field
+	return w
+}
+
+// Truncated returns a warning that only returned of total results are in field
+func Truncated(field string, returned, total int) Warning {
+	return Warn(WarnTruncated, "Returned %d of %d results", returned, total).OnField(field)
+}
+
+// Deprecated returns a warning that the field is deprecated, in favour of instead if it isn't empty
+func Deprecated(field, instead string) Warning {
+	if instead == "" {
+		return Warn(WarnDeprecated, "%s is deprecated", field).OnField(field)
+	}
+	return Warn(WarnDeprecated, "%s is deprecated, use %s instead", field, instead).OnField(field)
+}
@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"encoding/json"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/transform"
+)
+
+// migrateInput applies the input migrations of v, the named trigger or action, to its raw input. Old names
+// used are deprecated, so they're warned about and counted like any deprecated field.
+func migrateInput(name string, v interface{}, input json.RawMessage) (json.RawMessage, []message.Warning, error) {
+	migratable, ok := v.(Migratable)
+	if !ok {
+		return input, nil, nil
+	}
+	migrations := migratable.InputMigrations()
+	input, migrated, err := transform.Migrate(input, migrations)
+	if err != nil {
+		return nil, nil, err
+	}
+	var warnings []message.Warning
+	for _, from := range migrated {
+		for _, m := range migrations {
+			if m.From == from && m.To != "" && m.To != from {
+				warnings = append(warnings, message.Deprecated(from, m.To))
+				countDeprecation(name + "." + from)
+				break
+			}
+		}
+	}
+	return input, warnings, nil
+}
@@ -0,0 +1,233 @@
+// Package outbox couples emitting a trigger's events with advancing its checkpoint, so a crash between
+// the two neither loses events nor polls them again. A trigger commits a batch of events along with the
+// checkpoint after them in one step; the batch is then delivered from a persistent queue, and redelivered
+// until it's dispatched, while the trigger carries on polling from the committed checkpoint.
+//
+//	var cursor string
+//	ob.Checkpoint(&cursor)
+//	events, next := poll(cursor)
+//	if err := ob.Commit(events, next); err != nil {
+//		return err
+//	}
+//
+// Triggers that implement plugin.Outboxable have their outbox delivered by the runtime. Every event gets an
+// ID that's the same on every delivery of it, so the receiving end can drop the duplicates a crash right
+// after dispatching, but before acknowledging, causes.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/queue"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// Delivery timings
+const (
+	visibility     = time.Minute
+	retryBackoff   = time.Second
+	maxRetryWait   = time.Minute
+	deliverTimeout = 100 * time.Millisecond // deliverTimeout bounds each wait for a batch, so Deliver notices ctx promptly
+)
+
+const statePerms = 0600
+
+// Event is an event being delivered
+type Event struct {
+	ID   string          // ID is the same on every delivery of the event
+	Body json.RawMessage // Body is the event as committed, in JSON
+}
+
+// Outbox holds committed batches of events until they're delivered
+type Outbox struct {
+	q         queue.Queue
+	statePath string
+	id        string
+
+	mu    sync.Mutex
+	state state
+}
+
+// state is written atomically on every commit, it's what makes a commit a transaction
+type state struct {
+	ID         string          `json:"id"`  // ID is unique to the outbox, to prefix event IDs
+	Seq        int64           `json:"seq"` // Seq is the number of the last committed batch
+	Checkpoint json.RawMessage `json:"checkpoint,omitempty"`
+	// Pending is a committed batch that may not have been enqueued yet
+	Pending *batch `json:"pending,omitempty"`
+}
+
+// batch is the message enqueued for each commit
+type batch struct {
+	Seq    int64             `json:"seq"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// Open opens the outbox kept in dir, ie: /var/cache/outbox/<trigger>, with its batches in a DiskQueue
+func Open(dir string) (*Outbox, error) {
+	q, err := queue.NewDiskQueue(filepath.Join(dir, "queue"), queue.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return New(q, filepath.Join(dir, "state.json"))
+}
+
+// New returns an outbox delivering from q, with its state in the file at statePath. A batch committed but
+// not enqueued before a crash is enqueued now.
+func New(q queue.Queue, statePath string) (*Outbox, error) {
+	o := &Outbox{q: q, statePath: statePath}
+	b, err := ioutil.ReadFile(statePath)
+	switch {
+	case os.IsNotExist(err):
+		o.state.ID = utils.UniqueID()
+		if err = o.save(o.state); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err = json.Unmarshal(b, &o.state); err != nil {
+			return nil, fmt.Errorf("Invalid outbox state in %s: %s", statePath, err)
+		}
+	}
+	o.id = o.state.ID
+	if err = o.enqueuePending(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Checkpoint unmarshals the checkpoint of the last commit into v, and returns false if nothing was
+// committed yet
+func (o *Outbox) Checkpoint(v interface{}) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.state.Checkpoint) == 0 {
+		return false, nil
+	}
+	return true, json.Unmarshal(o.state.Checkpoint, v)
+}
+
+// Commit makes events and the checkpoint after them durable together, and queues the events for delivery.
+// If it returns an error, neither was committed and the trigger should poll again from the last checkpoint.
+func (o *Outbox) Commit(events []interface{}, checkpoint interface{}) error {
+	cp, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	b := &batch{Events: make([]json.RawMessage, len(events))}
+	for i, e := range events {
+		if b.Events[i], err = json.Marshal(e); err != nil {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// A batch still pending from an earlier commit has to be queued first, or it would be overwritten
+	if err = o.enqueuePending(); err != nil {
+		return err
+	}
+	next := o.state
+	next.Seq++
+	next.Checkpoint = cp
+	b.Seq = next.Seq
+	if len(events) > 0 {
+		next.Pending = b
+	}
+	if err = o.save(next); err != nil {
+		return err
+	}
+	o.state = next
+	// The commit is done, if enqueueing fails it's retried on the next commit or when the outbox is opened
+	o.enqueuePending()
+	return nil
+}
+
+// Deliver passes committed events to send, in order, until ctx is done. A batch is acknowledged once all
+// of its events were sent; if send fails, the batch is delivered again after a backoff, including the
+// events that were sent.
+func (o *Outbox) Deliver(ctx context.Context, send func(e Event) error) error {
+	backoff := retryBackoff
+	for {
+		receiveCtx, cancel := context.WithTimeout(ctx, deliverTimeout)
+		m, err := o.q.Receive(receiveCtx, visibility)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil || m == nil {
+			continue
+		}
+		var b batch
+		if err = m.Decode(&b); err != nil {
+			return fmt.Errorf("Invalid outbox batch %s: %s", m.ID, err)
+		}
+		if err = o.send(b, send); err == nil {
+			backoff = retryBackoff
+			o.q.Ack(m)
+			continue
+		}
+		o.q.Nack(m, 0)
+		if utils.SleepCtx(ctx, utils.Jitter(backoff, 0.2)) != nil {
+			return nil
+		}
+		if backoff *= 2; backoff > maxRetryWait {
+			backoff = maxRetryWait
+		}
+	}
+}
+
+func (o *Outbox) send(b batch, send func(e Event) error) error {
+	for i, body := range b.Events {
+		if err := send(Event{ID: fmt.Sprintf("%s-%d-%d", o.id, b.Seq, i), Body: body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueuePending enqueues the pending batch, and clears it from the state. The caller holds the lock.
+func (o *Outbox) enqueuePending() error {
+	if o.state.Pending == nil {
+		return nil
+	}
+	b, err := json.Marshal(o.state.Pending)
+	if err != nil {
+		return err
+	}
+	if _, err = o.q.Enqueue(b); err != nil {
+		return err
+	}
+	next := o.state
+	next.Pending = nil
+	if err = o.save(next); err != nil {
+		// The batch may be enqueued twice, which the stable event IDs make safe
+		return err
+	}
+	o.state = next
+	return nil
+}
+
+// save writes the state and renames it into place, so a crash leaves either the old or the new state
+func (o *Outbox) save(s state) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(o.statePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := o.statePath + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, statePerms); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.statePath)
+}
@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommitAndDeliver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor int
+	if ok, _ := o.Checkpoint(&cursor); ok {
+		t.Fatal("Expected no checkpoint in a new outbox")
+	}
+	if err = o.Commit([]interface{}{"a", "b"}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash after committing, but before the batch was queued, is recovered when it's opened again
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "state.json"))
+	var s state
+	json.Unmarshal(b, &s)
+	s.Seq++
+	s.Checkpoint = json.RawMessage("3")
+	s.Pending = &batch{Seq: s.Seq, Events: []json.RawMessage{json.RawMessage(`"c"`)}}
+	b, _ = json.Marshal(s)
+	ioutil.WriteFile(filepath.Join(dir, "state.json"), b, 0600)
+
+	o, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := o.Checkpoint(&cursor); !ok || cursor != 3 {
+		t.Errorf("Expected the committed checkpoint 3, got %d", cursor)
+	}
+
+	// The first attempt to send c fails, so its batch is delivered again with the same ID
+	var sent []string
+	ids := map[string]string{}
+	failed := false
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- o.Deliver(ctx, func(e Event) error {
+			if string(e.Body) == `"c"` && !failed {
+				failed = true
+				ids["failed"] = e.ID
+				return errors.New("dispatcher down")
+			}
+			sent = append(sent, string(e.Body))
+			ids[string(e.Body)] = e.ID
+			if len(sent) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the events to be delivered")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 3 || sent[0] != `"a"` || sent[1] != `"b"` || sent[2] != `"c"` {
+		t.Errorf("Expected a, b and c in order, got %v", sent)
+	}
+	if ids["failed"] != ids[`"c"`] || ids[`"a"`] == ids[`"b"`] {
+		t.Errorf("Expected stable and unique event IDs, got %v", ids)
+	}
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/outbox"
+)
+
+type OutboxTrigger struct {
+	Trigger
+	outbox     *outbox.Outbox
+	dispatcher *capturingDispatcher
+}
+
+func (t *OutboxTrigger) Name() string           { return "outbox_trigger" }
+func (t *OutboxTrigger) Description() string    { return "commits events" }
+func (t *OutboxTrigger) Outbox() *outbox.Outbox { return t.outbox }
+
+func (t *OutboxTrigger) RunTrigger() error {
+	if err := t.outbox.Commit([]interface{}{map[string]string{"n": "1"}}, "cursor-1"); err != nil {
+		return err
+	}
+	// Keep running until the runtime delivered the event
+	for i := 0; i < 100; i++ {
+		t.dispatcher.mu.Lock()
+		n := len(t.dispatcher.messages)
+		t.dispatcher.mu.Unlock()
+		if n > 0 {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestTriggerOutboxIsDelivered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	o, err := outbox.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := &capturingDispatcher{}
+	trigger := &OutboxTrigger{outbox: o, dispatcher: dispatcher}
+	task := &triggerTask{
+		message:    &message.TriggerStart{Trigger: trigger.Name()},
+		trigger:    trigger,
+		dispatcher: dispatcher,
+	}
+	if err = task.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+	if len(dispatcher.messages) != 1 {
+		t.Fatalf("Expected the committed event to be dispatched once, got %v", dispatcher.messages)
+	}
+	if m := dispatcher.messages[0]; !strings.Contains(m, `"n":"1"`) || !strings.Contains(m, `-1-0"`) {
+		t.Errorf("Expected the event with its outbox ID, got %s", m)
+	}
+	var cursor string
+	if ok, err := o.Checkpoint(&cursor); !ok || err != nil || cursor != "cursor-1" {
+		t.Errorf("Expected the checkpoint to be committed, got %q %v %v", cursor, ok, err)
+	}
+}
@@ -2,12 +2,21 @@ package plugin
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/komand/plugin-sdk-go/plugin/artifact"
+	"github.com/komand/plugin-sdk-go/plugin/codec"
 	"github.com/komand/plugin-sdk-go/plugin/message"
 	"github.com/komand/plugin-sdk-go/plugin/parameter"
+	"github.com/komand/plugin-sdk-go/plugin/schema"
+	"github.com/komand/plugin-sdk-go/plugin/sealed"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -32,6 +41,8 @@ type Meta struct {
 	Vendor      string
 	Version     string
 	Description string
+	// Egress are the hosts the plugin connects to, all it may connect to in air-gapped mode, see SetAirGapped
+	Egress []string
 }
 
 // Types of Start Messages
@@ -46,6 +57,56 @@ func init() {
 	log.SetOutput(os.Stderr)
 	log.SetLevel(log.InfoLevel)
 
+	// a fixed seed makes jitter and sampling reproducible when chasing a bug
+	if seed := os.Getenv("PLUGIN_RAND_SEED"); seed != "" {
+		if n, err := strconv.ParseInt(seed, 10, 64); err == nil {
+			utils.SetRandSeed(n)
+		} else {
+			log.Warnf("Ignoring invalid PLUGIN_RAND_SEED %q: %s", seed, err)
+		}
+	}
+
+	// orchestrators that watch for stuck triggers can turn heartbeats on without a plugin release
+	if interval := os.Getenv("PLUGIN_HEARTBEAT_INTERVAL"); interval != "" {
+		mode := os.Getenv("PLUGIN_HEARTBEAT_MODE")
+		if mode == "" {
+			mode = HeartbeatStderr
+		}
+		d, err := time.ParseDuration(interval)
+		if err == nil {
+			err = Plugin{}.SetHeartbeat(d, mode)
+		}
+		if err != nil {
+			log.Warnf("Ignoring invalid heartbeat configuration: %s", err)
+		}
+	}
+
+	// the key is provisioned by the orchestrator, so nothing sensitive is dispatched in the clear once it's set
+	if keys, err := sealed.EnvKeys(); err == nil {
+		Plugin{}.SetEncryption(keys)
+	} else if err != sealed.ErrNoKey {
+		log.Errorf("Unable to load the encryption key: %s", err)
+	}
+
+	// high security environments audit where plugins connect, and refuse anything undeclared
+	if os.Getenv("PLUGIN_AIRGAPPED") != "" {
+		Plugin{}.SetAirGapped(splitHosts(os.Getenv("PLUGIN_EGRESS_ALLOW"))...)
+	}
+
+	// customers can cap the events of a chatty source without a plugin release
+	samplingFromEnv()
+
+	// and let urgent events overtake more of a backlog
+	eventBufferFromEnv()
+
+	// telemetry is opt in, by whoever runs the plugin
+	telemetryFromEnv()
+
+	// long running plugins can connect before their first action arrives
+	if connection := os.Getenv("PLUGIN_WARM_CONNECTION"); connection != "" {
+		Plugin{}.SetWarmup(json.RawMessage(connection), os.Getenv("PLUGIN_WARM_TEST") != "")
+	}
+
 	// defaults to stdin
 	parameter.Stdin = parameter.NewParamSet(os.Stdin)
 
@@ -96,10 +157,16 @@ func (p *Plugin) Init(meta Meta) {
 }
 
 func (p *Plugin) setup() (task, error) {
+	return p.setupFrom(parameter.Stdin)
+}
+
+// setupFrom makes the task for the start message params hold
+func (p *Plugin) setupFrom(params *parameter.ParamSet) (task, error) {
+	p.declareEgress()
 	m := message.Message{}
 
 	// unmarshal message from stdin
-	if err := m.Unmarshal(parameter.Stdin); err != nil {
+	if err := m.Unmarshal(params); err != nil {
 		return nil, fmt.Errorf("Unable to deserialize message: %+v", err)
 	}
 
@@ -141,6 +208,7 @@ func (p *Plugin) setup() (task, error) {
 			message:    &start,
 			action:     action,
 			dispatcher: actionDispatcher(),
+			raw:        m.Body.RawMessage,
 		}
 		return task, nil
 	default:
@@ -148,8 +216,10 @@ func (p *Plugin) setup() (task, error) {
 	}
 }
 
-// Run runs a Plugin
+// Run runs a Plugin, then the shutdown hooks, see package shutdown
 func (p *Plugin) Run() error {
+	defer shutdown.Run()
+	p.startTelemetry()
 	t, err := p.setup()
 
 	if err != nil {
@@ -174,6 +244,9 @@ func (p Plugin) AddTrigger(trigger Triggerable) error {
 	if trigger.Name() == "" {
 		return errors.New("No Name() was found for the trigger.")
 	}
+	if _, ok := trigger.(*HealthTrigger); ok {
+		publishHealth = true
+	}
 
 	p.triggers[trigger.Name()] = trigger
 	return nil
@@ -197,6 +270,11 @@ func (p Plugin) AddAction(action Actionable) error {
 	if action.Name() == "" {
 		return errors.New("No Name() was found for the action.")
 	}
+	if schemable, ok := action.(InputSchemable); ok && !schema.Lazy {
+		if _, err := schema.Compile(schemable.InputSchema()); err != nil {
+			return fmt.Errorf("Invalid input schema for %s: %s", action.Name(), err)
+		}
+	}
 
 	p.actions[action.Name()] = action
 	return nil
@@ -237,6 +315,18 @@ func (p Plugin) SetDebug() {
 	log.Debug("Setting debug logging")
 }
 
+// SetDispatcher replaces the dispatcher for both triggers and actions, ie: to capture events in tests.
+// The start message can still configure it, as it's unpacked into whatever dispatcher is set.
+func (p Plugin) SetDispatcher(d Dispatcher) {
+	defaultTriggerDispatcher = d
+	defaultActionDispatcher = d
+}
+
+// SetCodec replaces the JSON implementation messages are encoded and decoded with, see package codec
+func (p Plugin) SetCodec(c codec.Codec) {
+	codec.Set(c)
+}
+
 // SetDebugLog mode will log all events to a debug log file.
 func (p Plugin) SetDebugLog(logfile string) error {
 	if logfile == "" {
@@ -252,3 +342,9 @@ func (p Plugin) SetDebugLog(logfile string) error {
 	defaultActionDispatcher = fd
 	return nil
 }
+
+// SetArtifactStore hands action outputs larger than threshold bytes off by reference: the output
+// is written to store and the action result carries a message.ArtifactRef valid for ttl instead.
+func (p Plugin) SetArtifactStore(store artifact.Store, threshold int, ttl time.Duration) {
+	artifactHandoff = &handoff{store: store, threshold: threshold, ttl: ttl}
+}
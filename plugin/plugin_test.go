@@ -1,6 +1,18 @@
 package plugin
 
-import "testing"
+import (
+	"os"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+// TestMain keeps what the tests save in the cache, like the totals of the triggers they run, in memory
+// rather than /var/cache
+func TestMain(m *testing.M) {
+	cache.SetBackend(&cache.MemoryBackend{})
+	os.Exit(m.Run())
+}
 
 type HelloPlugin struct {
 	Plugin
@@ -0,0 +1,137 @@
+package plugintest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// ErrChaos is the error injected when Chaos.Err is not set
+var ErrChaos = errors.New("plugintest: injected failure")
+
+// Chaos injects faults with the given probabilities (0 to 1), so plugin authors can check their
+// retry and backoff behavior before a flaky vendor API does it for them. Decisions are drawn from
+// utils.Rand, so combine it with SeedRand to make a failing run reproducible.
+type Chaos struct {
+	LatencyProbability float64       // LatencyProbability of delaying a call
+	MaxLatency         time.Duration // MaxLatency added to a delayed call, the delay is random up to this
+
+	ErrorProbability float64 // ErrorProbability of failing a call outright
+	Err              error   // Err to fail with, defaults to ErrChaos
+
+	StatusProbability float64 // StatusProbability of replacing an HTTP response with Status
+	Status            int     // Status to respond with, defaults to 503
+
+	TruncateProbability float64 // TruncateProbability of cutting an HTTP response body in half
+}
+
+// Transport wraps next (http.DefaultTransport if nil) with fault injection. Install it on the
+// http.Client the plugin under test uses.
+func (c Chaos) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &chaosTransport{chaos: c, next: next}
+}
+
+// Dispatcher wraps next with fault injection, so a trigger's handling of dispatch failures can be tested
+func (c Chaos) Dispatcher(next message.Dispatcher) message.Dispatcher {
+	return &chaosDispatcher{chaos: c, next: next}
+}
+
+func (c Chaos) roll(probability float64) bool {
+	return probability > 0 && utils.Rand().Float64() < probability
+}
+
+// delay sleeps for a random latency, if the dice say so
+func (c Chaos) delay() {
+	if c.MaxLatency > 0 && c.roll(c.LatencyProbability) {
+		time.Sleep(time.Duration(utils.Rand().Int63n(int64(c.MaxLatency))))
+	}
+}
+
+func (c Chaos) err() error {
+	if c.Err != nil {
+		return c.Err
+	}
+	return ErrChaos
+}
+
+type chaosTransport struct {
+	chaos Chaos
+	next  http.RoundTripper
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.chaos.delay()
+	if t.chaos.roll(t.chaos.ErrorProbability) {
+		return nil, t.chaos.err()
+	}
+	if t.chaos.roll(t.chaos.StatusProbability) {
+		status := t.chaos.Status
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		body := fmt.Sprintf("plugintest: injected %d", status)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !t.chaos.roll(t.chaos.TruncateProbability) {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &truncatedBody{Reader: bytes.NewReader(body[:len(body)/2])}
+	return resp, nil
+}
+
+// truncatedBody ends with io.ErrUnexpectedEOF, the way a dropped connection does
+type truncatedBody struct {
+	*bytes.Reader
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return nil
+}
+
+type chaosDispatcher struct {
+	chaos Chaos
+	next  message.Dispatcher
+}
+
+func (d *chaosDispatcher) Send(msg *message.Message) error {
+	d.chaos.delay()
+	if d.chaos.roll(d.chaos.ErrorProbability) {
+		return d.chaos.err()
+	}
+	return d.next.Send(msg)
+}
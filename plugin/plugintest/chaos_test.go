@@ -0,0 +1,146 @@
+package plugintest
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// recordingDispatcher counts the messages that got through to it
+type recordingDispatcher struct {
+	sent int
+}
+
+func (d *recordingDispatcher) Send(*message.Message) error {
+	d.sent++
+	return nil
+}
+
+func chaosServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		io.WriteString(w, "0123456789")
+	}))
+}
+
+// chaosErrors returns which of n requests through c failed with err
+func chaosErrors(t *testing.T, c Chaos, srv *httptest.Server, n int, err error) []bool {
+	client := &http.Client{Transport: c.Transport(nil)}
+	var failed []bool
+	for i := 0; i < n; i++ {
+		resp, e := client.Get(srv.URL)
+		if e == nil {
+			resp.Body.Close()
+		} else if e.(*url.Error).Err != err {
+			t.Fatalf("Expected the injected error, got %v", e)
+		}
+		failed = append(failed, e != nil)
+	}
+	return failed
+}
+
+func TestChaosErrors(t *testing.T) {
+	var requests int32
+	srv := chaosServer(&requests)
+	defer srv.Close()
+	c := Chaos{ErrorProbability: 0.5}
+
+	restore := SeedRand(42)
+	first := chaosErrors(t, c, srv, 50, ErrChaos)
+	restore()
+	failures := 0
+	for _, failed := range first {
+		if failed {
+			failures++
+		}
+	}
+	if failures == 0 || failures == 50 || int(atomic.LoadInt32(&requests)) != 50-failures {
+		t.Fatalf("Expected some of the 50 requests to fail and the rest to be sent, got %d failures and %d sent", failures, requests)
+	}
+
+	// the same seed fails the same requests
+	restore = SeedRand(42)
+	again := chaosErrors(t, c, srv, 50, ErrChaos)
+	restore()
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("Expected the same requests to fail with the same seed, request %d didn't", i)
+		}
+	}
+
+	refused := errors.New("connection refused")
+	for _, failed := range chaosErrors(t, Chaos{ErrorProbability: 1, Err: refused}, srv, 5, refused) {
+		if !failed {
+			t.Fatal("Expected every request to fail with a probability of 1")
+		}
+	}
+}
+
+func TestChaosDispatcher(t *testing.T) {
+	next := &recordingDispatcher{}
+	if err := (Chaos{ErrorProbability: 1}).Dispatcher(next).Send(&message.Message{}); err != ErrChaos || next.sent != 0 {
+		t.Fatalf("Expected the dispatch to fail without being sent, got %v and %d sent", err, next.sent)
+	}
+	if err := (Chaos{}).Dispatcher(next).Send(&message.Message{}); err != nil || next.sent != 1 {
+		t.Fatalf("Expected the dispatch to be sent without faults, got %v and %d sent", err, next.sent)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	const seed, max = 7, 50 * time.Millisecond
+	r := rand.New(rand.NewSource(seed))
+	r.Float64() // the roll
+	expected := time.Duration(r.Int63n(int64(max)))
+
+	defer SeedRand(seed)()
+	started := time.Now()
+	(Chaos{LatencyProbability: 1, MaxLatency: max}).Dispatcher(&recordingDispatcher{}).Send(&message.Message{})
+	if elapsed := time.Since(started); elapsed < expected || elapsed > max+time.Second {
+		t.Fatalf("Expected the dispatch to be delayed by %s, took %s", expected, elapsed)
+	}
+}
+
+func TestChaosStatus(t *testing.T) {
+	var requests int32
+	srv := chaosServer(&requests)
+	defer srv.Close()
+	for status, expected := range map[int]int{0: http.StatusServiceUnavailable, http.StatusTooManyRequests: http.StatusTooManyRequests} {
+		client := &http.Client{Transport: Chaos{StatusProbability: 1, Status: status}.Transport(nil)}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Expected the response to be replaced with %d, got %s", expected, resp.Status)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Fatalf("Expected replaced responses not to be requested, got %d requests", requests)
+	}
+}
+
+func TestChaosTruncates(t *testing.T) {
+	var requests int32
+	srv := chaosServer(&requests)
+	defer srv.Close()
+	client := &http.Client{Transport: Chaos{TruncateProbability: 1}.Transport(nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != io.ErrUnexpectedEOF || string(body) != "01234" {
+		t.Fatalf("Expected half the body then an unexpected EOF, got %q, %v", body, err)
+	}
+}
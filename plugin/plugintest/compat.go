@@ -0,0 +1,217 @@
+package plugintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin"
+	"github.com/komand/plugin-sdk-go/plugin/conformance"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+)
+
+// CompatDir is where recorded start messages are kept, relative to the package under test, in a directory
+// per plugin version: testdata/compat/<version>/<name>.json, next to <name>.result.json, the result that
+// version produced
+var CompatDir = filepath.Join("testdata", "compat")
+
+// resultSuffix names the recorded result of a start message
+const resultSuffix = ".result.json"
+
+// RecordCompat runs the action start message with the plugin and records both under CompatDir, for the
+// plugin's version. Record a few starts for each action when releasing, and CheckCompat keeps later
+// versions from breaking the workflows they came from.
+func RecordCompat(t testing.TB, p plugin.Pluginable, name string, start []byte) {
+	result, err := runAction(p, start)
+	if err != nil {
+		t.Fatalf("Unable to record %s: %s", name, err)
+	}
+	dir := filepath.Join(CompatDir, p.Version())
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, name+".json"), start, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, name+resultSuffix), result, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// CheckCompat runs every action start message recorded under CompatDir with the plugin, as a subtest named
+// <version>/<name>. Each has to be accepted, and produce a result with the recorded status and an output
+// compatible with the recorded output: fields may be added, but every recorded field has to still be there
+// with the same JSON type. Start messages without a recorded result only have to be accepted.
+func CheckCompat(t *testing.T, p plugin.Pluginable) {
+	starts, err := filepath.Glob(filepath.Join(CompatDir, "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(starts)
+	checked := 0
+	for _, path := range starts {
+		if strings.HasSuffix(path, resultSuffix) {
+			continue
+		}
+		checked++
+		version := filepath.Base(filepath.Dir(path))
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		path := path
+		t.Run(version+"/"+name, func(t *testing.T) {
+			if err := checkCompat(p, path); err != nil {
+				t.Errorf("Plugin version %s no longer handles %s from version %s: %s", p.Version(), name, version, err)
+			}
+		})
+	}
+	if checked == 0 {
+		t.Fatalf("No start messages recorded in %s, record some with RecordCompat", CompatDir)
+	}
+}
+
+func checkCompat(p plugin.Pluginable, path string) error {
+	start, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	b, err := runAction(p, start)
+	if err != nil {
+		return err
+	}
+	got, err := conformance.ValidateActionEvent(b)
+	if err != nil {
+		return err
+	}
+	recorded, err := ioutil.ReadFile(strings.TrimSuffix(path, ".json") + resultSuffix)
+	if os.IsNotExist(err) {
+		if got.Status != message.OK {
+			return fmt.Errorf("the action failed: %s", got.Error)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	want, err := conformance.ValidateActionEvent(recorded)
+	if err != nil {
+		return fmt.Errorf("invalid recorded result: %s", err)
+	}
+	if got.Status != want.Status {
+		return fmt.Errorf("expected status %s, got %s %s", want.Status, got.Status, got.Error)
+	}
+	if want.Status != message.OK {
+		return nil
+	}
+	var oldOutput, newOutput interface{}
+	if err = json.Unmarshal(want.Output.RawMessage, &oldOutput); err != nil {
+		return fmt.Errorf("invalid recorded output: %s", err)
+	}
+	if err = json.Unmarshal(got.Output.RawMessage, &newOutput); err != nil {
+		return err
+	}
+	if problems := compareOutputs("output", oldOutput, newOutput, nil); len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// compareOutputs appends how new breaks readers of old, at path, to problems
+func compareOutputs(path string, old, new interface{}, problems []string) []string {
+	if old == nil {
+		return problems
+	}
+	if jsonType(old) != jsonType(new) {
+		return append(problems, fmt.Sprintf("%s was %s, is %s", path, jsonType(old), jsonType(new)))
+	}
+	switch old := old.(type) {
+	case map[string]interface{}:
+		newObject := new.(map[string]interface{})
+		keys := make([]string, 0, len(old))
+		for key := range old {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v, ok := newObject[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", path, key))
+				continue
+			}
+			problems = compareOutputs(path+"."+key, old[key], v, problems)
+		}
+	case []interface{}:
+		// items are compared by shape, against the first recorded item
+		if len(old) == 0 {
+			return problems
+		}
+		for i, item := range new.([]interface{}) {
+			problems = compareOutputs(fmt.Sprintf("%s[%d]", path, i), old[0], item, problems)
+		}
+	}
+	return problems
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// runActionMu serializes runAction, as the plugin reads its start message from parameter.Stdin
+var runActionMu sync.Mutex
+
+// runAction runs the action start message with the plugin, returning the action event it emitted
+func runAction(p plugin.Pluginable, start []byte) ([]byte, error) {
+	setter, ok := p.(dispatcherSetter)
+	if !ok {
+		return nil, errors.New("The plugin must embed plugin.Plugin to be compatibility tested")
+	}
+	runActionMu.Lock()
+	defer runActionMu.Unlock()
+	capture := &capturingDispatcher{}
+	setter.SetDispatcher(capture)
+	stdin := parameter.Stdin
+	defer func() { parameter.Stdin = stdin }()
+	parameter.Stdin = parameter.NewParamSet(bytes.NewReader(start))
+	if err := p.Run(); err != nil {
+		return nil, fmt.Errorf("the start message was refused: %s", err)
+	}
+	if capture.last == nil {
+		return nil, errors.New("the action emitted nothing")
+	}
+	return capture.last, nil
+}
+
+// capturingDispatcher keeps the last message sent
+type capturingDispatcher struct {
+	URL  string `json:"url"`
+	last []byte
+}
+
+func (d *capturingDispatcher) Send(msg *message.Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	d.last = b
+	return nil
+}
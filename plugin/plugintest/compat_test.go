@@ -0,0 +1,59 @@
+package plugintest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin"
+	"github.com/komand/plugin-sdk-go/plugin/conformance"
+)
+
+type lookupOutput struct {
+	Country string   `json:"country"`
+	Tags    []string `json:"tags"`
+}
+
+// lookupAction returns its output as is, so each version of it can be built by changing the output
+type lookupAction struct {
+	plugin.Action
+	output interface{}
+}
+
+func (l *lookupAction) Name() string          { return "lookup" }
+func (l *lookupAction) Description() string   { return "Looks an address up" }
+func (l *lookupAction) Act() error            { return nil }
+func (l *lookupAction) Output() plugin.Output { return l.output }
+
+type compatPlugin struct {
+	plugin.Plugin
+}
+
+func newCompatPlugin(version string, output interface{}) *compatPlugin {
+	p := &compatPlugin{}
+	p.Init(plugin.Meta{Name: "compat", Version: version})
+	p.AddAction(&lookupAction{output: output})
+	return p
+}
+
+func TestCheckCompat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(old string) { CompatDir = old }(CompatDir)
+	CompatDir = dir
+
+	start := conformance.ActionStartMessage("lookup", []byte(`{}`), conformance.Sample{Input: map[string]string{"address": "1.2.3.4"}})
+	RecordCompat(t, newCompatPlugin("1.0.0", &lookupOutput{Country: "IE", Tags: []string{"cloud"}}), "lookup", start)
+
+	added := map[string]interface{}{"country": "IE", "tags": []string{}, "asn": 16509}
+	CheckCompat(t, newCompatPlugin("1.1.0", added))
+
+	renamed := map[string]interface{}{"country_code": "IE", "tags": "cloud"}
+	if err := checkCompat(newCompatPlugin("2.0.0", renamed), dir+"/1.0.0/lookup.json"); err == nil ||
+		err.Error() != "output.country is missing, output.tags was an array, is a string" {
+		t.Fatalf("Expected the breaking changes to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package plugintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin"
+	"github.com/komand/plugin-sdk-go/plugin/conformance"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+)
+
+const loadSampleInterval = 100 * time.Millisecond
+
+// MockSource stands in for a vendor API, generating synthetic events at a fixed rate. A polling
+// trigger can GET URL() to receive a JSON array of everything generated since its last poll, and a
+// streaming trigger can GET URL()+"/stream" to receive events as newline delimited JSON.
+type MockSource struct {
+	server    *httptest.Server
+	generate  func(i int) interface{}
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []interface{}
+	generated int
+	stopped   bool
+	done      chan struct{}
+}
+
+// NewMockSource starts generating rate events per second, each built by generate from its sequence number
+func NewMockSource(rate float64, generate func(i int) interface{}) *MockSource {
+	s := &MockSource{generate: generate, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.poll)
+	mux.HandleFunc("/stream", s.stream)
+	s.server = httptest.NewServer(mux)
+	go s.run(rate)
+	return s
+}
+
+// URL is the base URL of the mock source
+func (s *MockSource) URL() string {
+	return s.server.URL
+}
+
+// Generated is the number of events generated so far
+func (s *MockSource) Generated() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generated
+}
+
+// Stop stops generating events, but keeps serving the ones already generated
+func (s *MockSource) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Close stops the source and shuts down its server
+func (s *MockSource) Close() {
+	s.Stop()
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+func (s *MockSource) run(rate float64) {
+	if rate <= 0 {
+		return
+	}
+	// generate in small batches so high rates don't depend on timer resolution
+	start := time.Now()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			due := int(now.Sub(start).Seconds() * rate)
+			s.mu.Lock()
+			for s.generated < due {
+				s.pending = append(s.pending, s.generate(s.generated))
+				s.generated++
+			}
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *MockSource) take() []interface{} {
+	events := s.pending
+	s.pending = nil
+	return events
+}
+
+func (s *MockSource) poll(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	events := s.take()
+	s.mu.Unlock()
+	if events == nil {
+		events = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func (s *MockSource) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for {
+		s.mu.Lock()
+		for len(s.pending) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		events := s.take()
+		stopped := s.stopped
+		s.mu.Unlock()
+
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// LoadReport is what a LoadTest measured
+type LoadReport struct {
+	Duration      time.Duration // Duration the test ran for
+	Generated     int           // Generated events by the mock source
+	Dispatched    int           // Dispatched events by the trigger
+	Throughput    float64       // Throughput of dispatched events per second
+	MaxBacklog    int           // MaxBacklog of generated but not yet dispatched events seen while sampling
+	PeakHeapBytes uint64        // PeakHeapBytes allocated while sampling
+	Errors        []error       // Errors returned by the trigger, if it exited early
+}
+
+// LoadTest runs a trigger against a MockSource for a while and measures how it keeps up
+type LoadTest struct {
+	Plugin     plugin.Pluginable
+	Trigger    string
+	Input      interface{}
+	Connection interface{}
+	Source     *MockSource
+	Duration   time.Duration
+}
+
+type dispatcherSetter interface {
+	SetDispatcher(plugin.Dispatcher)
+}
+
+// Run starts the trigger, samples it until Duration is up, and reports. Triggers can't be stopped
+// from outside, so the trigger goroutine is left running: run load tests in their own test binary.
+func (l *LoadTest) Run() (*LoadReport, error) {
+	counter, exited, err := l.start()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LoadReport{}
+	began := time.Now()
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+	deadline := time.After(l.Duration)
+	var mem runtime.MemStats
+sampling:
+	for {
+		select {
+		case err := <-exited:
+			if err != nil {
+				report.Errors = append(report.Errors, err)
+			}
+			break sampling
+		case <-deadline:
+			break sampling
+		case <-ticker.C:
+			if backlog := l.Source.Generated() - counter.count(); backlog > report.MaxBacklog {
+				report.MaxBacklog = backlog
+			}
+			runtime.ReadMemStats(&mem)
+			if mem.HeapAlloc > report.PeakHeapBytes {
+				report.PeakHeapBytes = mem.HeapAlloc
+			}
+		}
+	}
+	l.Source.Stop()
+
+	report.Duration = time.Since(began)
+	report.Generated = l.Source.Generated()
+	report.Dispatched = counter.count()
+	report.Throughput = float64(report.Dispatched) / report.Duration.Seconds()
+	return report, nil
+}
+
+// start runs the trigger in the background with a counting dispatcher
+func (l *LoadTest) start() (*countingDispatcher, chan error, error) {
+	setter, ok := l.Plugin.(dispatcherSetter)
+	if !ok {
+		return nil, nil, errors.New("The plugin must embed plugin.Plugin to be load tested")
+	}
+	counter := &countingDispatcher{}
+	setter.SetDispatcher(counter)
+
+	start := conformance.TriggerStartMessage(l.Trigger, json.RawMessage(`{}`), "http://localhost/", conformance.Sample{
+		Input:      l.Input,
+		Connection: l.Connection,
+	})
+	parameter.Stdin = parameter.NewParamSet(bytes.NewReader(start))
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- l.Plugin.Run()
+	}()
+	return counter, exited, nil
+}
+
+// countingDispatcher counts events and throws them away
+type countingDispatcher struct {
+	URL string `json:"url"`
+	mu  sync.Mutex
+	n   int
+}
+
+func (d *countingDispatcher) Send(msg *message.Message) error {
+	d.mu.Lock()
+	d.n++
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *countingDispatcher) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
@@ -0,0 +1,123 @@
+package plugintest
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+// TestMain keeps what the triggers under test save in the cache in memory rather than /var/cache
+func TestMain(m *testing.M) {
+	cache.SetBackend(&cache.MemoryBackend{})
+	os.Exit(m.Run())
+}
+
+// pollTrigger polls a MockSource, dispatching what it gets unless it discards it, until the source is closed
+type pollTrigger struct {
+	plugin.Trigger
+	source  *MockSource
+	discard bool
+	done    chan struct{}
+}
+
+func (p *pollTrigger) Name() string        { return "poll" }
+func (p *pollTrigger) Description() string { return "Polls the mock source" }
+
+func (p *pollTrigger) RunTrigger() error {
+	defer close(p.done)
+	for {
+		resp, err := http.Get(p.source.URL())
+		if err != nil {
+			return err
+		}
+		var events []map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&events)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if p.discard {
+				continue
+			}
+			if err = p.Send(e); err != nil {
+				return err
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type loadPlugin struct {
+	plugin.Plugin
+}
+
+// newLoadTest load tests a pollTrigger against a source generating rate events per second. Call the
+// returned function once it's done to close the source and wait for the trigger to exit.
+func newLoadTest(t *testing.T, rate float64, discard bool, duration time.Duration) (*LoadTest, func()) {
+	source := NewMockSource(rate, func(i int) interface{} { return map[string]int{"id": i} })
+	trigger := &pollTrigger{source: source, discard: discard, done: make(chan struct{})}
+	p := &loadPlugin{}
+	p.Init(plugin.Meta{Name: "load", Version: "1.0.0"})
+	p.AddTrigger(trigger)
+	return &LoadTest{Plugin: p, Trigger: "poll", Source: source, Duration: duration}, func() {
+		source.Close()
+		select {
+		case <-trigger.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the trigger to exit once its source was closed")
+		}
+	}
+}
+
+func TestLoadTest(t *testing.T) {
+	l, done := newLoadTest(t, 200, false, 300*time.Millisecond)
+	defer done()
+	report, err := l.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) > 0 {
+		t.Fatalf("Expected the trigger to keep running, got %v", report.Errors)
+	}
+	if report.Generated < 20 || report.Dispatched == 0 || report.Dispatched > report.Generated {
+		t.Fatalf("Expected events to be generated and dispatched, got %d generated and %d dispatched", report.Generated, report.Dispatched)
+	}
+	if report.MaxBacklog > report.Generated || report.Throughput <= 0 || report.Duration < 300*time.Millisecond {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+}
+
+func TestLoadTestMeasuresTheBacklog(t *testing.T) {
+	l, done := newLoadTest(t, 200, true, 300*time.Millisecond)
+	defer done()
+	report, err := l.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Dispatched != 0 || report.MaxBacklog == 0 || report.MaxBacklog > report.Generated {
+		t.Fatalf("Expected a trigger that dispatches nothing to fall behind, got %+v", report)
+	}
+}
+
+func TestMockSourceStreams(t *testing.T) {
+	source := NewMockSource(100, func(i int) interface{} { return i })
+	defer source.Close()
+	resp, err := http.Get(source.URL() + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for expected := 0; expected < 3; expected++ {
+		var i int
+		if err = dec.Decode(&i); err != nil || i != expected {
+			t.Fatalf("Expected event %d to be streamed, got %d, %v", expected, i, err)
+		}
+	}
+}
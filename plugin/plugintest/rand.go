@@ -0,0 +1,17 @@
+package plugintest
+
+import (
+	"math/rand"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// SeedRand makes utils.Rand deterministic for the duration of a test, so jitter, generated IDs and
+// sampling decisions are the same on every run. Call the returned function to restore the
+// previous source, ie: defer plugintest.SeedRand(42)()
+func SeedRand(seed int64) (restore func()) {
+	previous := utils.SetRandSource(rand.NewSource(seed))
+	return func() {
+		utils.SetRandSource(previous)
+	}
+}
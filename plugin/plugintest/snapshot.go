@@ -0,0 +1,103 @@
+// Package plugintest holds helpers for testing plugins: snapshot (golden file) assertions,
+// compatibility checks against start messages recorded from earlier versions, and harnesses
+// for running actions and triggers against mocks.
+package plugintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/diff"
+)
+
+// SnapshotDir is where snapshots are kept, relative to the package under test
+var SnapshotDir = filepath.Join("testdata", "snapshots")
+
+// update is namespaced, so it doesn't clash with an -update flag of the plugin's own tests
+var update = flag.Bool("plugintest.update", false, "rewrite plugintest snapshots with the current output")
+
+// Normalizer rewrites volatile parts of an output, like timestamps or generated IDs, so that
+// snapshots only change when something meaningful does
+type Normalizer func([]byte) []byte
+
+// NormalizeRegexp replaces every match of pattern with replacement
+func NormalizeRegexp(pattern string, replacement string) Normalizer {
+	re := regexp.MustCompile(pattern)
+	return func(b []byte) []byte {
+		return re.ReplaceAll(b, []byte(replacement))
+	}
+}
+
+// NormalizeTimestamps replaces RFC3339 timestamps with <timestamp>
+var NormalizeTimestamps = NormalizeRegexp(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`, "<timestamp>")
+
+// NormalizeUUIDs replaces UUIDs with <uuid>
+var NormalizeUUIDs = NormalizeRegexp(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, "<uuid>")
+
+// NormalizeJSONField replaces the value of every JSON string or number field called name with <name>
+func NormalizeJSONField(name string) Normalizer {
+	return NormalizeRegexp(`("`+regexp.QuoteMeta(name)+`":\s*)("(?:[^"\\]|\\.)*"|-?[0-9.eE+-]+)`, `${1}"<`+name+`>"`)
+}
+
+// MatchSnapshot compares got with the snapshot called name, failing t with a diff if they differ.
+// Strings and byte slices are compared as is, anything else is compared as indented JSON.
+// Run the tests with -plugintest.update to write the current output as the new snapshot.
+func MatchSnapshot(t testing.TB, name string, got interface{}, normalizers ...Normalizer) {
+	actual, err := snapshotBytes(got)
+	if err != nil {
+		t.Fatalf("Unable to snapshot %s: %s", name, err)
+	}
+	for _, n := range normalizers {
+		actual = n(actual)
+	}
+
+	path := filepath.Join(SnapshotDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("No snapshot %s yet, run the tests with -plugintest.update to create it", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("Output does not match snapshot %s, run the tests with -plugintest.update if this is expected:\n%s",
+			path, diff.Unified("snapshot", "actual", string(expected), string(actual), 3))
+	}
+}
+
+func snapshotBytes(got interface{}) ([]byte, error) {
+	switch v := got.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case json.RawMessage:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, v, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+	b, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
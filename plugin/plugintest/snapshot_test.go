@@ -0,0 +1,22 @@
+package plugintest
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestMatchSnapshot(t *testing.T) {
+	output := map[string]interface{}{
+		"id":         "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"created_at": "2017-03-01T12:30:00Z",
+		"hosts":      []string{"web01", "db01"},
+	}
+	MatchSnapshot(t, "example", output, NormalizeUUIDs, NormalizeTimestamps)
+}
+
+func TestUpdateFlagIsNamespaced(t *testing.T) {
+	// a plugin's tests can define their own -update
+	if flag.Lookup("update") != nil || flag.Lookup("plugintest.update") == nil {
+		t.Fatal("Expected the update flag to be registered as -plugintest.update only")
+	}
+}
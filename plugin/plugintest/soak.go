@@ -0,0 +1,134 @@
+package plugintest
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/leakcheck"
+)
+
+// SoakInterval is how often Soak samples the trigger and checks its invariants
+var SoakInterval = 5 * time.Second
+
+// SoakSample is a point in time measurement of a soaking trigger
+type SoakSample struct {
+	Elapsed    time.Duration
+	Goroutines int
+	HeapAlloc  uint64
+	FDs        int // FDs open, -1 where they can't be counted
+	Generated  int // Generated events by the mock source so far
+	Dispatched int // Dispatched events by the trigger so far
+}
+
+// Invariant checks a sample against the baseline taken before the trigger started, and returns
+// an error describing the violation, if any
+type Invariant func(baseline, sample SoakSample) error
+
+// Soak runs a trigger against its mocks for duration, checking every invariant at each SoakInterval
+// and failing t on the first violation. It's meant for long running nightly jobs, where slow leaks
+// that no unit test notices have time to show up. As with LoadTest, the trigger can't be stopped
+// from outside and is left running.
+func Soak(t testing.TB, trigger *LoadTest, duration time.Duration, invariants ...Invariant) {
+	baseline := takeSoakSample(0, trigger, nil)
+	counter, exited, err := trigger.start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trigger.Source.Stop()
+
+	began := time.Now()
+	ticker := time.NewTicker(SoakInterval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+	for {
+		select {
+		case err := <-exited:
+			t.Fatalf("Trigger exited after %s: %v", time.Since(began), err)
+		case <-deadline:
+			return
+		case <-ticker.C:
+			sample := takeSoakSample(time.Since(began), trigger, counter)
+			for _, check := range invariants {
+				if err := check(baseline, sample); err != nil {
+					t.Fatalf("Invariant violated after %s: %s", sample.Elapsed, err)
+				}
+			}
+		}
+	}
+}
+
+func takeSoakSample(elapsed time.Duration, trigger *LoadTest, counter *countingDispatcher) SoakSample {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := SoakSample{
+		Elapsed:    elapsed,
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+		FDs:        leakcheck.CountFDs(),
+		Generated:  trigger.Source.Generated(),
+	}
+	if counter != nil {
+		s.Dispatched = counter.count()
+	}
+	return s
+}
+
+// MaxGoroutineGrowth fails if the number of goroutines grows by more than n over the baseline.
+// The trigger itself and the SDK's event collector account for a handful, so leave some headroom.
+func MaxGoroutineGrowth(n int) Invariant {
+	return func(baseline, sample SoakSample) error {
+		if growth := sample.Goroutines - baseline.Goroutines; growth > n {
+			return fmt.Errorf("Goroutines grew by %d (from %d to %d), more than the allowed %d", growth, baseline.Goroutines, sample.Goroutines, n)
+		}
+		return nil
+	}
+}
+
+// MaxFDGrowth fails if the number of open file descriptors grows by more than n over the baseline,
+// usually a response body or connection that's never closed
+func MaxFDGrowth(n int) Invariant {
+	return func(baseline, sample SoakSample) error {
+		if baseline.FDs < 0 || sample.FDs < 0 {
+			return nil
+		}
+		if growth := sample.FDs - baseline.FDs; growth > n {
+			return fmt.Errorf("File descriptors grew by %d (from %d to %d), more than the allowed %d", growth, baseline.FDs, sample.FDs, n)
+		}
+		return nil
+	}
+}
+
+// MaxHeap fails if the allocated heap exceeds max bytes
+func MaxHeap(max uint64) Invariant {
+	return func(baseline, sample SoakSample) error {
+		if sample.HeapAlloc > max {
+			return fmt.Errorf("Heap grew to %d bytes, more than the allowed %d", sample.HeapAlloc, max)
+		}
+		return nil
+	}
+}
+
+// MaxBacklog fails if more than n generated events are waiting to be dispatched
+func MaxBacklog(n int) Invariant {
+	return func(baseline, sample SoakSample) error {
+		if backlog := sample.Generated - sample.Dispatched; backlog > n {
+			return fmt.Errorf("Backlog of %d undispatched events is more than the allowed %d", backlog, n)
+		}
+		return nil
+	}
+}
+
+// Monotonic fails if position ever goes backwards, ie: a checkpoint that should only ever advance
+func Monotonic(name string, position func() int64) Invariant {
+	last := int64(-1 << 63)
+	return func(baseline, sample SoakSample) error {
+		current := position()
+		if current < last {
+			return fmt.Errorf("%s went backwards from %d to %d", name, last, current)
+		}
+		last = current
+		return nil
+	}
+}
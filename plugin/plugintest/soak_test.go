@@ -0,0 +1,104 @@
+package plugintest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fatalTB records the first failure of a Soak rather than failing the test, and stops the goroutine
+// it's called from like testing.T.Fatal does
+type fatalTB struct {
+	testing.TB
+	mu     sync.Mutex
+	failed string
+}
+
+func (f *fatalTB) Fatal(args ...interface{}) {
+	f.Fatalf("%s", fmt.Sprint(args...))
+}
+
+func (f *fatalTB) Fatalf(format string, args ...interface{}) {
+	f.mu.Lock()
+	f.failed = fmt.Sprintf(format, args...)
+	f.mu.Unlock()
+	runtime.Goexit()
+}
+
+// soak runs Soak with t standing in for the test, returning the failure it recorded, if any
+func soak(t *testing.T, l *LoadTest, duration time.Duration, invariants ...Invariant) string {
+	defer func(interval time.Duration) { SoakInterval = interval }(SoakInterval)
+	SoakInterval = 20 * time.Millisecond
+	tb := &fatalTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Soak(tb, l, duration, invariants...)
+	}()
+	<-done
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.failed
+}
+
+func TestSoak(t *testing.T) {
+	l, done := newLoadTest(t, 200, false, 0)
+	defer done()
+	var samples []SoakSample
+	record := func(baseline, sample SoakSample) error {
+		samples = append(samples, sample)
+		return nil
+	}
+	failed := soak(t, l, 200*time.Millisecond, MaxGoroutineGrowth(100), MaxBacklog(1000), MaxHeap(1<<30), record)
+	if failed != "" {
+		t.Fatal(failed)
+	}
+	if len(samples) < 3 {
+		t.Fatalf("Expected the trigger to be sampled every interval, got %d samples", len(samples))
+	}
+	last := samples[len(samples)-1]
+	if last.Elapsed <= 0 || last.Generated == 0 || last.Dispatched == 0 || last.Goroutines == 0 || last.HeapAlloc == 0 {
+		t.Fatalf("Expected the last sample to measure the trigger, got %+v", last)
+	}
+}
+
+func TestSoakFailsOnAViolatedInvariant(t *testing.T) {
+	l, done := newLoadTest(t, 200, false, 0)
+	defer done()
+	positions := []int64{1, 2, 1}
+	position := func() int64 {
+		p := positions[0]
+		if len(positions) > 1 {
+			positions = positions[1:]
+		}
+		return p
+	}
+	failed := soak(t, l, 5*time.Second, Monotonic("checkpoint", position))
+	if !strings.Contains(failed, "checkpoint went backwards from 2 to 1") {
+		t.Fatalf("Expected the soak to fail when the checkpoint went backwards, got %q", failed)
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	baseline := SoakSample{Goroutines: 10, FDs: 20}
+	for _, c := range []struct {
+		invariant Invariant
+		sample    SoakSample
+		violated  bool
+	}{
+		{MaxGoroutineGrowth(5), SoakSample{Goroutines: 15}, false},
+		{MaxGoroutineGrowth(5), SoakSample{Goroutines: 16}, true},
+		{MaxFDGrowth(5), SoakSample{FDs: 26}, true},
+		{MaxFDGrowth(5), SoakSample{FDs: -1}, false},
+		{MaxHeap(100), SoakSample{HeapAlloc: 101}, true},
+		{MaxBacklog(10), SoakSample{Generated: 30, Dispatched: 20}, false},
+		{MaxBacklog(10), SoakSample{Generated: 31, Dispatched: 20}, true},
+	} {
+		if err := c.invariant(baseline, c.sample); (err != nil) != c.violated {
+			t.Errorf("Expected %+v to violate the invariant: %v, got %v", c.sample, c.violated, err)
+		}
+	}
+}
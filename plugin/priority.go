@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// eventBuffer is how many events each priority lane of a trigger holds while the dispatcher is behind, set
+// by SetEventBuffer, or the PLUGIN_EVENT_BUFFER environment variable
+var eventBuffer = 1
+
+// The lanes of a trigger's queue, read highest first
+const (
+	laneHigh = iota
+	laneNormal
+	laneLow
+	lanes
+)
+
+// SetEventBuffer sets how many events of each priority a trigger can send ahead of the dispatcher, 1 by
+// default. Once a priority's are buffered, sending another blocks until one is dispatched. The dispatcher
+// takes the highest priority event buffered next, see Trigger.SendPriority, so a larger buffer lets urgent
+// events overtake more bulk ones, but the events buffered are lost if the plugin is killed.
+func (p Plugin) SetEventBuffer(n int) error {
+	if n < 1 {
+		return fmt.Errorf("Event buffer must be at least 1, got %d", n)
+	}
+	eventBuffer = n
+	return nil
+}
+
+// eventBufferFromEnv sets the event buffer if the environment asks for it
+func eventBufferFromEnv() {
+	v := os.Getenv("PLUGIN_EVENT_BUFFER")
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err == nil {
+		err = Plugin{}.SetEventBuffer(n)
+	}
+	if err != nil {
+		log.Warnf("Ignoring invalid event buffer: %s", err)
+	}
+}
+
+// prioritizedOutput wraps events sent with a priority other than PriorityNormal, until the collector
+// dispatches them
+type prioritizedOutput struct {
+	Output
+	priority message.Priority
+}
+
+// lane returns the lane events of the priority are queued in
+func lane(priority message.Priority) int {
+	switch priority {
+	case message.PriorityHigh:
+		return laneHigh
+	case message.PriorityLow:
+		return laneLow
+	}
+	return laneNormal
+}
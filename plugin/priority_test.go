@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+func TestPriorityLanes(t *testing.T) {
+	defer func(n int) { eventBuffer = n }(eventBuffer)
+	if err := (Plugin{}).SetEventBuffer(3); err != nil {
+		t.Fatal(err)
+	}
+	trigger := &Trigger{}
+	trigger.InitQueue()
+	for _, s := range []struct {
+		name     string
+		priority message.Priority
+	}{
+		{"info1", message.PriorityLow},
+		{"normal1", message.PriorityNormal},
+		{"info2", message.PriorityLow},
+		{"critical1", message.PriorityHigh},
+		{"normal2", message.PriorityNormal},
+		{"critical2", message.PriorityHigh},
+	} {
+		if err := trigger.SendPriority(s.name, s.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trigger.SendPriority("x", "urgent"); err == nil {
+		t.Fatal("Expected an unknown priority to be refused")
+	}
+	trigger.Stop()
+
+	dispatcher := &mockDispatcher{}
+	collector := &triggerEventCollector{
+		message:    &message.TriggerStart{Trigger: "hello"},
+		sender:     trigger,
+		dispatcher: dispatcher,
+		trigger:    &HelloTrigger{},
+	}
+	var order []string
+	for output := trigger.Read(); output != nil; output = trigger.Read() {
+		if err := collector.send(output); err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, dispatcher.result)
+	}
+	expected := []string{"critical1", "critical2", "normal1", "normal2", "info1", "info2"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected %d events dispatched, got %d", len(expected), len(order))
+	}
+	for i, name := range expected {
+		if !strings.Contains(order[i], `"output":"`+name+`"`) {
+			t.Fatalf("Expected %s dispatched %dth, got %s", name, i+1, order[i])
+		}
+	}
+	if !strings.Contains(order[0], `"priority":"high"`) || !strings.Contains(order[5], `"priority":"low"`) ||
+		strings.Contains(order[2], `"priority"`) {
+		t.Fatalf("Expected the events' priorities to be dispatched with them, got %v", order)
+	}
+}
+
+func TestSeverityPriority(t *testing.T) {
+	for severity, expected := range map[string]message.Priority{
+		"Critical":      message.PriorityHigh,
+		"high":          message.PriorityHigh,
+		"medium":        message.PriorityNormal,
+		"":              message.PriorityNormal,
+		"Informational": message.PriorityLow,
+	} {
+		if p := message.SeverityPriority(severity); p != expected {
+			t.Fatalf("Expected severity %q to be %s, got %s", severity, expected, p)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const filePerms = 0600
+
+// DiskQueue keeps each message in a file in a directory, with dead letters in its dead subdirectory.
+// Its state is kept in memory and written through on every change, so it's for sharing work between
+// the goroutines of one process; use a RedisQueue to share between processes.
+type DiskQueue struct {
+	dir  string
+	opts Options
+
+	mu      sync.Mutex
+	pending map[string]*diskMessage
+}
+
+// diskMessage is the file written for each message
+type diskMessage struct {
+	Message
+	VisibleAt time.Time `json:"visible_at"`
+}
+
+// NewDiskQueue opens the queue kept in dir, creating it if needed, ie: /var/cache/queue/<name>
+func NewDiskQueue(dir string, opts Options) (*DiskQueue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "dead"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{dir: dir, opts: opts, pending: map[string]*diskMessage{}}
+	messages, err := readMessages(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range messages {
+		q.pending[m.ID] = m
+	}
+	return q, nil
+}
+
+// Enqueue implements Queue
+func (q *DiskQueue) Enqueue(body []byte) (string, error) {
+	now := time.Now()
+	m := &diskMessage{Message: Message{ID: newID(now), Body: body, Enqueued: now}, VisibleAt: now}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := writeMessage(q.dir, m); err != nil {
+		return "", err
+	}
+	q.pending[m.ID] = m
+	return m.ID, nil
+}
+
+// Receive implements Queue
+func (q *DiskQueue) Receive(ctx context.Context, visibility time.Duration) (*Message, error) {
+	return poll(ctx, q.opts.pollInterval(), func() (*Message, error) {
+		return q.receive(visibility)
+	})
+}
+
+func (q *DiskQueue) receive(visibility time.Duration) (*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for _, m := range q.sorted() {
+		if m.VisibleAt.After(now) {
+			continue
+		}
+		if q.opts.MaxAttempts > 0 && m.Attempts >= q.opts.MaxAttempts {
+			if err := q.deadLetter(m); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		next := *m
+		next.Attempts++
+		next.VisibleAt = now.Add(visibility)
+		if err := writeMessage(q.dir, &next); err != nil {
+			return nil, err
+		}
+		q.pending[m.ID] = &next
+		received := next.Message
+		return &received, nil
+	}
+	return nil, nil
+}
+
+// Ack implements Queue
+func (q *DiskQueue) Ack(m *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.held(m); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(q.dir, m.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(q.pending, m.ID)
+	return nil
+}
+
+// Nack implements Queue
+func (q *DiskQueue) Nack(m *Message, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	current, err := q.held(m)
+	if err != nil {
+		return err
+	}
+	next := *current
+	next.VisibleAt = time.Now().Add(delay)
+	if err = writeMessage(q.dir, &next); err != nil {
+		return err
+	}
+	q.pending[m.ID] = &next
+	return nil
+}
+
+// DeadLetters implements Queue
+func (q *DiskQueue) DeadLetters() ([]*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dead, err := readMessages(filepath.Join(q.dir, "dead"))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, len(dead))
+	for i, m := range dead {
+		messages[i] = &m.Message
+	}
+	return messages, nil
+}
+
+// Redrive implements Queue
+func (q *DiskQueue) Redrive(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	path := filepath.Join(q.dir, "dead", id+".json")
+	m, err := readMessage(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	m.Attempts = 0
+	m.VisibleAt = time.Now()
+	if err = writeMessage(q.dir, m); err != nil {
+		return err
+	}
+	q.pending[m.ID] = m
+	return os.Remove(path)
+}
+
+// held returns the pending message if m is still the latest delivery of it and its visibility hasn't expired
+func (q *DiskQueue) held(m *Message) (*diskMessage, error) {
+	current, ok := q.pending[m.ID]
+	if !ok || current.Attempts != m.Attempts || !current.VisibleAt.After(time.Now()) {
+		return nil, ErrNotHeld
+	}
+	return current, nil
+}
+
+func (q *DiskQueue) deadLetter(m *diskMessage) error {
+	if err := writeMessage(filepath.Join(q.dir, "dead"), m); err != nil {
+		return err
+	}
+	delete(q.pending, m.ID)
+	return os.Remove(filepath.Join(q.dir, m.ID+".json"))
+}
+
+// sorted returns the pending messages oldest first
+func (q *DiskQueue) sorted() []*diskMessage {
+	messages := make([]*diskMessage, 0, len(q.pending))
+	for _, m := range q.pending {
+		messages = append(messages, m)
+	}
+	sort.Sort(byID(messages))
+	return messages
+}
+
+type byID []*diskMessage
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Less(i, j int) bool { return b[i].ID < b[j].ID }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// writeMessage writes and renames so a crash never leaves half a message behind
+func writeMessage(dir string, m *diskMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, m.ID+".json")
+	if err = ioutil.WriteFile(path+".tmp", b, filePerms); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func readMessage(path string) (*diskMessage, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &diskMessage{}
+	return m, json.Unmarshal(b, m)
+}
+
+// readMessages reads every message in dir, oldest first
+func readMessages(dir string) ([]*diskMessage, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var messages []*diskMessage
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		m, err := readMessage(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	sort.Sort(byID(messages))
+	return messages, nil
+}
@@ -0,0 +1,99 @@
+// Package queue is a small reliable work queue for handing work from a trigger to the goroutines that
+// process it. A received message stays invisible to other receivers for a visibility timeout, and comes
+// back if it isn't acknowledged in time, so work isn't lost when a worker crashes or hangs. Messages
+// received too many times are moved aside as dead letters rather than retried forever.
+//
+// DiskQueue keeps messages in a directory, ideally under /var/cache so they survive restarts, and
+// RedisQueue keeps them in Redis so replicas on different nodes can share a queue.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+const defaultPollInterval = 100 * time.Millisecond
+
+// ErrNotHeld is returned when acknowledging a message whose visibility timeout expired, since it may
+// already have been handed to another receiver
+var ErrNotHeld = errors.New("queue: message is no longer held, its visibility timeout expired")
+
+// ErrNotFound is returned when redriving a dead letter that doesn't exist
+var ErrNotFound = errors.New("queue: message not found")
+
+// Queue distributes messages between receivers
+type Queue interface {
+	// Enqueue adds a message and returns its ID
+	Enqueue(body []byte) (string, error)
+	// Receive waits for a message until ctx is done. The message is hidden from other receivers until
+	// visibility passes, by which time it must be acknowledged or it's delivered again.
+	Receive(ctx context.Context, visibility time.Duration) (*Message, error)
+	// Ack removes a received message for good
+	Ack(m *Message) error
+	// Nack returns a received message to the queue, to be delivered again after delay
+	Nack(m *Message, delay time.Duration) error
+	// DeadLetters returns the messages that were received more than the maximum number of attempts
+	DeadLetters() ([]*Message, error)
+	// Redrive moves a dead letter back onto the queue with its attempts reset
+	Redrive(id string) error
+}
+
+// Options are shared by the queue implementations
+type Options struct {
+	// MaxAttempts is how many times a message is received before it's dead lettered, 0 for no limit
+	MaxAttempts int
+	// PollInterval is how often Receive checks for messages when the queue is empty, defaults to 100ms
+	PollInterval time.Duration
+}
+
+func (o Options) pollInterval() time.Duration {
+	if o.PollInterval > 0 {
+		return o.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// Message is a received message
+type Message struct {
+	ID       string    `json:"id"`
+	Body     []byte    `json:"body"`
+	Attempts int       `json:"attempts"` // Attempts counts the times it was received, including this one
+	Enqueued time.Time `json:"enqueued"`
+}
+
+// Decode unmarshals the message body as JSON
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+// EnqueueJSON marshals v as JSON and enqueues it
+func EnqueueJSON(q Queue, v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return q.Enqueue(b)
+}
+
+// newID returns a message ID that sorts in the order messages were enqueued
+func newID(now time.Time) string {
+	return fmt.Sprintf("%020d-%s", now.UnixNano(), utils.UniqueID()[:8])
+}
+
+// poll calls receive until it returns a message or an error, sleeping between attempts until ctx is done
+func poll(ctx context.Context, interval time.Duration, receive func() (*Message, error)) (*Message, error) {
+	for {
+		m, err := receive()
+		if m != nil || err != nil {
+			return m, err
+		}
+		if err = utils.SleepCtx(ctx, utils.Jitter(interval, 0.2)); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewDiskQueue(dir, Options{MaxAttempts: 2, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := EnqueueJSON(q, "first")
+	q.Enqueue([]byte(`"second"`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// An unacknowledged message comes back once its visibility expires
+	m, err := q.Receive(ctx, 10*time.Millisecond)
+	if err != nil || m.ID != first {
+		t.Fatalf("Expected the first message but got %v, %v", m, err)
+	}
+	next, _ := q.Receive(ctx, time.Minute)
+	if err = q.Ack(next); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err = q.Ack(m); err != ErrNotHeld {
+		t.Fatalf("Expected ErrNotHeld acknowledging an expired message but got %v", err)
+	}
+
+	// Reopening reads the message back off disk, and its third delivery dead letters it
+	if q, err = NewDiskQueue(dir, Options{MaxAttempts: 2, PollInterval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	m, _ = q.Receive(ctx, time.Minute)
+	if m.Attempts != 2 {
+		t.Fatalf("Expected the second attempt but got %d", m.Attempts)
+	}
+	q.Nack(m, 0)
+	short, shortCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer shortCancel()
+	if _, err = q.Receive(short, time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("Expected no messages left but got %v", err)
+	}
+	dead, _ := q.DeadLetters()
+	if len(dead) != 1 || dead[0].ID != first {
+		t.Fatalf("Expected the first message to be dead lettered but got %v", dead)
+	}
+
+	// Redriving puts it back
+	if err = q.Redrive(first); err != nil {
+		t.Fatal(err)
+	}
+	m, _ = q.Receive(ctx, time.Minute)
+	var body string
+	if m.Decode(&body); body != "first" || m.Attempts != 1 {
+		t.Fatalf("Expected the redriven message on its first attempt but got %s, %d", body, m.Attempts)
+	}
+}
@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/redis"
+)
+
+// Receiving picks the oldest visible message, counts the attempt and hides it, or dead letters it if
+// it's been received too often. Scripts keep each step atomic between replicas.
+const redisReceiveScript = `
+local ids = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #ids == 0 then return nil end
+local id = ids[1]
+local attempts = tonumber(redis.call("hget", KEYS[3], id) or "0")
+if tonumber(ARGV[3]) > 0 and attempts >= tonumber(ARGV[3]) then
+	redis.call("zrem", KEYS[1], id)
+	redis.call("zadd", KEYS[4], ARGV[1], id)
+	return {id, "", attempts, 1}
+end
+attempts = redis.call("hincrby", KEYS[3], id, 1)
+redis.call("zadd", KEYS[1], ARGV[2], id)
+return {id, redis.call("hget", KEYS[2], id), attempts, 0}`
+
+// Acknowledging only works for the latest delivery of a message that's still hidden
+const redisAckScript = `
+if redis.call("hget", KEYS[3], ARGV[1]) ~= ARGV[2] then return 0 end
+local score = redis.call("zscore", KEYS[1], ARGV[1])
+if not score or tonumber(score) <= tonumber(ARGV[3]) then return 0 end
+if ARGV[4] == "" then
+	redis.call("zrem", KEYS[1], ARGV[1])
+	redis.call("hdel", KEYS[2], ARGV[1])
+	redis.call("hdel", KEYS[3], ARGV[1])
+else
+	redis.call("zadd", KEYS[1], ARGV[4], ARGV[1])
+end
+return 1`
+
+const redisRedriveScript = `
+if redis.call("zrem", KEYS[4], ARGV[1]) == 0 then return 0 end
+redis.call("hset", KEYS[3], ARGV[1], 0)
+redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+return 1`
+
+// RedisQueue keeps a queue in Redis, so it can be shared between processes and replicas. Message
+// bodies live in a hash, pending IDs in a sorted set scored by when they're next visible, and dead
+// letter IDs in another sorted set.
+type RedisQueue struct {
+	client *redis.Client
+	name   string
+	opts   Options
+}
+
+// NewRedisQueue returns the queue called name. All its keys share the {name} hash tag, so they live on
+// the same node of a Redis Cluster.
+func NewRedisQueue(client *redis.Client, name string, opts Options) *RedisQueue {
+	return &RedisQueue{client: client, name: name, opts: opts}
+}
+
+// keys are the pending set, bodies, attempts and dead letter set, in the order the scripts expect them
+func (q *RedisQueue) keys() []string {
+	prefix := "queue:{" + q.name + "}:"
+	return []string{prefix + "pending", prefix + "bodies", prefix + "attempts", prefix + "dead"}
+}
+
+// Enqueue implements Queue
+func (q *RedisQueue) Enqueue(body []byte) (string, error) {
+	now := time.Now()
+	id := newID(now)
+	keys := q.keys()
+	if _, err := q.client.Do("HSET", keys[1], id, string(body)); err != nil {
+		return "", err
+	}
+	if _, err := q.client.Do("ZADD", keys[0], millis(now), id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Receive implements Queue
+func (q *RedisQueue) Receive(ctx context.Context, visibility time.Duration) (*Message, error) {
+	return poll(ctx, q.opts.pollInterval(), func() (*Message, error) {
+		for {
+			now := time.Now()
+			reply, err := q.client.Eval(redisReceiveScript, q.keys(), millis(now), millis(now.Add(visibility)), strconv.Itoa(q.opts.MaxAttempts))
+			if err != nil || reply == nil {
+				return nil, err
+			}
+			fields, _ := reply.([]interface{})
+			if len(fields) != 4 {
+				return nil, redis.Error("Unexpected reply to queue receive")
+			}
+			if dead, _ := fields[3].(int64); dead == 1 {
+				continue // it was dead lettered, look for the next one
+			}
+			m := &Message{}
+			m.ID, _ = fields[0].(string)
+			body, _ := fields[1].(string)
+			m.Body = []byte(body)
+			attempts, _ := fields[2].(int64)
+			m.Attempts = int(attempts)
+			m.Enqueued = enqueuedAt(m.ID)
+			return m, nil
+		}
+	})
+}
+
+// Ack implements Queue
+func (q *RedisQueue) Ack(m *Message) error {
+	return q.settle(m, "")
+}
+
+// Nack implements Queue
+func (q *RedisQueue) Nack(m *Message, delay time.Duration) error {
+	return q.settle(m, millis(time.Now().Add(delay)))
+}
+
+func (q *RedisQueue) settle(m *Message, visibleAt string) error {
+	reply, err := q.client.Eval(redisAckScript, q.keys(), m.ID, strconv.Itoa(m.Attempts), millis(time.Now()), visibleAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// DeadLetters implements Queue
+func (q *RedisQueue) DeadLetters() ([]*Message, error) {
+	keys := q.keys()
+	reply, err := q.client.Do("ZRANGE", keys[3], "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := reply.([]interface{})
+	var messages []*Message
+	for _, id := range ids {
+		m := &Message{}
+		m.ID, _ = id.(string)
+		m.Enqueued = enqueuedAt(m.ID)
+		body, err := q.client.Do("HGET", keys[1], m.ID)
+		if err != nil {
+			return nil, err
+		}
+		b, _ := body.(string)
+		m.Body = []byte(b)
+		attempts, err := q.client.Do("HGET", keys[2], m.ID)
+		if err != nil {
+			return nil, err
+		}
+		s, _ := attempts.(string)
+		m.Attempts, _ = strconv.Atoi(s)
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// Redrive implements Queue
+func (q *RedisQueue) Redrive(id string) error {
+	reply, err := q.client.Eval(redisRedriveScript, q.keys(), id, millis(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// enqueuedAt recovers the enqueue time from the start of a message ID
+func enqueuedAt(id string) time.Time {
+	if len(id) < 20 {
+		return time.Time{}
+	}
+	nanos, err := strconv.ParseInt(id[:20], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,303 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/redis"
+)
+
+// redisStub keeps hashes and sorted sets in memory, running the queue's scripts as the Go they stand for
+type redisStub struct {
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+	zsets  map[string]map[string]int64
+}
+
+func newRedisStub() *redisStub {
+	return &redisStub{hashes: map[string]map[string]string{}, zsets: map[string]map[string]int64{}}
+}
+
+func (s *redisStub) serve(l net.Listener) {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(nc net.Conn) {
+			defer nc.Close()
+			r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+			for {
+				args, err := readStubCommand(r)
+				if err != nil {
+					return
+				}
+				s.mu.Lock()
+				writeStubReply(w, s.reply(args))
+				s.mu.Unlock()
+				w.Flush()
+			}
+		}(nc)
+	}
+}
+
+// readStubCommand reads a command sent as an array of bulk strings
+func readStubCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeStubReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeStubReply(w, item)
+		}
+	}
+}
+
+func (s *redisStub) hash(key string) map[string]string {
+	if s.hashes[key] == nil {
+		s.hashes[key] = map[string]string{}
+	}
+	return s.hashes[key]
+}
+
+func (s *redisStub) zset(key string) map[string]int64 {
+	if s.zsets[key] == nil {
+		s.zsets[key] = map[string]int64{}
+	}
+	return s.zsets[key]
+}
+
+// members returns a sorted set's members in score order
+func (s *redisStub) members(key string) []string {
+	set := s.zset(key)
+	var ids []string
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Sort(byScore{ids, set})
+	return ids
+}
+
+type byScore struct {
+	ids    []string
+	scores map[string]int64
+}
+
+func (b byScore) Len() int      { return len(b.ids) }
+func (b byScore) Swap(i, j int) { b.ids[i], b.ids[j] = b.ids[j], b.ids[i] }
+func (b byScore) Less(i, j int) bool {
+	si, sj := b.scores[b.ids[i]], b.scores[b.ids[j]]
+	return si < sj || si == sj && b.ids[i] < b.ids[j]
+}
+
+func (s *redisStub) reply(args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "HSET":
+		s.hash(args[1])[args[2]] = args[3]
+		return 1
+	case "HGET":
+		if v, ok := s.hash(args[1])[args[2]]; ok {
+			return v
+		}
+		return nil
+	case "ZADD":
+		s.zset(args[1])[args[3]] = atoi(args[2])
+		return 1
+	case "ZRANGE":
+		var ids []interface{}
+		for _, id := range s.members(args[1]) {
+			ids = append(ids, id)
+		}
+		return ids
+	case "EVAL":
+		keys := args[3 : 3+int(atoi(args[2]))]
+		return s.eval(args[1], keys, args[3+len(keys):])
+	}
+	return fmt.Errorf("ERR unknown command")
+}
+
+func (s *redisStub) eval(script string, keys, argv []string) interface{} {
+	pending, bodies, attempts, dead := s.zset(keys[0]), s.hash(keys[1]), s.hash(keys[2]), s.zset(keys[3])
+	switch script {
+	case redisReceiveScript:
+		ids := s.members(keys[0])
+		if len(ids) == 0 || pending[ids[0]] > atoi(argv[0]) {
+			return nil
+		}
+		id := ids[0]
+		n := atoi(attempts[id])
+		if max := atoi(argv[2]); max > 0 && n >= max {
+			delete(pending, id)
+			dead[id] = atoi(argv[0])
+			return []interface{}{id, "", int(n), 1}
+		}
+		attempts[id] = strconv.FormatInt(n+1, 10)
+		pending[id] = atoi(argv[1])
+		return []interface{}{id, bodies[id], int(n + 1), 0}
+	case redisAckScript:
+		id := argv[0]
+		score, ok := pending[id]
+		if attempts[id] != argv[1] || !ok || score <= atoi(argv[2]) {
+			return 0
+		}
+		if argv[3] == "" {
+			delete(pending, id)
+			delete(bodies, id)
+			delete(attempts, id)
+		} else {
+			pending[id] = atoi(argv[3])
+		}
+		return 1
+	case redisRedriveScript:
+		id := argv[0]
+		if _, ok := dead[id]; !ok {
+			return 0
+		}
+		delete(dead, id)
+		attempts[id] = "0"
+		pending[id] = atoi(argv[1])
+		return 1
+	}
+	return fmt.Errorf("NOSCRIPT unknown script")
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func testRedisQueue(t *testing.T, opts Options) (*RedisQueue, *redisStub, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := newRedisStub()
+	go stub.serve(l)
+	client, err := redis.New(redis.Options{Addr: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRedisQueue(client, "alerts", opts), stub, func() {
+		client.Close()
+		l.Close()
+	}
+}
+
+func TestRedisQueue(t *testing.T) {
+	q, _, done := testRedisQueue(t, Options{MaxAttempts: 2, PollInterval: time.Millisecond})
+	defer done()
+	first, _ := EnqueueJSON(q, "first")
+	time.Sleep(2 * time.Millisecond) // scores are in milliseconds
+	q.Enqueue([]byte(`"second"`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// An unacknowledged message comes back once its visibility expires
+	m, err := q.Receive(ctx, 10*time.Millisecond)
+	if err != nil || m.ID != first || m.Attempts != 1 {
+		t.Fatalf("Expected the first message on its first attempt but got %v, %v", m, err)
+	}
+	if m.Enqueued.IsZero() || time.Since(m.Enqueued) > time.Second {
+		t.Fatalf("Expected the enqueue time to be recovered from the ID, got %v", m.Enqueued)
+	}
+	next, _ := q.Receive(ctx, time.Minute)
+	var body string
+	if next.Decode(&body); body != "second" {
+		t.Fatalf("Expected the second message but got %s", body)
+	}
+	if err = q.Ack(next); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err = q.Ack(m); err != ErrNotHeld {
+		t.Fatalf("Expected ErrNotHeld acknowledging an expired message but got %v", err)
+	}
+
+	// Its third delivery dead letters it
+	m, _ = q.Receive(ctx, time.Minute)
+	if m.ID != first || m.Attempts != 2 {
+		t.Fatalf("Expected the second attempt at the first message but got %v", m)
+	}
+	if err = q.Nack(m, 0); err != nil {
+		t.Fatal(err)
+	}
+	short, shortCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer shortCancel()
+	if _, err = q.Receive(short, time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("Expected no messages left but got %v", err)
+	}
+	dead, err := q.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].ID != first || dead[0].Attempts != 2 || string(dead[0].Body) != `"first"` {
+		t.Fatalf("Expected the first message to be dead lettered but got %v, %v", dead, err)
+	}
+
+	// Redriving puts it back
+	if err = q.Redrive(first); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Redrive(first); err != ErrNotFound {
+		t.Fatalf("Expected redriving a message that isn't dead lettered to fail, got %v", err)
+	}
+	m, _ = q.Receive(ctx, time.Minute)
+	if m.Decode(&body); body != "first" || m.Attempts != 1 {
+		t.Fatalf("Expected the redriven message on its first attempt but got %s, %d", body, m.Attempts)
+	}
+}
+
+func TestRedisQueueKeysShareAHashTag(t *testing.T) {
+	q, stub, done := testRedisQueue(t, Options{})
+	defer done()
+	q.Enqueue([]byte("{}"))
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	for key := range stub.hashes {
+		if !strings.HasPrefix(key, "queue:{alerts}:") {
+			t.Errorf("Expected %s to share the queue's hash tag", key)
+		}
+	}
+	for key := range stub.zsets {
+		if !strings.HasPrefix(key, "queue:{alerts}:") {
+			t.Errorf("Expected %s to share the queue's hash tag", key)
+		}
+	}
+	if redis.Slot("queue:{alerts}:pending") != redis.Slot("queue:{alerts}:dead") {
+		t.Fatal("Expected the queue's keys to hash to the same slot")
+	}
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/komand/plugin-sdk-go/plugin/deadletter"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+)
+
+// Replay re-executes a recorded message through the normal runtime path with the current code, to
+// recover once a plugin bug is fixed. source is a file holding a start message, a trigger event or a
+// dead letter, or the ID of a dead letter in the store. Start messages run as if they came in on
+// stdin. Trigger events are sent to the dispatcher recorded with a dead letter, or else to dispatcher,
+// or else the default trigger dispatcher. Unlike Redrive, a dead letter is kept either way.
+func (p *Plugin) Replay(source string, dispatcher string) error {
+	var override json.RawMessage
+	if dispatcher != "" {
+		override, _ = json.Marshal(&HTTPDispatcher{URL: dispatcher})
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if os.IsNotExist(err) {
+		e, err := p.DeadLetters().Get(source)
+		if err == deadletter.ErrNotFound {
+			return fmt.Errorf("%s is neither a file nor a dead letter", source)
+		}
+		if err != nil {
+			return err
+		}
+		return p.replay(e.Message, firstRaw(e.Dispatcher, override))
+	}
+	if err != nil {
+		return err
+	}
+
+	// A dead letter has its message wrapped up with why it failed
+	var e deadletter.Entry
+	if json.Unmarshal(data, &e) == nil && e.Kind != "" && len(e.Message) > 0 {
+		return p.replay(e.Message, firstRaw(e.Dispatcher, override))
+	}
+	return p.replay(data, override)
+}
+
+// replay runs a start message, or sends a trigger event to dispatcher
+func (p *Plugin) replay(data []byte, dispatcher json.RawMessage) error {
+	var raw struct {
+		message.Header
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("Unable to deserialize message: %s", err)
+	}
+
+	switch raw.Type {
+	case ActionStart, TriggerStart:
+		start, err := openConnection(data)
+		if err != nil {
+			return err
+		}
+		stdin := parameter.Stdin
+		defer func() { parameter.Stdin = stdin }()
+		parameter.Stdin = parameter.NewParamSet(bytes.NewReader(start))
+
+		t, err := p.setup()
+		if err != nil {
+			return err
+		}
+		a, ok := t.(*actionTask)
+		if !ok {
+			return t.Run()
+		}
+		a.replay = true
+		if err = a.Run(); err != nil {
+			return err
+		}
+		return a.failure
+	case "trigger_event":
+		var d Dispatcher = triggerDispatcher()
+		if len(dispatcher) > 0 {
+			h := &HTTPDispatcher{}
+			if err := json.Unmarshal(dispatcher, h); err != nil {
+				return fmt.Errorf("Unable to parse dispatcher config: %s", err)
+			}
+			d = h
+		}
+		if h, ok := d.(*HTTPDispatcher); ok && h.URL == "" {
+			return errors.New("No dispatcher to send the trigger event to, provide one or use --debug to print it")
+		}
+		return d.Send(&message.Message{Header: raw.Header, Body: message.Body{RawMessage: raw.Body}})
+	default:
+		return fmt.Errorf("Unexpected message type: %s", raw.Type)
+	}
+}
+
+// firstRaw returns the first non empty message
+func firstRaw(raws ...json.RawMessage) json.RawMessage {
+	for _, raw := range raws {
+		if len(raw) > 0 {
+			return raw
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package report builds human readable reports for notification and reporting actions. A report is
+// assembled with a fluent builder and rendered to either Markdown or HTML. Both renderers escape every
+// piece of content, so values pulled from vendor APIs can't inject markup, links or table cells into an
+// email or ticket.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/komand/plugin-sdk-go/plugin/types"
+)
+
+type blockKind int
+
+const (
+	headingBlock blockKind = iota
+	paragraphBlock
+	listBlock
+	keyValueBlock
+	tableBlock
+	codeBlock
+)
+
+type block struct {
+	kind     blockKind
+	level    int      // heading level
+	text     string   // heading, paragraph or code contents
+	language string   // code language hint
+	items    []string // list items
+	keys     []string // key value pairs, in the order they were added
+	values   []string
+	table    *types.Table
+}
+
+// Report is an ordered set of blocks, built up by the fluent methods below
+type Report struct {
+	blocks []*block
+}
+
+// New starts a report with a top level title. An empty title is left out.
+func New(title string) *Report {
+	r := &Report{}
+	if title != "" {
+		r.blocks = append(r.blocks, &block{kind: headingBlock, level: 1, text: title})
+	}
+	return r
+}
+
+// Section starts a new section with the given heading
+func (r *Report) Section(title string) *Report {
+	r.blocks = append(r.blocks, &block{kind: headingBlock, level: 2, text: title})
+	return r
+}
+
+// Subsection starts a new subsection with the given heading
+func (r *Report) Subsection(title string) *Report {
+	r.blocks = append(r.blocks, &block{kind: headingBlock, level: 3, text: title})
+	return r
+}
+
+// Paragraph adds a paragraph of text
+func (r *Report) Paragraph(format string, args ...interface{}) *Report {
+	r.blocks = append(r.blocks, &block{kind: paragraphBlock, text: fmt.Sprintf(format, args...)})
+	return r
+}
+
+// List adds a bulleted list
+func (r *Report) List(items ...string) *Report {
+	r.blocks = append(r.blocks, &block{kind: listBlock, items: items})
+	return r
+}
+
+// KeyValue adds a key value pair. Consecutive pairs are rendered together as a single list.
+func (r *Report) KeyValue(key string, value interface{}) *Report {
+	var kv *block
+	if n := len(r.blocks); n > 0 && r.blocks[n-1].kind == keyValueBlock {
+		kv = r.blocks[n-1]
+	} else {
+		kv = &block{kind: keyValueBlock}
+		r.blocks = append(r.blocks, kv)
+	}
+	kv.keys = append(kv.keys, key)
+	kv.values = append(kv.values, fmt.Sprint(value))
+	return r
+}
+
+// Table adds a table
+func (r *Report) Table(t *types.Table) *Report {
+	r.blocks = append(r.blocks, &block{kind: tableBlock, table: t})
+	return r
+}
+
+// Code adds a preformatted code block, language is an optional syntax hint
+func (r *Report) Code(language string, code string) *Report {
+	r.blocks = append(r.blocks, &block{kind: codeBlock, language: language, text: code})
+	return r
+}
+
+// Markdown renders the report as Markdown. Text is escaped to read as it was given: headings, list items
+// and key value pairs are kept to a line, and only paragraphs and code keep their line breaks.
+func (r *Report) Markdown() string {
+	var parts []string
+	for _, b := range r.blocks {
+		switch b.kind {
+		case headingBlock:
+			parts = append(parts, strings.Repeat("#", b.level)+" "+types.EscapeMarkdown(oneLine(b.text)))
+		case paragraphBlock:
+			parts = append(parts, types.EscapeMarkdown(b.text))
+		case listBlock:
+			lines := make([]string, len(b.items))
+			for i, item := range b.items {
+				lines[i] = "- " + types.EscapeMarkdown(oneLine(item))
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+		case keyValueBlock:
+			lines := make([]string, len(b.keys))
+			for i := range b.keys {
+				lines[i] = "- **" + types.EscapeMarkdown(oneLine(b.keys[i])) + ":** " + types.EscapeMarkdown(oneLine(b.values[i]))
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+		case tableBlock:
+			parts = append(parts, strings.TrimSuffix(b.table.Markdown(), "\n"))
+		case codeBlock:
+			fence := codeFence(b.text)
+			language := b.language
+			if strings.ContainsAny(language, "`\r\n") {
+				language = ""
+			}
+			parts = append(parts, fence+language+"\n"+strings.TrimSuffix(b.text, "\n")+"\n"+fence)
+		}
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// HTML renders the report as an HTML fragment with all content escaped
+func (r *Report) HTML() string {
+	var buf bytes.Buffer
+	for _, b := range r.blocks {
+		switch b.kind {
+		case headingBlock:
+			fmt.Fprintf(&buf, "<h%d>%s</h%d>\n", b.level, html.EscapeString(b.text), b.level)
+		case paragraphBlock:
+			fmt.Fprintf(&buf, "<p>%s</p>\n", html.EscapeString(b.text))
+		case listBlock:
+			buf.WriteString("<ul>\n")
+			for _, item := range b.items {
+				fmt.Fprintf(&buf, "<li>%s</li>\n", html.EscapeString(item))
+			}
+			buf.WriteString("</ul>\n")
+		case keyValueBlock:
+			buf.WriteString("<dl>\n")
+			for i := range b.keys {
+				fmt.Fprintf(&buf, "<dt>%s</dt><dd>%s</dd>\n", html.EscapeString(b.keys[i]), html.EscapeString(b.values[i]))
+			}
+			buf.WriteString("</dl>\n")
+		case tableBlock:
+			writeHTMLTable(&buf, b.table)
+		case codeBlock:
+			class := ""
+			if b.language != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(b.language))
+			}
+			fmt.Fprintf(&buf, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(b.text))
+		}
+	}
+	return buf.String()
+}
+
+func writeHTMLTable(buf *bytes.Buffer, t *types.Table) {
+	buf.WriteString("<table>\n<thead><tr>")
+	for _, c := range t.Columns {
+		fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(c.Name))
+	}
+	buf.WriteString("</tr></thead>\n<tbody>\n")
+	for _, row := range t.Rows {
+		buf.WriteString("<tr>")
+		for _, v := range row {
+			fmt.Fprintf(buf, "<td>%s</td>", html.EscapeString(types.FormatCell(v)))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</tbody>\n</table>\n")
+}
+
+// oneLine joins the lines of s with spaces
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(strings.Replace(s, "\r\n", "\n", -1)), " ")
+}
+
+// codeFence returns a backtick fence longer than any run of backticks inside the code
+func codeFence(code string) string {
+	longest, run := 0, 0
+	for _, ch := range code {
+		if ch == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
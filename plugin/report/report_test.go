@@ -0,0 +1,49 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/types"
+)
+
+func sample() *Report {
+	table := types.NewTable().AddColumn("host", types.StringColumn).AddColumn("note", types.StringColumn)
+	table.AddRow("web|01", "line one\nline two")
+	table.AddRow("db01", "<img src=x onerror=alert(1)>")
+	return New("Scan of *prod*").
+		Section("Findings\n# injected").
+		Paragraph("Found %d hosts, see [the docs](http://evil.example) & <b>act</b>\n# not a heading\n1. not a list", 2).
+		List("first", "- nested\nsecond line").
+		KeyValue("owner", "_ops_").
+		KeyValue("ticket", "![x](http://evil.example/pixel)").
+		Table(table).
+		Code("go\nrm", "fmt.Println(\"```\")")
+}
+
+func TestMarkdown(t *testing.T) {
+	expected := "# Scan of \\*prod\\*\n\n" +
+		"## Findings # injected\n\n" +
+		"Found 2 hosts, see \\[the docs\\](http://evil.example) \\& \\<b\\>act\\</b\\>\n\\# not a heading\n1\\. not a list\n\n" +
+		"- first\n- \\- nested second line\n\n" +
+		"- **owner:** \\_ops\\_\n- **ticket:** \\!\\[x\\](http://evil.example/pixel)\n\n" +
+		"| host | note |\n| --- | --- |\n| web\\|01 | line one<br>line two |\n| db01 | \\<img src=x onerror=alert(1)\\> |\n\n" +
+		"````\nfmt.Println(\"```\")\n````\n"
+	if md := sample().Markdown(); md != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", md, expected)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	expected := "<h1>Scan of *prod*</h1>\n" +
+		"<h2>Findings\n# injected</h2>\n" +
+		"<p>Found 2 hosts, see [the docs](http://evil.example) &amp; &lt;b&gt;act&lt;/b&gt;\n# not a heading\n1. not a list</p>\n" +
+		"<ul>\n<li>first</li>\n<li>- nested\nsecond line</li>\n</ul>\n" +
+		"<dl>\n<dt>owner</dt><dd>_ops_</dd>\n<dt>ticket</dt><dd>![x](http://evil.example/pixel)</dd>\n</dl>\n" +
+		"<table>\n<thead><tr><th>host</th><th>note</th></tr></thead>\n<tbody>\n" +
+		"<tr><td>web|01</td><td>line one\nline two</td></tr>\n" +
+		"<tr><td>db01</td><td>&lt;img src=x onerror=alert(1)&gt;</td></tr>\n</tbody>\n</table>\n" +
+		"<pre><code class=\"language-go\nrm\">fmt.Println(&#34;```&#34;)</code></pre>\n"
+	if h := sample().HTML(); h != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", h, expected)
+	}
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/secrets"
+)
+
+// rotationCooldown is how soon after rotating credentials an auth expired error is returned rather than
+// rotated again, the new credentials having fared no better
+var rotationCooldown = time.Minute
+
+// AuthExpiredError is an error caused by credentials that expired or were revoked. When a connection's
+// Connect, an action or a trigger returns one, the runtime rotates the connection's credentials and tries
+// again.
+type AuthExpiredError struct {
+	Err error
+}
+
+// Error implements error
+func (e *AuthExpiredError) Error() string {
+	return e.Err.Error()
+}
+
+// AuthExpired marks err as caused by expired credentials, ie: when an API answers 401 to a token that used
+// to work
+func AuthExpired(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &AuthExpiredError{Err: err}
+}
+
+// IsAuthExpired reports whether err was marked by AuthExpired, or has an AuthExpired method returning true
+func IsAuthExpired(err error) bool {
+	switch e := err.(type) {
+	case *AuthExpiredError:
+		return true
+	case interface {
+		AuthExpired() bool
+	}:
+		return e.AuthExpired()
+	}
+	return false
+}
+
+// Rotatable is implemented by a connection that fetches fresh credentials itself, ie: by exchanging a
+// refresh token. Connections that don't implement it have their parameters resolved again from the
+// secrets providers, which is enough when the credentials are references to secrets, see the secrets
+// package.
+type Rotatable interface {
+	RotateCredentials() error
+}
+
+// rotator rotates the credentials of a task's connection
+type rotator struct {
+	connection Connection
+	params     json.RawMessage // params are the connection parameters as received, before secrets were resolved
+	last       time.Time
+}
+
+// newRotator returns the rotator of a task's connection. It's nil when the task has no connection.
+func newRotator(task interface{}, params json.RawMessage) *rotator {
+	connectable, ok := task.(Connectable)
+	if !ok {
+		return nil
+	}
+	return &rotator{connection: connectable.Connection(), params: params}
+}
+
+// run calls fn, and again after rotating the credentials each time it fails because they expired
+func (r *rotator) run(fn func() error) error {
+	for {
+		err := fn()
+		if r == nil || !IsAuthExpired(err) || (!r.last.IsZero() && time.Since(r.last) < rotationCooldown) {
+			return err
+		}
+		log.Warnf("Credentials expired, rotating them: %s", err)
+		if rotateErr := r.rotate(); rotateErr != nil {
+			log.Errorf("Unable to rotate credentials: %s", rotateErr)
+			return err
+		}
+		r.last = time.Now()
+	}
+}
+
+// rotate fetches fresh credentials and connects with them
+func (r *rotator) rotate() error {
+	if rotatable, ok := r.connection.(Rotatable); ok {
+		if err := rotatable.RotateCredentials(); err != nil {
+			return err
+		}
+	} else {
+		secrets.Invalidate()
+		resolved, err := secrets.ResolveJSON(r.params)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(resolved, r.connection); err != nil {
+			return fmt.Errorf("Unable to parse connection config: %s", err)
+		}
+		if err := clean(r.connection.Validate()); err != nil {
+			return fmt.Errorf("Connection validation failed: %s", joinErrors(err))
+		}
+	}
+	return r.connection.Connect()
+}
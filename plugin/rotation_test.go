@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// RotatedAction uses a token that's rotated while it runs
+type RotatedAction struct {
+	Action
+	connection HelloConnection
+	acts       int
+}
+
+func (r *RotatedAction) Name() string           { return "rotated_action" }
+func (r *RotatedAction) Description() string    { return "uses a token" }
+func (r *RotatedAction) Connection() Connection { return &r.connection }
+
+func (r *RotatedAction) Act() error {
+	r.acts++
+	if r.connection.Thing != "new-token" {
+		// the token is rotated in the secret store, after this one was resolved
+		os.Setenv("ROTATION_TEST_TOKEN", "new-token")
+		return AuthExpired(errors.New("401 Unauthorized"))
+	}
+	return nil
+}
+
+func TestAuthExpiredActionIsRetriedWithRotatedCredentials(t *testing.T) {
+	os.Setenv("ROTATION_TEST_TOKEN", "old-token")
+	defer os.Unsetenv("ROTATION_TEST_TOKEN")
+
+	action := &RotatedAction{}
+	dispatcher := &capturingDispatcher{}
+	start := &message.ActionStart{Action: action.Name()}
+	start.Connection.RawMessage = json.RawMessage(`{"thing": "env://ROTATION_TEST_TOKEN"}`)
+	task := &actionTask{message: start, action: action, dispatcher: dispatcher}
+	if err := task.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if action.acts != 2 || action.connection.Thing != "new-token" || !action.connection.connected {
+		t.Errorf("Expected the action to run again with the rotated token, got %d runs with %+v", action.acts, action.connection)
+	}
+	if task.failure != nil {
+		t.Errorf("Expected the action to succeed, got %s", task.failure)
+	}
+}
+
+func TestAuthExpiredIsNotRotatedInALoop(t *testing.T) {
+	calls := 0
+	r := &rotator{connection: &HelloConnection{}, params: json.RawMessage(`{"thing": "static"}`)}
+	err := r.run(func() error {
+		calls++
+		return AuthExpired(errors.New("401 Unauthorized"))
+	})
+	if !IsAuthExpired(err) || calls != 2 {
+		t.Errorf("Expected one retry before giving up, got %d calls and %v", calls, err)
+	}
+}
@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// DefaultSamplingReportInterval is how often sampled out events are reported, if the Sampling doesn't say
+const DefaultSamplingReportInterval = time.Minute
+
+// Sampling caps the events triggers dispatch, for customers ingesting from extremely chatty sources, without
+// changing the plugin. It's applied to events after they're filtered and transformed, just before they're
+// dispatched. Events delivered from an outbox aren't sampled, they were committed to be delivered, and nor
+// are high priority ones, see Trigger.SendPriority.
+type Sampling struct {
+	// Rate is the probability each event is dispatched, decided as it's sent, ie: 0.1 dispatches one event
+	// in ten. 0 dispatches them all.
+	Rate float64
+	// MaxPerSecond caps the events dispatched each second, those over it are sampled out. 0 is no cap.
+	MaxPerSecond float64
+	// ReportInterval is how often the number of events sampled out is logged, DefaultSamplingReportInterval
+	// if 0. The total is also in the trigger's Metrics.
+	ReportInterval time.Duration
+}
+
+// sampler is set by SetSampling, or the PLUGIN_SAMPLE_RATE and PLUGIN_SAMPLE_MAX_PER_SECOND environment
+// variables
+var sampler *eventSampler
+
+// eventsSampledOut counts the events the sampler dropped, reported is what the last report covered
+var eventsSampledOut, sampledOutReported int64
+
+type eventSampler struct {
+	Sampling
+
+	mu     sync.Mutex
+	tokens float64   // tokens are the events that can still be dispatched under MaxPerSecond
+	last   time.Time // last is when tokens were last topped up
+}
+
+// SetSampling samples the events triggers dispatch, see Sampling. nil turns sampling off.
+func (p Plugin) SetSampling(s *Sampling) error {
+	if s == nil {
+		sampler = nil
+		return nil
+	}
+	if s.Rate < 0 || s.Rate > 1 {
+		return fmt.Errorf("Sampling rate must be between 0 and 1, got %g", s.Rate)
+	}
+	if s.MaxPerSecond < 0 {
+		return fmt.Errorf("Sampling cap can't be negative, got %g", s.MaxPerSecond)
+	}
+	sampler = &eventSampler{Sampling: *s, tokens: s.burst(), last: time.Now()}
+	return nil
+}
+
+// samplingFromEnv turns sampling on if the environment asks for it
+func samplingFromEnv() {
+	rate, max := os.Getenv("PLUGIN_SAMPLE_RATE"), os.Getenv("PLUGIN_SAMPLE_MAX_PER_SECOND")
+	if rate == "" && max == "" {
+		return
+	}
+	var s Sampling
+	var err error
+	if rate != "" {
+		s.Rate, err = strconv.ParseFloat(rate, 64)
+	}
+	if err == nil && max != "" {
+		s.MaxPerSecond, err = strconv.ParseFloat(max, 64)
+	}
+	if err == nil {
+		err = Plugin{}.SetSampling(&s)
+	}
+	if err != nil {
+		log.Warnf("Ignoring invalid sampling configuration: %s", err)
+	}
+}
+
+// burst is how many events can be dispatched at once under MaxPerSecond
+func (s Sampling) burst() float64 {
+	if s.MaxPerSecond < 1 {
+		return 1
+	}
+	return s.MaxPerSecond
+}
+
+// keep returns whether the next event should be dispatched, counting it if it's sampled out
+func (s *eventSampler) keep() bool {
+	if s.Rate > 0 && s.Rate < 1 && utils.Rand().Float64() >= s.Rate {
+		atomic.AddInt64(&eventsSampledOut, 1)
+		return false
+	}
+	if s.MaxPerSecond <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.MaxPerSecond
+	if burst := s.burst(); s.tokens > burst {
+		s.tokens = burst
+	}
+	s.last = now
+	if s.tokens < 1 {
+		atomic.AddInt64(&eventsSampledOut, 1)
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// reportSampling logs the events the sampler dropped every report interval, until the returned function is
+// called
+func reportSampling(trigger string) (stop func()) {
+	s := sampler
+	if s == nil {
+		return func() {}
+	}
+	interval := s.ReportInterval
+	if interval <= 0 {
+		interval = DefaultSamplingReportInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for range utils.NewTicker(ctx, interval).C {
+			total := atomic.LoadInt64(&eventsSampledOut)
+			if n := total - atomic.SwapInt64(&sampledOutReported, total); n > 0 {
+				log.Infof("Sampled out %d events of trigger %s in the last %s, %d in all", n, trigger, interval, total)
+			}
+		}
+	}()
+	return cancel
+}
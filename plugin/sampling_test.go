@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+func TestSamplingCapsEvents(t *testing.T) {
+	if err := (Plugin{}).SetSampling(&Sampling{MaxPerSecond: 5}); err != nil {
+		t.Fatal(err)
+	}
+	defer Plugin{}.SetSampling(nil)
+	before := atomic.LoadInt64(&eventsSampledOut)
+	kept := 0
+	for i := 0; i < 100; i++ {
+		if sampler.keep() {
+			kept++
+		}
+	}
+	// a burst of a second's worth gets through, give or take what was topped up meanwhile
+	if kept < 5 || kept > 6 {
+		t.Fatalf("Expected about 5 events kept, got %d", kept)
+	}
+	if n := atomic.LoadInt64(&eventsSampledOut) - before; n != int64(100-kept) {
+		t.Fatalf("Expected %d events counted as sampled out, got %d", 100-kept, n)
+	}
+}
+
+func TestSamplingRate(t *testing.T) {
+	defer utils.SetRandSource(utils.SetRandSource(rand.NewSource(1)))
+	if err := (Plugin{}).SetSampling(&Sampling{Rate: 0.1}); err != nil {
+		t.Fatal(err)
+	}
+	defer Plugin{}.SetSampling(nil)
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		if sampler.keep() {
+			kept++
+		}
+	}
+	if kept < 900 || kept > 1100 {
+		t.Fatalf("Expected about 1000 of 10000 events kept, got %d", kept)
+	}
+	if err := (Plugin{}).SetSampling(&Sampling{Rate: 2}); err == nil {
+		t.Fatal("Expected a rate over 1 to be refused")
+	}
+}
@@ -0,0 +1,373 @@
+// Package schema validates JSON against JSON Schemas, compiling each schema once. Compiled schemas are kept
+// by the hash of their source, so a plugin handling hundreds of requests a minute in HTTP mode compiles an
+// action's input schema once, not for every request.
+//
+// Schemas registered with Register, ie: the schemas embedded in a plugin, are compiled straight away, so a
+// broken schema fails when the plugin starts rather than on its first request. Setting PLUGIN_SCHEMA_LAZY
+// defers compiling them until they're first used, for plugins with many schemas that start often.
+//
+// The keywords understood are type, properties, required, additionalProperties, items, enum, minimum,
+// maximum, minLength, maxLength, pattern, minItems and maxItems. Others are ignored, bar deprecated, which
+// doesn't fail validation but is reported by Schema.Deprecated, and format, which isn't checked but marks
+// secrets with "password", see Schema.Secret.
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// Lazy defers compiling registered schemas until they're first used. It's set by PLUGIN_SCHEMA_LAZY.
+var Lazy = os.Getenv("PLUGIN_SCHEMA_LAZY") != ""
+
+var (
+	compiledMu sync.Mutex
+	compiled   = map[[sha256.Size]byte]*Schema{}
+
+	registeredMu sync.Mutex
+	registered   = map[string]json.RawMessage{}
+)
+
+// Schema is a compiled schema
+type Schema struct {
+	types                []string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *bool
+	items                *Schema
+	enum                 []interface{}
+	minimum, maximum     *float64
+	minLength, maxLength *int
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+	deprecated           bool
+	format               string
+}
+
+// source is a schema as it's written
+type source struct {
+	Type                 interface{}                `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties *bool                      `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []interface{}              `json:"enum"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              string                     `json:"pattern"`
+	Deprecated           bool                       `json:"deprecated"`
+	Format               string                     `json:"format"`
+}
+
+// Compile compiles a schema, or returns the one compiled earlier from the same source
+func Compile(raw json.RawMessage) (*Schema, error) {
+	sum := sha256.Sum256(raw)
+	compiledMu.Lock()
+	s, ok := compiled[sum]
+	compiledMu.Unlock()
+	if ok {
+		return s, nil
+	}
+	s, err := compile(raw)
+	if err != nil {
+		return nil, err
+	}
+	compiledMu.Lock()
+	compiled[sum] = s
+	compiledMu.Unlock()
+	return s, nil
+}
+
+// Register names a schema, compiling it unless Lazy is set
+func Register(name string, raw json.RawMessage) error {
+	if !Lazy {
+		if _, err := Compile(raw); err != nil {
+			return fmt.Errorf("Invalid schema %s: %s", name, err)
+		}
+	}
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered[name] = raw
+	return nil
+}
+
+// MustRegister is Register, panicking if the schema doesn't compile, for schemas registered in a var or init
+func MustRegister(name string, raw json.RawMessage) {
+	if err := Register(name, raw); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the registered schema, compiling it if it wasn't yet
+func Get(name string) (*Schema, error) {
+	registeredMu.Lock()
+	raw, ok := registered[name]
+	registeredMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No schema named %s", name)
+	}
+	return Compile(raw)
+}
+
+func compile(raw json.RawMessage) (*Schema, error) {
+	var src source
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return nil, err
+	}
+	s := &Schema{
+		required:             src.Required,
+		additionalProperties: src.AdditionalProperties,
+		enum:                 src.Enum,
+		minimum:              src.Minimum,
+		maximum:              src.Maximum,
+		minLength:            src.MinLength,
+		maxLength:            src.MaxLength,
+		minItems:             src.MinItems,
+		maxItems:             src.MaxItems,
+		deprecated:           src.Deprecated,
+		format:               src.Format,
+	}
+	switch t := src.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid type %v", item)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid type %v", t)
+	}
+	if src.Pattern != "" {
+		var err error
+		if s.pattern, err = regexp.Compile(src.Pattern); err != nil {
+			return nil, fmt.Errorf("Invalid pattern: %s", err)
+		}
+	}
+	if len(src.Properties) > 0 {
+		s.properties = map[string]*Schema{}
+		for name, prop := range src.Properties {
+			compiled, err := compile(prop)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			s.properties[name] = compiled
+		}
+	}
+	if len(src.Items) > 0 {
+		items, err := compile(src.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %s", err)
+		}
+		s.items = items
+	}
+	return s, nil
+}
+
+// Validate validates the JSON in data, returning an error for each way it doesn't match the schema
+func (s *Schema) Validate(data []byte) []error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []error{err}
+	}
+	return s.validate("", v, nil)
+}
+
+func (s *Schema) validate(path string, v interface{}, errs []error) []error {
+	fail := func(format string, args ...interface{}) {
+		at := path
+		if at == "" {
+			at = "input"
+		}
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{at}, args...)...))
+	}
+	if len(s.types) > 0 && !s.hasType(v) {
+		fail("expected %s, got %s", joinTypes(s.types), typeOf(v))
+		return errs
+	}
+	if len(s.enum) > 0 && !s.inEnum(v) {
+		fail("%v isn't one of the allowed values", v)
+	}
+	switch v := v.(type) {
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("%v is less than the minimum of %v", v, *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("%v is more than the maximum of %v", v, *s.maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("shorter than %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("longer than %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("doesn't match %s", s.pattern)
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("fewer than %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("more than %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				errs = s.items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("%s is required", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.properties[name]
+			if !ok {
+				if s.additionalProperties != nil && !*s.additionalProperties {
+					fail("unexpected property %s", name)
+				}
+				continue
+			}
+			errs = prop.validate(join(path, name), v[name], errs)
+		}
+	}
+	return errs
+}
+
+// Deprecated returns the paths of the values in data the schema marks deprecated, ie: "options.legacy"
+// for a deprecated property options has. The paths are named as in Validate's errors.
+func (s *Schema) Deprecated(data []byte) ([]string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return s.deprecatedIn("", v, nil), nil
+}
+
+func (s *Schema) deprecatedIn(path string, v interface{}, paths []string) []string {
+	if s.deprecated && path != "" {
+		paths = append(paths, path)
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if s.items != nil {
+			for i, item := range v {
+				paths = s.items.deprecatedIn(fmt.Sprintf("%s[%d]", path, i), item, paths)
+			}
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.properties[name]; ok {
+				paths = prop.deprecatedIn(join(path, name), v[name], paths)
+			}
+		}
+	}
+	return paths
+}
+
+// Property returns the schema of the named property, or nil if it has none. It may be called on nil, so
+// a value can be walked along with its schema whether or not every part of it has one.
+func (s *Schema) Property(name string) *Schema {
+	if s == nil {
+		return nil
+	}
+	return s.properties[name]
+}
+
+// Items returns the schema of the items of an array, or nil if it has none
+func (s *Schema) Items() *Schema {
+	if s == nil {
+		return nil
+	}
+	return s.items
+}
+
+// Secret returns whether the schema is of a secret, ie: its format is password
+func (s *Schema) Secret() bool {
+	return s != nil && s.format == "password"
+}
+
+func (s *Schema) hasType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(v interface{}) bool {
+	b, _ := json.Marshal(v)
+	for _, allowed := range s.enum {
+		if a, _ := json.Marshal(allowed); string(a) == string(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names the JSON type of v, telling integers apart from other numbers
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func joinTypes(types []string) string {
+	s := types[0]
+	for _, t := range types[1:] {
+		s += " or " + t
+	}
+	return s
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var person = json.RawMessage(`{
+	"type": "object",
+	"required": ["name"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+	}
+}`)
+
+func TestValidate(t *testing.T) {
+	s, err := Compile(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := s.Validate([]byte(`{"name": "Bob", "age": 30, "role": "admin", "tags": ["a"]}`)); len(errs) != 0 {
+		t.Fatalf("Expected a valid person, got %v", errs)
+	}
+	errs := s.Validate([]byte(`{"age": 1.5, "role": "root", "tags": ["a", 2, "c"], "extra": true}`))
+	expected := []string{
+		"input: name is required",
+		"age: expected integer, got number",
+		"input: unexpected property extra",
+		"role: root isn't one of the allowed values",
+		"tags: more than 2 items",
+		"tags[1]: expected string, got integer",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], err)
+		}
+	}
+}
+
+func TestCompileIsCachedByHash(t *testing.T) {
+	a, err := Compile(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Compile(append(json.RawMessage{}, person...))
+	if a != b {
+		t.Error("Expected the same source to compile once")
+	}
+	if _, err = Compile(json.RawMessage(`{"type": "string", "pattern": "("}`)); err == nil {
+		t.Error("Expected an invalid pattern to fail to compile")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() { Lazy = false }()
+	broken := json.RawMessage(`{"properties": {"a": {"type": 1}}}`)
+	if err := Register("broken", broken); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("Expected a broken schema to fail registering, got %v", err)
+	}
+	Lazy = true
+	if err := Register("broken", broken); err != nil {
+		t.Fatalf("Expected a lazy registration not to compile, got %s", err)
+	}
+	if _, err := Get("broken"); err == nil {
+		t.Error("Expected the broken schema to fail when first used")
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	s, err := Compile(json.RawMessage(`{
+		"properties": {
+			"host": {"type": "string", "deprecated": true},
+			"hosts": {"type": "array", "items": {"properties": {"port": {"deprecated": true}}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := s.Deprecated([]byte(`{"host": "a", "hosts": [{"name": "b"}, {"port": 80}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(paths, ",") != "host,hosts[1].port" {
+		t.Fatalf("Expected the deprecated values used, got %v", paths)
+	}
+	if errs := s.Validate([]byte(`{"host": "a"}`)); len(errs) != 0 {
+		t.Fatalf("Expected deprecated values to be valid, got %v", errs)
+	}
+}
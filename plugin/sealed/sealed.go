@@ -0,0 +1,357 @@
+// Package sealed encrypts sensitive event payloads with AES-256-GCM, for plugins whose events pass through
+// intermediaries that shouldn't see them. A payload is sealed whole, or field by field, into envelopes that
+// only the holder of the key can open:
+//
+//	{"username": "bob", "password": {"$sealed": {"v": 1, "alg": "A256GCM", "kid": "...", "nonce": "...", "data": "..."}}}
+//
+// Keys come from a Keys provider: EnvKeys reads a key from the environment, and KMS wraps a data key with a
+// key management service, so only the wrapped key ever travels with the payload.
+package sealed
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Algorithm is the only algorithm envelopes are sealed with
+const Algorithm = "A256GCM"
+
+// Environment variables read by EnvKeys
+const (
+	KeyEnv   = "PLUGIN_ENCRYPTION_KEY"    // KeyEnv holds the 32 byte key, base64 encoded
+	KeyIDEnv = "PLUGIN_ENCRYPTION_KEY_ID" // KeyIDEnv optionally names the key, defaulting to a digest of it
+)
+
+// envelopeField is the key a sealed value is wrapped in, so it can be told apart from a plain object
+const envelopeField = "$sealed"
+
+// ErrNoKey is returned by EnvKeys and EnvKeysFrom when no key is configured
+var ErrNoKey = errors.New("No encryption key configured")
+
+// Keys provides the keys payloads are sealed and opened with
+type Keys interface {
+	// Current returns the key to seal with, and its ID
+	Current() (id string, key []byte, err error)
+	// Key returns the key with the given ID, to open an envelope sealed with it
+	Key(id string) ([]byte, error)
+}
+
+// Envelope is a sealed value
+type Envelope struct {
+	Version int    `json:"v"`
+	Alg     string `json:"alg"`
+	KeyID   string `json:"kid"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Seal marshals v to JSON and seals it with the current key
+func Seal(keys Keys, v interface{}) (*Envelope, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	id, key, err := keys.Current()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{Version: 1, Alg: Algorithm, KeyID: id, Nonce: make([]byte, gcm.NonceSize())}
+	if _, err = crand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Data = gcm.Seal(nil, e.Nonce, b, e.additionalData())
+	return e, nil
+}
+
+// Open returns the JSON sealed in the envelope
+func Open(keys Keys, e *Envelope) (json.RawMessage, error) {
+	if e.Version != 1 || e.Alg != Algorithm {
+		return nil, fmt.Errorf("Unsupported envelope version %d with algorithm %q", e.Version, e.Alg)
+	}
+	key, err := keys.Key(e.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("Invalid envelope nonce")
+	}
+	b, err := gcm.Open(nil, e.Nonce, e.Data, e.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open envelope sealed with key %s: %s", e.KeyID, err)
+	}
+	return json.RawMessage(b), nil
+}
+
+// MarshalJSON wraps the envelope so it's recognised as one
+func (e *Envelope) MarshalJSON() ([]byte, error) {
+	type envelope Envelope
+	return json.Marshal(map[string]*envelope{envelopeField: (*envelope)(e)})
+}
+
+// UnmarshalJSON unwraps an envelope marshaled by MarshalJSON
+func (e *Envelope) UnmarshalJSON(b []byte) error {
+	type envelope Envelope
+	var wrapper map[string]*envelope
+	if err := json.Unmarshal(b, &wrapper); err != nil {
+		return err
+	}
+	inner, ok := wrapper[envelopeField]
+	if !ok || inner == nil || len(wrapper) != 1 {
+		return errors.New("Not a sealed envelope")
+	}
+	*e = Envelope(*inner)
+	return nil
+}
+
+// additionalData binds the key ID and algorithm to the ciphertext, so neither can be swapped
+func (e *Envelope) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d.%s.%s", e.Version, e.Alg, e.KeyID))
+}
+
+// SealBody seals all of v, returning the JSON of the envelope
+func SealBody(keys Keys, v interface{}) (json.RawMessage, error) {
+	e, err := Seal(keys, v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// SealFields seals the named top level fields of v, which has to marshal to a JSON object, and leaves the
+// rest in the clear. Fields that aren't there are skipped.
+func SealFields(keys Keys, v interface{}, fields []string) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err = json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("Only objects can have fields sealed: %s", err)
+	}
+	for _, name := range fields {
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+		if obj[name], err = SealBody(keys, value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// OpenAll returns data with every envelope in it, at any depth, replaced by the value sealed in it
+func OpenAll(keys Keys, data []byte) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := openValue(keys, v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func openValue(keys Keys, v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v[envelopeField]; ok && len(v) == 1 {
+			return openEnvelope(keys, v)
+		}
+		for k, item := range v {
+			if v[k], err = openValue(keys, item); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = openValue(keys, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func openEnvelope(keys Keys, wrapped interface{}) (interface{}, error) {
+	b, err := json.Marshal(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	var e Envelope
+	if err = json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("Invalid envelope: %s", err)
+	}
+	opened, err := Open(keys, &e)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err = json.Unmarshal(opened, &v); err != nil {
+		return nil, err
+	}
+	// a sealed value may itself hold envelopes
+	return openValue(keys, v)
+}
+
+// Fields returns the JSON names of the fields of v's struct tagged sensitive:"true"
+func Fields(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("sensitive") != "true" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// StaticKeys seals with one key and opens with any it holds, ie: the current key and those it replaced
+type StaticKeys struct {
+	ID   string            // ID is the key sealed with
+	Keys map[string][]byte // Keys by ID
+}
+
+// Current implements Keys
+func (s *StaticKeys) Current() (string, []byte, error) {
+	key, err := s.Key(s.ID)
+	return s.ID, key, err
+}
+
+// Key implements Keys
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown encryption key %s", id)
+	}
+	return key, nil
+}
+
+// EnvKeys returns the key configured in the environment. It returns ErrNoKey if there isn't one.
+func EnvKeys() (*StaticKeys, error) {
+	return EnvKeysFrom(KeyEnv, KeyIDEnv)
+}
+
+// EnvKeysFrom returns the key in the keyEnv environment variable, base64 encoded, named by idEnv or a
+// digest of it. It returns ErrNoKey if there isn't one.
+func EnvKeysFrom(keyEnv, idEnv string) (*StaticKeys, error) {
+	encoded := os.Getenv(keyEnv)
+	if encoded == "" {
+		return nil, ErrNoKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s, expected base64: %s", keyEnv, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Invalid %s, expected 32 bytes, got %d", keyEnv, len(key))
+	}
+	id := os.Getenv(idEnv)
+	if id == "" {
+		sum := sha256.Sum256(key)
+		id = hex.EncodeToString(sum[:4])
+	}
+	return &StaticKeys{ID: id, Keys: map[string][]byte{id: key}}, nil
+}
+
+// KMS seals with a data key generated once per process and wrapped by a key management service. The
+// wrapped key is the key ID, so whoever opens an envelope unwraps its key with the same service, and the
+// service decides who may.
+type KMS struct {
+	Wrap   func(key []byte) ([]byte, error)     // Wrap encrypts a data key, ie: calls the service's encrypt API
+	Unwrap func(wrapped []byte) ([]byte, error) // Unwrap decrypts a wrapped data key
+
+	mu        sync.Mutex
+	id        string
+	key       []byte
+	unwrapped map[string][]byte
+}
+
+// Current implements Keys
+func (k *KMS) Current() (string, []byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil {
+		key := make([]byte, 32)
+		if _, err := crand.Read(key); err != nil {
+			return "", nil, err
+		}
+		wrapped, err := k.Wrap(key)
+		if err != nil {
+			return "", nil, fmt.Errorf("Unable to wrap the data key: %s", err)
+		}
+		k.id, k.key = base64.StdEncoding.EncodeToString(wrapped), key
+	}
+	return k.id, k.key, nil
+}
+
+// Key implements Keys, unwrapping each key once
+func (k *KMS) Key(id string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == k.id && k.key != nil {
+		return k.key, nil
+	}
+	if key, ok := k.unwrapped[id]; ok {
+		return key, nil
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid wrapped key: %s", err)
+	}
+	key, err := k.Unwrap(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unwrap the data key: %s", err)
+	}
+	if k.unwrapped == nil {
+		k.unwrapped = map[string][]byte{}
+	}
+	k.unwrapped[id] = key
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Invalid key, expected 32 bytes for %s, got %d", Algorithm, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,151 @@
+package sealed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+type login struct {
+	Username string `json:"username"`
+	Password string `json:"password" sensitive:"true"`
+	Token    string `sensitive:"true"`
+	Skipped  string `json:"-" sensitive:"true"`
+}
+
+func testKeys() *StaticKeys {
+	return &StaticKeys{ID: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+}
+
+func TestSealFieldsRoundTrip(t *testing.T) {
+	keys := testKeys()
+	in := login{Username: "bob", Password: "hunter2", Token: "abc"}
+	fields := Fields(&in)
+	if strings.Join(fields, ",") != "password,Token" {
+		t.Fatalf("Expected the tagged fields by their JSON names, got %v", fields)
+	}
+
+	out, err := SealFields(keys, in, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "hunter2") || strings.Contains(string(out), `"abc"`) {
+		t.Fatalf("Expected the sensitive fields to be sealed, got %s", out)
+	}
+	if !strings.Contains(string(out), `"username":"bob"`) {
+		t.Fatalf("Expected the other fields in the clear, got %s", out)
+	}
+
+	opened, err := OpenAll(keys, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got login
+	if err = json.Unmarshal(opened, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != in {
+		t.Errorf("Expected %+v after opening, got %+v", in, got)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	keys := testKeys()
+	e, err := Seal(keys, map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(e)
+	var decoded Envelope
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(keys, &decoded); err != nil {
+		t.Fatalf("Expected the envelope to open, got %s", err)
+	}
+
+	decoded.Data[0] ^= 1
+	if _, err = Open(keys, &decoded); err == nil {
+		t.Error("Expected a modified envelope not to open")
+	}
+	decoded.Data[0] ^= 1
+	keys.Keys["k2"] = keys.Keys["k1"]
+	decoded.KeyID = "k2"
+	if _, err = Open(keys, &decoded); err == nil {
+		t.Error("Expected an envelope with its key ID swapped not to open")
+	}
+}
+
+func TestKMSWrapsTheDataKey(t *testing.T) {
+	wraps := 0
+	mask := func(b []byte) ([]byte, error) {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ 0x5a
+		}
+		return out, nil
+	}
+	seal := &KMS{Wrap: func(b []byte) ([]byte, error) { wraps++; return mask(b) }, Unwrap: mask}
+	body1, err := SealBody(seal, "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body2, err := SealBody(seal, "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wraps != 1 {
+		t.Errorf("Expected the data key to be wrapped once, got %d", wraps)
+	}
+
+	open := &KMS{Unwrap: mask}
+	for want, body := range map[string]json.RawMessage{`"one"`: body1, `"two"`: body2} {
+		got, err := OpenAll(open, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	defer os.Unsetenv(KeyEnv)
+	os.Unsetenv(KeyEnv)
+	if _, err := EnvKeys(); err != ErrNoKey {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+	os.Setenv(KeyEnv, base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := EnvKeys(); err == nil {
+		t.Error("Expected a short key to be refused")
+	}
+	os.Setenv(KeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+	keys, err := EnvKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _, _ := keys.Current(); len(id) != 8 {
+		t.Errorf("Expected a key ID derived from the key, got %q", id)
+	}
+}
+
+func TestEnvKeysFrom(t *testing.T) {
+	defer os.Unsetenv("TEST_CACHE_KEY")
+	defer os.Unsetenv("TEST_CACHE_KEY_ID")
+	if _, err := EnvKeysFrom("TEST_CACHE_KEY", "TEST_CACHE_KEY_ID"); err != ErrNoKey {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+	os.Setenv("TEST_CACHE_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32)))
+	os.Setenv("TEST_CACHE_KEY_ID", "cache")
+	keys, err := EnvKeysFrom("TEST_CACHE_KEY", "TEST_CACHE_KEY_ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, key, _ := keys.Current(); id != "cache" || !bytes.Equal(key, bytes.Repeat([]byte{3}, 32)) {
+		t.Errorf("Expected the key named cache, got %q", id)
+	}
+}
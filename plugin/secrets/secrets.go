@@ -0,0 +1,205 @@
+// Package secrets resolves references to secrets in connection parameters when a plugin starts, so the
+// orchestrator only stores where a credential lives rather than the credential itself. A reference is a
+// string parameter whose scheme has a Provider registered:
+//
+//	{"username": "svc", "password": "vault://secret/data/db#password"}
+//
+// env:// and file:// are registered by default. Register a Vault provider, or any other, with Register:
+//
+//	secrets.Register("vault", secrets.VaultFromEnv())
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Ref is a parsed reference, scheme://path#key
+type Ref struct {
+	Scheme string
+	Path   string
+	Key    string // Key selects a field of the secret, if it has several
+}
+
+// String formats the reference back into scheme://path#key
+func (r Ref) String() string {
+	s := r.Scheme + "://" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// ParseRef parses a reference, returning false if s isn't one
+func ParseRef(s string) (Ref, bool) {
+	i := strings.Index(s, "://")
+	if i <= 0 || strings.ContainsAny(s[:i], " \t\n/") {
+		return Ref{}, false
+	}
+	r := Ref{Scheme: s[:i], Path: s[i+3:]}
+	if j := strings.LastIndex(r.Path, "#"); j >= 0 {
+		r.Path, r.Key = r.Path[:j], r.Path[j+1:]
+	}
+	return r, true
+}
+
+// Provider fetches the secrets of one scheme
+type Provider interface {
+	Resolve(ref Ref) (string, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ref Ref) (string, error)
+
+// Resolve implements Provider
+func (f ProviderFunc) Resolve(ref Ref) (string, error) {
+	return f(ref)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{
+		"env":  ProviderFunc(resolveEnv),
+		"file": ProviderFunc(resolveFile),
+	}
+)
+
+// Register makes references with the scheme resolve with p, replacing any provider it had. Registering
+// a nil provider stops the scheme being resolved.
+func Register(scheme string, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if p == nil {
+		delete(providers, scheme)
+		return
+	}
+	providers[scheme] = p
+}
+
+// Invalidate drops the secrets providers kept, so the next references resolved are fetched again, ie:
+// after the credentials were rotated. Providers that keep secrets implement Invalidate() to be told.
+func Invalidate() {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	for _, p := range providers {
+		if i, ok := p.(interface {
+			Invalidate()
+		}); ok {
+			i.Invalidate()
+		}
+	}
+}
+
+// Resolve returns the secret s refers to, and false if s isn't a reference to a registered scheme
+func Resolve(s string) (string, bool, error) {
+	ref, ok := ParseRef(s)
+	if !ok {
+		return "", false, nil
+	}
+	providersMu.RLock()
+	p, ok := providers[ref.Scheme]
+	providersMu.RUnlock()
+	if !ok {
+		return "", false, nil
+	}
+	v, err := p.Resolve(ref)
+	if err != nil {
+		// the reference isn't secret, but say which one failed without echoing anything resolved
+		return "", true, fmt.Errorf("Unable to resolve secret %s: %s", ref, err)
+	}
+	return v, true, nil
+}
+
+// ResolveJSON returns data with every string in it, at any depth, that's a reference replaced by the
+// secret it refers to. data is returned as is if it holds no references.
+func ResolveJSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, changed, err := resolveValue(v)
+	if err != nil || !changed {
+		return data, err
+	}
+	return json.Marshal(v)
+}
+
+func resolveValue(v interface{}) (interface{}, bool, error) {
+	changed := false
+	switch v := v.(type) {
+	case string:
+		secret, ok, err := Resolve(v)
+		if err != nil || !ok {
+			return v, false, err
+		}
+		return secret, true, nil
+	case map[string]interface{}:
+		for k, item := range v {
+			resolved, ok, err := resolveValue(item)
+			if err != nil {
+				return nil, false, fmt.Errorf("%s: %s", k, err)
+			}
+			v[k], changed = resolved, changed || ok
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, ok, err := resolveValue(item)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i], changed = resolved, changed || ok
+		}
+	}
+	return v, changed, nil
+}
+
+// resolveEnv resolves env://NAME to the environment variable, or with a key to a field of the JSON in it
+func resolveEnv(ref Ref) (string, error) {
+	v, ok := os.LookupEnv(ref.Path)
+	if !ok {
+		return "", fmt.Errorf("%s isn't set", ref.Path)
+	}
+	return selectKey([]byte(v), ref.Key)
+}
+
+// resolveFile resolves file:///path to the file's content, or with a key to a field of the JSON in it
+func resolveFile(ref Ref) (string, error) {
+	b, err := ioutil.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	return selectKey(b, ref.Key)
+}
+
+// selectKey returns the key of the JSON object in b, or b trimmed of the trailing newline editors add
+// without a key
+func selectKey(b []byte, key string) (string, error) {
+	if key == "" {
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "", fmt.Errorf("Expected a JSON object to select %s from", key)
+	}
+	return field(fields, key)
+}
+
+// field returns a field of a secret as a string
+func field(fields map[string]interface{}, key string) (string, error) {
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("No %s in the secret", key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, ok := ParseRef("vault://secret/data/db#password")
+	if !ok || ref.Scheme != "vault" || ref.Path != "secret/data/db" || ref.Key != "password" {
+		t.Errorf("Unexpected ref %+v", ref)
+	}
+	if ref.String() != "vault://secret/data/db#password" {
+		t.Errorf("Expected the ref to format back, got %s", ref)
+	}
+	for _, s := range []string{"hunter2", "://x", "a b://x", ""} {
+		if _, ok := ParseRef(s); ok {
+			t.Errorf("Expected %q not to be a ref", s)
+		}
+	}
+}
+
+func TestResolveJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db.json")
+	if err = ioutil.WriteFile(path, []byte(`{"password": "from-file"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SECRETS_TEST_TOKEN", "from-env\n")
+	defer os.Unsetenv("SECRETS_TEST_TOKEN")
+
+	in := json.RawMessage(`{"url": "https://example.com", "token": "env://SECRETS_TEST_TOKEN", "db": {"password": "file://` + path + `#password"}}`)
+	out, err := ResolveJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+		DB    struct {
+			Password string `json:"password"`
+		} `json:"db"`
+	}
+	if err = json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "https://example.com" || got.Token != "from-env" || got.DB.Password != "from-file" {
+		t.Errorf("Unexpected resolution %s", out)
+	}
+
+	plain := json.RawMessage(`{"a": "b"}`)
+	if out, err = ResolveJSON(plain); err != nil || string(out) != string(plain) {
+		t.Errorf("Expected parameters without refs untouched, got %s %v", out, err)
+	}
+	if _, err = ResolveJSON(json.RawMessage(`{"a": "env://SECRETS_TEST_MISSING"}`)); err == nil {
+		t.Error("Expected an unset variable to fail")
+	}
+}
+
+func TestVault(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			w.Write([]byte(`{"data": {"data": {"username": "svc", "password": "s3cret"}, "metadata": {"version": 2}}}`))
+		case "/v1/kv/api":
+			w.Write([]byte(`{"data": {"key": "abc"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	Register("vault", &Vault{Addr: srv.URL, Token: "root"})
+	defer Register("vault", nil)
+
+	for ref, want := range map[string]string{
+		"vault://secret/data/db#password": "s3cret",
+		"vault://secret/data/db#username": "svc",
+		"vault://kv/api":                  "abc",
+	} {
+		got, ok, err := Resolve(ref)
+		if err != nil || !ok || got != want {
+			t.Errorf("Expected %s to resolve to %s, got %q %v %v", ref, want, got, ok, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected each path to be read once, got %d requests", requests)
+	}
+	if _, _, err := Resolve("vault://secret/data/db"); err == nil {
+		t.Error("Expected a secret with several fields to need a key")
+	}
+	if _, _, err := Resolve("vault://missing#x"); err == nil {
+		t.Error("Expected a missing secret to fail")
+	}
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+// Environment variables read by VaultFromEnv, the same ones the vault CLI reads
+const (
+	VaultAddrEnv  = "VAULT_ADDR"
+	VaultTokenEnv = "VAULT_TOKEN"
+)
+
+const defaultVaultTimeout = 10 * time.Second
+
+// Vault resolves vault://path#key references by reading path from a Vault-compatible HTTP API, ie:
+// vault://secret/data/db#password reads GET /v1/secret/data/db. Both KV version 1 and 2 responses are
+// understood. The secrets at a path are read once and kept, as a start resolves several fields of one.
+type Vault struct {
+	Addr   string // Addr is the server's base URL, ie: https://vault:8200
+	Token  string
+	Client *http.Client // Client defaults to one with a 10 second timeout
+
+	mu    sync.Mutex
+	paths map[string]map[string]interface{}
+}
+
+// VaultFromEnv returns a Vault provider for the server and token in VAULT_ADDR and VAULT_TOKEN
+func VaultFromEnv() *Vault {
+	return &Vault{Addr: os.Getenv(VaultAddrEnv), Token: os.Getenv(VaultTokenEnv)}
+}
+
+// Resolve implements Provider
+func (v *Vault) Resolve(ref Ref) (string, error) {
+	fields, err := v.read(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	if ref.Key == "" {
+		if len(fields) != 1 {
+			return "", errors.New("The secret has several fields, choose one with #key")
+		}
+		for key := range fields {
+			ref.Key = key
+		}
+	}
+	return field(fields, ref.Key)
+}
+
+// Invalidate forgets the secrets read, so they're read again after they were rotated
+func (v *Vault) Invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.paths = nil
+}
+
+func (v *Vault) read(path string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if fields, ok := v.paths[path]; ok {
+		return fields, nil
+	}
+	if v.Addr == "" {
+		return nil, fmt.Errorf("No Vault address, set %s", VaultAddrEnv)
+	}
+	req, err := http.NewRequest("GET", strings.TrimRight(v.Addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = httpclient.New(httpclient.Options{Timeout: defaultVaultTimeout})
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// drain so the connection is reused, the body may hold errors but never the secret
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("Vault returned %s", resp.Status)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Invalid Vault response: %s", err)
+	}
+	fields := body.Data
+	// KV version 2 nests the secret in data.data, next to its metadata
+	if inner, ok := fields["data"].(map[string]interface{}); ok {
+		if _, versioned := fields["metadata"]; versioned {
+			fields = inner
+		}
+	}
+	if v.paths == nil {
+		v.paths = map[string]map[string]interface{}{}
+	}
+	v.paths[path] = fields
+	return fields, nil
+}
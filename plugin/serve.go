@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/parameter"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// StatusTrailer is the trailer a streamed response ends with, holding the status the action finished with
+const StatusTrailer = "X-Plugin-Status"
+
+// serveReadTimeout bounds reading a request, its headers and start message, so a slow or stalled client
+// doesn't hold a connection open indefinitely. Actions run after it's read, so it doesn't bound them.
+const serveReadTimeout = 30 * time.Second
+
+// Serve runs the plugin's actions over HTTP on addr, for orchestrators that keep a plugin running rather
+// than starting it for every action. See Handler. The shutdown hooks are run when it returns.
+func (p *Plugin) Serve(addr string) error {
+	defer shutdown.Run()
+	p.startTelemetry()
+	p.warm()
+	log.Infof("Serving actions on %s", addr)
+	srv := &http.Server{Addr: addr, Handler: p.Handler(), ReadTimeout: serveReadTimeout}
+	return srv.ListenAndServe()
+}
+
+// Handler runs an action for each start message POSTed to it, responding with the action_event it finished
+// with. Actions keep their input in themselves, so requests are run one at a time, once their start message
+// has been read: a client slow to send one doesn't hold up the others.
+//
+// The response to a Streamable action is streamed instead, as newline delimited action_events: one with a
+// partial status for each part flushed, then the result. The status it finished with is also sent in the
+// StatusTrailer trailer, so a caller reading the stream can tell a complete export from a truncated one
+// without parsing it.
+func (p *Plugin) Handler() http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST a start message", http.StatusMethodNotAllowed)
+			return
+		}
+		t, err := p.setupFrom(parameter.NewParamSet(r.Body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a, ok := t.(*actionTask)
+		if !ok {
+			http.Error(w, "Triggers don't run in HTTP mode", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		d := &responseDispatcher{w: w}
+		a.dispatcher = d
+		if streamable, ok := a.action.(Streamable); ok {
+			if d.flusher, ok = w.(http.Flusher); ok {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Header().Set("Trailer", StatusTrailer)
+				streamable.SetFlush(a.flush)
+				defer streamable.SetFlush(nil)
+			}
+		}
+		if err = a.Run(); err != nil {
+			log.Errorf("Action %s failed: %s", a.message.Action, err)
+			if !d.written {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		}
+	})
+}
+
+// responseDispatcher writes an action's events to the response to its start message
+type responseDispatcher struct {
+	w       http.ResponseWriter
+	flusher http.Flusher // flusher is set when the response is streamed
+	written bool
+}
+
+// Send implements Dispatcher
+func (d *responseDispatcher) Send(m *message.Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if d.flusher == nil {
+		if d.written {
+			return fmt.Errorf("Unable to send more than one %s in a response", m.Type)
+		}
+		d.w.Header().Set("Content-Type", "application/json")
+	}
+	d.written = true
+	if _, err = d.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if d.flusher == nil {
+		return nil
+	}
+	if result, ok := m.Body.Contents.(*message.ActionResult); ok && result.Status != message.PARTIAL {
+		d.w.Header().Set(StatusTrailer, string(result.Status))
+	}
+	d.flusher.Flush()
+	return nil
+}
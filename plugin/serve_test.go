@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/conformance"
+)
+
+type PagedAction struct {
+	HelloAction
+	flush func(Output) error
+}
+
+func (p *PagedAction) Name() string {
+	return "paged_action"
+}
+
+func (p *PagedAction) SetFlush(flush func(Output) error) {
+	p.flush = flush
+}
+
+func (p *PagedAction) Act() error {
+	for _, page := range []string{"page 1", "page 2"} {
+		if err := p.flush(&HelloActionOutput{Greeting: page}); err != nil {
+			return err
+		}
+	}
+	p.output.Greeting = "done"
+	return nil
+}
+
+func TestServeRunsActions(t *testing.T) {
+	p := New()
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(actionStartMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	expected := `{"version":"v1","type":"action_event","body":{"meta":{"action_id":14},"status":"ok","error":"","output":{"greeting":"good day to you"}}}`
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != expected {
+		t.Fatalf("Expected the action result, got %s %s", resp.Status, body)
+	}
+
+	resp, err = http.Post(srv.URL, "application/json", strings.NewReader(triggerStartMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a trigger start to be refused, got %s", resp.Status)
+	}
+}
+
+func TestServeStreamsPartialOutput(t *testing.T) {
+	p := New()
+	p.AddAction(&PagedAction{})
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(strings.Replace(actionStartMessage, "hello_action", "paged_action", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.Contains(lines[0], `"status":"partial"`) || !strings.Contains(lines[1], "page 2") || !strings.Contains(lines[2], `"greeting":"done"`) {
+		t.Fatalf("Expected two partial events and the result, got %v", lines)
+	}
+	if status := resp.Trailer.Get(StatusTrailer); status != "ok" {
+		t.Errorf("Expected the status trailer to be ok, got %q", status)
+	}
+}
+
+func TestServeDoesntWaitOnSlowClients(t *testing.T) {
+	p := New()
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+
+	// A client that starts sending its start message and stalls
+	stalled, w := io.Pipe()
+	defer w.Close()
+	go http.Post(srv.URL, "application/json", stalled)
+	w.Write([]byte(`{"version": "v1",`))
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(actionStartMessage))
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the action to run while the other start message is being read")
+	}
+}
+
+func TestServeConforms(t *testing.T) {
+	p := New()
+	p.AddAction(&PagedAction{})
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+	suite := &conformance.Suite{
+		Target:  &conformance.HTTPEndpoint{URL: srv.URL},
+		Actions: map[string]conformance.Sample{"hello_action": {}, "paged_action": {}},
+	}
+	suite.Test(t)
+}
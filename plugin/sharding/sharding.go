@@ -0,0 +1,108 @@
+// Package sharding splits a keyspace, like the assets or mailboxes a trigger monitors, between the
+// replicas of a trigger so each key is polled by exactly one of them. Every replica works out the same
+// assignment independently from its index and the replica count, with no coordination between them.
+//
+// Keys are assigned with jump consistent hashing, so scaling from N to N+1 replicas only moves about
+// 1/(N+1) of the keys instead of reshuffling everything.
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read by FromEnv
+const (
+	IndexEnv = "PLUGIN_REPLICA_INDEX" // IndexEnv is this replica's index, from 0
+	TotalEnv = "PLUGIN_REPLICA_TOTAL" // TotalEnv is the number of replicas
+)
+
+// Shard is one replica's share of the keyspace
+type Shard struct {
+	Index int
+	Total int
+}
+
+// Single is the shard of a trigger that isn't replicated, it owns every key
+var Single = Shard{Index: 0, Total: 1}
+
+// FromEnv returns this replica's shard from PLUGIN_REPLICA_INDEX and PLUGIN_REPLICA_TOTAL. Without an
+// index, the ordinal at the end of the hostname is used, as given to the pods of a Kubernetes
+// StatefulSet (ie: trigger-2). Without a total, the trigger isn't replicated and gets Single.
+func FromEnv() (Shard, error) {
+	total := os.Getenv(TotalEnv)
+	if total == "" {
+		return Single, nil
+	}
+	s := Shard{}
+	var err error
+	if s.Total, err = strconv.Atoi(total); err != nil {
+		return s, fmt.Errorf("Invalid %s %q: %s", TotalEnv, total, err)
+	}
+
+	index := os.Getenv(IndexEnv)
+	if index == "" {
+		hostname, _ := os.Hostname()
+		index = hostname[strings.LastIndex(hostname, "-")+1:]
+	}
+	if s.Index, err = strconv.Atoi(index); err != nil {
+		return s, fmt.Errorf("Invalid %s %q, and no ordinal in the hostname: %s", IndexEnv, index, err)
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the index is within the number of replicas
+func (s Shard) Validate() error {
+	if s.Total < 1 {
+		return fmt.Errorf("The replica total must be at least 1, got %d", s.Total)
+	}
+	if s.Index < 0 || s.Index >= s.Total {
+		return fmt.Errorf("The replica index must be between 0 and %d, got %d", s.Total-1, s.Index)
+	}
+	return nil
+}
+
+// Owns returns whether key belongs to this shard
+func (s Shard) Owns(key string) bool {
+	return Of(key, s.Total) == s.Index
+}
+
+// Filter returns the keys that belong to this shard, in their original order
+func (s Shard) Filter(keys []string) []string {
+	var owned []string
+	for _, key := range keys {
+		if s.Owns(key) {
+			owned = append(owned, key)
+		}
+	}
+	return owned
+}
+
+// String implements fmt.Stringer, ie: 2/5
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+// Of returns the index of the shard that owns key, out of total
+func Of(key string, total int) int {
+	if total <= 1 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return jump(h.Sum64(), total)
+}
+
+// jump is Lamping and Veach's jump consistent hash, see https://arxiv.org/abs/1406.2294
+func jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,61 @@
+package sharding
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShardsCoverEveryKeyOnce(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("asset-%d", i))
+	}
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		owned := Shard{Index: i, Total: 4}.Filter(keys)
+		if len(owned) < 150 {
+			t.Fatalf("Expected shard %d to get roughly a quarter of the keys but got %d", i, len(owned))
+		}
+		for _, key := range owned {
+			seen[key]++
+		}
+	}
+	for _, key := range keys {
+		if seen[key] != 1 {
+			t.Fatalf("Expected %s to be owned once but it was owned %d times", key, seen[key])
+		}
+	}
+}
+
+func TestScalingMovesFewKeys(t *testing.T) {
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("mailbox-%d", i)
+		if Of(key, 4) != Of(key, 5) {
+			moved++
+		}
+	}
+	// About a fifth should move, a naive modulo would move about four fifths
+	if moved > 300 {
+		t.Fatalf("Expected about 200 keys to move when scaling to 5 replicas but %d did", moved)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	defer os.Unsetenv(TotalEnv)
+	defer os.Unsetenv(IndexEnv)
+
+	if s, err := FromEnv(); err != nil || s != Single {
+		t.Fatalf("Expected a single shard without env but got %s, %v", s, err)
+	}
+	os.Setenv(TotalEnv, "3")
+	os.Setenv(IndexEnv, "2")
+	if s, err := FromEnv(); err != nil || s != (Shard{Index: 2, Total: 3}) {
+		t.Fatalf("Expected 2/3 but got %s, %v", s, err)
+	}
+	os.Setenv(IndexEnv, "3")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("Expected an error for an index out of range")
+	}
+}
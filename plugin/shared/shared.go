@@ -0,0 +1,200 @@
+// Package shared is a small keyed store that lets steps of the same workflow run pass large or
+// binary intermediate state to each other without round-tripping it through the orchestrator.
+// Keys are namespaced by the workflow run ID found in the start message meta, so two runs of the
+// same workflow never see each other's state.
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/utils/objectstore"
+)
+
+// ErrNotFound is returned by Get when nothing has been stored under the key for this run
+var ErrNotFound = errors.New("No shared context found for key")
+
+// ErrNoRunID is returned when the start message meta doesn't identify a workflow run
+var ErrNoRunID = errors.New("No workflow run ID was found in the message meta")
+
+// InvalidKey is returned when a key is empty or tries to escape its namespace
+type InvalidKey string
+
+// Error implements the error interface
+func (e InvalidKey) Error() string {
+	return string(e)
+}
+
+// InvalidRunID is returned when the run ID in the message meta isn't one that can namespace keys
+type InvalidRunID string
+
+// Error implements the error interface
+func (e InvalidRunID) Error() string {
+	return string(e)
+}
+
+// maxRunIDLength bounds run IDs, which are UUIDs or numbers in practice
+const maxRunIDLength = 128
+
+// Backend persists the shared state. Get returns ErrNotFound for missing keys.
+type Backend interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+// Store reads and writes state for a single workflow run
+type Store struct {
+	backend Backend
+	runID   string
+}
+
+// New creates a Store for the workflow run identified by meta
+func New(backend Backend, meta *json.RawMessage) (*Store, error) {
+	runID, err := RunID(meta)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{backend: backend, runID: runID}, nil
+}
+
+// RunID extracts the workflow run ID from a start message meta. Both "workflow_run_id" and
+// "run_id" are accepted, as strings or whole numbers, which are kept as written rather than rounded
+// through a float64 so large IDs stay distinct. It's only accepted as a single segment of a
+// key, of letters, digits, '.', '_', ':' and '-', so one run can't name another's state.
+func RunID(meta *json.RawMessage) (string, error) {
+	if meta == nil {
+		return "", ErrNoRunID
+	}
+	fields := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(*meta))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return "", fmt.Errorf("Unable to parse message meta: %s", err)
+	}
+	for _, name := range []string{"workflow_run_id", "run_id"} {
+		var id string
+		switch v := fields[name].(type) {
+		case string:
+			id = v
+		case json.Number:
+			if strings.Trim(v.String(), "0123456789") != "" {
+				return "", InvalidRunID(fmt.Sprintf("'%s' is not a valid workflow run ID", v))
+			}
+			id = v.String()
+		}
+		if id == "" {
+			continue
+		}
+		if err := validRunID(id); err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+	return "", ErrNoRunID
+}
+
+// validRunID checks id can namespace keys
+func validRunID(id string) error {
+	if len(id) > maxRunIDLength || id == "." || id == ".." {
+		return InvalidRunID(fmt.Sprintf("'%s' is not a valid workflow run ID", id))
+	}
+	for _, ch := range id {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', strings.ContainsRune("._:-", ch):
+		default:
+			return InvalidRunID(fmt.Sprintf("'%s' is not a valid workflow run ID", id))
+		}
+	}
+	return nil
+}
+
+// Put stores data under key for this run
+func (s *Store) Put(key string, data []byte) error {
+	k, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.backend.Put(k, data)
+}
+
+// Get returns the data stored under key for this run, or ErrNotFound
+func (s *Store) Get(key string) ([]byte, error) {
+	k, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.backend.Get(k)
+}
+
+// PutJSON marshals v and stores it under key
+func (s *Store) PutJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, data)
+}
+
+// GetJSON unmarshals the data stored under key into v
+func (s *Store) GetJSON(key string, v interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// key namespaces key under the run ID
+func (s *Store) key(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") || strings.HasPrefix(key, "/") {
+		return "", InvalidKey(fmt.Sprintf("'%s' is not a valid shared context key", key))
+	}
+	return "shared/" + s.runID + "/" + key, nil
+}
+
+// CacheBackend keeps shared state in the plugin cache's current backend, which by default works when the
+// steps of a workflow run on the same host and share its /var/cache volume
+type CacheBackend struct{}
+
+// Put writes data to the cache entry for key
+func (CacheBackend) Put(key string, data []byte) error {
+	return cache.Put(key, data)
+}
+
+// Get reads the cache entry for key
+func (CacheBackend) Get(key string) ([]byte, error) {
+	data, err := cache.Get(key)
+	if err == cache.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// ObjectStoreBackend keeps shared state in an S3-compatible bucket, for workflows whose steps run
+// on different hosts
+type ObjectStoreBackend struct {
+	Client *objectstore.Client
+}
+
+// Put uploads data for key
+func (o ObjectStoreBackend) Put(key string, data []byte) error {
+	return o.Client.Put(key, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+}
+
+// Get downloads the data for key
+func (o ObjectStoreBackend) Get(key string) ([]byte, error) {
+	r, err := o.Client.Get(key)
+	if err == objectstore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,91 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// mapBackend keeps shared state in memory
+type mapBackend map[string][]byte
+
+func (m mapBackend) Put(key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m mapBackend) Get(key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func meta(s string) *json.RawMessage {
+	m := json.RawMessage(s)
+	return &m
+}
+
+func TestRunID(t *testing.T) {
+	for m, expected := range map[string]string{
+		`{"workflow_run_id":"3f2a-9c:1"}`:          "3f2a-9c:1",
+		`{"run_id":42}`:                            "42",
+		`{"run_id":9007199254740993}`:              "9007199254740993",
+		`{"workflow_run_id":"","run_id":"second"}`: "second",
+	} {
+		if id, err := RunID(meta(m)); err != nil || id != expected {
+			t.Errorf("Expected %s to have run ID %s, got %q, %v", m, expected, id, err)
+		}
+	}
+	if _, err := RunID(meta(`{"action_id":14}`)); err != ErrNoRunID {
+		t.Errorf("Expected ErrNoRunID, got %v", err)
+	}
+	if _, err := RunID(nil); err != ErrNoRunID {
+		t.Errorf("Expected ErrNoRunID without meta, got %v", err)
+	}
+	for _, m := range []string{`{"run_id":1e300}`, `{"run_id":1.5}`, `{"run_id":-1}`} {
+		if _, err := RunID(meta(m)); err == nil {
+			t.Errorf("Expected %s to be refused, run IDs are whole numbers", m)
+		}
+	}
+	for _, id := range []string{"..", ".", "other/key", "../other", `a\b`, "run\x00", "run id", string(make([]byte, maxRunIDLength+1))} {
+		b, _ := json.Marshal(map[string]string{"run_id": id})
+		if _, err := RunID(meta(string(b))); err == nil {
+			t.Errorf("Expected run ID %q to be refused", id)
+		} else if _, ok := err.(InvalidRunID); !ok {
+			t.Errorf("Expected run ID %q to be refused with an InvalidRunID, got %v", id, err)
+		}
+	}
+}
+
+func TestRunsAreIsolated(t *testing.T) {
+	backend := mapBackend{}
+	first, err := New(backend, meta(`{"workflow_run_id":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New(backend, meta(`{"workflow_run_id":"2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = first.PutJSON("hosts", []string{"web01"}); err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	if err = first.GetJSON("hosts", &hosts); err != nil || len(hosts) != 1 || hosts[0] != "web01" {
+		t.Fatalf("Expected the hosts stored, got %v, %v", hosts, err)
+	}
+	if _, err = second.Get("hosts"); err != ErrNotFound {
+		t.Fatalf("Expected another run not to see the hosts, got %v", err)
+	}
+	if _, ok := backend["shared/1/hosts"]; !ok {
+		t.Fatalf("Expected the key to be namespaced by the run, got %v", backend)
+	}
+	for _, key := range []string{"", "../2/hosts", "/etc/passwd"} {
+		if err = second.Put(key, nil); err == nil {
+			t.Errorf("Expected key %q to be refused", key)
+		} else if _, ok := err.(InvalidKey); !ok {
+			t.Errorf("Expected key %q to be refused with an InvalidKey, got %v", key, err)
+		}
+	}
+}
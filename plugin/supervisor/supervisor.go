@@ -0,0 +1,217 @@
+// Package supervisor runs goroutines that are restarted when they fail, so long running helpers (pollers,
+// refreshers, keep-alives) recover from errors and panics the same way everywhere instead of each
+// loop inventing its own. The SDK runs its own background loops under it.
+//
+//	sup := supervisor.New(ctx)
+//	sup.Go(supervisor.Spec{Name: "token refresher", MaxRestarts: 5, Window: time.Minute}, refreshTokens)
+//	...
+//	sup.Stop()
+//
+// A goroutine that's restarted more than MaxRestarts times within Window is given up on. With Escalate
+// set, giving up stops every goroutine of its supervisor and Wait returns why, so a supervisor created
+// with Child can fail as a unit, like a branch of a supervision tree.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// Policy decides when a goroutine is restarted
+type Policy int
+
+// Restart policies
+const (
+	Permanent Policy = iota // Permanent goroutines are always restarted, even when they return nil
+	Transient               // Transient goroutines are restarted when they return an error or panic
+	Temporary               // Temporary goroutines are never restarted
+)
+
+// Defaults for Spec
+const (
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultWindow     = time.Minute
+)
+
+// maxPanicStack bounds the stack kept from a panic
+const maxPanicStack = 16 << 10
+
+// PanicError is the error of a goroutine that panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Spec describes how a goroutine is supervised
+type Spec struct {
+	Name    string // Name identifies the goroutine in logs and errors
+	Restart Policy
+	// MaxRestarts is how many restarts are allowed within Window before the goroutine is given up on.
+	// Zero allows any number.
+	MaxRestarts int
+	Window      time.Duration // Window defaults to DefaultWindow
+	Backoff     time.Duration // Backoff is the wait before the first restart, doubling up to MaxBackoff
+	MaxBackoff  time.Duration
+	// Escalate stops the whole supervisor when this goroutine is given up on
+	Escalate bool
+}
+
+// Supervisor runs and restarts goroutines until it's stopped
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// New returns a supervisor whose goroutines run until ctx is done or it's stopped
+func New(ctx context.Context) *Supervisor {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine, restarting it according to spec. fn should return once ctx is done.
+func (s *Supervisor) Go(spec Spec, fn func(ctx context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(spec.withDefaults(), fn)
+	}()
+}
+
+// Child returns a supervisor that's stopped with this one. Stop and Wait on this one wait for it too, and
+// if its goroutines escalate, Wait returns the error from this one as well.
+func (s *Supervisor) Child() *Supervisor {
+	child := New(s.ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := child.Wait(); err != nil {
+			s.fail(err, true)
+		}
+	}()
+	return child
+}
+
+// Stop stops every goroutine and waits for them to return
+func (s *Supervisor) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Wait waits until the supervisor is stopped, or a goroutine escalates, and every goroutine returned. It
+// returns the error of the first goroutine given up on, if any.
+func (s *Supervisor) Wait() error {
+	<-s.ctx.Done()
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Supervisor) fail(err error, escalate bool) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	if escalate {
+		s.cancel()
+	}
+}
+
+func (s *Supervisor) supervise(spec Spec, fn func(ctx context.Context) error) {
+	backoff := spec.Backoff
+	var restarts []time.Time
+	for {
+		began := time.Now()
+		err := run(s.ctx, fn)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if p, ok := err.(*PanicError); ok {
+			log.Errorf("%s panicked: %v\n%s", spec.Name, p.Value, p.Stack)
+		} else if err != nil {
+			log.Errorf("%s failed: %s", spec.Name, err)
+		}
+		if spec.Restart == Temporary || (spec.Restart == Transient && err == nil) {
+			return
+		}
+
+		now := time.Now()
+		restarts = append(since(restarts, now.Add(-spec.Window)), now)
+		if spec.MaxRestarts > 0 && len(restarts) > spec.MaxRestarts {
+			if err == nil {
+				err = fmt.Errorf("returned")
+			}
+			err = fmt.Errorf("%s restarted more than %d times in %s, giving up: %s", spec.Name, spec.MaxRestarts, spec.Window, err)
+			log.Error(err)
+			s.fail(err, spec.Escalate)
+			return
+		}
+
+		// One that ran for a while before failing starts over with the shortest backoff
+		if time.Since(began) > spec.MaxBackoff {
+			backoff = spec.Backoff
+		}
+		log.Warnf("Restarting %s in %s", spec.Name, backoff)
+		if utils.SleepCtx(s.ctx, utils.Jitter(backoff, 0.2)) != nil {
+			return
+		}
+		if backoff *= 2; backoff > spec.MaxBackoff {
+			backoff = spec.MaxBackoff
+		}
+	}
+}
+
+// run calls fn, turning a panic into a PanicError
+func run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			stack := make([]byte, maxPanicStack)
+			err = &PanicError{Value: v, Stack: stack[:runtime.Stack(stack, false)]}
+		}
+	}()
+	return fn(ctx)
+}
+
+// since drops the times before cutoff
+func since(times []time.Time, cutoff time.Time) []time.Time {
+	for len(times) > 0 && times[0].Before(cutoff) {
+		times = times[1:]
+	}
+	return times
+}
+
+func (spec Spec) withDefaults() Spec {
+	if spec.Name == "" {
+		spec.Name = "supervised goroutine"
+	}
+	if spec.Window <= 0 {
+		spec.Window = DefaultWindow
+	}
+	if spec.Backoff <= 0 {
+		spec.Backoff = DefaultBackoff
+	}
+	if spec.MaxBackoff <= 0 {
+		spec.MaxBackoff = DefaultMaxBackoff
+	}
+	if spec.MaxBackoff < spec.Backoff {
+		spec.MaxBackoff = spec.Backoff
+	}
+	return spec
+}
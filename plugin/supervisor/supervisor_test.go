@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartsAfterPanic(t *testing.T) {
+	sup := New(context.Background())
+	var runs int32
+	done := make(chan struct{})
+	sup.Go(Spec{Name: "panicky", Restart: Transient, Backoff: time.Millisecond}, func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) < 3 {
+			panic("boom")
+		}
+		close(done)
+		return nil
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the goroutine to be restarted after panicking")
+	}
+	sup.Stop()
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Errorf("Expected 3 runs, got %d", n)
+	}
+}
+
+func TestPermanentRestartsUntilStopped(t *testing.T) {
+	sup := New(context.Background())
+	var runs int32
+	sup.Go(Spec{Name: "loop", Backoff: time.Millisecond}, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	sup.Stop()
+	n := atomic.LoadInt32(&runs)
+	if n < 2 {
+		t.Errorf("Expected a permanent goroutine to be restarted when it returns, ran %d times", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != n {
+		t.Error("Expected no restarts after Stop")
+	}
+}
+
+func TestGivesUpAndEscalates(t *testing.T) {
+	parent := New(context.Background())
+	child := parent.Child()
+	sibling := make(chan struct{})
+	child.Go(Spec{Name: "sibling"}, func(ctx context.Context) error {
+		<-ctx.Done()
+		close(sibling)
+		return nil
+	})
+	child.Go(Spec{Name: "failing", MaxRestarts: 2, Backoff: time.Millisecond, Escalate: true}, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	select {
+	case <-sibling:
+	case <-time.After(time.Second):
+		t.Fatal("Expected escalating to stop the other goroutines of the supervisor")
+	}
+	parent.Stop()
+	err := parent.Wait()
+	if err == nil || !strings.Contains(err.Error(), "failing restarted more than 2 times") {
+		t.Errorf("Expected the give up to reach the parent, got %v", err)
+	}
+}
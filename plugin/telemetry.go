@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
+)
+
+// SDKVersion is the version of the SDK the plugin was built with, reported by telemetry. Release builds set
+// it with -ldflags "-X github.com/komand/plugin-sdk-go/plugin.SDKVersion=<tag>".
+var SDKVersion = "dev"
+
+// DefaultTelemetryInterval is how often long running plugins report telemetry, if SetTelemetry isn't told
+const DefaultTelemetryInterval = time.Hour
+
+// telemetryTimeout bounds posting a report, so a slow endpoint can't hold up a plugin exiting
+const telemetryTimeout = 5 * time.Second
+
+// TelemetryReport is what's posted to the telemetry endpoint, as JSON. It's anonymous: counts, and versions,
+// but nothing about the inputs, outputs, connections, or the host the plugin runs on.
+type TelemetryReport struct {
+	SDKVersion    string                      `json:"sdk_version"`
+	GoVersion     string                      `json:"go_version"`
+	Plugin        string                      `json:"plugin"`
+	PluginVersion string                      `json:"plugin_version"`
+	Since         time.Time                   `json:"since"` // Since is when the counts start, the last report
+	Until         time.Time                   `json:"until"`
+	ActionRuns    map[string]int64            `json:"action_runs,omitempty"` // ActionRuns are the runs of each action
+	ErrorCodes    map[message.ErrorCode]int64 `json:"error_codes,omitempty"` // ErrorCodes are how often actions failed with each code
+}
+
+// telemetry is set by SetTelemetry, or the PLUGIN_TELEMETRY_ENDPOINT environment variable
+var telemetry *telemetryConfig
+
+type telemetryConfig struct {
+	endpoint string
+	interval time.Duration
+	client   *http.Client
+	once     sync.Once // once starts the periodic reports
+
+	mu         sync.Mutex
+	meta       Meta
+	since      time.Time
+	actionRuns map[string]int64
+	errorCodes map[message.ErrorCode]int64
+}
+
+// SetTelemetry opts in to posting anonymous usage statistics to endpoint, for plugin vendors to learn which
+// actions and failures dominate in the field: how often each action ran and failed with each error code,
+// with the SDK and plugin versions, see TelemetryReport. Reports are posted every interval, or
+// DefaultTelemetryInterval if it's 0, and when the plugin exits. It's off unless it's called, or turned on
+// by PLUGIN_TELEMETRY_ENDPOINT, with PLUGIN_TELEMETRY_INTERVAL.
+func (p Plugin) SetTelemetry(endpoint string, interval time.Duration) error {
+	if endpoint == "" {
+		return errors.New("A telemetry endpoint is required")
+	}
+	if interval < 0 {
+		return fmt.Errorf("Telemetry interval can't be negative, got %s", interval)
+	}
+	if interval == 0 {
+		interval = DefaultTelemetryInterval
+	}
+	telemetry = &telemetryConfig{
+		endpoint:   endpoint,
+		interval:   interval,
+		client:     httpclient.New(httpclient.Options{Timeout: telemetryTimeout, Connection: "telemetry"}),
+		since:      time.Now(),
+		actionRuns: map[string]int64{},
+		errorCodes: map[message.ErrorCode]int64{},
+	}
+	return nil
+}
+
+// telemetryFromEnv turns telemetry on if the environment opts in
+func telemetryFromEnv() {
+	endpoint := os.Getenv("PLUGIN_TELEMETRY_ENDPOINT")
+	if endpoint == "" {
+		return
+	}
+	var interval time.Duration
+	var err error
+	if s := os.Getenv("PLUGIN_TELEMETRY_INTERVAL"); s != "" {
+		interval, err = time.ParseDuration(s)
+	}
+	if err == nil {
+		err = Plugin{}.SetTelemetry(endpoint, interval)
+	}
+	if err != nil {
+		log.Warnf("Ignoring invalid telemetry configuration: %s", err)
+	}
+}
+
+// startTelemetry has the plugin's telemetry reported when it exits, and every interval while it runs
+func (p *Plugin) startTelemetry() {
+	t := telemetry
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.meta = p.Meta
+	t.mu.Unlock()
+	shutdown.Register("telemetry", func() error {
+		t.reportOrLog()
+		return nil
+	})
+	t.once.Do(func() {
+		go func() {
+			for range utils.NewTicker(context.Background(), t.interval).C {
+				t.reportOrLog()
+			}
+		}()
+	})
+}
+
+// reportOrLog reports telemetry, only logging a failure for debugging, as it's of no concern to the user
+func (t *telemetryConfig) reportOrLog() {
+	if err := t.report(); err != nil {
+		log.Debugf("Unable to report telemetry: %s", err)
+	}
+}
+
+// countActionRun counts a run of the named action for telemetry, and the code of err if it failed
+func countActionRun(name string, err error) {
+	t := telemetry
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.actionRuns[name]++
+	if err != nil {
+		t.errorCodes[ErrorCode(err)]++
+	}
+}
+
+// take returns the report of what was counted since the last, and starts counting afresh
+func (t *telemetryConfig) take() TelemetryReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	r := TelemetryReport{
+		SDKVersion:    SDKVersion,
+		GoVersion:     runtime.Version(),
+		Plugin:        t.meta.Name,
+		PluginVersion: t.meta.Version,
+		Since:         t.since,
+		Until:         now,
+		ActionRuns:    t.actionRuns,
+		ErrorCodes:    t.errorCodes,
+	}
+	t.since = now
+	t.actionRuns = map[string]int64{}
+	t.errorCodes = map[message.ErrorCode]int64{}
+	return r
+}
+
+// putBack returns the counts of a report that couldn't be posted, for the next one
+func (t *telemetryConfig) putBack(r TelemetryReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.since = r.Since
+	for name, n := range r.ActionRuns {
+		t.actionRuns[name] += n
+	}
+	for code, n := range r.ErrorCodes {
+		t.errorCodes[code] += n
+	}
+}
+
+// report posts what was counted since the last report, if anything was
+func (t *telemetryConfig) report() error {
+	r := t.take()
+	if len(r.ActionRuns) == 0 {
+		t.putBack(r)
+		return nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(b))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("the telemetry endpoint answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		t.putBack(r)
+	}
+	return err
+}
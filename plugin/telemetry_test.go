@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+func TestTelemetryReportsActionRuns(t *testing.T) {
+	reports := make(chan TelemetryReport, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report TelemetryReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		reports <- report
+	}))
+	defer srv.Close()
+	if err := (Plugin{}).SetTelemetry(srv.URL, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { telemetry = nil }()
+
+	runEnrich(t, &EnrichAction{})
+	runEnrich(t, &EnrichAction{down: true})
+	var runs, failures int64
+	for i := 0; i < 2; i++ {
+		r := <-reports
+		if r.SDKVersion != SDKVersion || r.GoVersion == "" {
+			t.Fatalf("Expected the versions to be reported, got %+v", r)
+		}
+		runs += r.ActionRuns["hello_action"]
+		failures += r.ErrorCodes[message.CodeInternal]
+	}
+	if runs != 2 || failures != 1 {
+		t.Fatalf("Expected 2 runs and 1 failure reported, got %d and %d", runs, failures)
+	}
+	if err := (Plugin{}).SetTelemetry("", 0); err == nil {
+		t.Fatal("Expected an endpoint to be required")
+	}
+}
+
+func TestTelemetryIsReportedByLongRunningModes(t *testing.T) {
+	reports := make(chan TelemetryReport, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report TelemetryReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		reports <- report
+	}))
+	defer srv.Close()
+	if err := (Plugin{}).SetTelemetry(srv.URL, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { telemetry = nil }()
+
+	p := New()
+	if err := p.RunKeepAlive(strings.NewReader(actionStartMessage), ioutil.Discard, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-reports:
+		if r.ActionRuns["hello_action"] != 1 {
+			t.Fatalf("Expected the keep-alive run to be reported, got %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected telemetry to be reported when keep-alive mode exits")
+	}
+
+	// as though an action was served before the server stopped
+	countActionRun("hello_action", nil)
+	if err := p.Serve("256.0.0.1:0"); err == nil {
+		t.Fatal("Expected an error serving on an invalid address")
+	}
+	select {
+	case r := <-reports:
+		if r.ActionRuns["hello_action"] != 1 {
+			t.Fatalf("Expected the served run to be reported, got %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected telemetry to be reported when serving stops")
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// totalsInterval is how often a running trigger adds what it did to its totals
+var totalsInterval = 15 * time.Second
+
+// Totals are what a trigger did across every run, unlike its Metrics, which are what this process did. They're
+// kept in the cache, see cache.SetBackend, under health/totals/, so operators can check a restarted collector
+// carried on where it left off rather than starting over.
+type Totals struct {
+	EventsDispatched int64     `json:"events_dispatched"`
+	Errors           int64     `json:"errors"` // Errors are the events that couldn't be dispatched
+	LastEvent        time.Time `json:"last_event"`
+}
+
+// LoadTotals returns the totals of the named trigger, zero if it never ran
+func LoadTotals(trigger string) (Totals, error) {
+	var t Totals
+	if err := cache.GetJSON(totalsKey(trigger), &t); err != nil && err != cache.ErrNotFound {
+		return t, err
+	}
+	return t, nil
+}
+
+func totalsKey(trigger string) string {
+	return "health/totals/" + trigger
+}
+
+// totals records the totals of the trigger this process runs, if it's running one
+var (
+	totalsMu sync.RWMutex
+	totals   *totalsRecorder
+)
+
+// currentTotals returns the recorder of the trigger this process runs, nil if it isn't running one
+func currentTotals() *totalsRecorder {
+	totalsMu.RLock()
+	defer totalsMu.RUnlock()
+	return totals
+}
+
+func setTotals(r *totalsRecorder) {
+	totalsMu.Lock()
+	defer totalsMu.Unlock()
+	totals = r
+}
+
+// totalsRecorder adds this process's counters to a trigger's totals as they grow
+type totalsRecorder struct {
+	trigger string
+
+	mu         sync.Mutex
+	saved      Totals // saved are the totals as they were last saved
+	dispatched int64  // dispatched and failed are the counters saved so far
+	failed     int64
+}
+
+// recordTotals saves what this process does to the trigger's totals every totalsInterval, until the
+// returned function is called, when it saves what's left
+func recordTotals(trigger string) (stop func()) {
+	r := &totalsRecorder{trigger: trigger}
+	var err error
+	if r.saved, err = LoadTotals(trigger); err != nil {
+		log.Warnf("Unable to load the totals of trigger %s: %s", trigger, err)
+	}
+	r.dispatched = atomic.LoadInt64(&eventsDispatched)
+	r.failed = atomic.LoadInt64(&eventsFailed)
+	setTotals(r)
+	sup := supervisor.New(context.Background())
+	sup.Go(supervisor.Spec{Name: "totals recorder"}, func(ctx context.Context) error {
+		ticker := utils.NewTicker(ctx, totalsInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := r.save(); err != nil {
+				log.Warnf("Unable to save the totals of trigger %s: %s", trigger, err)
+			}
+		}
+		return nil
+	})
+	return func() {
+		sup.Stop()
+		if err := r.save(); err != nil {
+			log.Warnf("Unable to save the totals of trigger %s: %s", trigger, err)
+		}
+	}
+}
+
+// save adds what was counted since the last save to the totals, locked in the cache, so two processes of
+// the same trigger both count
+func (r *totalsRecorder) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := totalsKey(r.trigger)
+	b := cache.CurrentBackend()
+	if err := b.Lock(context.Background(), key); err != nil {
+		return err
+	}
+	defer b.Unlock(key)
+	t, err := LoadTotals(r.trigger)
+	if err != nil {
+		return err
+	}
+	dispatched, failed := atomic.LoadInt64(&eventsDispatched), atomic.LoadInt64(&eventsFailed)
+	t.add(dispatched-r.dispatched, failed-r.failed)
+	if err = cache.PutJSON(key, t); err != nil {
+		return err
+	}
+	r.saved, r.dispatched, r.failed = t, dispatched, failed
+	return nil
+}
+
+// current returns the totals with what was counted since they were saved
+func (r *totalsRecorder) current() Totals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.saved
+	t.add(atomic.LoadInt64(&eventsDispatched)-r.dispatched, atomic.LoadInt64(&eventsFailed)-r.failed)
+	return t
+}
+
+// add adds counts to the totals, and this process's last event if it's later than theirs
+func (t *Totals) add(dispatched, failed int64) {
+	t.EventsDispatched += dispatched
+	t.Errors += failed
+	if last := atomic.LoadInt64(&lastEvent); last != 0 && time.Unix(0, last).After(t.LastEvent) {
+		t.LastEvent = time.Unix(0, last).UTC()
+	}
+}
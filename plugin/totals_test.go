@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+func TestTotalsCarryOverRestarts(t *testing.T) {
+	defer cache.SetBackend(cache.CurrentBackend())
+	cache.SetBackend(&cache.MemoryBackend{})
+	defer setTotals(currentTotals())
+
+	// What the trigger did before it was restarted
+	before := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := cache.PutJSON(totalsKey("hello"), Totals{EventsDispatched: 40, Errors: 2, LastEvent: before}); err != nil {
+		t.Fatal(err)
+	}
+	stop := recordTotals("hello")
+	atomic.AddInt64(&eventsDispatched, 3)
+	atomic.AddInt64(&eventsFailed, 1)
+	atomic.StoreInt64(&lastEvent, time.Now().UnixNano())
+
+	if m := RuntimeMetrics("hello"); m.Totals == nil || m.Totals.EventsDispatched != 43 || m.Totals.Errors != 3 {
+		t.Fatalf("Expected the totals in the metrics to include what wasn't saved yet, got %+v", m.Totals)
+	}
+	stop()
+	saved, err := LoadTotals("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.EventsDispatched != 43 || saved.Errors != 3 || !saved.LastEvent.After(before) {
+		t.Fatalf("Expected the totals to be saved on stop, got %+v", saved)
+	}
+	if m := RuntimeMetrics("other"); m.Totals != nil {
+		t.Fatalf("Expected no totals for a trigger that isn't running, got %+v", m.Totals)
+	}
+}
@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Condition matches events for filter steps. Either Field and Op are set, or one of All, Any or Not.
+//
+// Ops are eq, ne, in, not_in, contains, exists, missing, gt, gte, lt, lte and matches (a regular
+// expression). Values compare as numbers when both sides are numbers, and as strings otherwise.
+type Condition struct {
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	re *regexp.Regexp
+}
+
+var ops = map[string]bool{
+	"eq": true, "ne": true, "in": true, "not_in": true, "contains": true, "exists": true, "missing": true,
+	"gt": true, "gte": true, "lt": true, "lte": true, "matches": true,
+}
+
+func (c *Condition) validate() error {
+	switch {
+	case c.All != nil:
+		for i := range c.All {
+			if err := c.All[i].validate(); err != nil {
+				return err
+			}
+		}
+	case c.Any != nil:
+		for i := range c.Any {
+			if err := c.Any[i].validate(); err != nil {
+				return err
+			}
+		}
+	case c.Not != nil:
+		return c.Not.validate()
+	default:
+		if c.Field == "" || !ops[c.Op] {
+			return fmt.Errorf("a condition needs a field and one of the ops eq, ne, in, not_in, contains, exists, missing, gt, gte, lt, lte or matches")
+		}
+		if c.Op == "in" || c.Op == "not_in" {
+			if _, ok := c.Value.([]interface{}); !ok {
+				return fmt.Errorf("%s needs a list value", c.Op)
+			}
+		}
+		if c.Op == "matches" {
+			pattern, _ := c.Value.(string)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern for matches: %s", err)
+			}
+			c.re = re
+		}
+	}
+	return nil
+}
+
+// Match returns whether the event matches the condition
+func (c *Condition) Match(e Event) (bool, error) {
+	switch {
+	case c.All != nil:
+		for i := range c.All {
+			if ok, err := c.All[i].Match(e); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case c.Any != nil:
+		for i := range c.Any {
+			if ok, err := c.Any[i].Match(e); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case c.Not != nil:
+		ok, err := c.Not.Match(e)
+		return !ok, err
+	}
+
+	v, exists := get(e, c.Field)
+	switch c.Op {
+	case "exists":
+		return exists, nil
+	case "missing":
+		return !exists, nil
+	case "eq":
+		return exists && equal(v, c.Value), nil
+	case "ne":
+		return !exists || !equal(v, c.Value), nil
+	case "in", "not_in":
+		list, _ := c.Value.([]interface{})
+		found := false
+		for _, item := range list {
+			if exists && equal(v, item) {
+				found = true
+				break
+			}
+		}
+		return found == (c.Op == "in"), nil
+	case "contains":
+		switch t := v.(type) {
+		case string:
+			return strings.Contains(t, fmt.Sprint(c.Value)), nil
+		case []interface{}:
+			for _, item := range t {
+				if equal(item, c.Value) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "matches":
+		if c.re == nil {
+			if err := c.validate(); err != nil {
+				return false, err
+			}
+		}
+		return exists && c.re.MatchString(fmt.Sprint(v)), nil
+	case "gt", "gte", "lt", "lte":
+		if !exists {
+			return false, nil
+		}
+		cmp := compare(v, c.Value)
+		switch c.Op {
+		case "gt":
+			return cmp > 0, nil
+		case "gte":
+			return cmp >= 0, nil
+		case "lt":
+			return cmp < 0, nil
+		default:
+			return cmp <= 0, nil
+		}
+	}
+	return false, fmt.Errorf("Unknown condition op: %s", c.Op)
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			return x == y
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func compare(a, b interface{}) int {
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if !xok || !yok {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
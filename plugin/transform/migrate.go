@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration moves an input field from the name an older version of a plugin took it by to its current
+// one, so workflows configured against the older version keep working after it's renamed:
+//
+//	{From: "ip", To: "address"}
+//	{From: "severity", Values: map[string]interface{}{"med": "medium"}}
+//	{From: "host", To: "hosts", Convert: func(v interface{}) (interface{}, error) { return []interface{}{v}, nil }}
+//
+// Fields are dotted paths, as in pipelines. Values maps old values to new ones, by their string form, and
+// Convert changes the value's shape; Values is applied first. A migration without To changes the value
+// where it is.
+type Migration struct {
+	From    string
+	To      string
+	Values  map[string]interface{}
+	Convert func(old interface{}) (interface{}, error)
+}
+
+// Migrate applies the migrations to input in order, returning it migrated and the fields that were
+// migrated by their old names. input is returned as is if no migration applied. When input has a field by
+// both its old and new name, the new one is kept and the old one dropped.
+func Migrate(input json.RawMessage, migrations []Migration) (json.RawMessage, []string, error) {
+	if len(input) == 0 || len(migrations) == 0 {
+		return input, nil, nil
+	}
+	var e map[string]interface{}
+	if err := json.Unmarshal(input, &e); err != nil {
+		// only objects have fields to migrate
+		return input, nil, nil
+	}
+	var migrated []string
+	for _, m := range migrations {
+		ok, err := m.apply(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to migrate %s: %s", m.From, err)
+		}
+		if ok {
+			migrated = append(migrated, m.From)
+		}
+	}
+	if len(migrated) == 0 {
+		return input, nil, nil
+	}
+	b, err := json.Marshal(e)
+	return b, migrated, err
+}
+
+// apply migrates the field in e, returning false if it isn't there
+func (m Migration) apply(e map[string]interface{}) (bool, error) {
+	to := m.To
+	if to == "" {
+		to = m.From
+	}
+	v, ok := get(e, m.From)
+	if !ok {
+		return false, nil
+	}
+	if to != m.From {
+		remove(e, m.From)
+		if _, current := get(e, to); current {
+			return true, nil
+		}
+	}
+	if newValue, found := m.Values[fmt.Sprint(v)]; found {
+		v = newValue
+	}
+	if m.Convert != nil {
+		var err error
+		if v, err = m.Convert(v); err != nil {
+			return false, err
+		}
+	}
+	set(e, to, v)
+	return true, nil
+}
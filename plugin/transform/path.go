@@ -0,0 +1,50 @@
+package transform
+
+import "strings"
+
+// get returns the value at a dotted path, ie: source.ip
+func get(event map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = event
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// set stores value at a dotted path, creating objects along the way
+func set(event map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	m := event
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+// remove deletes the value at a dotted path and returns it
+func remove(event map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	m := event
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	last := parts[len(parts)-1]
+	v, ok := m[last]
+	delete(m, last)
+	return v, ok
+}
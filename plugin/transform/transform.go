@@ -0,0 +1,269 @@
+// Package transform shapes trigger events with a declarative pipeline a trigger takes from its input,
+// so simple customer-specific changes (dropping noise, renaming fields, mapping codes to names) don't
+// need a new plugin release. A pipeline is a list of steps, each doing one thing:
+//
+//	[
+//	  {"filter": {"field": "severity", "op": "in", "value": ["high", "critical"]}},
+//	  {"rename": {"src": "source.ip"}},
+//	  {"map": {"host_name": "host.name"}},
+//	  {"drop": ["raw"]},
+//	  {"enrich": {"field": "country_code", "target": "country", "table": {"US": "United States"}}},
+//	  {"where": "size(tags) > 0 && !host_name.startsWith('test-')"}
+//	]
+//
+// Fields are dotted paths into the event's JSON. Triggers that implement plugin.Transformable have their
+// pipeline applied to every event before it's dispatched.
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/expr"
+)
+
+// Event is a transformed event, as generic JSON
+type Event map[string]interface{}
+
+// Lookup resolves keys for enrich steps that name a table instead of listing it inline. The lookups
+// package loads tables from files or URLs that implement it.
+type Lookup interface {
+	Lookup(key string) (interface{}, bool)
+}
+
+var lookupsMu sync.RWMutex
+var lookups = map[string]Lookup{}
+
+// RegisterLookup makes a lookup table available to enrich steps by name
+func RegisterLookup(name string, l Lookup) {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+	lookups[name] = l
+}
+
+func lookup(name string) (Lookup, bool) {
+	lookupsMu.RLock()
+	defer lookupsMu.RUnlock()
+	l, ok := lookups[name]
+	return l, ok
+}
+
+// Pipeline is a list of steps applied in order
+type Pipeline []Step
+
+// Step does one of its fields, only one should be set
+type Step struct {
+	Filter *Condition        `json:"filter,omitempty"` // Filter drops events that don't match
+	Map    map[string]string `json:"map,omitempty"`    // Map copies fields, destination to source
+	Rename map[string]string `json:"rename,omitempty"` // Rename moves fields, old to new
+	Drop   []string          `json:"drop,omitempty"`   // Drop removes fields
+	Enrich *Enrich           `json:"enrich,omitempty"` // Enrich adds a field looked up from another
+	// Where drops events for which an expression isn't true, see Filter for the syntax
+	Where string `json:"where,omitempty"`
+}
+
+// Enrich looks Field up in a table and stores the result in Target
+type Enrich struct {
+	Field   string                 `json:"field"`
+	Target  string                 `json:"target"`
+	Table   map[string]interface{} `json:"table,omitempty"`   // Table is an inline table
+	Lookup  string                 `json:"lookup,omitempty"`  // Lookup names a table registered with RegisterLookup
+	Default interface{}            `json:"default,omitempty"` // Default is stored when the key isn't found, if set
+}
+
+// Filter is a filter expression for triggers that take one from their input, evaluated against each
+// event with its top level fields as variables, ie:
+//
+//	severity in ["high", "critical"] && !source.ip.startsWith("10.")
+//
+// See the utils/expr package for the syntax, and the limits evaluation runs under.
+type Filter string
+
+// Validate implements the input validation convention, checking the expression compiles
+func (f Filter) Validate() []error {
+	if f == "" {
+		return nil
+	}
+	if _, err := compileCached(string(f)); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Pipeline returns a pipeline with just the filter, empty if there isn't one
+func (f Filter) Pipeline() Pipeline {
+	if f == "" {
+		return nil
+	}
+	return Pipeline{{Where: string(f)}}
+}
+
+// Validate implements the input validation convention, so a Pipeline can be embedded in trigger input
+func (p Pipeline) Validate() []error {
+	var errs []error
+	for i, step := range p {
+		if err := step.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("transform step %d: %s", i+1, err))
+		}
+	}
+	return errs
+}
+
+func (s Step) validate() error {
+	n := 0
+	for _, set := range []bool{s.Filter != nil, s.Map != nil, s.Rename != nil, s.Drop != nil, s.Enrich != nil, s.Where != ""} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("exactly one of filter, map, rename, drop, enrich or where is required, got %d", n)
+	}
+	switch {
+	case s.Filter != nil:
+		return s.Filter.validate()
+	case s.Where != "":
+		_, err := compileCached(s.Where)
+		return err
+	case s.Enrich != nil:
+		if s.Enrich.Field == "" || s.Enrich.Target == "" {
+			return fmt.Errorf("enrich needs a field and a target")
+		}
+		if (s.Enrich.Table == nil) == (s.Enrich.Lookup == "") {
+			return fmt.Errorf("enrich needs either a table or a lookup")
+		}
+	}
+	return nil
+}
+
+var compiledMu sync.Mutex
+var compiled = map[string]*expr.Program{}
+
+// compileCached compiles src the first time it's seen, so pipelines don't parse it for every event
+func compileCached(src string) (*expr.Program, error) {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+	if p, ok := compiled[src]; ok {
+		return p, nil
+	}
+	p, err := expr.CompileCondition(src, expr.Options{})
+	if err != nil {
+		return nil, err
+	}
+	compiled[src] = p
+	return p, nil
+}
+
+// Apply runs the pipeline over an event, which may be any value that marshals to a JSON object.
+// It returns false if a filter dropped the event.
+func (p Pipeline) Apply(event interface{}) (Event, bool, error) {
+	e, err := toEvent(event)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, step := range p {
+		keep, err := step.apply(e)
+		if err != nil || !keep {
+			return nil, false, err
+		}
+	}
+	return e, true, nil
+}
+
+func (s Step) apply(e Event) (bool, error) {
+	switch {
+	case s.Where != "":
+		where, err := compileCached(s.Where)
+		if err != nil {
+			return false, err
+		}
+		return where.EvalBool(e)
+	case s.Filter != nil:
+		return s.Filter.Match(e)
+	case s.Map != nil:
+		for dst, src := range s.Map {
+			if v, ok := get(e, src); ok {
+				set(e, dst, copyValue(v))
+			}
+		}
+	case s.Rename != nil:
+		for from, to := range s.Rename {
+			if v, ok := remove(e, from); ok {
+				set(e, to, v)
+			}
+		}
+	case s.Drop != nil:
+		for _, field := range s.Drop {
+			remove(e, field)
+		}
+	case s.Enrich != nil:
+		return true, s.Enrich.apply(e)
+	}
+	return true, nil
+}
+
+func (en *Enrich) apply(e Event) error {
+	key, ok := get(e, en.Field)
+	if !ok {
+		return nil
+	}
+	k := fmt.Sprint(key)
+	var v interface{}
+	var found bool
+	if en.Lookup != "" {
+		l, ok := lookup(en.Lookup)
+		if !ok {
+			return fmt.Errorf("No lookup table named %s", en.Lookup)
+		}
+		v, found = l.Lookup(k)
+	} else {
+		v, found = en.Table[k]
+	}
+	if !found {
+		if en.Default == nil {
+			return nil
+		}
+		v = en.Default
+	}
+	set(e, en.Target, v)
+	return nil
+}
+
+// toEvent converts an event to generic JSON, so the pipeline doesn't need to know the trigger's types
+func toEvent(event interface{}) (Event, error) {
+	switch e := event.(type) {
+	case Event:
+		return e, nil
+	case map[string]interface{}:
+		return Event(e), nil
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	e := Event{}
+	if err = json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("Only events that are JSON objects can be transformed: %s", err)
+	}
+	return e, nil
+}
+
+// copyValue deep copies objects and arrays, so a mapped field can be changed without changing its source
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = copyValue(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, v := range t {
+			a[i] = copyValue(v)
+		}
+		return a
+	}
+	return v
+}
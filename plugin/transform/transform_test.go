@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const pipelineJSON = `[
+	{"filter": {"field": "severity", "op": "in", "value": ["high", "critical"]}},
+	{"rename": {"src": "source.ip"}},
+	{"map": {"host_name": "host.name"}},
+	{"drop": ["raw"]},
+	{"enrich": {"field": "country_code", "target": "country", "table": {"US": "United States"}, "default": "Unknown"}}
+]`
+
+type alert struct {
+	Severity    string            `json:"severity"`
+	Src         string            `json:"src"`
+	Host        map[string]string `json:"host"`
+	Raw         string            `json:"raw"`
+	CountryCode string            `json:"country_code"`
+}
+
+func TestPipeline(t *testing.T) {
+	var p Pipeline
+	if err := json.Unmarshal([]byte(pipelineJSON), &p); err != nil {
+		t.Fatal(err)
+	}
+	if errs := p.Validate(); errs != nil {
+		t.Fatal(errs)
+	}
+
+	e, ok, err := p.Apply(&alert{Severity: "high", Src: "10.0.0.1", Host: map[string]string{"name": "web-1"}, Raw: "...", CountryCode: "US"})
+	if err != nil || !ok {
+		t.Fatalf("Expected the event to pass but got %v, %v", ok, err)
+	}
+	expected := Event{
+		"severity":     "high",
+		"source":       map[string]interface{}{"ip": "10.0.0.1"},
+		"host":         map[string]interface{}{"name": "web-1"},
+		"host_name":    "web-1",
+		"country_code": "US",
+		"country":      "United States",
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Fatalf("Expected %v but got %v", expected, e)
+	}
+
+	if _, ok, _ = p.Apply(&alert{Severity: "low"}); ok {
+		t.Fatal("Expected the low severity event to be filtered out")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := Pipeline{{Drop: []string{"a"}, Map: map[string]string{"b": "c"}}, {Filter: &Condition{Field: "a", Op: "like"}}}
+	if errs := p.Validate(); len(errs) != 2 {
+		t.Fatalf("Expected 2 errors but got %v", errs)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrations := []Migration{
+		{From: "ip", To: "address"},
+		{From: "severity", Values: map[string]interface{}{"med": "medium"}},
+		{From: "host", To: "target.hosts", Convert: func(v interface{}) (interface{}, error) { return []interface{}{v}, nil }},
+		{From: "old", To: "new"},
+	}
+	input := json.RawMessage(`{"ip": "10.0.0.1", "severity": "med", "host": "a", "old": 1, "new": 2}`)
+	out, migrated, err := Migrate(input, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"address":"10.0.0.1","new":2,"severity":"medium","target":{"hosts":["a"]}}`
+	if string(out) != expected {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+	if len(migrated) != 4 {
+		t.Errorf("Expected every field to be migrated, got %v", migrated)
+	}
+
+	current := json.RawMessage(`{"address": "10.0.0.1"}`)
+	if out, migrated, _ = Migrate(current, migrations); string(out) != string(current) || len(migrated) != 0 {
+		t.Errorf("Expected current input to be left as is, got %s", out)
+	}
+}
@@ -1,5 +1,7 @@
 package plugin
 
+import "github.com/komand/plugin-sdk-go/plugin/message"
+
 // Triggerable must be implemented by a plugin trigger.
 type Triggerable interface {
 	RunTrigger() error   // RunTrigger will run the trigger.
@@ -11,9 +13,20 @@ type Triggerable interface {
 // implemented Trigger.
 type Trigger struct {
 	sendQueue
+	progress
 }
 
 // Send emits an event
 func (t *Trigger) Send(event Output) error {
 	return t.sendQueue.Send(event)
 }
+
+// SendPriority emits an event with a priority. While the dispatcher is behind, events are dispatched highest
+// priority first, so a critical detection isn't stuck behind thousands of informational ones:
+//
+//	t.SendPriority(alert, message.SeverityPriority(alert.Severity))
+//
+// Events of the same priority are dispatched in the order they're sent. Send is PriorityNormal.
+func (t *Trigger) SendPriority(event Output, priority message.Priority) error {
+	return t.sendQueue.sendPriority(event, priority)
+}
@@ -1,12 +1,20 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"sync/atomic"
+	"time"
 
+	"github.com/komand/plugin-sdk-go/plugin/deadletter"
 	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/outbox"
+	"github.com/komand/plugin-sdk-go/plugin/secrets"
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
 )
 
 // triggerTask runs a trigger
@@ -14,6 +22,7 @@ type triggerTask struct {
 	dispatcher Dispatcher
 	message    *message.TriggerStart
 	trigger    Triggerable
+	rotator    *rotator
 }
 
 // Test the task
@@ -62,7 +71,7 @@ func (t *triggerTask) Run() error {
 
 	// connect the connection
 	if connectable, ok := t.trigger.(Connectable); ok {
-		if err := connectable.Connection().Connect(); err != nil {
+		if err := t.rotator.run(connectable.Connection().Connect); err != nil {
 			return err
 		}
 	}
@@ -78,17 +87,38 @@ func (t *triggerTask) Run() error {
 		return err
 	}
 
+	// the totals are saved last, once the collector dispatched what it had
+	defer recordTotals(t.message.Trigger)()
 	defer collector.stop()
+	if publishHealth {
+		defer publishMetrics(t.message.Trigger)()
+	}
+	defer startHeartbeat(t.message, t.trigger, t.dispatcher)()
+	defer reportSampling(t.message.Trigger)()
+	if outboxable, ok := t.trigger.(Outboxable); ok && outboxable.Outbox() != nil {
+		defer deliverOutbox(outboxable.Outbox(), collector)()
+	}
 	go func() {
 		err := collector.start()
 		collector.stopped <- true
 		if err != nil {
+			shutdown.Run()
 			log.Fatal("Stopping trigger, received error collecting events: ", err)
 		}
 	}()
 
-	// finally start the trigger
-	return t.trigger.RunTrigger()
+	// catch up on the past, if asked to, before polling
+	if err := runBackfill(t.message, t.trigger); err != nil {
+		return err
+	}
+
+	// finally start the trigger, starting it again if it stops because its credentials expired
+	return t.rotator.run(func() error {
+		if watchdog != nil {
+			return runWatched(t.message, t.trigger, t.dispatcher, *watchdog)
+		}
+		return runTrigger(context.Background(), t.trigger)
+	})
 }
 
 // unpack unpacks the message into the trigger task object
@@ -97,6 +127,10 @@ func (t *triggerTask) unpack() error {
 	connectable, _ := t.trigger.(Connectable)
 	inputable, _ := t.trigger.(Inputable)
 
+	if metaable, ok := t.trigger.(Metaable); ok {
+		metaable.SetMeta(t.message.Meta)
+	}
+
 	if connectable != nil {
 		t.message.Connection.Contents = connectable.Connection()
 	}
@@ -107,6 +141,21 @@ func (t *triggerTask) unpack() error {
 
 	t.message.Dispatcher.Contents = t.dispatcher
 
+	// references to secrets are resolved here, so only the connection ever holds the credentials
+	t.rotator = newRotator(t.trigger, t.message.Connection.RawMessage)
+	resolved, err := secrets.ResolveJSON(t.message.Connection.RawMessage)
+	if err != nil {
+		return fmt.Errorf("Connection validation failed: %s", err)
+	}
+	t.message.Connection.RawMessage = resolved
+
+	migrated, warnings, err := migrateInput(t.message.Trigger, t.trigger, t.message.Input.RawMessage)
+	if err != nil {
+		return fmt.Errorf("Input validation failed: %s", err)
+	}
+	t.message.Input.RawMessage = migrated
+	warnings = append(warnings, deprecatedUses(t.message.Trigger, t.trigger, t.message.Input.RawMessage)...)
+
 	if err := t.message.Unpack(); err != nil {
 		return err
 	}
@@ -124,6 +173,10 @@ func (t *triggerTask) unpack() error {
 
 		}
 	}
+
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w.Message)
+	}
 	return nil
 }
 
@@ -134,6 +187,7 @@ type triggerEventCollector struct {
 	sender     queueable
 	dispatcher Dispatcher
 	message    *message.TriggerStart
+	trigger    Triggerable
 }
 
 func makeTriggerEventCollector(message *message.TriggerStart, trigger Triggerable, dispatcher Dispatcher) (*triggerEventCollector, error) {
@@ -146,6 +200,7 @@ func makeTriggerEventCollector(message *message.TriggerStart, trigger Triggerabl
 			stopped:    make(chan bool, 1),
 			sender:     q,
 			dispatcher: dispatcher,
+			trigger:    trigger,
 		}, nil
 	}
 	return nil, errors.New("Trigger does not implement Send() interface. Did you compose with plugin.Trigger?")
@@ -171,10 +226,82 @@ func (t *triggerEventCollector) stop() {
 	<-t.stopped
 }
 
-// send will dispatch an output event
+// send will dispatch an output event. With dead lettering on, an event that can't be dispatched after
+// retrying is dead lettered and the trigger carries on. An event the transform fails on is counted as
+// failed and dropped, rather than stopping the trigger.
 func (t *triggerEventCollector) send(event message.Output) error {
+	priority := message.PriorityNormal
+	if p, ok := event.(prioritizedOutput); ok {
+		event, priority = p.Output, p.priority
+	}
+	b, backfilled := event.(backfilledOutput)
+	if backfilled {
+		event = b.Output
+	}
+	var id string
+	if e, ok := event.(outbox.Event); ok {
+		id, event = e.ID, e.Body
+	}
+	marked := event
+	if filterable, ok := t.trigger.(Filterable); ok && filterable.Filter() != "" {
+		_, keep, err := filterable.Filter().Pipeline().Apply(event)
+		if err != nil {
+			log.Printf("Dispatching trigger event the filter couldn't be evaluated for: %s", err)
+		} else if !keep {
+			atomic.AddInt64(&eventsFiltered, 1)
+			return nil
+		}
+	}
+	if transformable, ok := t.trigger.(Transformable); ok && len(transformable.Transform()) > 0 {
+		e, keep, err := transformable.Transform().Apply(event)
+		if err != nil {
+			log.Printf("Dropping trigger event that couldn't be transformed: %s", err)
+			atomic.AddInt64(&eventsFailed, 1)
+			return nil
+		}
+		if !keep {
+			atomic.AddInt64(&eventsFiltered, 1)
+			return nil
+		}
+		event = e
+	}
+	if sampler != nil && id == "" && priority != message.PriorityHigh && !sampler.keep() {
+		return nil
+	}
+	event, err := seal(marked, event)
+	if err != nil {
+		return err
+	}
 	m := makeTriggerEvent(t.message.Meta, event)
-	return t.dispatcher.Send(m)
+	e := m.Body.Contents.(*message.TriggerEvent)
+	e.ID = id
+	e.Backfilled = backfilled
+	if priority != message.PriorityNormal {
+		e.Priority = priority
+	}
+	attempts, err := sendWithRetry(t.dispatcher, m)
+	if err != nil {
+		atomic.AddInt64(&eventsFailed, 1)
+	} else {
+		atomic.AddInt64(&eventsDispatched, 1)
+		atomic.StoreInt64(&lastEvent, time.Now().UnixNano())
+	}
+	if err != nil && deadLetters != nil {
+		deadLetter(deadletter.TriggerEvent, t.message.Trigger, err, attempts, m, t.message.Dispatcher.RawMessage)
+		return nil
+	}
+	return err
+}
+
+// deliverOutbox dispatches the events committed to a trigger's outbox until the returned function is called
+func deliverOutbox(o *outbox.Outbox, collector *triggerEventCollector) (stop func()) {
+	sup := supervisor.New(context.Background())
+	sup.Go(supervisor.Spec{Name: "outbox delivery"}, func(ctx context.Context) error {
+		return o.Deliver(ctx, func(e outbox.Event) error {
+			return collector.send(e)
+		})
+	})
+	return sup.Stop
 }
 
 func makeTriggerEvent(meta *json.RawMessage, output message.Output) *message.Message {
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/komand/plugin-sdk-go/plugin/message"
 	"github.com/komand/plugin-sdk-go/plugin/parameter"
+	"github.com/komand/plugin-sdk-go/plugin/transform"
 )
 
 var triggerTestStartMessage = `
@@ -387,3 +389,91 @@ func TestGenerateSampleTriggerStartMessage(t *testing.T) {
 	}
 
 }
+
+type TransformTrigger struct {
+	HelloTrigger
+	input struct {
+		Transform transform.Pipeline `json:"transform"`
+	}
+}
+
+func (t *TransformTrigger) Input() Input {
+	return &t.input.Transform
+}
+
+func (t *TransformTrigger) Transform() transform.Pipeline {
+	return t.input.Transform
+}
+
+func TestTriggerEventsAreTransformed(t *testing.T) {
+	start := strings.Replace(triggerStartMessage, `{ "person": "Bob"}`, `[{"rename": {"Goodbye": "farewell"}}]`, 1)
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(start))
+	dispatcher := &mockDispatcher{}
+	defaultTriggerDispatcher = dispatcher
+
+	p := New()
+	p.AddTrigger(&TransformTrigger{})
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dispatcher.result, `"output":{"farewell":"bob"}`) {
+		t.Fatalf("Expected the event to be transformed but got %s", dispatcher.result)
+	}
+}
+
+type FilterTrigger struct {
+	HelloTrigger
+	filter transform.Filter
+}
+
+func (t *FilterTrigger) Filter() transform.Filter {
+	return t.filter
+}
+
+func TestTriggerEventsAreFiltered(t *testing.T) {
+	for filter, dispatched := range map[transform.Filter]bool{`Goodbye == "bob"`: true, `Goodbye != "bob"`: false} {
+		parameter.Stdin = parameter.NewParamSet(strings.NewReader(triggerStartMessage))
+		dispatcher := &mockDispatcher{}
+		defaultTriggerDispatcher = dispatcher
+
+		p := New()
+		p.AddTrigger(&FilterTrigger{filter: filter})
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if (dispatcher.result != "") != dispatched {
+			t.Fatalf("Expected %s to dispatch the event: %v, but got %q", filter, dispatched, dispatcher.result)
+		}
+	}
+}
+
+type SeverityTrigger struct {
+	TransformTrigger
+}
+
+func (t *SeverityTrigger) RunTrigger() error {
+	if err := t.Send(map[string]interface{}{"severity": "high"}); err != nil {
+		return err
+	}
+	return t.Send(map[string]interface{}{"severity": 5})
+}
+
+func TestTriggerCarriesOnWhenAnEventCantBeTransformed(t *testing.T) {
+	start := strings.Replace(triggerStartMessage, `{ "person": "Bob"}`, `[{"where": "severity > 3"}]`, 1)
+	parameter.Stdin = parameter.NewParamSet(strings.NewReader(start))
+	dispatcher := &mockDispatcher{}
+	defaultTriggerDispatcher = dispatcher
+	failed := atomic.LoadInt64(&eventsFailed)
+
+	p := New()
+	p.AddTrigger(&SeverityTrigger{})
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&eventsFailed) - failed; n != 1 {
+		t.Fatalf("Expected the event without a numeric severity to be counted as failed, got %d", n)
+	}
+	if !strings.Contains(dispatcher.result, `"output":{"severity":5}`) {
+		t.Fatalf("Expected the next event to be dispatched but got %q", dispatcher.result)
+	}
+}
@@ -1,9 +1,15 @@
 package plugin
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync/atomic"
 
 	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/outbox"
+	"github.com/komand/plugin-sdk-go/plugin/transform"
 )
 
 // Testable must be implemented by a trigger or action if it accepts a test
@@ -20,6 +26,12 @@ type Inputable interface {
 	Input() Input
 }
 
+// InputSchemable can be implemented by an action to have its input checked against a JSON Schema before
+// it's unpacked. The schema is compiled when the action is added, see the schema package.
+type InputSchemable interface {
+	InputSchema() json.RawMessage
+}
+
 // Output structures define output fields for a trigger or action
 type Output message.Output
 
@@ -28,6 +40,13 @@ type Outputable interface {
 	Output() Output
 }
 
+// Streamable must be implemented by an action to send parts of its output before it finishes, ie: a page
+// of a large export at a time. In HTTP mode it's given a flush function that streams the part to the caller
+// straight away, see Plugin.Serve. In other modes it isn't, and the action returns all of its output.
+type Streamable interface {
+	SetFlush(flush func(partial Output) error)
+}
+
 type queueable interface {
 	Send(Output) error
 	Read() Output
@@ -36,38 +55,94 @@ type queueable interface {
 }
 
 type sendQueue struct {
-	queue chan Output
+	lanes       [lanes]chan Output // lanes queue the events of each priority, highest first
+	backfilling int32              // backfilling is set while the runtime is backfilling, to mark the events sent
 }
 
 // InitQueue inits the queue
 func (s *sendQueue) InitQueue() {
-	s.queue = make(chan Output, 1)
+	for i := range s.lanes {
+		s.lanes[i] = make(chan Output, eventBuffer)
+	}
 }
 
 // Send the event
 func (s *sendQueue) Send(output Output) error {
-	if s.queue != nil {
-		s.queue <- output
-		return nil
+	return s.sendPriority(output, message.PriorityNormal)
+}
+
+func (s *sendQueue) sendPriority(output Output, priority message.Priority) error {
+	if s.lanes[laneNormal] == nil {
+		return errors.New("No queue defined - did you call Init()?")
+	}
+	if !priority.Known() {
+		return fmt.Errorf("Unknown event priority %q", priority)
 	}
+	if atomic.LoadInt32(&s.backfilling) != 0 {
+		output = backfilledOutput{output}
+	}
+	if priority != message.PriorityNormal {
+		output = prioritizedOutput{output, priority}
+	}
+	s.lanes[lane(priority)] <- output
+	return nil
+}
 
-	return errors.New("No queue defined - did you call Init()?")
+func (s *sendQueue) setBackfilling(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&s.backfilling, v)
 }
 
 // Stop the queue
 func (s *sendQueue) Stop() error {
-	if s.queue != nil {
-		close(s.queue)
+	for _, lane := range s.lanes {
+		if lane != nil {
+			close(lane)
+		}
 	}
 	return nil
 }
 
-// Read the queue event
+// Read the queue event, the highest priority one waiting first. It returns nil once the queue is stopped
+// and every event read.
 func (s *sendQueue) Read() Output {
-	if s.queue != nil {
-		return <-s.queue
+	if s.lanes[laneNormal] == nil {
+		return nil
+	}
+	for {
+		drained := 0
+		for _, lane := range s.lanes {
+			select {
+			case output, ok := <-lane:
+				if ok {
+					return output
+				}
+				drained++
+			default:
+			}
+		}
+		if drained == len(s.lanes) {
+			return nil
+		}
+		// Nothing's waiting, take whatever's sent next
+		select {
+		case output, ok := <-s.lanes[laneHigh]:
+			if ok {
+				return output
+			}
+		case output, ok := <-s.lanes[laneNormal]:
+			if ok {
+				return output
+			}
+		case output, ok := <-s.lanes[laneLow]:
+			if ok {
+				return output
+			}
+		}
 	}
-	return nil
 }
 
 // Connection implements a Connect method
@@ -78,6 +153,67 @@ type Connectable interface {
 	Connection() Connection // Connection will return the actual connection to populate
 }
 
+// Metaable is implemented by a trigger or action that wants the meta information from its
+// start message, for example to find the workflow run it belongs to.
+type Metaable interface {
+	SetMeta(meta *json.RawMessage)
+}
+
+// Transformable is implemented by a trigger whose events are shaped by a transform pipeline, usually
+// taken from its input. The pipeline is applied to each event before it's dispatched, and events it
+// filters out are dropped.
+type Transformable interface {
+	Transform() transform.Pipeline
+}
+
+// Filterable is implemented by a trigger that takes a filter expression from its input. Events the
+// expression isn't true for are dropped before they're dispatched, or transformed. If it can't be
+// evaluated for an event, the event is dispatched anyway rather than silently lost.
+type Filterable interface {
+	Filter() transform.Filter
+}
+
+// ContextTriggerable is implemented by a trigger that can be stopped, by returning from RunTriggerContext
+// once ctx is done. The runtime calls it instead of RunTrigger, and the watchdog uses it to restart a
+// trigger that stopped making progress.
+type ContextTriggerable interface {
+	RunTriggerContext(ctx context.Context) error
+}
+
+// Outboxable is implemented by a trigger that commits its events to an outbox along with its checkpoint,
+// see the outbox package. Outbox is called once, after the trigger connects and before it runs, and the
+// runtime dispatches the outbox's events while the trigger runs, each with its outbox event ID.
+type Outboxable interface {
+	Outbox() *outbox.Outbox
+}
+
+// Degradable is implemented by an action that degrades while its vendor is failing, see Degradation
+type Degradable interface {
+	Degradation() Degradation
+}
+
+// Deprecatable is implemented by a trigger or action that's deprecated. Deprecated says why, or what to use
+// instead, and returns "" if it isn't.
+//
+// Input fields are deprecated with "deprecated": true in the input schema, or a deprecated tag on the input
+// struct's field, holding the field to use instead or "true":
+//
+//	Host  string   `json:"host" deprecated:"hosts"`
+//	Hosts []string `json:"hosts"`
+//
+// Each start that uses something deprecated is counted in the runtime metrics, and actions are sent
+// message.WarnDeprecated warnings with their result.
+type Deprecatable interface {
+	Deprecated() string
+}
+
+// Migratable is implemented by a trigger or action whose input fields were renamed, or whose values changed,
+// since earlier versions. Its input is migrated before it's validated, so workflows configured against an
+// earlier version keep working. See transform.Migration.
+type Migratable interface {
+	InputMigrations() []transform.Migration
+}
+
 type task interface {
 	Run() error
 	Test() error
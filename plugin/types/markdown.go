@@ -0,0 +1,49 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+)
+
+// markdownInline is what's escaped wherever it is: emphasis, code, links, images, HTML and entities,
+// strikethrough and table cells
+const markdownInline = "\\`*_[]<>&!~|"
+
+// markdownLineStart is what's also escaped at the start of a line: headings, lists and setext underlines
+const markdownLineStart = "#-+="
+
+// EscapeMarkdown backslash escapes s so it renders as the text it is, not as Markdown
+func EscapeMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		var buf bytes.Buffer
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		buf.WriteString(line[:indent])
+		rest := line[indent:]
+		if rest != "" && strings.IndexByte(markdownLineStart, rest[0]) >= 0 {
+			buf.WriteByte('\\')
+		} else if digits := len(rest) - len(strings.TrimLeft(rest, "0123456789")); digits > 0 && digits < len(rest) && (rest[digits] == '.' || rest[digits] == ')') {
+			// an ordered list item, ie: 1. or 1)
+			buf.WriteString(rest[:digits])
+			buf.WriteByte('\\')
+			rest = rest[digits:]
+		}
+		for _, ch := range rest {
+			if ch < 0x80 && strings.IndexByte(markdownInline, byte(ch)) >= 0 {
+				buf.WriteByte('\\')
+			}
+			buf.WriteRune(ch)
+		}
+		lines[i] = buf.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeMarkdownCell escapes a table cell, which has to be a line: line breaks are kept as <br>
+func escapeMarkdownCell(s string) string {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := range lines {
+		lines[i] = EscapeMarkdown(lines[i])
+	}
+	return strings.Join(lines, "<br>")
+}
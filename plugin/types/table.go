@@ -0,0 +1,154 @@
+// Package types holds common output structures that actions can emit, so the orchestrator UI and
+// downstream steps can consume them uniformly regardless of which plugin produced them.
+package types
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ColumnType describes the kind of values held in a column
+type ColumnType string
+
+// Types of table columns
+const (
+	StringColumn  = ColumnType("string")
+	IntegerColumn = ColumnType("integer")
+	NumberColumn  = ColumnType("number")
+	BooleanColumn = ColumnType("boolean")
+	TimeColumn    = ColumnType("time")
+)
+
+// Column is a named, typed table column
+type Column struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+}
+
+// Table is a structured table output. Every row has exactly one value per column.
+type Table struct {
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// NewTable creates an empty table with the given columns
+func NewTable(columns ...Column) *Table {
+	return &Table{Columns: columns, Rows: [][]interface{}{}}
+}
+
+// AddColumn appends a column. It must be called before any rows are added.
+func (t *Table) AddColumn(name string, kind ColumnType) *Table {
+	t.Columns = append(t.Columns, Column{Name: name, Type: kind})
+	return t
+}
+
+// AddRow appends a row, checking it has one value per column and the values match the column types
+func (t *Table) AddRow(values ...interface{}) error {
+	if len(values) != len(t.Columns) {
+		return fmt.Errorf("Row has %d values but the table has %d columns", len(values), len(t.Columns))
+	}
+	for i, v := range values {
+		if !t.Columns[i].Type.accepts(v) {
+			return fmt.Errorf("Value %v for column %s is not of type %s", v, t.Columns[i].Name, t.Columns[i].Type)
+		}
+	}
+	t.Rows = append(t.Rows, values)
+	return nil
+}
+
+// accepts reports whether v can be stored in a column of this type. nil is always accepted.
+func (c ColumnType) accepts(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch c {
+	case StringColumn:
+		_, ok := v.(string)
+		return ok
+	case IntegerColumn:
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return true
+		}
+	case NumberColumn:
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return true
+		}
+	case BooleanColumn:
+		_, ok := v.(bool)
+		return ok
+	case TimeColumn:
+		_, ok := v.(time.Time)
+		return ok
+	}
+	return false
+}
+
+// CSV renders the table as CSV with a header row
+func (t *Table) CSV() (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(t.columnNames()); err != nil {
+		return "", err
+	}
+	for _, row := range t.Rows {
+		if err := w.Write(t.format(row)); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// Markdown renders the table as a GitHub flavoured Markdown table. Cells are escaped with EscapeMarkdown,
+// so values can't inject markup, links or cells, and line breaks in them are kept as <br>.
+func (t *Table) Markdown() string {
+	var buf bytes.Buffer
+	names := t.columnNames()
+	for i := range names {
+		names[i] = escapeMarkdownCell(names[i])
+	}
+	buf.WriteString("| " + strings.Join(names, " | ") + " |\n")
+	buf.WriteString("|" + strings.Repeat(" --- |", len(names)) + "\n")
+	for _, row := range t.Rows {
+		cells := t.format(row)
+		for i := range cells {
+			cells[i] = escapeMarkdownCell(cells[i])
+		}
+		buf.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return buf.String()
+}
+
+func (t *Table) columnNames() []string {
+	names := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// format turns a row into strings
+func (t *Table) format(row []interface{}) []string {
+	cells := make([]string, len(row))
+	for i, v := range row {
+		cells[i] = FormatCell(v)
+	}
+	return cells
+}
+
+// FormatCell renders a single table value as text, using RFC3339 for times and an empty string for nil
+func FormatCell(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return value.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestTableRenderers(t *testing.T) {
+	table := NewTable().AddColumn("host", StringColumn).AddColumn("open ports", IntegerColumn)
+	if err := table.AddRow("web|01", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.AddRow("db01", "three"); err == nil {
+		t.Fatal("Expected a type error for a string in an integer column")
+	}
+
+	csv, err := table.CSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "host,open ports\nweb|01,3\n"; csv != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", csv, expected)
+	}
+
+	expected := "| host | open ports |\n| --- | --- |\n| web\\|01 | 3 |\n"
+	if md := table.Markdown(); md != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", md, expected)
+	}
+}
+
+func TestTableMarkdownEscapesCells(t *testing.T) {
+	table := NewTable().AddColumn("*name*", StringColumn).AddColumn("note", StringColumn)
+	table.AddRow("# web", "<img src=x>\r\n[link](http://evil.example)")
+	expected := "| \\*name\\* | note |\n| --- | --- |\n| \\# web | \\<img src=x\\><br>\\[link\\](http://evil.example) |\n"
+	if md := table.Markdown(); md != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", md, expected)
+	}
+}
@@ -0,0 +1,154 @@
+// Package aggregate collapses alert storms: events with the same key arriving within a window are grouped,
+// and emitted as one summary with their count, when the first and last were seen, and a sample, rather
+// than flooding the orchestrator's queues with thousands of alike events.
+//
+//	agg := aggregate.New(5*time.Minute, func(s aggregate.Summary) error { return t.Send(s) })
+//	defer agg.Start(ctx)()
+//	for _, alert := range alerts {
+//		agg.Add(alert.Rule+"/"+alert.Host, alert.Timestamp, alert)
+//	}
+package aggregate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// Summary is what's emitted for the events of a key in a window
+type Summary struct {
+	Key       string      `json:"key"`
+	Count     int         `json:"count"`
+	FirstSeen time.Time   `json:"first_seen"`
+	LastSeen  time.Time   `json:"last_seen"`
+	Sample    interface{} `json:"sample"` // Sample is the first event of the window
+}
+
+// Aggregator groups events by key for a window, opened by the first event of a key, and emits a Summary
+// once the window has passed. An event arriving after that opens a new window. It's safe for concurrent
+// use, but emit is called with the aggregator locked, so it mustn't call Add.
+type Aggregator struct {
+	window time.Duration
+	emit   func(Summary) error
+
+	mu     sync.Mutex
+	groups map[string]*group
+	now    func() time.Time
+}
+
+type group struct {
+	Summary
+	opened time.Time // opened is when the window's first event arrived
+}
+
+// New returns an aggregator that groups events for window before passing their summary to emit
+func New(window time.Duration, emit func(Summary) error) *Aggregator {
+	return &Aggregator{window: window, emit: emit, groups: map[string]*group{}, now: time.Now}
+}
+
+// Add adds an event seen at ts to the window of key, ts being when it arrived if it's zero
+func (a *Aggregator) Add(key string, ts time.Time, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if ts.IsZero() {
+		ts = now
+	}
+	g, ok := a.groups[key]
+	if !ok {
+		a.groups[key] = &group{
+			Summary: Summary{Key: key, Count: 1, FirstSeen: ts, LastSeen: ts, Sample: value},
+			opened:  now,
+		}
+		return
+	}
+	g.Count++
+	if ts.Before(g.FirstSeen) {
+		g.FirstSeen = ts
+	}
+	if ts.After(g.LastSeen) {
+		g.LastSeen = ts
+	}
+}
+
+// Len returns the number of windows open
+func (a *Aggregator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.groups)
+}
+
+// Flush emits the summaries of the windows that have passed, oldest first. If emit fails, the window is
+// kept and Flush returns the error.
+func (a *Aggregator) Flush() error {
+	return a.flush(false)
+}
+
+// FlushAll emits the summary of every window open, regardless of whether it's passed, ie: when shutting down
+func (a *Aggregator) FlushAll() error {
+	return a.flush(true)
+}
+
+func (a *Aggregator) flush(all bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	due := a.now().Add(-a.window)
+	var groups byOpened
+	for _, g := range a.groups {
+		if all || !g.opened.After(due) {
+			groups = append(groups, g)
+		}
+	}
+	sort.Sort(groups)
+	for _, g := range groups {
+		if err := a.emit(g.Summary); err != nil {
+			return err
+		}
+		delete(a.groups, g.Key)
+	}
+	return nil
+}
+
+// Start flushes the aggregator periodically until the returned function is called, or ctx is done, at which
+// point every window still open is emitted
+func (a *Aggregator) Start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	interval := a.window / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := utils.NewTicker(ctx, interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := a.Flush(); err != nil {
+				log.Warnf("Unable to emit aggregated events, retrying: %s", err)
+			}
+		}
+		if err := a.FlushAll(); err != nil {
+			log.Errorf("Unable to emit the last aggregated events: %s", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// byOpened orders windows by when they were opened, then key
+type byOpened []*group
+
+func (g byOpened) Len() int      { return len(g) }
+func (g byOpened) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g byOpened) Less(i, j int) bool {
+	if g[i].opened.Equal(g[j].opened) {
+		return g[i].Key < g[j].Key
+	}
+	return g[i].opened.Before(g[j].opened)
+}
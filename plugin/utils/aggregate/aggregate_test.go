@@ -0,0 +1,78 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	base := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := base
+	var emitted []Summary
+	fail := false
+	a := New(time.Minute, func(s Summary) error {
+		if fail {
+			return errors.New("dispatcher down")
+		}
+		emitted = append(emitted, s)
+		return nil
+	})
+	a.now = func() time.Time { return clock }
+
+	a.Add("brute-force/host1", base.Add(2*time.Second), "first")
+	a.Add("brute-force/host1", base.Add(1*time.Second), "second")
+	clock = clock.Add(30 * time.Second)
+	a.Add("port-scan/host2", time.Time{}, "scan")
+	a.Add("brute-force/host1", base.Add(30*time.Second), "third")
+
+	// Nothing's been open a minute yet
+	if a.Flush(); len(emitted) != 0 {
+		t.Fatalf("Expected nothing to be emitted yet, got %v", emitted)
+	}
+	clock = clock.Add(31 * time.Second)
+	fail = true
+	if err := a.Flush(); err == nil || a.Len() != 2 {
+		t.Fatalf("Expected the window to be kept when emitting fails, got %v with %d open", err, a.Len())
+	}
+	fail = false
+	a.Flush()
+	if len(emitted) != 1 {
+		t.Fatalf("Expected one summary, got %v", emitted)
+	}
+	s := emitted[0]
+	if s.Key != "brute-force/host1" || s.Count != 3 || s.Sample != "first" ||
+		!s.FirstSeen.Equal(base.Add(time.Second)) || !s.LastSeen.Equal(base.Add(30*time.Second)) {
+		t.Fatalf("Unexpected summary %+v", s)
+	}
+
+	// A later event opens a new window
+	a.Add("brute-force/host1", time.Time{}, "fourth")
+	if err := a.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 3 || emitted[1].Key != "port-scan/host2" || !emitted[1].FirstSeen.Equal(base.Add(30*time.Second)) ||
+		emitted[2].Count != 1 || emitted[2].Sample != "fourth" {
+		t.Fatalf("Unexpected summaries %+v", emitted[1:])
+	}
+}
+
+func TestStartFlushesOnStop(t *testing.T) {
+	emitted := make(chan Summary, 1)
+	a := New(time.Hour, func(s Summary) error {
+		emitted <- s
+		return nil
+	})
+	stop := a.Start(context.Background())
+	a.Add("k", time.Time{}, 1)
+	stop()
+	select {
+	case s := <-emitted:
+		if s.Count != 1 {
+			t.Fatalf("Unexpected summary %+v", s)
+		}
+	default:
+		t.Fatal("Expected the open window to be emitted on stop")
+	}
+}
@@ -0,0 +1,102 @@
+// Package bufpool pools the buffers used on hot paths, like encoding and dispatching events, so a trigger
+// sending thousands of events a second reuses a few buffers rather than allocating and collecting one for
+// every event.
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/codec"
+)
+
+// CopySize is the size of the slices GetSlice returns
+const CopySize = 32 * 1024
+
+// maxPooled is the largest buffer kept, so one huge event doesn't pin its memory for good
+const maxPooled = 1 << 20
+
+var (
+	buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	slices  = sync.Pool{New: func() interface{} {
+		b := make([]byte, CopySize)
+		return &b
+	}}
+)
+
+// Get returns an empty buffer, give it back with Put once nothing uses what's in it
+func Get() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// Put returns a buffer to the pool
+func Put(b *bytes.Buffer) {
+	if b == nil || b.Cap() > maxPooled {
+		return
+	}
+	b.Reset()
+	buffers.Put(b)
+}
+
+// GetSlice returns a slice of CopySize bytes, give it back with PutSlice. It's a pointer, as putting a
+// slice itself in a pool allocates.
+func GetSlice() *[]byte {
+	return slices.Get().(*[]byte)
+}
+
+// PutSlice returns a slice to the pool
+func PutSlice(b *[]byte) {
+	if b == nil || len(*b) != CopySize {
+		return
+	}
+	slices.Put(b)
+}
+
+// Copy is io.Copy with a pooled buffer
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	b := GetSlice()
+	defer PutSlice(b)
+	return io.CopyBuffer(dst, src, *b)
+}
+
+// Marshal encodes v as JSON with the current codec, like json.Marshal, into a pooled buffer. Put the buffer
+// back once it's written.
+func Marshal(v interface{}) (*bytes.Buffer, error) {
+	b := Get()
+	if err := codec.Current().NewEncoder(b).Encode(v); err != nil {
+		Put(b)
+		return nil, err
+	}
+	// json.Marshal doesn't end with a newline
+	b.Truncate(b.Len() - 1)
+	return b, nil
+}
+
+// ReadAll reads r to the end, growing a pooled buffer rather than a new slice, and returns a copy of
+// exactly what was read
+func ReadAll(r io.Reader) ([]byte, error) {
+	b := Get()
+	defer Put(b)
+	_, err := b.ReadFrom(r)
+	return append([]byte(nil), b.Bytes()...), err
+}
+
+// Body is a request body that returns its buffer to the pool when it's closed, which the http package
+// does once it's sent
+type Body struct {
+	*bytes.Reader
+	once sync.Once
+	buf  *bytes.Buffer
+}
+
+// NewBody returns a request body reading b, which it puts back in the pool when closed
+func NewBody(b *bytes.Buffer) *Body {
+	return &Body{Reader: bytes.NewReader(b.Bytes()), buf: b}
+}
+
+// Close implements io.Closer
+func (b *Body) Close() error {
+	b.once.Do(func() { Put(b.buf) })
+	return nil
+}
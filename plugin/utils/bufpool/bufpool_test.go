@@ -0,0 +1,96 @@
+package bufpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type event struct {
+	ID       string            `json:"id"`
+	Severity int               `json:"severity"`
+	Tags     []string          `json:"tags"`
+	Fields   map[string]string `json:"fields"`
+}
+
+var sample = event{
+	ID:       "4f2c6a",
+	Severity: 3,
+	Tags:     []string{"malware", "endpoint"},
+	Fields:   map[string]string{"host": "ws-042", "user": "bob", "path": "C:\\Users\\bob\\a.exe", "html": "<b>"},
+}
+
+func TestMarshalMatchesEncodingJSON(t *testing.T) {
+	expected, _ := json.Marshal(sample)
+	b, err := Marshal(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Put(b)
+	if !bytes.Equal(b.Bytes(), expected) {
+		t.Errorf("Expected %s, got %s", expected, b.Bytes())
+	}
+	if _, err = Marshal(func() {}); err == nil {
+		t.Error("Expected a function to fail to marshal")
+	}
+}
+
+func TestLargeBuffersAreNotKept(t *testing.T) {
+	b := Get()
+	b.Grow(2 * maxPooled)
+	Put(b)
+	for i := 0; i < 10; i++ {
+		if got := Get(); got.Cap() > maxPooled {
+			t.Fatal("Expected a buffer over the limit to be dropped")
+		}
+	}
+}
+
+func TestBodyIsReturnedOnce(t *testing.T) {
+	b := Get()
+	b.WriteString("payload")
+	body := NewBody(b)
+	if data, _ := ioutil.ReadAll(body); string(data) != "payload" {
+		t.Fatalf("Unexpected body %q", data)
+	}
+	body.Close()
+	body.Close()
+	if data, _ := ReadAll(strings.NewReader("again")); string(data) != "again" {
+		t.Errorf("Unexpected read %q", data)
+	}
+}
+
+func BenchmarkJSONMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := json.Marshal(sample)
+		ioutil.Discard.Write(data)
+	}
+}
+
+func BenchmarkPooledMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := Marshal(sample)
+		ioutil.Discard.Write(buf.Bytes())
+		Put(buf)
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ioutil.ReadAll(bytes.NewReader(data))
+	}
+}
+
+func BenchmarkPooledReadAll(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ReadAll(bytes.NewReader(data))
+	}
+}
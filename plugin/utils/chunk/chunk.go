@@ -0,0 +1,206 @@
+// Package chunk hashes, splits and reassembles large files in chunks, streaming rather than loading them,
+// for plugins uploading to services with a per request size limit, ie: sandboxes taking samples in parts.
+// Splitting produces a Manifest describing the chunks, which is all that's needed to put them back together
+// and check nothing was lost or changed on the way:
+//
+//	manifest, err := chunk.SplitFile(path, 32*utils.MiB, func(c chunk.Chunk, r io.Reader) error {
+//		return upload(sampleID, c.Index, c.SHA256, r)
+//	})
+package chunk
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Digests are the hashes of a whole file, the ones threat intelligence services look files up by
+type Digests struct {
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+}
+
+// Chunk is a part of a file
+type Chunk struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a file split into chunks
+type Manifest struct {
+	Name      string `json:"name,omitempty"`
+	ChunkSize int64  `json:"chunk_size"`
+	Digests
+	Chunks []Chunk `json:"chunks"`
+}
+
+// ChecksumError is returned by Join when a chunk, or the file reassembled, doesn't match its manifest.
+// Chunk is -1 for the whole file.
+type ChecksumError struct {
+	Chunk    int
+	Expected string
+	Actual   string
+}
+
+// Error implements error
+func (e *ChecksumError) Error() string {
+	if e.Chunk < 0 {
+		return fmt.Sprintf("The reassembled file has SHA256 %s, expected %s", e.Actual, e.Expected)
+	}
+	return fmt.Sprintf("Chunk %d has SHA256 %s, expected %s", e.Chunk, e.Actual, e.Expected)
+}
+
+// Hash returns the digests of everything r reads
+func Hash(r io.Reader) (Digests, error) {
+	h := newHasher()
+	_, err := io.Copy(h, r)
+	return h.digests(), err
+}
+
+// HashFile returns the digests of the file at path
+func HashFile(path string) (Digests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Digests{}, err
+	}
+	defer f.Close()
+	return Hash(f)
+}
+
+// Split reads size bytes of r in chunks of chunkSize, calling fn with each chunk and a reader of it, in
+// order. The chunks are hashed before fn is called, so fn can send a chunk's hash along with it. It
+// returns the manifest of the chunks, or the first error fn returns.
+func Split(r io.ReaderAt, size, chunkSize int64, fn func(Chunk, io.Reader) error) (*Manifest, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("The chunk size has to be positive")
+	}
+	m := &Manifest{ChunkSize: chunkSize}
+	whole := newHasher()
+	for offset, index := int64(0), 0; offset < size || index == 0; index++ {
+		c := Chunk{Index: index, Offset: offset, Size: chunkSize}
+		if offset+c.Size > size {
+			c.Size = size - offset
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(h, whole), io.NewSectionReader(r, c.Offset, c.Size))
+		if err != nil {
+			return nil, err
+		}
+		if n != c.Size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		c.SHA256 = hex.EncodeToString(h.Sum(nil))
+		if err = fn(c, io.NewSectionReader(r, c.Offset, c.Size)); err != nil {
+			return nil, err
+		}
+		m.Chunks = append(m.Chunks, c)
+		offset += c.Size
+	}
+	m.Digests = whole.digests()
+	return m, nil
+}
+
+// SplitFile splits the file at path like Split, naming the manifest after the file
+func SplitFile(path string, chunkSize int64, fn func(Chunk, io.Reader) error) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m, err := Split(f, info.Size(), chunkSize, fn)
+	if err != nil {
+		return nil, err
+	}
+	m.Name = filepath.Base(path)
+	return m, nil
+}
+
+// Carve copies length bytes of the file at path from offset to w, ie: to pull an embedded payload out of a
+// sample, and returns their digests. It returns io.ErrUnexpectedEOF if the file ends first.
+func Carve(path string, offset, length int64, w io.Writer) (Digests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Digests{}, err
+	}
+	defer f.Close()
+	h := newHasher()
+	n, err := io.Copy(io.MultiWriter(w, h), io.NewSectionReader(f, offset, length))
+	if err == nil && n != length {
+		err = io.ErrUnexpectedEOF
+	}
+	return h.digests(), err
+}
+
+// Join writes the chunks of the manifest to w in order, opening each with open, and checks each chunk and
+// the whole file against the manifest. On a ChecksumError, what was written to w is incomplete or wrong.
+func Join(m *Manifest, w io.Writer, open func(Chunk) (io.ReadCloser, error)) error {
+	whole := newHasher()
+	for _, c := range m.Chunks {
+		if err := joinChunk(c, io.MultiWriter(w, whole), open); err != nil {
+			return err
+		}
+	}
+	if d := whole.digests(); d.Size != m.Size || d.SHA256 != m.SHA256 {
+		return &ChecksumError{Chunk: -1, Expected: m.SHA256, Actual: d.SHA256}
+	}
+	return nil
+}
+
+func joinChunk(c Chunk, w io.Writer, open func(Chunk) (io.ReadCloser, error)) error {
+	r, err := open(c)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	// one byte more than the chunk should hold, so a chunk that's too long fails its checksum
+	if _, err = io.Copy(io.MultiWriter(w, h), io.LimitReader(r, c.Size+1)); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != c.SHA256 {
+		return &ChecksumError{Chunk: c.Index, Expected: c.SHA256, Actual: sum}
+	}
+	return nil
+}
+
+// hasher computes all the Digests in one pass
+type hasher struct {
+	io.Writer
+	size              int64
+	md5, sha1, sha256 hash.Hash
+}
+
+func newHasher() *hasher {
+	h := &hasher{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+	h.Writer = io.MultiWriter(h.md5, h.sha1, h.sha256)
+	return h
+}
+
+func (h *hasher) Write(p []byte) (int, error) {
+	h.size += int64(len(p))
+	return h.Writer.Write(p)
+}
+
+func (h *hasher) digests() Digests {
+	return Digests{
+		Size:   h.size,
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
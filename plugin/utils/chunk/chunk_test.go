@@ -0,0 +1,70 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitAndJoin(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 25)
+	chunks := map[int][]byte{}
+	m, err := Split(bytes.NewReader(content), int64(len(content)), 100, func(c Chunk, r io.Reader) error {
+		b, err := ioutil.ReadAll(r)
+		chunks[c.Index] = b
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Chunks) != 3 || m.Chunks[2].Offset != 200 || m.Chunks[2].Size != 50 || len(chunks[2]) != 50 {
+		t.Fatalf("Expected chunks of 100, 100 and 50 bytes, got %+v", m.Chunks)
+	}
+	whole, _ := Hash(bytes.NewReader(content))
+	if m.Digests != whole {
+		t.Errorf("Expected the manifest digests %+v, got %+v", whole, m.Digests)
+	}
+
+	open := func(c Chunk) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(chunks[c.Index])), nil
+	}
+	var out bytes.Buffer
+	if err = Join(m, &out, open); err != nil || !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("Expected the file reassembled, got %v", err)
+	}
+
+	chunks[1] = append([]byte("x"), chunks[1][1:]...)
+	err = Join(m, ioutil.Discard, open)
+	if e, ok := err.(*ChecksumError); !ok || e.Chunk != 1 {
+		t.Errorf("Expected the changed chunk to fail its checksum, got %v", err)
+	}
+}
+
+func TestSplitFileAndCarve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sample.bin")
+	if err = ioutil.WriteFile(path, []byte("headerPAYLOADtrailer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := SplitFile(path, 8, func(Chunk, io.Reader) error { return nil })
+	if err != nil || m.Name != "sample.bin" || len(m.Chunks) != 3 || m.Size != 20 {
+		t.Fatalf("Unexpected manifest %+v %v", m, err)
+	}
+
+	var payload bytes.Buffer
+	d, err := Carve(path, 6, 7, &payload)
+	if err != nil || payload.String() != "PAYLOAD" || d.Size != 7 {
+		t.Errorf("Expected to carve out PAYLOAD, got %q %+v %v", payload.String(), d, err)
+	}
+	if _, err = Carve(path, 15, 10, ioutil.Discard); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected carving past the end to fail, got %v", err)
+	}
+}
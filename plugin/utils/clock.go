@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clockJump is how far a new offset sample has to be from the estimate to be taken as the remote clock
+// being reset, rather than noise
+const clockJump = time.Minute
+
+// SkewClock compares local time with timestamps from a remote API, allowing for the two clocks drifting
+// apart. It estimates the remote clock's offset from the Date headers of its responses, and treats
+// timestamps within Tolerance of each other as equal. Triggers that poll for events since a cursor use
+// Since and Until to build the window, so an event stamped by a clock behind the container's isn't missed.
+// It's safe for concurrent use.
+type SkewClock struct {
+	Tolerance time.Duration
+
+	mu       sync.Mutex
+	offset   time.Duration
+	observed bool
+	now      func() time.Time
+}
+
+// NewSkewClock returns a SkewClock treating timestamps within tolerance of each other as equal
+func NewSkewClock(tolerance time.Duration) *SkewClock {
+	return &SkewClock{Tolerance: tolerance}
+}
+
+// Observe updates the offset estimate from the Date header of a response from the remote API, and
+// returns false if it didn't have one
+func (c *SkewClock) Observe(resp *http.Response) bool {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	// Date is truncated to the second, so on average it's half a second behind
+	c.ObserveTime(date.Add(500*time.Millisecond), c.localNow())
+	return true
+}
+
+// ObserveTime updates the offset estimate from the remote clock reading remote at local time at
+func (c *SkewClock) ObserveTime(remote, at time.Time) {
+	sample := remote.Sub(at)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	diff := sample - c.offset
+	if !c.observed || diff > clockJump || diff < -clockJump {
+		c.offset = sample
+		c.observed = true
+		return
+	}
+	// Smooth the noise of network latency and second resolution dates out
+	c.offset += diff / 4
+}
+
+// Offset returns how far the remote clock is ahead of the local one, negative if it's behind
+func (c *SkewClock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// RemoteNow returns the current time by the remote clock
+func (c *SkewClock) RemoteNow() time.Time {
+	return c.ToRemote(c.localNow())
+}
+
+// ToRemote converts a local time to the remote clock
+func (c *SkewClock) ToRemote(local time.Time) time.Time {
+	return local.Add(c.Offset())
+}
+
+// ToLocal converts a remote time to the local clock
+func (c *SkewClock) ToLocal(remote time.Time) time.Time {
+	return remote.Add(-c.Offset())
+}
+
+// Equal returns whether two times are within the tolerance of each other
+func (c *SkewClock) Equal(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d <= c.Tolerance && d >= -c.Tolerance
+}
+
+// Before returns whether a is before b by more than the tolerance
+func (c *SkewClock) Before(a, b time.Time) bool {
+	return b.Sub(a) > c.Tolerance
+}
+
+// After returns whether a is after b by more than the tolerance
+func (c *SkewClock) After(a, b time.Time) bool {
+	return a.Sub(b) > c.Tolerance
+}
+
+// Since returns where a poll for events after cursor, a remote timestamp, should start: the tolerance
+// before it, so events that arrive stamped slightly in the past are still picked up. Expect to see the
+// events just before the cursor again, and deduplicate them.
+func (c *SkewClock) Since(cursor time.Time) time.Time {
+	return cursor.Add(-c.Tolerance)
+}
+
+// Until returns where a poll for events should end, the tolerance before now by the remote clock, as
+// events in the last moments may still be being written
+func (c *SkewClock) Until() time.Time {
+	return c.RemoteNow().Add(-c.Tolerance)
+}
+
+func (c *SkewClock) localNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
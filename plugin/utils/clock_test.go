@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSkewClock(t *testing.T) {
+	local := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewSkewClock(2 * time.Second)
+	c.now = func() time.Time { return local }
+
+	// The remote clock is 30 seconds ahead of ours
+	resp := &http.Response{Header: http.Header{"Date": {local.Add(30 * time.Second).Format(http.TimeFormat)}}}
+	if !c.Observe(resp) {
+		t.Fatal("Expected the Date header to be observed")
+	}
+	if off := c.Offset(); off != 30500*time.Millisecond {
+		t.Errorf("Expected an offset of 30.5s, got %s", off)
+	}
+	// Later samples are smoothed, unless the clock jumped
+	c.ObserveTime(local.Add(31500*time.Millisecond), local)
+	if off := c.Offset(); off != 30750*time.Millisecond {
+		t.Errorf("Expected a smoothed offset of 30.75s, got %s", off)
+	}
+	c.ObserveTime(local.Add(-time.Hour), local)
+	if off := c.Offset(); off != -time.Hour {
+		t.Errorf("Expected the estimate to reset after a jump, got %s", off)
+	}
+	c.ObserveTime(local.Add(30*time.Second), local)
+
+	if got := c.Until(); !got.Equal(local.Add(28 * time.Second)) {
+		t.Errorf("Unexpected end of poll window %s", got)
+	}
+	cursor := local.Add(10 * time.Second)
+	if got := c.Since(cursor); !got.Equal(local.Add(8 * time.Second)) {
+		t.Errorf("Unexpected start of poll window %s", got)
+	}
+	if !c.Equal(cursor, cursor.Add(time.Second)) || c.Before(cursor, cursor.Add(time.Second)) || !c.After(cursor.Add(3*time.Second), cursor) {
+		t.Error("Expected comparisons to allow for the tolerance")
+	}
+	if resp.Header.Del("Date"); c.Observe(resp) {
+		t.Error("Expected a response without a Date not to be observed")
+	}
+}
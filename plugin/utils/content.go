@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a reader DetectContentType looks at. It's more than net/http's 512 bytes, so the
+// entry names that tell office documents from other zip archives are usually in it.
+const sniffLen = 16 * KiB
+
+// Content types detected beyond those net/http.DetectContentType knows
+const (
+	ContentTypeDOCX        = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	ContentTypeXLSX        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	ContentTypePPTX        = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	ContentTypeOLE         = "application/vnd.ms-office" // ContentTypeOLE is a legacy office document or installer, ie: .doc, .xls, .msi
+	ContentTypeJAR         = "application/java-archive"
+	ContentTypeAPK         = "application/vnd.android.package-archive"
+	ContentTypeZip         = "application/zip"
+	ContentTypeGzip        = "application/gzip"
+	ContentTypeBzip2       = "application/x-bzip2"
+	ContentTypeXZ          = "application/x-xz"
+	ContentTypeZstd        = "application/zstd"
+	ContentType7z          = "application/x-7z-compressed"
+	ContentTypeRAR         = "application/vnd.rar"
+	ContentTypeTar         = "application/x-tar"
+	ContentTypeCAB         = "application/vnd.ms-cab-compressed"
+	ContentTypePE          = "application/vnd.microsoft.portable-executable"
+	ContentTypeELF         = "application/x-executable"
+	ContentTypeMachO       = "application/x-mach-binary"
+	ContentTypeJavaClass   = "application/java-vm"
+	ContentTypeRTF         = "application/rtf"
+	ContentTypeScript      = "text/x-shellscript"
+	ContentTypeOctetStream = "application/octet-stream"
+)
+
+// magic is a signature at a fixed offset
+type magic struct {
+	offset      int
+	signature   string
+	contentType string
+}
+
+// magics are checked in order, before falling back to net/http
+var magics = []magic{
+	{0, "PK\x03\x04", ContentTypeZip},
+	{0, "PK\x05\x06", ContentTypeZip}, // an empty archive
+	{0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", ContentTypeOLE},
+	{0, "MZ", ContentTypePE},
+	{0, "\x7FELF", ContentTypeELF},
+	{0, "\xFE\xED\xFA\xCE", ContentTypeMachO},
+	{0, "\xFE\xED\xFA\xCF", ContentTypeMachO},
+	{0, "\xCE\xFA\xED\xFE", ContentTypeMachO},
+	{0, "\xCF\xFA\xED\xFE", ContentTypeMachO},
+	{0, "\x1F\x8B", ContentTypeGzip},
+	{0, "BZh", ContentTypeBzip2},
+	{0, "\xFD7zXZ\x00", ContentTypeXZ},
+	{0, "\x28\xB5\x2F\xFD", ContentTypeZstd},
+	{0, "7z\xBC\xAF\x27\x1C", ContentType7z},
+	{0, "Rar!\x1A\x07", ContentTypeRAR},
+	{0, "MSCF", ContentTypeCAB},
+	{0, "{\\rtf", ContentTypeRTF},
+	{0, "#!", ContentTypeScript},
+	{257, "ustar", ContentTypeTar},
+}
+
+// zipEntries tell archives apart by the names of their entries
+var zipEntries = []struct {
+	prefix      string
+	contentType string
+}{
+	{"word/", ContentTypeDOCX},
+	{"xl/", ContentTypeXLSX},
+	{"ppt/", ContentTypePPTX},
+	{"AndroidManifest.xml", ContentTypeAPK},
+	{"META-INF/MANIFEST.MF", ContentTypeJAR},
+}
+
+// DetectContentType detects the content type of what r reads, by its magic number. It tells apart the
+// archives, office documents and executables net/http.DetectContentType doesn't, and falls back to it for
+// everything else. The reader returned reads all of r, including what was read to detect the type.
+func DetectContentType(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return detectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// DetectFileContentType detects the content type of the file at path like DetectContentType. Zip archives
+// are told apart by their central directory, which is more reliable than the start of the file.
+func DetectFileContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	contentType, _, err := DetectContentType(f)
+	if err != nil || contentType != ContentTypeZip {
+		return contentType, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	archive, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		// a damaged archive is still an archive
+		return contentType, nil
+	}
+	for _, file := range archive.File {
+		if t := zipEntryType(file.Name); t != "" {
+			return t, nil
+		}
+	}
+	return contentType, nil
+}
+
+func detectContentType(head []byte) string {
+	for _, m := range magics {
+		if len(head) >= m.offset+len(m.signature) && string(head[m.offset:m.offset+len(m.signature)]) == m.signature {
+			switch m.contentType {
+			case ContentTypeZip:
+				return zipContentType(head)
+			case ContentTypePE:
+				if !isPE(head) {
+					continue
+				}
+			}
+			return m.contentType
+		}
+	}
+	// 0xCAFEBABE starts both Java classes and universal Mach-O binaries, which have few architectures where
+	// classes have a version of at least 45
+	if len(head) >= 8 && string(head[:4]) == "\xCA\xFE\xBA\xBE" {
+		if binary.BigEndian.Uint32(head[4:8]) < 20 {
+			return ContentTypeMachO
+		}
+		return ContentTypeJavaClass
+	}
+	return http.DetectContentType(head)
+}
+
+// zipContentType looks for the entries, or the OpenDocument mimetype entry, in the start of an archive
+func zipContentType(head []byte) string {
+	// OpenDocument files start with an uncompressed entry named mimetype holding their type
+	if len(head) > 38 && string(head[30:38]) == "mimetype" {
+		rest := head[38:]
+		if end := bytes.Index(rest, []byte("PK\x03\x04")); end > 0 {
+			if t := string(rest[:end]); strings.HasPrefix(t, "application/vnd.oasis.opendocument.") {
+				return t
+			}
+		}
+	}
+	for _, entry := range zipEntries {
+		if bytes.Contains(head, []byte(entry.prefix)) {
+			return entry.contentType
+		}
+	}
+	return ContentTypeZip
+}
+
+func zipEntryType(name string) string {
+	for _, entry := range zipEntries {
+		if strings.HasPrefix(name, entry.prefix) {
+			return entry.contentType
+		}
+	}
+	return ""
+}
+
+// isPE checks the DOS header of an executable points at a PE header, as plenty of text starts with "MZ"
+func isPE(head []byte) bool {
+	if len(head) < 0x40 {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(head[0x3C:0x40]))
+	if offset+4 > len(head) {
+		// the header is further in than was read, trust the DOS header
+		return offset < 64*KiB
+	}
+	return string(head[offset:offset+4]) == "PE\x00\x00"
+}
+
+// ContentTypeError is returned by ValidateContentType for a content type that isn't allowed
+type ContentTypeError struct {
+	ContentType string
+	Allowed     []string
+}
+
+// Error implements error
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("Content type %s isn't allowed, expected one of %s", e.ContentType, strings.Join(e.Allowed, ", "))
+}
+
+// ValidateContentType returns a ContentTypeError unless contentType is one of allowed. Parameters, such as
+// the charset, are ignored, and an allowed type may end in /* to allow all the subtypes of a type, ie:
+// image/*.
+func ValidateContentType(contentType string, allowed ...string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	mediaType = strings.ToLower(mediaType)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == mediaType || a == "*/*" || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1])) {
+			return nil
+		}
+	}
+	return &ContentTypeError{ContentType: contentType, Allowed: allowed}
+}
+
+// RequireContentType detects the content type of r and validates it's one of allowed, returning a reader
+// of all of r if it is, ie: before uploading a file to a sandbox that only accepts documents
+func RequireContentType(r io.Reader, allowed ...string) (io.Reader, error) {
+	contentType, r, err := DetectContentType(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateContentType(contentType, allowed...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func zipWith(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(strings.Repeat("x", 100)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("hello"))
+	gw.Close()
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0600, Size: 1})
+	tw.Write([]byte("a"))
+	tw.Close()
+	pe := make([]byte, 0x84)
+	copy(pe, "MZ")
+	pe[0x3C] = 0x80
+	copy(pe[0x80:], "PE\x00\x00")
+
+	cases := map[string][]byte{
+		ContentTypeDOCX:             zipWith(t, "[Content_Types].xml", "_rels/.rels", "word/document.xml"),
+		ContentTypeXLSX:             zipWith(t, "[Content_Types].xml", "xl/workbook.xml"),
+		ContentTypeJAR:              zipWith(t, "META-INF/MANIFEST.MF", "Main.class"),
+		ContentTypeZip:              zipWith(t, "notes.txt"),
+		ContentTypeGzip:             gz.Bytes(),
+		ContentTypeTar:              tarball.Bytes(),
+		ContentTypePE:               pe,
+		ContentTypeELF:              []byte("\x7FELF\x02\x01\x01\x00"),
+		ContentTypeJavaClass:        []byte("\xCA\xFE\xBA\xBE\x00\x00\x00\x34"),
+		ContentTypeOLE:              []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00\x00"),
+		ContentTypeScript:           []byte("#!/bin/sh\necho hi\n"),
+		"text/plain; charset=utf-8": []byte("MZ is how this sentence starts, it isn't an executable"),
+	}
+	for expected, content := range cases {
+		contentType, r, err := DetectContentType(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != expected {
+			t.Errorf("Expected %s but got %s", expected, contentType)
+		}
+		if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, content) {
+			t.Errorf("Expected the reader to read all of the %s", expected)
+		}
+	}
+}
+
+func TestDetectFileContentTypeReadsTheCentralDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the entry that gives the type away is past what's sniffed
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.CreateHeader(&zip.FileHeader{Name: "[Content_Types].xml", Method: zip.Store})
+	f.Write(bytes.Repeat([]byte("x"), 2*sniffLen))
+	w.Create("ppt/presentation.xml")
+	w.Close()
+	path := filepath.Join(dir, "deck")
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if contentType, err := DetectFileContentType(path); err != nil || contentType != ContentTypePPTX {
+		t.Errorf("Expected %s but got %s %v", ContentTypePPTX, contentType, err)
+	}
+}
+
+func TestValidateContentType(t *testing.T) {
+	if err := ValidateContentType("image/png", "application/pdf", "image/*"); err != nil {
+		t.Errorf("Expected image/* to allow image/png, got %s", err)
+	}
+	if err := ValidateContentType("text/plain; charset=utf-8", "TEXT/PLAIN"); err != nil {
+		t.Errorf("Expected the charset to be ignored, got %s", err)
+	}
+	if _, ok := ValidateContentType(ContentTypePE, "application/pdf", ContentTypeDOCX).(*ContentTypeError); !ok {
+		t.Error("Expected an executable to be refused")
+	}
+	if _, err := RequireContentType(bytes.NewReader([]byte("\x7FELF\x02")), "application/pdf"); err == nil {
+		t.Error("Expected RequireContentType to refuse an executable")
+	}
+}
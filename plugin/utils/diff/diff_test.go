@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\n"
+	b := "one\n2\nthree\nfour\nfive\n"
+	expected := "--- old\n+++ new\n@@ -1,4 +1,5 @@\n one\n-two\n+2\n three\n four\n+five\n"
+	if d := Unified("old", "new", a, b, 3); d != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", d, expected)
+	}
+	if d := Unified("old", "new", a, a, 3); d != "" {
+		t.Fatalf("Expected no diff for identical input, got:\n%s", d)
+	}
+}
+
+func TestUnifiedNoNewlineAtEnd(t *testing.T) {
+	expected := "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n"
+	if d := Unified("a", "b", "x", "x\n", 3); d != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", d, expected)
+	}
+	expected = "--- a\n+++ b\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n\\ No newline at end of file\n"
+	if d := Unified("a", "b", "one\ntwo\n", "one\n2", 3); d != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", d, expected)
+	}
+	if d := Unified("a", "b", "x", "x", 3); d != "" {
+		t.Fatalf("Expected no diff for identical input, got:\n%s", d)
+	}
+}
+
+// lcs is the length of the longest common subsequence of a and b, by dynamic programming
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestMyersIsShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		l := make([]string, r.Intn(30))
+		for i := range l {
+			l[i] = string('a' + rune(r.Intn(4)))
+		}
+		return l
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := lines(), lines()
+		edits := myers(a, b)
+		var got []string
+		changes, x := 0, 0
+		for _, e := range edits {
+			switch e.kind {
+			case equalOp:
+				if e.a != x || a[e.a] != b[e.b] || e.b != len(got) {
+					t.Fatalf("Bad equal edit %+v diffing %v and %v", e, a, b)
+				}
+				got = append(got, a[e.a])
+				x++
+			case deleteOp:
+				if e.a != x || e.b != len(got) {
+					t.Fatalf("Bad delete %+v diffing %v and %v", e, a, b)
+				}
+				x++
+				changes++
+			case insertOp:
+				if e.a != x || e.b != len(got) {
+					t.Fatalf("Bad insert %+v diffing %v and %v", e, a, b)
+				}
+				got = append(got, b[e.b])
+				changes++
+			}
+		}
+		if x != len(a) || strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("Edits of %v don't make %v: %+v", a, b, edits)
+		}
+		if shortest := len(a) + len(b) - 2*lcs(a, b); changes != shortest {
+			t.Fatalf("Expected %d changes diffing %v and %v, got %d", shortest, a, b, changes)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	changes, err := JSON(
+		[]byte(`{"name":"fw1","rules":[{"port":22},{"port":80}],"enabled":true}`),
+		[]byte(`{"name":"fw1","rules":[{"port":2222}],"owner":"bob"}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Path: "enabled", Type: Removed, Old: true},
+		{Path: "owner", Type: Added, New: "bob"},
+		{Path: "rules[0].port", Type: Changed, Old: float64(22), New: float64(2222)},
+		{Path: "rules[1]", Type: Removed, Old: map[string]interface{}{"port": float64(80)}},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes but got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i := range expected {
+		if changes[i].Path != expected[i].Path || changes[i].Type != expected[i].Type {
+			t.Fatalf("Expected %+v but got %+v", expected[i], changes[i])
+		}
+	}
+}
+
+func TestJSONPathsQuoteAmbiguousKeys(t *testing.T) {
+	changes, err := JSON(
+		[]byte(`{"a":{"b":1},"a.b":1,"labels":{"x[0]":1,"":1}}`),
+		[]byte(`{"a":{"b":2},"a.b":2,"labels":{"x[0]":2,"":2}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.b", `["a.b"]`, `labels[""]`, `labels["x[0]"]`}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes but got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, path := range expected {
+		if changes[i].Path != path {
+			t.Errorf("Expected path %s but got %s", path, changes[i].Path)
+		}
+	}
+}
+
+func TestValuesThatCantBeMarshaled(t *testing.T) {
+	if _, err := Values(map[string]float64{"score": math.NaN()}, nil); err == nil {
+		t.Fatal("Expected NaN to be refused")
+	}
+	if _, err := Values(nil, make(chan int)); err == nil {
+		t.Fatal("Expected a channel to be refused")
+	}
+}
@@ -0,0 +1,139 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeType says what happened to a value
+type ChangeType string
+
+// Types of changes between two JSON documents
+const (
+	Added   = ChangeType("added")
+	Removed = ChangeType("removed")
+	Changed = ChangeType("changed")
+)
+
+// Change is a single difference between two JSON documents. Path uses dots for object keys and
+// brackets for array indexes, ie: "hosts[2].ports". Keys that are empty or hold '.', '[', ']' or '"'
+// are quoted in brackets instead, ie: `labels["app.kubernetes.io/name"]`, so every path names one
+// value. The root of the document has an empty path.
+type Change struct {
+	Path string      `json:"path"`
+	Type ChangeType  `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// JSON compares two JSON documents and returns their differences ordered by path
+func JSON(a, b []byte) ([]Change, error) {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return nil, fmt.Errorf("Unable to parse the first document: %s", err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return nil, fmt.Errorf("Unable to parse the second document: %s", err)
+	}
+	return compare("", av, bv, nil), nil
+}
+
+// Values compares two values as they would be marshaled to JSON, ie: structs are compared by their
+// JSON fields. It returns an error if either can't be marshaled, ie: holds a NaN or a channel.
+func Values(a, b interface{}) ([]Change, error) {
+	av, err := normalize(a)
+	if err != nil {
+		return nil, err
+	}
+	bv, err := normalize(b)
+	if err != nil {
+		return nil, err
+	}
+	return compare("", av, bv, nil), nil
+}
+
+// normalize round trips v through JSON so structs, typed maps and numbers compare uniformly
+func normalize(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to compare %T: %s", v, err)
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+func compare(path string, a, b interface{}, changes []Change) []Change {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := keyPath(path, k)
+			aChild, inA := av[k]
+			bChild, inB := bv[k]
+			switch {
+			case !inA:
+				changes = append(changes, Change{Path: child, Type: Added, New: bChild})
+			case !inB:
+				changes = append(changes, Change{Path: child, Type: Removed, Old: aChild})
+			default:
+				changes = compare(child, aChild, bChild, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(av):
+				changes = append(changes, Change{Path: child, Type: Added, New: bv[i]})
+			case i >= len(bv):
+				changes = append(changes, Change{Path: child, Type: Removed, Old: av[i]})
+			default:
+				changes = compare(child, av[i], bv[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		changes = append(changes, Change{Path: path, Type: Changed, Old: a, New: b})
+	}
+	return changes
+}
+
+// keyPath is the path of key k of the object at path
+func keyPath(path, k string) string {
+	switch {
+	case k == "" || strings.ContainsAny(k, `.[]"`):
+		return path + "[" + strconv.Quote(k) + "]"
+	case path == "":
+		return k
+	default:
+		return path + "." + k
+	}
+}
@@ -0,0 +1,271 @@
+// Package diff compares two inputs, either as lines of text rendered as a unified diff, or as JSON
+// documents reported as a list of structured changes. It's meant for change-detection triggers and
+// configuration-audit actions that need to tell a user what changed, not just that something did.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type opKind int
+
+const (
+	equalOp opKind = iota
+	deleteOp
+	insertOp
+)
+
+type edit struct {
+	kind opKind
+	a, b int // line indexes in a and b
+}
+
+// noNewline follows a last line that has no newline after it, as diff and patch write it. Being part of
+// the line, it also tells "x" from "x\n".
+const noNewline = "\n\\ No newline at end of file"
+
+// Unified returns a unified diff of a and b with the given number of context lines, named
+// aName and bName in the header. It returns an empty string if the inputs are identical.
+func Unified(aName, bName, a, b string, context int) string {
+	aLines, bLines := splitLines(a), splitLines(b)
+	edits := myers(aLines, bLines)
+
+	changed := false
+	for _, e := range edits {
+		if e.kind != equalOp {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks(edits, context) {
+		writeHunk(&buf, h, aLines, bLines)
+	}
+	return buf.String()
+}
+
+// splitLines splits on newlines, dropping the empty string after a trailing newline or marking the last
+// line with noNewline if there isn't one
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += noNewline
+	}
+	return lines
+}
+
+// myers computes a shortest edit script between a and b (Myers 1986) in linear space: rather than keep
+// every round's furthest reaching paths to backtrack through, it finds the middle snake of a shortest
+// path searching from both ends at once, then diffs either side of it in turn
+func myers(a, b []string) []edit {
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{a: a, b: b, forward: make([]int, size), backward: make([]int, size), offset: size / 2}
+	d.diff(0, len(a), 0, len(b))
+	return deletesFirst(d.edits)
+}
+
+// differ is the state of a linear space diff: the furthest reaching x of each diagonal, searching
+// forward from the start and backward from the end of the ranges diffed, shared between them
+type differ struct {
+	a, b              []string
+	forward, backward []int
+	offset            int // offset is the index of diagonal 0 in forward and backward
+	edits             []edit
+}
+
+// diff appends the edits turning a[aLo:aHi] into b[bLo:bHi]
+func (d *differ) diff(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{kind: equalOp, a: aLo, b: bLo})
+		aLo++
+		bLo++
+	}
+	aEnd := aHi
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.edits = append(d.edits, edit{kind: insertOp, a: aLo, b: y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.edits = append(d.edits, edit{kind: deleteOp, a: x, b: bLo})
+		}
+	default:
+		x0, y0, x1, y1 := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.diff(aLo, x0, bLo, y0)
+		for x, y := x0, y0; x < x1; x, y = x+1, y+1 {
+			d.edits = append(d.edits, edit{kind: equalOp, a: x, b: y})
+		}
+		d.diff(x1, aHi, y1, bHi)
+	}
+	for x, y := aHi, bHi; x < aEnd; x, y = x+1, y+1 {
+		d.edits = append(d.edits, edit{kind: equalOp, a: x, b: y})
+	}
+}
+
+// middleSnake returns the run of equal lines from (x0, y0) to (x1, y1) that the middle of a shortest
+// path from (aLo, bLo) to (aHi, bHi) follows. The ranges must neither be empty nor start or end equal.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x0, y0, x1, y1 int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	f, r, o := d.forward, d.backward, d.offset
+	f[o+1], r[o+1] = 0, 0
+	for D := 0; D <= (n+m+1)/2; D++ {
+		// forward, along diagonals k = x - y from the start
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && f[o+k-1] < f[o+k+1]) {
+				x = f[o+k+1]
+			} else {
+				x = f[o+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			f[o+k] = x
+			// the backward search has been D-1 rounds along diagonal delta - k, measured from the end
+			if back := delta - k; odd && back >= -(D-1) && back <= D-1 && x+r[o+back] >= n {
+				return aLo + sx, bLo + sy, aLo + x, bLo + y
+			}
+		}
+		// backward, along diagonals k = u - w from the end, where u = n - x and w = m - y
+		for k := -D; k <= D; k += 2 {
+			var u int
+			if k == -D || (k != D && r[o+k-1] < r[o+k+1]) {
+				u = r[o+k+1]
+			} else {
+				u = r[o+k-1] + 1
+			}
+			w := u - k
+			su, sw := u, w
+			for u < n && w < m && d.a[aHi-1-u] == d.b[bHi-1-w] {
+				u++
+				w++
+			}
+			r[o+k] = u
+			if fore := delta - k; !odd && fore >= -D && fore <= D && u+f[o+fore] >= n {
+				return aHi - u, bHi - w, aHi - su, bHi - sw
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
+
+// deletesFirst reorders each run of changes to delete lines before inserting them, as diffs are read
+func deletesFirst(edits []edit) []edit {
+	for i := 0; i < len(edits); {
+		if edits[i].kind == equalOp {
+			i++
+			continue
+		}
+		j := i
+		for j < len(edits) && edits[j].kind != equalOp {
+			j++
+		}
+		a, b := edits[i].a, edits[i].b
+		var deletes, inserts []edit
+		for _, e := range edits[i:j] {
+			if e.kind == deleteOp {
+				deletes = append(deletes, e)
+			} else {
+				inserts = append(inserts, e)
+			}
+		}
+		for _, e := range deletes {
+			e.b = b
+			edits[i] = e
+			i++
+		}
+		for _, e := range inserts {
+			e.a = a + len(deletes)
+			edits[i] = e
+			i++
+		}
+	}
+	return edits
+}
+
+// hunks groups edits into ranges of changes surrounded by up to context equal lines
+func hunks(edits []edit, context int) [][]edit {
+	var result [][]edit
+	start, end := -1, -1
+	for i, e := range edits {
+		if e.kind == equalOp {
+			continue
+		}
+		lo, hi := i-context, i+context+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(edits) {
+			hi = len(edits)
+		}
+		if start >= 0 && lo <= end {
+			end = hi
+			continue
+		}
+		if start >= 0 {
+			result = append(result, edits[start:end])
+		}
+		start, end = lo, hi
+	}
+	if start >= 0 {
+		result = append(result, edits[start:end])
+	}
+	return result
+}
+
+func writeHunk(buf *bytes.Buffer, h []edit, a, b []string) {
+	aStart, bStart := h[0].a, h[0].b
+	aCount, bCount := 0, 0
+	for _, e := range h {
+		if e.kind != insertOp {
+			aCount++
+		}
+		if e.kind != deleteOp {
+			bCount++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, e := range h {
+		switch e.kind {
+		case equalOp:
+			buf.WriteString(" " + a[e.a] + "\n")
+		case deleteOp:
+			buf.WriteString("-" + a[e.a] + "\n")
+		case insertOp:
+			buf.WriteString("+" + b[e.b] + "\n")
+		}
+	}
+}
+
+// hunkRange formats a 1-based line range, where an empty range points at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
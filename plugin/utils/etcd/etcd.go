@@ -0,0 +1,273 @@
+// Package etcd is a thin client for the etcd v3 JSON gateway (/v3/...), for the SDK's etcd-backed
+// locks and for plugins that keep a little shared state in etcd. It covers key values, leases and
+// the single compare-and-put transaction locks need, using only the standard library.
+package etcd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// ErrNotFound is returned when a key does not exist
+var ErrNotFound = errors.New("etcd: key not found")
+
+// ErrLeaseNotFound is returned when keeping alive a lease that already expired or was revoked
+var ErrLeaseNotFound = errors.New("etcd: lease not found")
+
+// Options configures how a Client reaches the cluster
+type Options struct {
+	// Endpoints are gateway base URLs, ie: http://etcd-0:2379. They're tried in order until one answers.
+	Endpoints []string
+	// Username and Password authenticate with etcd's auth API when set
+	Username string
+	Password string
+	// TLS is used for https endpoints when not nil
+	TLS *tls.Config
+	// Timeout bounds each request, defaults to 5s
+	Timeout time.Duration
+}
+
+// Client talks to an etcd cluster. It is safe for concurrent use.
+type Client struct {
+	opts   Options
+	client *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// New creates a Client. No connection is made until the first request.
+func New(opts Options) (*Client, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, errors.New("At least one etcd endpoint is required")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	for i, e := range opts.Endpoints {
+		opts.Endpoints[i] = strings.TrimRight(e, "/")
+	}
+	return &Client{
+		opts:   opts,
+		client: httpclient.New(httpclient.Options{Timeout: opts.Timeout, TLS: opts.TLS}),
+	}, nil
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Get returns the value of key, or ErrNotFound
+func (c *Client) Get(key string) ([]byte, error) {
+	var resp struct {
+		KVs []keyValue `json:"kvs"`
+	}
+	if err := c.call("/v3/kv/range", map[string]interface{}{"key": encode(key)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 0 {
+		return nil, ErrNotFound
+	}
+	return base64.StdEncoding.DecodeString(resp.KVs[0].Value)
+}
+
+// Put sets key to value, attached to lease unless it's 0
+func (c *Client) Put(key string, value []byte, lease int64) error {
+	return c.call("/v3/kv/put", putRequest(key, value, lease), nil)
+}
+
+// PutIfAbsent sets key to value, attached to lease unless it's 0, only if the key doesn't exist yet.
+// It returns whether the key was set.
+func (c *Client) PutIfAbsent(key string, value []byte, lease int64) (bool, error) {
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	txn := map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":             encode(key),
+			"target":          "CREATE",
+			"result":          "EQUAL",
+			"create_revision": "0",
+		}},
+		"success": []map[string]interface{}{{"request_put": putRequest(key, value, lease)}},
+	}
+	if err := c.call("/v3/kv/txn", txn, &resp); err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// Delete removes key, it isn't an error if it doesn't exist
+func (c *Client) Delete(key string) error {
+	return c.call("/v3/kv/deleterange", map[string]interface{}{"key": encode(key)}, nil)
+}
+
+// Grant creates a lease that expires after ttl, rounded up to whole seconds, and returns its ID
+func (c *Client) Grant(ttl time.Duration) (int64, error) {
+	var resp struct {
+		ID    string `json:"ID"`
+		Error string `json:"error"`
+	}
+	if err := c.call("/v3/lease/grant", map[string]interface{}{"TTL": ttlSeconds(ttl)}, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Error != "" {
+		return 0, errors.New(resp.Error)
+	}
+	return strconv.ParseInt(resp.ID, 10, 64)
+}
+
+// KeepAlive refreshes a lease to its original ttl and returns the remaining ttl, or ErrLeaseNotFound
+func (c *Client) KeepAlive(lease int64) (time.Duration, error) {
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := c.call("/v3/lease/keepalive", map[string]interface{}{"ID": strconv.FormatInt(lease, 10)}, &resp); err != nil {
+		return 0, err
+	}
+	ttl, _ := strconv.ParseInt(resp.Result.TTL, 10, 64)
+	if ttl <= 0 {
+		return 0, ErrLeaseNotFound
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// Revoke ends a lease early, deleting every key attached to it
+func (c *Client) Revoke(lease int64) error {
+	err := c.call("/v3/lease/revoke", map[string]interface{}{"ID": strconv.FormatInt(lease, 10)}, nil)
+	if err != nil && strings.Contains(err.Error(), "lease not found") {
+		return ErrLeaseNotFound
+	}
+	return err
+}
+
+func putRequest(key string, value []byte, lease int64) map[string]interface{} {
+	req := map[string]interface{}{"key": encode(key), "value": base64.StdEncoding.EncodeToString(value)}
+	if lease != 0 {
+		req["lease"] = strconv.FormatInt(lease, 10)
+	}
+	return req
+}
+
+func encode(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+func ttlSeconds(ttl time.Duration) int64 {
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// call posts body to path on the first endpoint that answers, and decodes the reply into result
+func (c *Client) call(path string, body, result interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, endpoint := range c.opts.Endpoints {
+		var reply []byte
+		reply, lastErr = c.post(endpoint, path, b)
+		if lastErr == errUnreachable {
+			continue
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(reply, result)
+	}
+	return fmt.Errorf("No etcd endpoint could be reached: %v", c.opts.Endpoints)
+}
+
+var errUnreachable = errors.New("etcd: endpoint unreachable")
+
+func (c *Client) post(endpoint, path string, body []byte) ([]byte, error) {
+	token, err := c.authenticate(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errUnreachable
+	}
+	reply, err := httpclient.ReadBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(reply, &e)
+		if e.Message == "" {
+			e.Message = e.Error
+		}
+		if strings.Contains(e.Message, "invalid auth token") {
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		}
+		return nil, fmt.Errorf("etcd %s returned %d: %s", path, resp.StatusCode, e.Message)
+	}
+	return reply, nil
+}
+
+// authenticate returns a token for the auth header, fetching one the first time it's needed
+func (c *Client) authenticate(endpoint string) (string, error) {
+	if c.opts.Username == "" {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	b, _ := json.Marshal(map[string]string{"name": c.opts.Username, "password": c.opts.Password})
+	resp, err := c.client.Post(endpoint+"/v3/auth/authenticate", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return "", errUnreachable
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd authentication failed with status %d", resp.StatusCode)
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", err
+	}
+	c.token = auth.Token
+	return c.token, nil
+}
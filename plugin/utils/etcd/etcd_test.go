@@ -0,0 +1,60 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeGateway implements just enough of the etcd JSON gateway to exercise the client
+func fakeGateway() *httptest.Server {
+	kvs := map[string]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			if v, ok := kvs[req["key"].(string)]; ok {
+				json.NewEncoder(w).Encode(map[string]interface{}{"kvs": []keyValue{{Key: req["key"].(string), Value: v}}})
+				return
+			}
+			w.Write([]byte(`{}`))
+		case "/v3/kv/txn":
+			key := req["compare"].([]interface{})[0].(map[string]interface{})["key"].(string)
+			if _, ok := kvs[key]; ok {
+				w.Write([]byte(`{"succeeded":false}`))
+				return
+			}
+			put := req["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{})
+			kvs[key] = put["value"].(string)
+			w.Write([]byte(`{"succeeded":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not implemented","message":"not implemented"}`))
+		}
+	}))
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	server := fakeGateway()
+	defer server.Close()
+	// The first endpoint is unreachable, the client should move on to the next
+	c, err := New(Options{Endpoints: []string{"http://127.0.0.1:1", server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.Get("lock"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound but got %v", err)
+	}
+	if ok, err := c.PutIfAbsent("lock", []byte("a"), 0); !ok || err != nil {
+		t.Fatalf("Expected the first put to succeed but got %v, %v", ok, err)
+	}
+	if ok, err := c.PutIfAbsent("lock", []byte("b"), 0); ok || err != nil {
+		t.Fatalf("Expected the second put to fail but got %v, %v", ok, err)
+	}
+	if v, err := c.Get("lock"); err != nil || string(v) != "a" {
+		t.Fatalf("Expected a but got %s, %v", v, err)
+	}
+}
@@ -0,0 +1,211 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Type is the type of a value in an expression
+type Type string
+
+// Types of values. Numbers are always float64, as they are when decoded from JSON.
+const (
+	Any    = Type("any")
+	Null   = Type("null")
+	Bool   = Type("bool")
+	Number = Type("number")
+	String = Type("string")
+	List   = Type("list")
+	Object = Type("object")
+)
+
+// Schema maps variable names to their types
+type Schema map[string]Type
+
+// typeOf returns the type of a value
+func typeOf(v interface{}) Type {
+	switch v.(type) {
+	case nil:
+		return Null
+	case bool:
+		return Bool
+	case float64:
+		return Number
+	case string:
+		return String
+	case []interface{}:
+		return List
+	case map[string]interface{}:
+		return Object
+	}
+	return Type(fmt.Sprintf("%T", v))
+}
+
+// is returns whether a value of type t may be used where one of want is needed
+func (t Type) is(want ...Type) bool {
+	if t == Any {
+		return true
+	}
+	for _, w := range want {
+		if t == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *literal) check(schema Schema) (Type, error) {
+	return typeOf(n.value), nil
+}
+
+func (n *ident) check(schema Schema) (Type, error) {
+	if schema == nil {
+		return Any, nil
+	}
+	t, ok := schema[n.name]
+	if !ok {
+		return "", fmt.Errorf("unknown variable %s", n.name)
+	}
+	return t, nil
+}
+
+func (n *list) check(schema Schema) (Type, error) {
+	for _, item := range n.items {
+		if _, err := item.check(schema); err != nil {
+			return "", err
+		}
+	}
+	return List, nil
+}
+
+func (n *index) check(schema Schema) (Type, error) {
+	target, err := n.target.check(schema)
+	if err != nil {
+		return "", err
+	}
+	key, err := n.key.check(schema)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case target == Object && !key.is(String):
+		return "", fmt.Errorf("objects are indexed by strings, not %s", key)
+	case target == List && !key.is(Number):
+		return "", fmt.Errorf("lists are indexed by numbers, not %s", key)
+	case !target.is(Object, List, Null):
+		return "", fmt.Errorf("can't index into %s", target)
+	}
+	// Schemas only describe the top level, so what's inside is only known at evaluation
+	return Any, nil
+}
+
+func (n *unary) check(schema Schema) (Type, error) {
+	t, err := n.operand.check(schema)
+	if err != nil {
+		return "", err
+	}
+	if n.op == "!" {
+		if !t.is(Bool) {
+			return "", fmt.Errorf("! needs a bool, not %s", t)
+		}
+		return Bool, nil
+	}
+	if !t.is(Number) {
+		return "", fmt.Errorf("- needs a number, not %s", t)
+	}
+	return Number, nil
+}
+
+func (n *binary) check(schema Schema) (Type, error) {
+	left, err := n.left.check(schema)
+	if err != nil {
+		return "", err
+	}
+	right, err := n.right.check(schema)
+	if err != nil {
+		return "", err
+	}
+	switch n.op {
+	case "&&", "||":
+		if !left.is(Bool) || !right.is(Bool) {
+			return "", fmt.Errorf("%s needs bools, not %s and %s", n.op, left, right)
+		}
+		return Bool, nil
+	case "==", "!=":
+		return Bool, nil
+	case "in":
+		if !right.is(List, Object) {
+			return "", fmt.Errorf("in needs a list or object, not %s", right)
+		}
+		return Bool, nil
+	case "<", "<=", ">", ">=":
+		if !(left.is(Number) && right.is(Number)) && !(left.is(String) && right.is(String)) {
+			return "", fmt.Errorf("can't compare %s with %s", left, right)
+		}
+		return Bool, nil
+	case "+":
+		switch {
+		case left == Any || right == Any:
+			return Any, nil
+		case left == String && right == String:
+			return String, nil
+		case left == List && right == List:
+			return List, nil
+		}
+	}
+	if !left.is(Number) || !right.is(Number) {
+		return "", fmt.Errorf("%s needs numbers, not %s and %s", n.op, left, right)
+	}
+	return Number, nil
+}
+
+func (n *call) check(schema Schema) (Type, error) {
+	if n.name == "has" && n.target == nil {
+		// has takes a field without evaluating it, so only check what it's a field of
+		if idx, ok := n.args[0].(*index); ok {
+			if _, err := idx.target.check(schema); err != nil {
+				return "", err
+			}
+		}
+		return Bool, nil
+	}
+	fn, ok := functions[n.name]
+	if !ok {
+		return "", fmt.Errorf("unknown function %s", n.name)
+	}
+	var args []Type
+	if n.target != nil {
+		t, err := n.target.check(schema)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, t)
+	}
+	for _, arg := range n.args {
+		t, err := arg.check(schema)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, t)
+	}
+	if len(args) != len(fn.args) {
+		return "", fmt.Errorf("%s takes %d arguments, got %d", n.name, len(fn.args), len(args))
+	}
+	for i, want := range fn.args {
+		if !args[i].is(want...) {
+			return "", fmt.Errorf("%s can't take a %s", n.name, args[i])
+		}
+	}
+	// Constant patterns are compiled now, so a bad one fails early and isn't compiled per event
+	if n.name == "matches" {
+		if lit, ok := n.args[len(n.args)-1].(*literal); ok {
+			pattern, _ := lit.value.(string)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", fmt.Errorf("invalid pattern: %s", err)
+			}
+			n.re = re
+		}
+	}
+	return fn.result, nil
+}
@@ -0,0 +1,350 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+type node interface {
+	check(schema Schema) (Type, error)
+	eval(s *state) (interface{}, error)
+}
+
+// fieldPath is implemented by nodes that name a field, which has() can test for
+type fieldPath interface {
+	exists(s *state) (bool, error)
+}
+
+type literal struct{ value interface{} }
+
+func (n *literal) eval(s *state) (interface{}, error) {
+	return n.value, s.step()
+}
+
+type ident struct{ name string }
+
+func (n *ident) eval(s *state) (interface{}, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	v, err := normalize(s, s.vars[n.name])
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := s.opts.Schema[n.name]; ok && t != Any && v != nil && typeOf(v) != t {
+		return nil, fmt.Errorf("%s should be a %s, not %s", n.name, t, typeOf(v))
+	}
+	return v, nil
+}
+
+func (n *ident) exists(s *state) (bool, error) {
+	_, ok := s.vars[n.name]
+	return ok, s.step()
+}
+
+type list struct{ items []node }
+
+func (n *list) eval(s *state) (interface{}, error) {
+	values := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+type index struct{ target, key node }
+
+func (n *index) lookup(s *state) (interface{}, bool, error) {
+	target, err := n.target.eval(s)
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := n.key.eval(s)
+	if err != nil {
+		return nil, false, err
+	}
+	switch t := target.(type) {
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("Objects are indexed by strings, not %s", typeOf(key))
+		}
+		v, ok := t[k]
+		if v, err = normalize(s, v); err != nil {
+			return nil, false, err
+		}
+		return v, ok, nil
+	case []interface{}:
+		i, ok := key.(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil, false, fmt.Errorf("Lists are indexed by whole numbers, not %v", key)
+		}
+		if i < 0 || int(i) >= len(t) {
+			return nil, false, nil
+		}
+		v, err := normalize(s, t[int(i)])
+		return v, true, err
+	case nil:
+		return nil, false, nil
+	}
+	return nil, false, fmt.Errorf("Can't index into %s", typeOf(target))
+}
+
+func (n *index) eval(s *state) (interface{}, error) {
+	v, _, err := n.lookup(s)
+	return v, err
+}
+
+func (n *index) exists(s *state) (bool, error) {
+	_, ok, err := n.lookup(s)
+	return ok, err
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (n *unary) eval(s *state) (interface{}, error) {
+	v, err := n.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.step(); err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! needs a bool, not %s", typeOf(v))
+		}
+		return !b, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- needs a number, not %s", typeOf(v))
+	}
+	return -f, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n *binary) eval(s *state) (interface{}, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.step(); err != nil {
+		return nil, err
+	}
+	// && and || short circuit
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.op, typeOf(left))
+		}
+		if l == (n.op == "||") {
+			return l, nil
+		}
+		right, err := n.right.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.op, typeOf(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			for _, item := range r {
+				if err = s.step(); err != nil {
+					return nil, err
+				}
+				if reflect.DeepEqual(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			k, ok := left.(string)
+			_, found := r[k]
+			return ok && found, nil
+		}
+		return nil, fmt.Errorf("in needs a list or object, not %s", typeOf(right))
+	case "<", "<=", ">", ">=":
+		cmp, err := order(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	case "+":
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				if err = s.size(len(l) + len(r)); err != nil {
+					return nil, err
+				}
+				return l + r, nil
+			}
+		}
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				if err = s.size(len(l) + len(r)); err != nil {
+					return nil, err
+				}
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s needs numbers, not %s and %s", n.op, typeOf(left), typeOf(right))
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	if r == 0 {
+		return nil, fmt.Errorf("modulus by zero")
+	}
+	return math.Mod(l, r), nil
+}
+
+// order compares two numbers or two strings
+func order(a, b interface{}) (int, error) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("Can't compare %s with %s", typeOf(a), typeOf(b))
+}
+
+type call struct {
+	name   string
+	target node // target is the receiver of a method call, nil for functions
+	args   []node
+	re     *regexp.Regexp // re is the pattern of matches, when it's a constant
+}
+
+func (n *call) eval(s *state) (interface{}, error) {
+	if n.name == "has" && n.target == nil {
+		return n.args[0].(fieldPath).exists(s)
+	}
+	var args []interface{}
+	if n.target != nil {
+		target, err := n.target.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, target)
+	}
+	for _, arg := range n.args {
+		v, err := arg.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	if n.re != nil {
+		str, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("matches needs a string, not %s", typeOf(args[0]))
+		}
+		return n.re.MatchString(str), nil
+	}
+	fn := functions[n.name]
+	return fn.call(s, args)
+}
+
+// normalize converts the Go values plugins commonly pass as variables into the ones decoded JSON
+// would have, so ints and []string compare and index the same as numbers and lists from an event
+func normalize(s *state, v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, bool, float64, string, []interface{}, map[string]interface{}:
+		return v, nil
+	case []string:
+		if err := s.size(len(t)); err != nil {
+			return nil, err
+		}
+		l := make([]interface{}, len(t))
+		for i, item := range t {
+			l[i] = item
+		}
+		return l, nil
+	case map[string]string:
+		if err := s.size(len(t)); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			m[k] = item
+		}
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32:
+		return rv.Float(), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,158 @@
+// Package expr evaluates small user-supplied expressions safely, for filters on trigger input and
+// actions that accept conditions. The language is a subset of CEL:
+//
+//	severity in ["high", "critical"] && !source.ip.startsWith("10.") && size(tags) > 0
+//
+// There are number, string, bool, null and list literals; field access with . and []; the operators
+// ! - * / % + < <= > >= == != in && ||; the functions size, has (which tests if a field exists),
+// string and double; and the methods contains, startsWith, endsWith, matches, size, lowerAscii and
+// upperAscii. Missing fields are null.
+//
+// Expressions are compiled once and evaluated many times. Compiling type checks the expression against
+// a schema of the variables it may use, so a typo fails when the input is validated rather than on the
+// first event. Evaluation is bounded in steps, time and the size of the values it builds, so a hostile
+// expression can't stall or exhaust the plugin.
+package expr
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default limits for evaluation
+const (
+	DefaultMaxCost = 10000                 // DefaultMaxCost is the default number of evaluation steps
+	DefaultMaxSize = 1 << 16               // DefaultMaxSize is the default length of built strings and lists
+	DefaultTimeout = 10 * time.Millisecond // DefaultTimeout is the default time an evaluation may take
+	maxSourceSize  = 4096
+)
+
+// LimitExceeded is returned when an evaluation goes over one of its limits
+type LimitExceeded string
+
+// Error implements the error interface
+func (e LimitExceeded) Error() string {
+	return string(e)
+}
+
+// Options configures compilation and evaluation
+type Options struct {
+	// Schema declares the variables an expression may use and their types. When nil, any variable
+	// is allowed and its type is checked at evaluation.
+	Schema Schema
+	// MaxCost bounds the number of steps an evaluation takes, defaults to DefaultMaxCost
+	MaxCost int
+	// MaxSize bounds the length of strings and lists an evaluation builds, defaults to DefaultMaxSize
+	MaxSize int
+	// Timeout bounds the time an evaluation takes, defaults to DefaultTimeout
+	Timeout time.Duration
+}
+
+// Program is a compiled expression. It's safe to evaluate concurrently.
+type Program struct {
+	src  string
+	root node
+	typ  Type
+	opts Options
+}
+
+// Compile parses and type checks src
+func Compile(src string, opts Options) (*Program, error) {
+	if len(src) > maxSourceSize {
+		return nil, fmt.Errorf("Expression is longer than %d characters", maxSourceSize)
+	}
+	if opts.MaxCost <= 0 {
+		opts.MaxCost = DefaultMaxCost
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	p := &parser{lex: &lexer{src: src}}
+	p.next()
+	root, err := p.parseOr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = fmt.Errorf("unexpected %s at %d", p.tok.text, p.tok.pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression %q: %s", src, err)
+	}
+	typ, err := root.check(opts.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression %q: %s", src, err)
+	}
+	return &Program{src: src, root: root, typ: typ, opts: opts}, nil
+}
+
+// CompileCondition compiles src and checks it evaluates to a bool
+func CompileCondition(src string, opts Options) (*Program, error) {
+	p, err := Compile(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	if p.typ != Any && p.typ != Bool {
+		return nil, fmt.Errorf("Invalid condition %q: it's a %s, not a bool", src, p.typ)
+	}
+	return p, nil
+}
+
+// String returns the source of the expression
+func (p *Program) String() string {
+	return p.src
+}
+
+// Type returns the type the expression evaluates to, Any if it can't be known before evaluation
+func (p *Program) Type() Type {
+	return p.typ
+}
+
+// Eval evaluates the expression with vars as its variables
+func (p *Program) Eval(vars map[string]interface{}) (interface{}, error) {
+	s := &state{vars: vars, opts: &p.opts, deadline: time.Now().Add(p.opts.Timeout)}
+	return p.root.eval(s)
+}
+
+// EvalBool evaluates the expression as a condition, which must be true or false
+func (p *Program) EvalBool(vars map[string]interface{}) (bool, error) {
+	v, err := p.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("Expression %q returned %s, not a bool", p.src, typeOf(v))
+	}
+	return b, nil
+}
+
+// state tracks one evaluation against its limits
+type state struct {
+	vars     map[string]interface{}
+	opts     *Options
+	cost     int
+	deadline time.Time
+}
+
+// step counts an evaluation step, and checks the limits
+func (s *state) step() error {
+	s.cost++
+	if s.cost > s.opts.MaxCost {
+		return LimitExceeded(fmt.Sprintf("Expression took more than %d steps", s.opts.MaxCost))
+	}
+	// Checking the clock is comparatively slow, so only do it every so often
+	if s.cost%64 == 0 && time.Now().After(s.deadline) {
+		return LimitExceeded(fmt.Sprintf("Expression took longer than %s", s.opts.Timeout))
+	}
+	return nil
+}
+
+// size checks a built string or list against the size limit
+func (s *state) size(n int) error {
+	if n > s.opts.MaxSize {
+		return LimitExceeded(fmt.Sprintf("Expression built a value longer than %d", s.opts.MaxSize))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpressions(t *testing.T) {
+	vars := map[string]interface{}{
+		"severity": "high",
+		"score":    7.5,
+		"source":   map[string]interface{}{"ip": "10.1.2.3"},
+		"tags":     []interface{}{"phishing", "email"},
+	}
+	cases := map[string]bool{
+		`severity in ["high", "critical"]`:                  true,
+		`score > 5 && score <= 7.5`:                         true,
+		`source.ip.startsWith("10.") && !has(source.host)`:  true,
+		`"email" in tags && size(tags) == 2`:                true,
+		`tags[0] == 'phishing' || missing.field == "x"`:     true,
+		`missing == null && !has(missing)`:                  true,
+		`severity.upperAscii() == "HIGH"`:                   true,
+		`source["ip"].matches("^10\\.") && score * 2 == 15`: true,
+		`severity == "low" || (score - 1) / 2 > 10`:         false,
+		`string(score) + "!" == "7.5!" && -score < 0`:       true,
+	}
+	for src, want := range cases {
+		p, err := CompileCondition(src, Options{})
+		if err != nil {
+			t.Fatalf("Unable to compile %s: %s", src, err)
+		}
+		got, err := p.EvalBool(vars)
+		if err != nil {
+			t.Fatalf("Unable to evaluate %s: %s", src, err)
+		}
+		if got != want {
+			t.Errorf("Expected %s to be %v", src, want)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, src := range []string{`severity ==`, `(score > 1`, `has("x")`, `score > 1 )`, `'unterminated`, `"x".matches("(")`} {
+		if _, err := Compile(src, Options{}); err == nil {
+			t.Errorf("Expected %s not to compile", src)
+		}
+	}
+	p, _ := Compile(`score + "x"`, Options{})
+	if _, err := p.Eval(map[string]interface{}{"score": 1.0}); err == nil {
+		t.Error("Expected adding a number and a string to fail")
+	}
+}
+
+func TestExpressionSchema(t *testing.T) {
+	schema := Schema{"severity": String, "score": Number, "source": Object, "tags": List}
+	for _, src := range []string{`sevrity == "high"`, `score.startsWith("1")`, `score + "x"`, `!severity`, `tags < 1`, `size(score) > 1`} {
+		if _, err := Compile(src, Options{Schema: schema}); err == nil {
+			t.Errorf("Expected %s not to type check", src)
+		}
+	}
+	if _, err := CompileCondition(`score + 1`, Options{Schema: schema}); err == nil {
+		t.Error("Expected a number not to compile as a condition")
+	}
+
+	p, err := Compile(`score * 2`, Options{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type() != Number {
+		t.Errorf("Expected a number, got %s", p.Type())
+	}
+	// Go numbers are treated like the ones decoded from JSON
+	if v, err := p.Eval(map[string]interface{}{"score": 21}); err != nil || v != 42.0 {
+		t.Errorf("Expected 42, got %v, %v", v, err)
+	}
+	if _, err := p.Eval(map[string]interface{}{"score": "21"}); err == nil {
+		t.Error("Expected a variable that doesn't match the schema to fail")
+	}
+}
+
+func TestExpressionLimits(t *testing.T) {
+	big := make([]interface{}, 100000)
+	p, err := Compile(`"x" in items`, Options{MaxCost: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Eval(map[string]interface{}{"items": big}); err == nil {
+		t.Fatal("Expected a cost limit error")
+	} else if _, ok := err.(LimitExceeded); !ok {
+		t.Fatalf("Expected a cost limit error, got %s", err)
+	}
+
+	p, _ = Compile(`s + s + s + s`, Options{MaxSize: 100})
+	if _, err = p.Eval(map[string]interface{}{"s": strings.Repeat("x", 30)}); err == nil {
+		t.Error("Expected a size limit error")
+	}
+
+	p, _ = Compile(`"x" in items`, Options{MaxCost: 1 << 30, Timeout: time.Millisecond})
+	if _, err = p.Eval(map[string]interface{}{"items": make([]interface{}, 1<<24)}); err == nil {
+		t.Error("Expected a timeout")
+	}
+
+	if _, err = Compile(strings.Repeat("1 + ", 2000)+"1", Options{}); err == nil {
+		t.Error("Expected an over long expression not to compile")
+	}
+}
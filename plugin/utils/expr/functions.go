@@ -0,0 +1,86 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type function struct {
+	args   [][]Type // args are the types each argument may be, starting with the receiver of methods
+	result Type
+	call   func(s *state, args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"size": {[][]Type{{String, List, Object, Null}}, Number, func(s *state, args []interface{}) (interface{}, error) {
+		switch t := args[0].(type) {
+		case string:
+			return float64(len([]rune(t))), nil
+		case []interface{}:
+			return float64(len(t)), nil
+		case map[string]interface{}:
+			return float64(len(t)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("size needs a string, list or object, not %s", typeOf(args[0]))
+	}},
+	"string": {[][]Type{{Any}}, String, func(s *state, args []interface{}) (interface{}, error) {
+		if f, ok := args[0].(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		str := fmt.Sprint(args[0])
+		return str, s.size(len(str))
+	}},
+	"double": {[][]Type{{Number, String}}, Number, func(s *state, args []interface{}) (interface{}, error) {
+		switch t := args[0].(type) {
+		case float64:
+			return t, nil
+		case string:
+			return strconv.ParseFloat(t, 64)
+		}
+		return nil, fmt.Errorf("double needs a number or string, not %s", typeOf(args[0]))
+	}},
+	"contains":   stringMethod(func(str, arg string) interface{} { return strings.Contains(str, arg) }),
+	"startsWith": stringMethod(func(str, arg string) interface{} { return strings.HasPrefix(str, arg) }),
+	"endsWith":   stringMethod(func(str, arg string) interface{} { return strings.HasSuffix(str, arg) }),
+	"matches": {[][]Type{{String}, {String}}, Bool, func(s *state, args []interface{}) (interface{}, error) {
+		str, ok1 := args[0].(string)
+		pattern, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("matches needs strings, not %s and %s", typeOf(args[0]), typeOf(args[1]))
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(str), nil
+	}},
+	"lowerAscii": {[][]Type{{String}}, String, func(s *state, args []interface{}) (interface{}, error) {
+		str, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("lowerAscii needs a string, not %s", typeOf(args[0]))
+		}
+		return strings.ToLower(str), nil
+	}},
+	"upperAscii": {[][]Type{{String}}, String, func(s *state, args []interface{}) (interface{}, error) {
+		str, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("upperAscii needs a string, not %s", typeOf(args[0]))
+		}
+		return strings.ToUpper(str), nil
+	}},
+}
+
+func stringMethod(fn func(str, arg string) interface{}) function {
+	return function{[][]Type{{String}, {String}}, Bool, func(s *state, args []interface{}) (interface{}, error) {
+		str, ok1 := args[0].(string)
+		arg, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("needs strings, not %s and %s", typeOf(args[0]), typeOf(args[1]))
+		}
+		return fn(str, arg), nil
+	}}
+}
@@ -0,0 +1,302 @@
+package expr
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lexing
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+	num  float64
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+var twoCharOps = []string{"&&", "||", "==", "!=", "<=", ">="}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, text: "end of expression", pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9':
+		for l.pos < len(l.src) && (l.src[l.pos] >= '0' && l.src[l.pos] <= '9' || strings.IndexByte(".eE", l.src[l.pos]) >= 0 ||
+			(l.src[l.pos] == '-' || l.src[l.pos] == '+') && strings.IndexByte("eE", l.src[l.pos-1]) >= 0) {
+			l.pos++
+		}
+		n, err := strconv.ParseFloat(l.src[start:l.pos], 64)
+		if err != nil {
+			return token{}, fmt.Errorf("invalid number %s at %d", l.src[start:l.pos], start)
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start, num: n}, nil
+	case c == '"' || c == '\'':
+		l.pos++
+		var b bytes.Buffer
+		for l.pos < len(l.src) && l.src[l.pos] != c {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+				switch l.src[l.pos] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(l.src[l.pos])
+				}
+			} else {
+				b.WriteByte(l.src[l.pos])
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		}
+		l.pos++
+		return token{kind: tokString, text: b.String(), pos: start}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+	for _, op := range twoCharOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += 2
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	if strings.IndexByte("!-+*/%<>()[],.", c) >= 0 {
+		l.pos++
+		return token{kind: tokOp, text: string(c), pos: start}, nil
+	}
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+// Parsing, by recursive descent from the lowest precedence operator up
+
+type parser struct {
+	lex *lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF}
+	}
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp && !(p.tok.kind == tokIdent && p.tok.text == "in") {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.isOp(op) {
+		return fmt.Errorf("expected %s but got %s at %d", op, p.tok.text, p.tok.pos)
+	}
+	p.next()
+	return p.err
+}
+
+func (p *parser) parseBinary(operand func() (node, error), ops ...string) (node, error) {
+	left, err := operand()
+	for err == nil && p.isOp(ops...) {
+		op := p.tok.text
+		p.next()
+		var right node
+		if right, err = operand(); err == nil {
+			left = &binary{op: op, left: left, right: right}
+		}
+	}
+	if err == nil {
+		err = p.err
+	}
+	return left, err
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdd()
+	if err != nil || !p.isOp("==", "!=", "<", "<=", ">", ">=", "in") {
+		return left, err
+	}
+	op := p.tok.text
+	p.next()
+	right, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{op: op, left: left, right: right}, p.err
+}
+
+func (p *parser) parseAdd() (node, error) {
+	return p.parseBinary(p.parseMul, "+", "-")
+}
+
+func (p *parser) parseMul() (node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!", "-") {
+		op := p.tok.text
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	for err == nil && p.isOp(".", "[") {
+		if p.isOp(".") {
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected a field or method name at %d", p.tok.pos)
+			}
+			name := p.tok.text
+			p.next()
+			if p.isOp("(") {
+				var args []node
+				if args, err = p.parseArgs(")"); err == nil {
+					n = &call{name: name, target: n, args: args}
+				}
+			} else {
+				n = &index{target: n, key: &literal{value: name}}
+			}
+		} else {
+			p.next()
+			var key node
+			if key, err = p.parseOr(); err == nil {
+				err = p.expect("]")
+				n = &index{target: n, key: key}
+			}
+		}
+	}
+	return n, err
+}
+
+// parseArgs parses a comma separated list after its opening bracket, up to and including end
+func (p *parser) parseArgs(end string) ([]node, error) {
+	p.next()
+	var args []node
+	for !p.isOp(end) {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, p.expect(end)
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		p.next()
+		return &literal{value: tok.num}, nil
+	case tok.kind == tokString:
+		p.next()
+		return &literal{value: tok.text}, nil
+	case tok.kind == tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null":
+			return &literal{value: nil}, nil
+		}
+		if p.isOp("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			if tok.text == "has" {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("has takes one field")
+				}
+				if _, ok := args[0].(fieldPath); !ok {
+					return nil, fmt.Errorf("has takes a field, like has(source.ip)")
+				}
+			}
+			return &call{name: tok.text, args: args}, nil
+		}
+		return &ident{name: tok.text}, nil
+	case p.isOp("("):
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case p.isOp("["):
+		items, err := p.parseArgs("]")
+		if err != nil {
+			return nil, err
+		}
+		return &list{items: items}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", tok.text, tok.pos)
+}
@@ -0,0 +1,150 @@
+// Package feed polls HTTP feeds with conditional requests, remembering the ETag and Last-Modified each feed
+// was last fetched with, so a trigger watching a threat feed downloads it only when it changed:
+//
+//	f := &feed.Feed{URL: "https://feeds.example.com/ips.csv"}
+//	update, err := f.Fetch(ctx)
+//	if err != nil || update == nil {
+//		return err // nil update, the feed didn't change
+//	}
+//	defer update.Close()
+//	... send an event for each line of update.Body ...
+//	return update.Commit()
+package feed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+// Feed is a URL polled for changes
+type Feed struct {
+	URL    string
+	Header http.Header   // Header is sent with every request, ie: an API key
+	Client *http.Client  // Client defaults to httpclient.New with no options
+	State  cache.Backend // State keeps the validators, defaults to the cache's current backend
+}
+
+// validators are what's kept for a feed between polls
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Update is a feed that changed since it was last committed
+type Update struct {
+	Body     io.ReadCloser
+	Response *http.Response
+
+	feed       *Feed
+	validators validators
+}
+
+// Fetch requests the feed if it changed since the last update committed, returning a nil Update if it
+// didn't. The caller closes the update's body.
+func (f *Feed) Fetch(ctx context.Context) (*Update, error) {
+	last, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range f.Header {
+		req.Header[k] = v
+	}
+	if last.ETag != "" {
+		req.Header.Set("If-None-Match", last.ETag)
+	}
+	if last.LastModified != "" {
+		req.Header.Set("If-Modified-Since", last.LastModified)
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Unable to fetch feed %s: %s", f.URL, resp.Status)
+	}
+	return &Update{
+		Body:     resp.Body,
+		Response: resp,
+		feed:     f,
+		validators: validators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}, nil
+}
+
+// Commit records the update as processed, so the feed is only fetched again once it changes from it. Call
+// it after the update was handled, a poll that fails halfway then fetches the feed again.
+func (u *Update) Commit() error {
+	b, err := json.Marshal(u.validators)
+	if err != nil {
+		return err
+	}
+	return u.feed.state().Put(u.feed.name(), b)
+}
+
+// Close closes the update's body
+func (u *Update) Close() error {
+	return u.Body.Close()
+}
+
+// Reset forgets the feed's validators, so the next Fetch downloads it whether it changed or not
+func (f *Feed) Reset() error {
+	return f.state().Delete(f.name())
+}
+
+func (f *Feed) load() (validators, error) {
+	var v validators
+	b, err := f.state().Get(f.name())
+	if err == cache.ErrNotFound {
+		return v, nil
+	}
+	if err != nil {
+		return v, err
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return validators{}, fmt.Errorf("Invalid state for feed %s: %s", f.URL, err)
+	}
+	return v, nil
+}
+
+// name is where the feed's validators are kept, a digest as URLs can carry credentials
+func (f *Feed) name() string {
+	sum := sha256.Sum256([]byte(f.URL))
+	return "feed/" + hex.EncodeToString(sum[:]) + ".json"
+}
+
+func (f *Feed) client() *http.Client {
+	if f.Client == nil {
+		return httpclient.New(httpclient.Options{})
+	}
+	return f.Client
+}
+
+func (f *Feed) state() cache.Backend {
+	if f.State == nil {
+		return cache.CurrentBackend()
+	}
+	return f.State
+}
@@ -0,0 +1,75 @@
+package feed
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+func TestFetchSkipsUnchangedFeeds(t *testing.T) {
+	version := "v1"
+	full := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"`+version+`"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"`+version+`"`)
+		w.Write([]byte("10.0.0.1\n"))
+	}))
+	defer srv.Close()
+
+	f := &Feed{URL: srv.URL, Header: http.Header{"X-Api-Key": {"secret"}}, State: &cache.MemoryBackend{}}
+	ctx := context.Background()
+	fetch := func(commit bool) bool {
+		update, err := f.Fetch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if update == nil {
+			return false
+		}
+		defer update.Close()
+		if b, _ := ioutil.ReadAll(update.Body); string(b) != "10.0.0.1\n" {
+			t.Fatalf("Unexpected feed %q", b)
+		}
+		if commit {
+			if err = update.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	}
+
+	if !fetch(false) || !fetch(true) {
+		t.Fatal("Expected the feed fetched until an update was committed")
+	}
+	if fetch(true) {
+		t.Fatal("Expected the unchanged feed to be skipped")
+	}
+	version = "v2"
+	if !fetch(true) || full != 3 {
+		t.Errorf("Expected the changed feed fetched, after %d full fetches", full)
+	}
+	if err := f.Reset(); err != nil || !fetch(true) {
+		t.Errorf("Expected the feed fetched again after a reset, got %v", err)
+	}
+}
+
+func TestFetchFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	f := &Feed{URL: srv.URL, State: &cache.MemoryBackend{}}
+	if update, err := f.Fetch(context.Background()); err == nil || update != nil {
+		t.Errorf("Expected a 404 to fail, got %v %v", update, err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package leakcheck
+
+// CountFDs returns -1, counting file descriptors is only supported on linux
+func CountFDs() int {
+	return -1
+}
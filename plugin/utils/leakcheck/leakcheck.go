@@ -0,0 +1,162 @@
+// Package leakcheck finds leaked goroutines and file descriptors. Leaked goroutines from abandoned
+// polling loops are the most common reason trigger containers run out of memory, and they rarely
+// show up in a short test run, so this can be used both from tests and as a periodic self-check
+// in a running plugin.
+package leakcheck
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Snapshot records the goroutines and open file descriptors at a point in time
+type Snapshot struct {
+	Goroutines map[string]string // Goroutines maps goroutine IDs to their stack traces
+	FDs        int               // FDs is the number of open file descriptors, or -1 if unknown
+}
+
+// ignored goroutines belong to the runtime or the test framework, not to the code under test
+var ignored = []string{
+	"testing.RunTests",
+	"testing.(*T).Run",
+	"testing.(*M).",
+	"testing.tRunner",
+	"runtime.goexit",
+	"created by runtime.gc",
+	"runtime.MHeap_Scavenger",
+	"signal.signal_recv",
+	"os/signal.loop",
+	"leakcheck.goroutines",
+}
+
+// Take records the current goroutines and file descriptors
+func Take() Snapshot {
+	return Snapshot{Goroutines: goroutines(), FDs: CountFDs()}
+}
+
+// Leaks returns the stacks of goroutines running now that weren't in the snapshot, and how many
+// more file descriptors are open
+func (s Snapshot) Leaks() ([]string, int) {
+	var leaked []string
+	for id, stack := range goroutines() {
+		if _, ok := s.Goroutines[id]; !ok {
+			leaked = append(leaked, stack)
+		}
+	}
+	sort.Strings(leaked)
+	fds := 0
+	if s.FDs >= 0 {
+		if now := CountFDs(); now > s.FDs {
+			fds = now - s.FDs
+		}
+	}
+	return leaked, fds
+}
+
+// Verify takes a snapshot and returns a function that fails t if goroutines or file descriptors
+// were leaked since, ie: defer leakcheck.Verify(t)(). Goroutines are given up to a second to wind
+// down before being reported.
+func Verify(t testing.TB) func() {
+	before := Take()
+	return func() {
+		var leaked []string
+		var fds int
+		deadline := time.Now().Add(time.Second)
+		for {
+			leaked, fds = before.Leaks()
+			if (len(leaked) == 0 && fds == 0) || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(leaked) > 0 {
+			t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+		if fds > 0 {
+			t.Errorf("%d file descriptors leaked", fds)
+		}
+	}
+}
+
+// Monitor periodically checks a running plugin against thresholds and logs a warning when one is
+// crossed. It never kills anything, it's there to make a slow leak visible before it's an outage.
+type Monitor struct {
+	MaxGoroutines int           // MaxGoroutines before warning, 0 to not check
+	MaxFDs        int           // MaxFDs before warning, 0 to not check
+	Interval      time.Duration // Interval between checks, defaults to a minute
+	// Warn is called with a description of each crossed threshold, defaults to logging a warning
+	Warn func(msg string)
+}
+
+// Start begins checking in the background, call the returned function to stop
+func (m *Monitor) Start() (stop func()) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	warn := m.Warn
+	if warn == nil {
+		warn = func(msg string) { log.Warn(msg) }
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if n := runtime.NumGoroutine(); m.MaxGoroutines > 0 && n > m.MaxGoroutines {
+					warn(fmt.Sprintf("leakcheck: %d goroutines running, above the threshold of %d", n, m.MaxGoroutines))
+				}
+				if n := CountFDs(); m.MaxFDs > 0 && n > m.MaxFDs {
+					warn(fmt.Sprintf("leakcheck: %d file descriptors open, above the threshold of %d", n, m.MaxFDs))
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// goroutines returns the stacks of all interesting goroutines keyed by goroutine ID
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	result := map[string]string{}
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		s := string(stack)
+		// "goroutine 18 [running]:"
+		fields := strings.Fields(s)
+		if len(fields) < 2 || fields[0] != "goroutine" || isIgnored(s) {
+			continue
+		}
+		result[fields[1]] = s
+	}
+	return result
+}
+
+func isIgnored(stack string) bool {
+	for _, pattern := range ignored {
+		if strings.Contains(stack, pattern) {
+			return true
+		}
+	}
+	return false
+}
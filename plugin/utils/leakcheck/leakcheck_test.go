@@ -0,0 +1,23 @@
+package leakcheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaks(t *testing.T) {
+	before := Take()
+	done := make(chan struct{})
+	go func() {
+		<-done
+	}()
+
+	if leaked, _ := before.Leaks(); len(leaked) != 1 {
+		t.Fatalf("Expected 1 leaked goroutine but got %d", len(leaked))
+	}
+	close(done)
+	time.Sleep(10 * time.Millisecond)
+	if leaked, _ := before.Leaks(); len(leaked) != 0 {
+		t.Fatalf("Expected no leaked goroutines but got %d", len(leaked))
+	}
+}
@@ -0,0 +1,183 @@
+// Package memo remembers the results of expensive lookups in memory, for plugins that resolve the same
+// users or assets over and over within seconds, ie: an HTTP-mode plugin running an action per request.
+// The cache is bounded, evicting the least recently used results, and concurrent lookups of the same key
+// share one call rather than all hitting the API:
+//
+//	users := memo.New(10000, time.Minute)
+//	...
+//	user, err := users.Do(id, func() (interface{}, error) {
+//		return client.GetUser(id)
+//	})
+//
+// Results are interface{} rather than a type parameter, the SDK builds with Go 1.7 which has no generics,
+// so callers assert them back to the type their lookup returns.
+package memo
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries bounds a Cache created with no MaxEntries
+const DefaultMaxEntries = 1000
+
+// errPanicked is returned to those waiting on a lookup that panicked, the panic is the caller's
+var errPanicked = errors.New("memo: lookup panicked")
+
+// Cache is an LRU cache of lookup results, safe for concurrent use. Errors aren't remembered, the next
+// lookup of the key tries again.
+type Cache struct {
+	MaxEntries int
+	TTL        time.Duration // TTL is how long results are remembered, 0 is until they're evicted
+
+	mu      sync.Mutex
+	lru     *list.List // lru holds the entries, most recently used first
+	entries map[string]*list.Element
+	calls   map[string]*call
+	now     func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// call is a lookup in flight, shared by everyone looking up its key meanwhile
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// New returns a cache remembering up to maxEntries results for ttl each
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{MaxEntries: maxEntries, TTL: ttl}
+}
+
+// Get returns the result remembered for key, and false if there isn't one or it expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key)
+}
+
+// Set remembers value for key
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+// Do returns the result remembered for key, or calls lookup for it and remembers what it returns. If
+// key is already being looked up, Do waits for that lookup and returns its result, error included.
+func (c *Cache) Do(key string, lookup func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if v, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return v, nil
+	}
+	if inflight, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-inflight.done
+		return inflight.value, inflight.err
+	}
+	if c.calls == nil {
+		c.calls = map[string]*call{}
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	// the call is finished even if lookup panics, or everyone waiting on it would wait forever
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		if cl.err == nil {
+			c.set(key, cl.value)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.err = errPanicked
+	cl.value, cl.err = lookup()
+	return cl.value, cl.err
+}
+
+// Remove forgets the result for key, ie: once it's known to have changed
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge forgets every result
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru, c.entries = nil, nil
+}
+
+// Len returns the number of results remembered, including any that expired but weren't evicted yet
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
+
+func (c *Cache) get(key string) (interface{}, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && !c.clock().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *Cache) set(key string, value interface{}) {
+	if c.lru == nil {
+		c.lru, c.entries = list.New(), map[string]*list.Element{}
+	}
+	var expires time.Time
+	if c.TTL > 0 {
+		expires = c.clock().Add(c.TTL)
+	}
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&entry{key: key, value: value, expires: expires})
+	max := c.MaxEntries
+	if max <= 0 {
+		max = DefaultMaxEntries
+	}
+	for c.lru.Len() > max {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
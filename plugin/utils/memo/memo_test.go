@@ -0,0 +1,120 @@
+package memo
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEviction(t *testing.T) {
+	c := New(2, 0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok || c.Len() != 1 {
+		t.Error("Expected a to be removed")
+	}
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("Expected no entries after purging, got %d", c.Len())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(10, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Set("user", "alice")
+	now = now.Add(59 * time.Second)
+	if v, ok := c.Get("user"); !ok || v != "alice" {
+		t.Errorf("Expected alice before the TTL, got %v", v)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get("user"); ok {
+		t.Error("Expected the entry to expire after the TTL")
+	}
+}
+
+func TestDo(t *testing.T) {
+	c := New(10, 0)
+	var calls int32
+	release := make(chan struct{})
+	lookup := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "alice", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Do("user", lookup)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+	for v := range results {
+		if v != "alice" {
+			t.Errorf("Expected alice, got %v", v)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected concurrent lookups to share 1 call, got %d", calls)
+	}
+	c.Do("user", lookup)
+	if calls != 1 {
+		t.Errorf("Expected the result to be remembered, got %d calls", calls)
+	}
+}
+
+func TestDoError(t *testing.T) {
+	c := New(10, 0)
+	failed := errors.New("unavailable")
+	if _, err := c.Do("user", func() (interface{}, error) { return nil, failed }); err != failed {
+		t.Errorf("Expected the lookup's error, got %v", err)
+	}
+	v, err := c.Do("user", func() (interface{}, error) { return "alice", nil })
+	if err != nil || v != "alice" {
+		t.Errorf("Expected errors not to be remembered, got %v, %v", v, err)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	c := New(10, 0)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to reach the caller")
+			}
+		}()
+		c.Do("user", func() (interface{}, error) { panic("boom") })
+	}()
+	v, err := c.Do("user", func() (interface{}, error) { return "alice", nil })
+	if err != nil || v != "alice" {
+		t.Errorf("Expected the key to be looked up again after a panic, got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,299 @@
+// Package objectstore is a small client for S3-compatible object storage (AWS S3, MinIO, Ceph, etc.)
+// for plugins that need to stash artifacts too large to pass through the orchestrator inline.
+// Requests are signed with AWS Signature Version 4 and only use the standard library.
+package objectstore
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+const defaultRegion = "us-east-1"
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("Object not found")
+
+// Options configures where and how to reach the object store
+type Options struct {
+	Endpoint     string // Endpoint is the base URL, ie: https://s3.amazonaws.com or http://minio:9000
+	Region       string // Region defaults to us-east-1
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // SessionToken is only needed for temporary credentials
+
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of bucket.endpoint/key.
+	// Most self-hosted S3-compatible stores need this.
+	PathStyle bool
+	// CACert is an optional PEM encoded certificate bundle used to verify the endpoint
+	CACert []byte
+	// Timeout bounds each request, defaults to no timeout since objects can be large
+	Timeout time.Duration
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Client talks to a single bucket
+type Client struct {
+	opts     Options
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// New creates a Client for the bucket described by opts
+func New(opts Options) (*Client, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("An endpoint and bucket are required for the object store")
+	}
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid object store endpoint: %s", err)
+	}
+
+	var tlsConfig *tls.Config
+	if len(opts.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(opts.CACert) {
+			return nil, errors.New("Unable to parse the object store CA certificate")
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &Client{
+		opts:     opts,
+		endpoint: u,
+		client:   httpclient.New(httpclient.Options{TLS: tlsConfig, Timeout: opts.Timeout}),
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads size bytes from body to key. The size has to be known up front: S3 refuses uploads without
+// a length, and signing one streamed in chunks needs the length too.
+func (c *Client) Put(key string, body io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		return fmt.Errorf("Unable to upload %s without knowing its size", key)
+	}
+	if size == 0 {
+		// a body with a length of 0 is taken as one of unknown length, and sent chunked
+		body = nil
+	}
+	req, err := http.NewRequest("PUT", c.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads key. The caller is responsible for closing the returned reader.
+func (c *Client) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", c.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, emptyHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Head returns information about key without downloading it
+func (c *Client) Head(key string) (*ObjectInfo, error) {
+	req, err := http.NewRequest("HEAD", c.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, emptyHash)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength, ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lm
+	}
+	return info, nil
+}
+
+// Delete removes key. Deleting a key that does not exist is not an error.
+func (c *Client) Delete(key string) error {
+	req, err := http.NewRequest("DELETE", c.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, emptyHash)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns every object whose key starts with prefix, following continuation tokens
+func (c *Client) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		u := c.objectURL("")
+		q := url.Values{}
+		q.Set("list-type", "2")
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(q)
+
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req, emptyHash)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse object listing: %s", err)
+		}
+
+		for _, o := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          o.Key,
+				Size:         o.Size,
+				ETag:         strings.Trim(o.ETag, `"`),
+				LastModified: o.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Presign returns a URL that allows anyone holding it to perform method (GET or PUT) on key
+// until it expires, without any credentials of their own
+func (c *Client) Presign(method string, key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("Presigned URLs must expire within 7 days")
+	}
+	return c.presign(method, c.objectURL(key), expires, c.now()), nil
+}
+
+// Bucket returns the name of the bucket the client talks to
+func (c *Client) Bucket() string {
+	return c.opts.Bucket
+}
+
+// objectURL builds the URL for key in either path or virtual-host style
+func (c *Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	key = strings.TrimLeft(key, "/")
+	if c.opts.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + c.opts.Bucket + "/" + key
+	} else {
+		u.Host = c.opts.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	return &u
+}
+
+// Key returns the key of the object u is the URL of, ie: a presigned URL, and false if u isn't a URL of
+// an object in the client's bucket
+func (c *Client) Key(u *url.URL) (string, bool) {
+	base := c.objectURL("")
+	if u.Scheme != base.Scheme || !strings.EqualFold(u.Host, base.Host) || !strings.HasPrefix(u.Path, base.Path) {
+		return "", false
+	}
+	key := strings.TrimPrefix(u.Path, base.Path)
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return "", false
+	}
+	return key, true
+}
+
+func (c *Client) region() string {
+	if c.opts.Region == "" {
+		return defaultRegion
+	}
+	return c.opts.Region
+}
+
+// do signs and sends req, turning non-2xx responses into errors
+func (c *Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	c.sign(req, payloadHash, c.now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reach object store: %s", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	var s3err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+		return nil, fmt.Errorf("Object store returned %s: %s: %s", resp.Status, s3err.Code, s3err.Message)
+	}
+	return nil, fmt.Errorf("Object store returned %s", resp.Status)
+}
+
+var emptyHash = func() string {
+	h := sha256.Sum256(nil)
+	return hex.EncodeToString(h[:])
+}()
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
@@ -0,0 +1,164 @@
+package objectstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const amzDateFormat = "20060102T150405Z"
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds AWS Signature Version 4 headers to req. payloadHash is the hex sha256 of the body,
+// or UNSIGNED-PAYLOAD when streaming a body we can't hash up front.
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if c.opts.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", c.opts.SessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		value := req.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders += name + ":" + value + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope, signature := c.signature(now, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.opts.AccessKey, scope, signedHeaders, signature))
+}
+
+// presign returns a copy of u with the query string signature for method, valid for expires
+func (c *Client) presign(method string, u *url.URL, expires time.Duration, now time.Time) string {
+	amzDate := now.UTC().Format(amzDateFormat)
+	scope := credentialScope(now, c.region())
+
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", c.opts.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", fmt.Sprintf("%d", int64(expires/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if c.opts.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", c.opts.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI(u),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	_, signature := c.signature(now, canonicalRequest)
+	signed := *u
+	signed.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + signature
+	return signed.String()
+}
+
+// signature derives the signing key for the day and signs the canonical request
+func (c *Client) signature(now time.Time, canonicalRequest string) (string, string) {
+	scope := credentialScope(now, c.region())
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.UTC().Format(amzDateFormat),
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.opts.SecretKey), now.UTC().Format("20060102"))
+	key = hmacSHA256(key, c.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func credentialScope(now time.Time, region string) string {
+	return now.UTC().Format("20060102") + "/" + region + "/s3/aws4_request"
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalURI encodes each path segment the way S3 expects (it is not double encoded like other services)
+func canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = uriEncode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and strictly encodes the query string
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent encodes everything except the unreserved characters from RFC 3986
+func uriEncode(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
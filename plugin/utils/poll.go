@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Defaults of AdaptiveOptions
+const (
+	defaultAdaptiveFactor = 2
+	defaultQuietPolls     = 3
+)
+
+// AdaptiveOptions configures an AdaptiveInterval
+type AdaptiveOptions struct {
+	Min time.Duration // Min is the interval while events are flowing
+	Max time.Duration // Max is the interval a quiet source settles at
+	// Factor the interval is lengthened by, defaulting to 2
+	Factor float64
+	// QuietPolls is how many polls in a row have to come back empty before the interval is lengthened,
+	// defaulting to 3, so a source that's busy with gaps isn't slowed down by every gap
+	QuietPolls int
+}
+
+// AdaptiveInterval is a polling interval that backs off while a source is quiet, sparing its API quota,
+// and drops back to the minimum as soon as events flow again, keeping latency low. It isn't safe for
+// concurrent use.
+type AdaptiveInterval struct {
+	opts    AdaptiveOptions
+	current time.Duration
+	quiet   int
+}
+
+// NewAdaptiveInterval returns an interval starting at opts.Min
+func NewAdaptiveInterval(opts AdaptiveOptions) (*AdaptiveInterval, error) {
+	if opts.Min <= 0 || opts.Max < opts.Min {
+		return nil, errors.New("An adaptive interval needs a positive minimum, no greater than its maximum")
+	}
+	if opts.Factor <= 1 {
+		opts.Factor = defaultAdaptiveFactor
+	}
+	if opts.QuietPolls <= 0 {
+		opts.QuietPolls = defaultQuietPolls
+	}
+	return &AdaptiveInterval{opts: opts, current: opts.Min}, nil
+}
+
+// Current returns the interval until the next poll
+func (a *AdaptiveInterval) Current() time.Duration {
+	return a.current
+}
+
+// Observe records how many events a poll returned, and returns the interval until the next poll
+func (a *AdaptiveInterval) Observe(events int) time.Duration {
+	if events > 0 {
+		a.quiet = 0
+		a.current = a.opts.Min
+		return a.current
+	}
+	if a.quiet++; a.quiet >= a.opts.QuietPolls {
+		a.quiet = 0
+		a.current = time.Duration(float64(a.current) * a.opts.Factor)
+		if a.current > a.opts.Max {
+			a.current = a.opts.Max
+		}
+	}
+	return a.current
+}
+
+// PollAdaptive calls poll at an AdaptiveInterval until ctx is done, or poll fails. poll returns how
+// many events it found.
+//
+//	err := utils.PollAdaptive(ctx, utils.AdaptiveOptions{Min: 10 * time.Second, Max: 5 * time.Minute}, func(ctx context.Context) (int, error) {
+//		events, err := client.Fetch(ctx, cursor)
+//		...
+//		return len(events), nil
+//	})
+func PollAdaptive(ctx context.Context, opts AdaptiveOptions, poll func(ctx context.Context) (int, error)) error {
+	interval, err := NewAdaptiveInterval(opts)
+	if err != nil {
+		return err
+	}
+	for {
+		events, err := poll(ctx)
+		if err != nil {
+			return err
+		}
+		// jittered so the triggers of many tenants don't end up polling in step
+		if SleepCtx(ctx, Jitter(interval.Observe(events), 0.1)) != nil {
+			return nil
+		}
+	}
+}
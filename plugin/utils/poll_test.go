@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveIntervalHysteresis(t *testing.T) {
+	a, err := NewAdaptiveInterval(AdaptiveOptions{Min: time.Second, Max: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []time.Duration
+	for _, events := range []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0} {
+		got = append(got, a.Observe(events))
+	}
+	want := []time.Duration{1, 1, 2, 2, 2, 4, 4, 4, 5, 1, 1, 1}
+	for i := range want {
+		if got[i] != want[i]*time.Second {
+			t.Fatalf("Expected intervals %v seconds, got %v", want, got)
+		}
+	}
+
+	if _, err = NewAdaptiveInterval(AdaptiveOptions{Min: time.Minute, Max: time.Second}); err == nil {
+		t.Error("Expected a maximum below the minimum to be refused")
+	}
+}
+
+func TestPollAdaptiveStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	polls := 0
+	err := PollAdaptive(ctx, AdaptiveOptions{Min: time.Millisecond, Max: time.Millisecond}, func(context.Context) (int, error) {
+		if polls++; polls == 3 {
+			cancel()
+		}
+		return 0, nil
+	})
+	if err != nil || polls != 3 {
+		t.Errorf("Expected polling to stop once cancelled, got %d polls and %v", polls, err)
+	}
+
+	failed := errors.New("down")
+	err = PollAdaptive(context.Background(), AdaptiveOptions{Min: time.Millisecond, Max: time.Millisecond}, func(context.Context) (int, error) {
+		return 0, failed
+	})
+	if err != failed {
+		t.Errorf("Expected the poll's error, got %v", err)
+	}
+}
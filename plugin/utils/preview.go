@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/komand/plugin-sdk-go/plugin/schema"
+)
+
+// Redacted replaces the value of anything that looks like a secret in a preview
+const Redacted = "[REDACTED]"
+
+// defaultSecretKeys are matched case insensitively against field and map key names. A key containing any
+// of these is treated as a secret.
+var defaultSecretKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "cookie", "private_key", "credential"}
+
+// PreviewOptions controls how much of a payload Preview keeps. Zero values use the defaults.
+type PreviewOptions struct {
+	MaxDepth   int      // MaxDepth of nested objects and arrays to descend into, defaults to 4
+	MaxItems   int      // MaxItems kept from each array, defaults to 3
+	MaxString  int      // MaxString length before strings are truncated, defaults to 256
+	SecretKeys []string // SecretKeys are extra key names to redact, on top of the defaults
+	// Schema is the JSON Schema of the payload, ie: an action's input or output schema. Properties it gives
+	// the password format are redacted too, on top of the ones whose names look like secrets.
+	Schema *schema.Schema
+}
+
+// Preview returns a truncated, redacted copy of v that is safe to log. Struct fields are named as
+// they would be in JSON, and a field tagged `secret:"true"` or `sensitive:"true"` is always redacted, as
+// is anything the schema says is a password, and any field or map key whose name looks like a secret. Arrays are sampled, long strings are cut short and anything nested
+// deeper than MaxDepth is elided, so the preview stays small whatever the payload.
+func Preview(v interface{}, opts PreviewOptions) interface{} {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = 4
+	}
+	if opts.MaxItems <= 0 {
+		opts.MaxItems = 3
+	}
+	if opts.MaxString <= 0 {
+		opts.MaxString = 256
+	}
+	keys := append([]string{}, defaultSecretKeys...)
+	for _, k := range opts.SecretKeys {
+		keys = append(keys, strings.ToLower(k))
+	}
+	p := previewer{opts: opts, secretKeys: keys}
+	return p.walk(reflect.ValueOf(v), 0, opts.Schema)
+}
+
+// PreviewString renders Preview(v) as compact JSON for log lines
+func PreviewString(v interface{}, opts PreviewOptions) string {
+	b, err := json.Marshal(Preview(v, opts))
+	if err != nil {
+		return fmt.Sprintf("<unable to preview %T: %s>", v, err)
+	}
+	return string(b)
+}
+
+type previewer struct {
+	opts       PreviewOptions
+	secretKeys []string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// walk previews v, whose schema is s if it has one
+func (p previewer) walk(v reflect.Value, depth int, s *schema.Schema) interface{} {
+	if s.Secret() {
+		return Redacted
+	}
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	case v.Type() == rawMessageType:
+		var decoded interface{}
+		if err := json.Unmarshal(v.Bytes(), &decoded); err != nil {
+			return fmt.Sprintf("<%d bytes of invalid JSON>", v.Len())
+		}
+		return p.walk(reflect.ValueOf(decoded), depth, s)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return p.truncate(v.String())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return v.Interface()
+	case reflect.Struct:
+		if depth >= p.opts.MaxDepth {
+			return "{...}"
+		}
+		out := map[string]interface{}{}
+		p.walkStruct(v, depth, s, out)
+		return out
+	case reflect.Map:
+		if depth >= p.opts.MaxDepth {
+			return "{...}"
+		}
+		out := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			if p.isSecret(name) {
+				out[name] = Redacted
+				continue
+			}
+			out[name] = p.walk(v.MapIndex(key), depth+1, s.Property(name))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("<%d bytes>", v.Len())
+		}
+		if depth >= p.opts.MaxDepth {
+			return fmt.Sprintf("[... %d items]", v.Len())
+		}
+		n := v.Len()
+		out := []interface{}{}
+		for i := 0; i < n && i < p.opts.MaxItems; i++ {
+			out = append(out, p.walk(v.Index(i), depth+1, s.Items()))
+		}
+		if n > p.opts.MaxItems {
+			out = append(out, fmt.Sprintf("... %d more", n-p.opts.MaxItems))
+		}
+		return out
+	default:
+		return fmt.Sprintf("<%s>", v.Type())
+	}
+}
+
+// walkStruct adds the exported fields of v to out, flattening embedded structs like encoding/json
+func (p previewer) walkStruct(v reflect.Value, depth int, s *schema.Schema, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		fv := v.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				p.walkStruct(fv, depth, s, out)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Tag.Get("secret") == "true" || field.Tag.Get("sensitive") == "true" || p.isSecret(name) {
+			out[name] = Redacted
+			continue
+		}
+		out[name] = p.walk(fv, depth+1, s.Property(name))
+	}
+}
+
+func (p previewer) isSecret(name string) bool {
+	lower := strings.ToLower(name)
+	for _, k := range p.secretKeys {
+		if strings.Contains(lower, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts s down to MaxString bytes, without splitting a character
+func (p previewer) truncate(s string) string {
+	if len(s) <= p.opts.MaxString {
+		return s
+	}
+	cut := p.opts.MaxString
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("... (%d more bytes)", len(s)-cut)
+}
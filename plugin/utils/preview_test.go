@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/komand/plugin-sdk-go/plugin/schema"
+)
+
+type previewConnection struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Key      string `json:"key" secret:"true"`
+}
+
+func TestPreview(t *testing.T) {
+	payload := map[string]interface{}{
+		"connection": previewConnection{Username: "bob", Password: "hunter2", Key: "abc"},
+		"ids":        []int{1, 2, 3, 4, 5},
+		"api_token":  "xyz",
+		"nested":     map[string]interface{}{"a": map[string]interface{}{"b": "deep"}},
+	}
+	expected := `{"api_token":"[REDACTED]","connection":{"key":"[REDACTED]","password":"[REDACTED]","username":"bob"},"ids":[1,2,"... 3 more"],"nested":{"a":"{...}"}}`
+	if s := PreviewString(payload, PreviewOptions{MaxDepth: 2, MaxItems: 2}); s != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", s, expected)
+	}
+}
+
+type previewCredentials struct {
+	Username   string   `json:"username"`
+	Passphrase string   `json:"passphrase"`
+	Recovery   []string `json:"recovery"`
+	Signing    string   `json:"signing" sensitive:"true"`
+}
+
+func TestPreviewWithSchema(t *testing.T) {
+	s, err := schema.Compile(json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"passphrase": {"type": "string", "format": "password"},
+			"recovery": {"type": "array", "items": {"type": "string", "format": "password"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := previewCredentials{Username: "bob", Passphrase: "hunter2", Recovery: []string{"a", "b"}, Signing: "key"}
+	expected := `{"passphrase":"[REDACTED]","recovery":["[REDACTED]","[REDACTED]"],"signing":"[REDACTED]","username":"bob"}`
+	if s := PreviewString(payload, PreviewOptions{Schema: s}); s != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", s, expected)
+	}
+
+	// Names that look like secrets are redacted even when the schema doesn't mention them
+	raw := json.RawMessage(`{"password": "hunter2", "api_token": "abc", "passphrase": "hunter2", "count": 3}`)
+	expected = `{"api_token":"[REDACTED]","count":3,"passphrase":"[REDACTED]","password":"[REDACTED]"}`
+	if s := PreviewString(raw, PreviewOptions{Schema: s}); s != expected {
+		t.Fatalf("Got:\n%s\nbut expected:\n%s", s, expected)
+	}
+}
+
+func TestPreviewTruncatesCharacters(t *testing.T) {
+	p := Preview("héllo wörld", PreviewOptions{MaxString: 2}).(string)
+	if !strings.HasPrefix(p, "h... ") || !strings.HasSuffix(p, "(12 more bytes)") {
+		t.Fatalf("Expected the string to be cut before the character split, got %q", p)
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The SDK and plugins should take randomness for jitter and sampling from Rand rather than math/rand's
+// global source, so tests can swap in a seeded source and get reproducible results. Identifiers that have
+// to be unique, ie: tokens proving who holds a lock, come from UniqueID instead, which a seed can't repeat.
+var randMu sync.Mutex
+var randSource = newLockedSource(rand.NewSource(time.Now().UnixNano()))
+var randGen = rand.New(randSource)
+
+// Rand returns the shared random number generator. It is safe for concurrent use.
+func Rand() *rand.Rand {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return randGen
+}
+
+// SetRandSeed makes Rand deterministic, producing the same sequence for the same seed
+func SetRandSeed(seed int64) {
+	SetRandSource(rand.NewSource(seed))
+}
+
+// SetCryptoRand makes Rand draw from crypto/rand, for code paths where predictability matters more
+// than speed
+func SetCryptoRand() {
+	SetRandSource(cryptoSource{})
+}
+
+// SetRandSource replaces the source behind Rand and returns the previous one, so callers
+// (typically tests) can restore it
+func SetRandSource(src rand.Source) rand.Source {
+	randMu.Lock()
+	defer randMu.Unlock()
+	previous := randSource.src
+	randSource = newLockedSource(src)
+	randGen = rand.New(randSource)
+	return previous
+}
+
+// UniqueID returns a random 128 bit hex identifier drawn from crypto/rand, for identifiers that must not
+// collide with another process's, however Rand is seeded
+func UniqueID() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		panic("utils: crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// RandomID returns a random 126 bit hex identifier drawn from Rand, so it's repeated by a seeded Rand. Use
+// UniqueID for identifiers that must be unique.
+func RandomID() string {
+	b := make([]byte, 16)
+	r := Rand()
+	binary.LittleEndian.PutUint64(b[:8], uint64(r.Int63()))
+	binary.LittleEndian.PutUint64(b[8:], uint64(r.Int63()))
+	return hex.EncodeToString(b)
+}
+
+// Jitter returns d randomly adjusted by up to +/- fraction of itself, ie: Jitter(10*time.Second, 0.2)
+// is somewhere between 8s and 12s
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	delta := (Rand().Float64()*2 - 1) * fraction * float64(d)
+	return d + time.Duration(delta)
+}
+
+// lockedSource makes a rand.Source safe for concurrent use, like math/rand's global source
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func newLockedSource(src rand.Source) *lockedSource {
+	return &lockedSource{src: src}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// cryptoSource is a rand.Source backed by crypto/rand
+type cryptoSource struct{}
+
+func (cryptoSource) Int63() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic("utils: crypto/rand failed: " + err.Error())
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]) & (1<<63 - 1))
+}
+
+func (cryptoSource) Seed(int64) {}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestUniqueIDIgnoresSeed(t *testing.T) {
+	defer SetRandSource(SetRandSource(rand.NewSource(1)))
+	random, unique := RandomID(), UniqueID()
+	SetRandSeed(1)
+	if RandomID() != random {
+		t.Fatal("Expected a seeded RandomID to repeat")
+	}
+	if id := UniqueID(); id == unique || len(id) != 32 {
+		t.Fatalf("Expected a new 128 bit UniqueID whatever the seed, got %s after %s", id, unique)
+	}
+}
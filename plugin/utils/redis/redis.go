@@ -0,0 +1,501 @@
+// Package redis is a thin Redis client for plugins that talk to Redis, and for the SDK's own
+// Redis-backed helpers. It speaks just enough of the protocol to authenticate, select a database,
+// run commands over TLS, follow cluster redirects and discover a master through sentinels.
+// Connections are pooled per server and reused between calls, so a Client should be created once
+// and shared rather than created per request.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+const defaultPoolSize = 4
+const defaultDialTimeout = 5 * time.Second
+const defaultCommandTimeout = 5 * time.Second
+const maxRedirects = 5
+
+// ErrNil is returned by the typed helpers when the key does not exist
+var ErrNil = errors.New("redis: nil")
+
+// Options configures how a Client reaches the server(s)
+type Options struct {
+	// Addr is the host:port of a standalone server. It is ignored when sentinels or cluster nodes are given.
+	Addr string
+	// Username and Password are used to AUTH each new connection. Username is only needed for Redis 6 ACLs.
+	Username string
+	Password string
+	// DB is selected on each new connection. Redis Cluster only supports DB 0.
+	DB int
+	// TLS enables TLS when not nil
+	TLS *tls.Config
+
+	// SentinelAddrs and SentinelMaster enable discovery of the current master through sentinels
+	SentinelAddrs  []string
+	SentinelMaster string
+
+	// ClusterAddrs are seed nodes for a Redis Cluster, tried in turn until one answers. MOVED and ASK
+	// redirects are followed.
+	ClusterAddrs []string
+
+	DialTimeout time.Duration // defaults to 5s
+	// CommandTimeout bounds sending each command and reading its reply, defaulting to 5s. Negative is no
+	// bound, for blocking commands: use DoContext to bound those instead.
+	CommandTimeout time.Duration
+	PoolSize       int // idle connections kept per server, defaults to 4
+}
+
+// Client is a pooled connection to a Redis deployment. It is safe for concurrent use.
+type Client struct {
+	opts Options
+
+	mu     sync.Mutex
+	pools  map[string]chan *conn
+	master string        // resolved sentinel master
+	seed   int           // index of the cluster seed node that last answered
+	slots  [16384]string // cluster slot -> node address, filled in lazily from MOVED replies
+}
+
+type conn struct {
+	addr string
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// New creates a Client. No connection is made until the first command, call Ping to verify settings.
+func New(opts Options) (*Client, error) {
+	if opts.Addr == "" && len(opts.SentinelAddrs) == 0 && len(opts.ClusterAddrs) == 0 {
+		return nil, errors.New("No redis address, sentinel or cluster node was provided")
+	}
+	if len(opts.SentinelAddrs) > 0 && opts.SentinelMaster == "" {
+		return nil, errors.New("A sentinel master name is required when using sentinels")
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+	if opts.CommandTimeout == 0 {
+		opts.CommandTimeout = defaultCommandTimeout
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	return &Client{opts: opts, pools: map[string]chan *conn{}}, nil
+}
+
+// Do runs a command and returns the raw reply: string, int64, []interface{} or nil.
+// An error reply from the server is returned as an Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	return c.DoContext(context.Background(), args...)
+}
+
+// DoContext runs a command like Do, giving up when ctx is done, or its deadline passes if that's before
+// the command timeout. The connection a command is given up on is closed, rather than reused with its
+// reply still to come.
+func (c *Client) DoContext(ctx context.Context, args ...string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("No redis command given")
+	}
+	addr, err := c.addrFor(args)
+	if err != nil {
+		return nil, err
+	}
+
+	asking := false
+	for i := 0; i <= maxRedirects; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reply, err := c.doOn(ctx, addr, asking, args)
+		if err != nil {
+			return nil, err
+		}
+		rerr, ok := reply.(Error)
+		if !ok {
+			return reply, nil
+		}
+		// Cluster redirects look like "MOVED 3999 127.0.0.1:6381"
+		fields := strings.Fields(string(rerr))
+		if len(fields) == 3 && (fields[0] == "MOVED" || fields[0] == "ASK") {
+			addr, asking = fields[2], fields[0] == "ASK"
+			if !asking {
+				if slot, err := strconv.Atoi(fields[1]); err == nil && slot >= 0 && slot < len(c.slots) {
+					c.mu.Lock()
+					c.slots[slot] = addr
+					c.mu.Unlock()
+				}
+			}
+			continue
+		}
+		return nil, rerr
+	}
+	return nil, fmt.Errorf("Too many redis cluster redirects for %s", args[0])
+}
+
+// Ping checks the server is reachable and the credentials work
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
+
+// Get returns the value of key, or ErrNil if it does not exist
+func (c *Client) Get(key string) ([]byte, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNil
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected reply type %T for GET", reply)
+	}
+	return []byte(s), nil
+}
+
+// Set stores value at key. A ttl of zero means the key never expires.
+func (c *Client) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// SetNX stores value at key only if it does not already exist, and reports whether it was stored
+func (c *Client) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	reply, err := c.Do(args...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// Eval runs a Lua script against keys, so check-and-set style operations happen atomically on the server
+func (c *Client) Eval(script string, keys []string, args ...string) (interface{}, error) {
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return c.Do(append(cmd, args...)...)
+}
+
+// Del removes the keys and returns how many existed
+func (c *Client) Del(keys ...string) (int64, error) {
+	reply, err := c.Do(append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// GetJSON reads key and unmarshals it into v, returning ErrNil if it does not exist
+func (c *Client) GetJSON(key string, v interface{}) error {
+	b, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// SetJSON marshals v and stores it at key. A ttl of zero means the key never expires.
+func (c *Client) SetJSON(key string, v interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(key, b, ttl)
+}
+
+// Close closes all idle pooled connections
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, pool := range c.pools {
+	drain:
+		for {
+			select {
+			case cn := <-pool:
+				cn.Close()
+			default:
+				break drain
+			}
+		}
+		delete(c.pools, addr)
+	}
+	return nil
+}
+
+// doOn runs a single command on the server at addr, or a cluster seed node if it's "", returning the connection to the pool afterwards
+func (c *Client) doOn(ctx context.Context, addr string, asking bool, args []string) (interface{}, error) {
+	var cn *conn
+	var err error
+	if addr == "" {
+		cn, err = c.getSeed()
+	} else {
+		cn, err = c.get(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	done := c.deadline(ctx, cn)
+	reply, err := roundTrip(cn, asking, args)
+	done()
+	if err != nil {
+		cn.Close()
+		c.forgetMaster()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	c.put(cn)
+	return reply, nil
+}
+
+// roundTrip sends a command, preceded by ASKING when following an ASK redirect, and reads its reply
+func roundTrip(cn *conn, asking bool, args []string) (interface{}, error) {
+	if asking {
+		if err := writeCommand(cn.w, []string{"ASKING"}); err != nil {
+			return nil, err
+		}
+		if _, err := readReply(cn.r); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeCommand(cn.w, args); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// deadline sets the deadline of the next command on cn, the command timeout or ctx's deadline if that's
+// sooner, and has ctx being done interrupt it. The returned function stops watching ctx.
+func (c *Client) deadline(ctx context.Context, cn *conn) (done func()) {
+	var d time.Time
+	if c.opts.CommandTimeout > 0 {
+		d = time.Now().Add(c.opts.CommandTimeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (d.IsZero() || ctxDeadline.Before(d)) {
+		d = ctxDeadline
+	}
+	// set even when zero, a pooled connection may have the deadline of its last command
+	cn.SetDeadline(d)
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			cn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// addrFor works out which server a command should go to, "" for any cluster seed node
+func (c *Client) addrFor(args []string) (string, error) {
+	switch {
+	case len(c.opts.ClusterAddrs) > 0:
+		if key, ok := commandKey(args); ok {
+			c.mu.Lock()
+			addr := c.slots[Slot(key)]
+			c.mu.Unlock()
+			if addr != "" {
+				return addr, nil
+			}
+		}
+		return "", nil // any seed node will redirect it
+	case len(c.opts.SentinelAddrs) > 0:
+		return c.resolveMaster()
+	default:
+		return c.opts.Addr, nil
+	}
+}
+
+// commandKey returns the first key a command touches, which for most commands is its first argument
+func commandKey(args []string) (string, bool) {
+	if len(args) > 3 && (strings.EqualFold(args[0], "EVAL") || strings.EqualFold(args[0], "EVALSHA")) {
+		return args[3], args[2] != "0"
+	}
+	if len(args) > 1 {
+		return args[1], true
+	}
+	return "", false
+}
+
+// resolveMaster asks each sentinel in turn for the current master address
+func (c *Client) resolveMaster() (string, error) {
+	c.mu.Lock()
+	master := c.master
+	c.mu.Unlock()
+	if master != "" {
+		return master, nil
+	}
+
+	var lastErr error
+	for _, sentinel := range c.opts.SentinelAddrs {
+		cn, err := c.dial(sentinel, false)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.deadline(context.Background(), cn)
+		err = writeCommand(cn.w, []string{"SENTINEL", "get-master-addr-by-name", c.opts.SentinelMaster})
+		var reply interface{}
+		if err == nil {
+			reply, err = readReply(cn.r)
+		}
+		cn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if hostPort, ok := reply.([]interface{}); ok && len(hostPort) == 2 {
+			host, _ := hostPort[0].(string)
+			port, _ := hostPort[1].(string)
+			master = net.JoinHostPort(host, port)
+			c.mu.Lock()
+			c.master = master
+			c.mu.Unlock()
+			return master, nil
+		}
+		lastErr = fmt.Errorf("Sentinel %s does not know master %s", sentinel, c.opts.SentinelMaster)
+	}
+	return "", fmt.Errorf("Unable to resolve redis master through sentinels: %s", lastErr)
+}
+
+// forgetMaster drops the resolved sentinel master so the next command asks the sentinels again,
+// which is how we pick up a failover
+func (c *Client) forgetMaster() {
+	c.mu.Lock()
+	c.master = ""
+	c.mu.Unlock()
+}
+
+// get takes an idle connection for addr from the pool, or dials a new one
+func (c *Client) get(addr string) (*conn, error) {
+	c.mu.Lock()
+	pool := c.pools[addr]
+	c.mu.Unlock()
+	if pool != nil {
+		select {
+		case cn := <-pool:
+			return cn, nil
+		default:
+		}
+	}
+	return c.dial(addr, true)
+}
+
+// getSeed gets a connection to a cluster seed node, trying each in turn from the last one that answered,
+// so one node being down doesn't make the whole cluster unreachable
+func (c *Client) getSeed() (*conn, error) {
+	c.mu.Lock()
+	first := c.seed
+	c.mu.Unlock()
+	seeds := c.opts.ClusterAddrs
+	var lastErr error
+	for i := range seeds {
+		n := (first + i) % len(seeds)
+		cn, err := c.get(seeds[n])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.seed = n
+		c.mu.Unlock()
+		return cn, nil
+	}
+	return nil, fmt.Errorf("Unable to reach any redis cluster node: %s", lastErr)
+}
+
+// put returns a healthy connection to its pool, closing it if the pool is full
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	pool, ok := c.pools[cn.addr]
+	if !ok {
+		pool = make(chan *conn, c.opts.PoolSize)
+		c.pools[cn.addr] = pool
+	}
+	c.mu.Unlock()
+	select {
+	case pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// dial opens a connection, and when setup is true authenticates and selects the database
+func (c *Client) dial(addr string, setup bool) (*conn, error) {
+	var nc net.Conn
+	var err error
+	if err = httpclient.CheckEgress(addr); err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: c.opts.DialTimeout}
+	if c.opts.TLS != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, c.opts.TLS)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to redis at %s: %s", addr, err)
+	}
+	cn := &conn{addr: addr, Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if !setup {
+		return cn, nil
+	}
+
+	var cmds [][]string
+	if c.opts.Password != "" {
+		if c.opts.Username != "" {
+			cmds = append(cmds, []string{"AUTH", c.opts.Username, c.opts.Password})
+		} else {
+			cmds = append(cmds, []string{"AUTH", c.opts.Password})
+		}
+	}
+	if c.opts.DB != 0 && len(c.opts.ClusterAddrs) == 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	c.deadline(context.Background(), cn)
+	for _, cmd := range cmds {
+		if err := writeCommand(cn.w, cmd); err != nil {
+			cn.Close()
+			return nil, err
+		}
+		reply, err := readReply(cn.r)
+		if err == nil {
+			if rerr, ok := reply.(Error); ok {
+				err = rerr
+			}
+		}
+		if err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("Redis %s failed: %s", cmd[0], err)
+		}
+	}
+	return cn, nil
+}
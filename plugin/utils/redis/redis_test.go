@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers just enough commands to exercise the client
+func fakeServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// connections are served one at a time, so the map needs no lock
+	data := map[string]string{}
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			func(nc net.Conn) {
+				defer nc.Close()
+				r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+				for {
+					reply, err := readReply(r)
+					if err != nil {
+						return
+					}
+					args := reply.([]interface{})
+					switch args[0].(string) {
+					case "BLPOP":
+						// blocks until the client gives up on it
+						continue
+					case "PING":
+						w.WriteString("+PONG\r\n")
+					case "SET":
+						data[args[1].(string)] = args[2].(string)
+						w.WriteString("+OK\r\n")
+					case "GET":
+						if v, ok := data[args[1].(string)]; ok {
+							fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+						} else {
+							w.WriteString("$-1\r\n")
+						}
+					default:
+						w.WriteString("-ERR unknown command\r\n")
+					}
+					w.Flush()
+				}
+			}(nc)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestSetGet(t *testing.T) {
+	c, err := New(Options{Addr: fakeServer(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("greeting", []byte("sup"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("greeting"); err != nil || string(v) != "sup" {
+		t.Fatalf("Expected sup but got %s (%v)", v, err)
+	}
+	if _, err := c.Get("missing"); err != ErrNil {
+		t.Fatalf("Expected ErrNil but got %v", err)
+	}
+	if _, err := c.Do("BOGUS"); err == nil {
+		t.Fatal("Expected an error reply")
+	} else if _, ok := err.(Error); !ok {
+		t.Fatalf("Expected a redis Error but got %T", err)
+	}
+}
+
+func TestSlot(t *testing.T) {
+	if s := Slot("123456789"); s != 12739 {
+		t.Fatalf("Expected slot 12739 but got %d", s)
+	}
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Fatal("Expected keys sharing a hash tag to share a slot")
+	}
+}
+
+func TestCommandsHaveDeadlines(t *testing.T) {
+	c, err := New(Options{Addr: fakeServer(t), CommandTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err = c.Do("BLPOP", "queue", "0"); err == nil {
+		t.Fatal("Expected a command without a reply to time out")
+	} else if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	// Given up on when ctx is cancelled, without a deadline of its own
+	c.opts.CommandTimeout = -1
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err = c.DoContext(ctx, "BLPOP", "queue", "0"); err != context.Canceled {
+		t.Fatalf("Expected the command to be cancelled, got %v", err)
+	}
+
+	// and the connections given up on aren't reused
+	if err = c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterTriesEachSeed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().String()
+	l.Close()
+
+	c, err := New(Options{ClusterAddrs: []string{dead, fakeServer(t)}, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Set("greeting", []byte("sup"), 0); err != nil {
+		t.Fatalf("Expected the second seed to be used when the first is down, got %v", err)
+	}
+	if v, err := c.Get("greeting"); err != nil || string(v) != "sup" {
+		t.Fatalf("Expected sup but got %s (%v)", v, err)
+	}
+
+	c, err = New(Options{ClusterAddrs: []string{dead}, DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Ping(); err == nil {
+		t.Fatal("Expected an error when no seed answers")
+	}
+}
+
+func TestRepliesAreBounded(t *testing.T) {
+	for _, reply := range []string{"$536870913\r\n", "*536870913\r\n"} {
+		if _, err := readReply(bufio.NewReader(strings.NewReader(reply))); err == nil {
+			t.Errorf("Expected %q to be refused", reply)
+		}
+	}
+	// a large array length is only trusted as far as its items arrive
+	if _, err := readReply(bufio.NewReader(strings.NewReader("*536870912\r\n:1\r\n"))); err != io.EOF {
+		t.Fatalf("Expected the reply to be cut short, got %v", err)
+	}
+	reply, err := readReply(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nsup\r\n:7\r\n")))
+	if items, ok := reply.([]interface{}); err != nil || !ok || len(items) != 2 || items[0] != "sup" || items[1] != int64(7) {
+		t.Fatalf("Expected [sup 7], got %v, %v", reply, err)
+	}
+}
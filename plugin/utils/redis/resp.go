@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxBulkLength is the longest string Redis itself will hold, so a bulk or array length over it is a
+// broken or hostile server rather than something to allocate room for
+const maxBulkLength = 512 << 20
+
+// Error is a reply from the server that carried an error, ie: "-ERR unknown command"
+type Error string
+
+// Error implements the error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+// writeCommand encodes the arguments as a RESP array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// readReply decodes a single RESP reply. Simple and bulk strings come back as string,
+// integers as int64, arrays as []interface{} and nil bulk strings or arrays as nil.
+// Server errors are returned as an Error in the value position, so callers can tell them
+// apart from a broken connection.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("Empty reply from redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bulk length from redis: %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxBulkLength {
+			return nil, fmt.Errorf("Bulk length %d from redis is over the %d byte limit", n, maxBulkLength)
+		}
+		buf := make([]byte, n+2) // include the trailing \r\n
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid array length from redis: %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxBulkLength {
+			return nil, fmt.Errorf("Array length %d from redis is over the %d element limit", n, maxBulkLength)
+		}
+		// grown as items arrive rather than sized up front, each takes at least a few bytes to send
+		items := make([]interface{}, 0, minInt(n, 1024))
+		for i := 0; i < n; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("Unexpected reply from redis: %q", line)
+	}
+}
+
+// readLine reads up to the next \r\n and strips it
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("Malformed line from redis: %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
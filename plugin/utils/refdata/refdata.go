@@ -0,0 +1,178 @@
+// Package refdata ships reference tables that many plugins need to turn codes into names: ISO 3166
+// countries, IANA well-known ports and services, and autonomous system names. Countries and services
+// are compiled in. ASN names change too often and the full table is too large to ship, so they are
+// loaded from a data file the plugin provides.
+package refdata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Country is an ISO 3166-1 country
+type Country struct {
+	Alpha2  string `json:"alpha2"`
+	Alpha3  string `json:"alpha3"`
+	Numeric string `json:"numeric"`
+	Name    string `json:"name"`
+}
+
+// Service is a named service on a well-known port
+type Service struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"` // tcp or udp
+	Name     string `json:"name"`
+}
+
+// ASN is an autonomous system and the organization it belongs to
+type ASN struct {
+	Number  uint32 `json:"number"`
+	Name    string `json:"name"`
+	Country string `json:"country,omitempty"`
+}
+
+var countryIndex = map[string]*Country{}
+var serviceIndex = map[string]*Service{}
+var serviceNames = map[string]*Service{}
+
+func init() {
+	for i := range countries {
+		c := &countries[i]
+		countryIndex[c.Alpha2] = c
+		countryIndex[c.Alpha3] = c
+		countryIndex[c.Numeric] = c
+		countryIndex[strings.ToUpper(c.Name)] = c
+	}
+	for i := range services {
+		s := &services[i]
+		serviceIndex[serviceKey(s.Port, s.Protocol)] = s
+		if _, ok := serviceNames[s.Name]; !ok {
+			serviceNames[s.Name] = s
+		}
+	}
+}
+
+// LookupCountry finds a country by its alpha-2, alpha-3 or numeric code, or its name. It is case insensitive.
+func LookupCountry(code string) (Country, bool) {
+	c, ok := countryIndex[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Country{}, false
+	}
+	return *c, true
+}
+
+// Countries returns every country, ordered by alpha-2 code
+func Countries() []Country {
+	out := make([]Country, len(countries))
+	copy(out, countries)
+	return out
+}
+
+// LookupService returns the service registered on port for protocol ("tcp" or "udp")
+func LookupService(port int, protocol string) (Service, bool) {
+	s, ok := serviceIndex[serviceKey(port, protocol)]
+	if !ok {
+		return Service{}, false
+	}
+	return *s, true
+}
+
+// LookupPort returns the first service registered under name, ie: "https" is 443/tcp
+func LookupPort(name string) (Service, bool) {
+	s, ok := serviceNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Service{}, false
+	}
+	return *s, true
+}
+
+func serviceKey(port int, protocol string) string {
+	return strconv.Itoa(port) + "/" + strings.ToLower(protocol)
+}
+
+var asnMu sync.RWMutex
+var asns = map[uint32]ASN{}
+
+// LoadASNFile replaces the ASN table with the contents of a CSV file, see LoadASNData
+func LoadASNFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadASNData(f)
+}
+
+// LoadASNData replaces the ASN table with CSV rows of "asn,name[,country]". The asn may be prefixed
+// with "AS", and blank lines and lines starting with # are ignored. The table is swapped in only if the whole
+// file parses, so a bad file never leaves lookups half loaded.
+func LoadASNData(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	table := map[uint32]ASN{}
+	first := true
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// read a line at a time, so errors are reported with the line of the file, comments and all
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.FieldsPerRecord = -1
+		record, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("ASN data line %d: %s", line, err)
+		}
+		if len(record) < 2 {
+			return fmt.Errorf("ASN data line %d has %d fields, expected at least 2", line, len(record))
+		}
+		header := first
+		first = false
+		number, err := ParseASN(record[0])
+		if err != nil {
+			if header {
+				continue // most likely a header
+			}
+			return fmt.Errorf("ASN data line %d: %s", line, err)
+		}
+		asn := ASN{Number: number, Name: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			asn.Country = strings.TrimSpace(record[2])
+		}
+		table[number] = asn
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Unable to read ASN data: %s", err)
+	}
+
+	asnMu.Lock()
+	asns = table
+	asnMu.Unlock()
+	return nil
+}
+
+// LookupASN returns the autonomous system for number. LoadASNData must be called first.
+func LookupASN(number uint32) (ASN, bool) {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	asn, ok := asns[number]
+	return asn, ok
+}
+
+// ParseASN parses an autonomous system number written as "13335", "AS13335" or "as13335"
+func ParseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid autonomous system number: %s", s)
+	}
+	return uint32(n), nil
+}
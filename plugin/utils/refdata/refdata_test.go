@@ -0,0 +1,45 @@
+package refdata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookups(t *testing.T) {
+	for _, code := range []string{"de", "DEU", "276", "germany"} {
+		if c, ok := LookupCountry(code); !ok || c.Alpha2 != "DE" {
+			t.Fatalf("Expected %s to be Germany, got %+v", code, c)
+		}
+	}
+	if s, ok := LookupService(443, "TCP"); !ok || s.Name != "https" {
+		t.Fatalf("Expected 443/tcp to be https, got %+v", s)
+	}
+	if s, ok := LookupPort("ssh"); !ok || s.Port != 22 {
+		t.Fatalf("Expected ssh to be port 22, got %+v", s)
+	}
+	if s, ok := LookupPort("echo"); !ok || s.Port != 7 || s.Protocol != "tcp" {
+		t.Fatalf("Expected echo to be 7/tcp, got %+v", s)
+	}
+	for _, s := range services {
+		if s.Protocol != "tcp" && s.Protocol != "udp" {
+			t.Errorf("Expected every service to be tcp or udp, got %+v", s)
+		}
+	}
+}
+
+func TestLoadASNData(t *testing.T) {
+	data := "asn,name,country\n# comment\nAS13335,\"Cloudflare, Inc.\",US\n15169,Google LLC\n"
+	if err := LoadASNData(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if asn, ok := LookupASN(13335); !ok || asn.Name != "Cloudflare, Inc." || asn.Country != "US" {
+		t.Fatalf("Unexpected ASN %+v", asn)
+	}
+	err := LoadASNData(strings.NewReader("1,a\n# comment\n\nbogus,b\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("Expected an error for the bad ASN on line 4, got %v", err)
+	}
+	if _, ok := LookupASN(15169); !ok {
+		t.Fatal("Expected a failed load to keep the previous table")
+	}
+}
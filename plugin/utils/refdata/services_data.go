@@ -0,0 +1,319 @@
+package refdata
+
+// services are the IANA registered service names for well-known ports, as shipped in the
+// netbase /etc/services file, without its AppleTalk and SCTP rows
+var services = []Service{
+	{Port: 1, Protocol: "tcp", Name: "tcpmux"},
+	{Port: 7, Protocol: "tcp", Name: "echo"},
+	{Port: 7, Protocol: "udp", Name: "echo"},
+	{Port: 9, Protocol: "tcp", Name: "discard"},
+	{Port: 9, Protocol: "udp", Name: "discard"},
+	{Port: 11, Protocol: "tcp", Name: "systat"},
+	{Port: 13, Protocol: "tcp", Name: "daytime"},
+	{Port: 13, Protocol: "udp", Name: "daytime"},
+	{Port: 15, Protocol: "tcp", Name: "netstat"},
+	{Port: 17, Protocol: "tcp", Name: "qotd"},
+	{Port: 19, Protocol: "tcp", Name: "chargen"},
+	{Port: 19, Protocol: "udp", Name: "chargen"},
+	{Port: 20, Protocol: "tcp", Name: "ftp-data"},
+	{Port: 21, Protocol: "tcp", Name: "ftp"},
+	{Port: 21, Protocol: "udp", Name: "fsp"},
+	{Port: 22, Protocol: "tcp", Name: "ssh"},
+	{Port: 23, Protocol: "tcp", Name: "telnet"},
+	{Port: 25, Protocol: "tcp", Name: "smtp"},
+	{Port: 37, Protocol: "tcp", Name: "time"},
+	{Port: 37, Protocol: "udp", Name: "time"},
+	{Port: 43, Protocol: "tcp", Name: "whois"},
+	{Port: 49, Protocol: "tcp", Name: "tacacs"},
+	{Port: 49, Protocol: "udp", Name: "tacacs"},
+	{Port: 53, Protocol: "tcp", Name: "domain"},
+	{Port: 53, Protocol: "udp", Name: "domain"},
+	{Port: 67, Protocol: "udp", Name: "bootps"},
+	{Port: 68, Protocol: "udp", Name: "bootpc"},
+	{Port: 69, Protocol: "udp", Name: "tftp"},
+	{Port: 70, Protocol: "tcp", Name: "gopher"},
+	{Port: 79, Protocol: "tcp", Name: "finger"},
+	{Port: 80, Protocol: "tcp", Name: "http"},
+	{Port: 88, Protocol: "tcp", Name: "kerberos"},
+	{Port: 88, Protocol: "udp", Name: "kerberos"},
+	{Port: 102, Protocol: "tcp", Name: "iso-tsap"},
+	{Port: 104, Protocol: "tcp", Name: "acr-nema"},
+	{Port: 106, Protocol: "tcp", Name: "poppassd"},
+	{Port: 110, Protocol: "tcp", Name: "pop3"},
+	{Port: 111, Protocol: "tcp", Name: "sunrpc"},
+	{Port: 111, Protocol: "udp", Name: "sunrpc"},
+	{Port: 113, Protocol: "tcp", Name: "auth"},
+	{Port: 119, Protocol: "tcp", Name: "nntp"},
+	{Port: 123, Protocol: "udp", Name: "ntp"},
+	{Port: 135, Protocol: "tcp", Name: "epmap"},
+	{Port: 137, Protocol: "udp", Name: "netbios-ns"},
+	{Port: 138, Protocol: "udp", Name: "netbios-dgm"},
+	{Port: 139, Protocol: "tcp", Name: "netbios-ssn"},
+	{Port: 143, Protocol: "tcp", Name: "imap2"},
+	{Port: 161, Protocol: "tcp", Name: "snmp"},
+	{Port: 161, Protocol: "udp", Name: "snmp"},
+	{Port: 162, Protocol: "tcp", Name: "snmp-trap"},
+	{Port: 162, Protocol: "udp", Name: "snmp-trap"},
+	{Port: 163, Protocol: "tcp", Name: "cmip-man"},
+	{Port: 163, Protocol: "udp", Name: "cmip-man"},
+	{Port: 164, Protocol: "tcp", Name: "cmip-agent"},
+	{Port: 164, Protocol: "udp", Name: "cmip-agent"},
+	{Port: 174, Protocol: "tcp", Name: "mailq"},
+	{Port: 177, Protocol: "udp", Name: "xdmcp"},
+	{Port: 179, Protocol: "tcp", Name: "bgp"},
+	{Port: 199, Protocol: "tcp", Name: "smux"},
+	{Port: 209, Protocol: "tcp", Name: "qmtp"},
+	{Port: 210, Protocol: "tcp", Name: "z3950"},
+	{Port: 213, Protocol: "udp", Name: "ipx"},
+	{Port: 319, Protocol: "udp", Name: "ptp-event"},
+	{Port: 320, Protocol: "udp", Name: "ptp-general"},
+	{Port: 345, Protocol: "tcp", Name: "pawserv"},
+	{Port: 346, Protocol: "tcp", Name: "zserv"},
+	{Port: 369, Protocol: "tcp", Name: "rpc2portmap"},
+	{Port: 369, Protocol: "udp", Name: "rpc2portmap"},
+	{Port: 370, Protocol: "tcp", Name: "codaauth2"},
+	{Port: 370, Protocol: "udp", Name: "codaauth2"},
+	{Port: 371, Protocol: "udp", Name: "clearcase"},
+	{Port: 389, Protocol: "tcp", Name: "ldap"},
+	{Port: 389, Protocol: "udp", Name: "ldap"},
+	{Port: 427, Protocol: "tcp", Name: "svrloc"},
+	{Port: 427, Protocol: "udp", Name: "svrloc"},
+	{Port: 443, Protocol: "tcp", Name: "https"},
+	{Port: 443, Protocol: "udp", Name: "https"},
+	{Port: 444, Protocol: "tcp", Name: "snpp"},
+	{Port: 445, Protocol: "tcp", Name: "microsoft-ds"},
+	{Port: 464, Protocol: "tcp", Name: "kpasswd"},
+	{Port: 464, Protocol: "udp", Name: "kpasswd"},
+	{Port: 465, Protocol: "tcp", Name: "submissions"},
+	{Port: 487, Protocol: "tcp", Name: "saft"},
+	{Port: 500, Protocol: "udp", Name: "isakmp"},
+	{Port: 512, Protocol: "tcp", Name: "exec"},
+	{Port: 512, Protocol: "udp", Name: "biff"},
+	{Port: 513, Protocol: "tcp", Name: "login"},
+	{Port: 513, Protocol: "udp", Name: "who"},
+	{Port: 514, Protocol: "tcp", Name: "shell"},
+	{Port: 514, Protocol: "udp", Name: "syslog"},
+	{Port: 515, Protocol: "tcp", Name: "printer"},
+	{Port: 517, Protocol: "udp", Name: "talk"},
+	{Port: 518, Protocol: "udp", Name: "ntalk"},
+	{Port: 520, Protocol: "udp", Name: "route"},
+	{Port: 538, Protocol: "tcp", Name: "gdomap"},
+	{Port: 538, Protocol: "udp", Name: "gdomap"},
+	{Port: 540, Protocol: "tcp", Name: "uucp"},
+	{Port: 543, Protocol: "tcp", Name: "klogin"},
+	{Port: 544, Protocol: "tcp", Name: "kshell"},
+	{Port: 546, Protocol: "udp", Name: "dhcpv6-client"},
+	{Port: 547, Protocol: "udp", Name: "dhcpv6-server"},
+	{Port: 548, Protocol: "tcp", Name: "afpovertcp"},
+	{Port: 554, Protocol: "tcp", Name: "rtsp"},
+	{Port: 554, Protocol: "udp", Name: "rtsp"},
+	{Port: 563, Protocol: "tcp", Name: "nntps"},
+	{Port: 587, Protocol: "tcp", Name: "submission"},
+	{Port: 607, Protocol: "tcp", Name: "nqs"},
+	{Port: 623, Protocol: "udp", Name: "asf-rmcp"},
+	{Port: 628, Protocol: "tcp", Name: "qmqp"},
+	{Port: 631, Protocol: "tcp", Name: "ipp"},
+	{Port: 636, Protocol: "tcp", Name: "ldaps"},
+	{Port: 636, Protocol: "udp", Name: "ldaps"},
+	{Port: 646, Protocol: "tcp", Name: "ldp"},
+	{Port: 646, Protocol: "udp", Name: "ldp"},
+	{Port: 655, Protocol: "tcp", Name: "tinc"},
+	{Port: 655, Protocol: "udp", Name: "tinc"},
+	{Port: 706, Protocol: "tcp", Name: "silc"},
+	{Port: 749, Protocol: "tcp", Name: "kerberos-adm"},
+	{Port: 750, Protocol: "tcp", Name: "kerberos4"},
+	{Port: 750, Protocol: "udp", Name: "kerberos4"},
+	{Port: 751, Protocol: "tcp", Name: "kerberos-master"},
+	{Port: 751, Protocol: "udp", Name: "kerberos-master"},
+	{Port: 752, Protocol: "udp", Name: "passwd-server"},
+	{Port: 754, Protocol: "tcp", Name: "krb-prop"},
+	{Port: 775, Protocol: "tcp", Name: "moira-db"},
+	{Port: 777, Protocol: "tcp", Name: "moira-update"},
+	{Port: 779, Protocol: "udp", Name: "moira-ureg"},
+	{Port: 783, Protocol: "tcp", Name: "spamd"},
+	{Port: 853, Protocol: "tcp", Name: "domain-s"},
+	{Port: 853, Protocol: "udp", Name: "domain-s"},
+	{Port: 871, Protocol: "tcp", Name: "supfilesrv"},
+	{Port: 873, Protocol: "tcp", Name: "rsync"},
+	{Port: 989, Protocol: "tcp", Name: "ftps-data"},
+	{Port: 990, Protocol: "tcp", Name: "ftps"},
+	{Port: 992, Protocol: "tcp", Name: "telnets"},
+	{Port: 993, Protocol: "tcp", Name: "imaps"},
+	{Port: 995, Protocol: "tcp", Name: "pop3s"},
+	{Port: 1080, Protocol: "tcp", Name: "socks"},
+	{Port: 1093, Protocol: "tcp", Name: "proofd"},
+	{Port: 1094, Protocol: "tcp", Name: "rootd"},
+	{Port: 1099, Protocol: "tcp", Name: "rmiregistry"},
+	{Port: 1127, Protocol: "tcp", Name: "supfiledbg"},
+	{Port: 1178, Protocol: "tcp", Name: "skkserv"},
+	{Port: 1194, Protocol: "tcp", Name: "openvpn"},
+	{Port: 1194, Protocol: "udp", Name: "openvpn"},
+	{Port: 1210, Protocol: "udp", Name: "predict"},
+	{Port: 1236, Protocol: "tcp", Name: "rmtcfg"},
+	{Port: 1313, Protocol: "tcp", Name: "xtel"},
+	{Port: 1314, Protocol: "tcp", Name: "xtelw"},
+	{Port: 1352, Protocol: "tcp", Name: "lotusnote"},
+	{Port: 1433, Protocol: "tcp", Name: "ms-sql-s"},
+	{Port: 1434, Protocol: "udp", Name: "ms-sql-m"},
+	{Port: 1524, Protocol: "tcp", Name: "ingreslock"},
+	{Port: 1645, Protocol: "tcp", Name: "datametrics"},
+	{Port: 1645, Protocol: "udp", Name: "datametrics"},
+	{Port: 1646, Protocol: "tcp", Name: "sa-msg-port"},
+	{Port: 1646, Protocol: "udp", Name: "sa-msg-port"},
+	{Port: 1649, Protocol: "tcp", Name: "kermit"},
+	{Port: 1677, Protocol: "tcp", Name: "groupwise"},
+	{Port: 1701, Protocol: "udp", Name: "l2f"},
+	{Port: 1812, Protocol: "tcp", Name: "radius"},
+	{Port: 1812, Protocol: "udp", Name: "radius"},
+	{Port: 1813, Protocol: "tcp", Name: "radius-acct"},
+	{Port: 1813, Protocol: "udp", Name: "radius-acct"},
+	{Port: 2000, Protocol: "tcp", Name: "cisco-sccp"},
+	{Port: 2049, Protocol: "tcp", Name: "nfs"},
+	{Port: 2049, Protocol: "udp", Name: "nfs"},
+	{Port: 2086, Protocol: "tcp", Name: "gnunet"},
+	{Port: 2086, Protocol: "udp", Name: "gnunet"},
+	{Port: 2101, Protocol: "tcp", Name: "rtcm-sc104"},
+	{Port: 2101, Protocol: "udp", Name: "rtcm-sc104"},
+	{Port: 2102, Protocol: "udp", Name: "zephyr-srv"},
+	{Port: 2103, Protocol: "udp", Name: "zephyr-clt"},
+	{Port: 2104, Protocol: "udp", Name: "zephyr-hm"},
+	{Port: 2119, Protocol: "tcp", Name: "gsigatekeeper"},
+	{Port: 2121, Protocol: "tcp", Name: "iprop"},
+	{Port: 2135, Protocol: "tcp", Name: "gris"},
+	{Port: 2401, Protocol: "tcp", Name: "cvspserver"},
+	{Port: 2430, Protocol: "tcp", Name: "venus"},
+	{Port: 2430, Protocol: "udp", Name: "venus"},
+	{Port: 2431, Protocol: "tcp", Name: "venus-se"},
+	{Port: 2431, Protocol: "udp", Name: "venus-se"},
+	{Port: 2432, Protocol: "tcp", Name: "codasrv"},
+	{Port: 2432, Protocol: "udp", Name: "codasrv"},
+	{Port: 2433, Protocol: "tcp", Name: "codasrv-se"},
+	{Port: 2433, Protocol: "udp", Name: "codasrv-se"},
+	{Port: 2583, Protocol: "tcp", Name: "mon"},
+	{Port: 2583, Protocol: "udp", Name: "mon"},
+	{Port: 2600, Protocol: "tcp", Name: "zebrasrv"},
+	{Port: 2601, Protocol: "tcp", Name: "zebra"},
+	{Port: 2602, Protocol: "tcp", Name: "ripd"},
+	{Port: 2603, Protocol: "tcp", Name: "ripngd"},
+	{Port: 2604, Protocol: "tcp", Name: "ospfd"},
+	{Port: 2605, Protocol: "tcp", Name: "bgpd"},
+	{Port: 2606, Protocol: "tcp", Name: "ospf6d"},
+	{Port: 2607, Protocol: "tcp", Name: "ospfapi"},
+	{Port: 2608, Protocol: "tcp", Name: "isisd"},
+	{Port: 2628, Protocol: "tcp", Name: "dict"},
+	{Port: 2792, Protocol: "tcp", Name: "f5-globalsite"},
+	{Port: 2811, Protocol: "tcp", Name: "gsiftp"},
+	{Port: 2947, Protocol: "tcp", Name: "gpsd"},
+	{Port: 3050, Protocol: "tcp", Name: "gds-db"},
+	{Port: 3130, Protocol: "udp", Name: "icpv2"},
+	{Port: 3205, Protocol: "tcp", Name: "isns"},
+	{Port: 3205, Protocol: "udp", Name: "isns"},
+	{Port: 3260, Protocol: "tcp", Name: "iscsi-target"},
+	{Port: 3306, Protocol: "tcp", Name: "mysql"},
+	{Port: 3389, Protocol: "tcp", Name: "ms-wbt-server"},
+	{Port: 3493, Protocol: "tcp", Name: "nut"},
+	{Port: 3493, Protocol: "udp", Name: "nut"},
+	{Port: 3632, Protocol: "tcp", Name: "distcc"},
+	{Port: 3689, Protocol: "tcp", Name: "daap"},
+	{Port: 3690, Protocol: "tcp", Name: "svn"},
+	{Port: 4031, Protocol: "tcp", Name: "suucp"},
+	{Port: 4094, Protocol: "tcp", Name: "sysrqd"},
+	{Port: 4190, Protocol: "tcp", Name: "sieve"},
+	{Port: 4353, Protocol: "tcp", Name: "f5-iquery"},
+	{Port: 4369, Protocol: "tcp", Name: "epmd"},
+	{Port: 4373, Protocol: "tcp", Name: "remctl"},
+	{Port: 4460, Protocol: "tcp", Name: "ntske"},
+	{Port: 4500, Protocol: "udp", Name: "ipsec-nat-t"},
+	{Port: 4557, Protocol: "tcp", Name: "fax"},
+	{Port: 4559, Protocol: "tcp", Name: "hylafax"},
+	{Port: 4569, Protocol: "udp", Name: "iax"},
+	{Port: 4691, Protocol: "tcp", Name: "mtn"},
+	{Port: 4899, Protocol: "tcp", Name: "radmin-port"},
+	{Port: 4949, Protocol: "tcp", Name: "munin"},
+	{Port: 5060, Protocol: "tcp", Name: "sip"},
+	{Port: 5060, Protocol: "udp", Name: "sip"},
+	{Port: 5061, Protocol: "tcp", Name: "sip-tls"},
+	{Port: 5061, Protocol: "udp", Name: "sip-tls"},
+	{Port: 5222, Protocol: "tcp", Name: "xmpp-client"},
+	{Port: 5269, Protocol: "tcp", Name: "xmpp-server"},
+	{Port: 5308, Protocol: "tcp", Name: "cfengine"},
+	{Port: 5353, Protocol: "udp", Name: "mdns"},
+	{Port: 5432, Protocol: "tcp", Name: "postgresql"},
+	{Port: 5555, Protocol: "udp", Name: "rplay"},
+	{Port: 5556, Protocol: "tcp", Name: "freeciv"},
+	{Port: 5666, Protocol: "tcp", Name: "nrpe"},
+	{Port: 5667, Protocol: "tcp", Name: "nsca"},
+	{Port: 5671, Protocol: "tcp", Name: "amqps"},
+	{Port: 5672, Protocol: "tcp", Name: "amqp"},
+	{Port: 5680, Protocol: "tcp", Name: "canna"},
+	{Port: 6000, Protocol: "tcp", Name: "x11"},
+	{Port: 6001, Protocol: "tcp", Name: "x11-1"},
+	{Port: 6002, Protocol: "tcp", Name: "x11-2"},
+	{Port: 6003, Protocol: "tcp", Name: "x11-3"},
+	{Port: 6004, Protocol: "tcp", Name: "x11-4"},
+	{Port: 6005, Protocol: "tcp", Name: "x11-5"},
+	{Port: 6006, Protocol: "tcp", Name: "x11-6"},
+	{Port: 6007, Protocol: "tcp", Name: "x11-7"},
+	{Port: 6346, Protocol: "tcp", Name: "gnutella-svc"},
+	{Port: 6346, Protocol: "udp", Name: "gnutella-svc"},
+	{Port: 6347, Protocol: "tcp", Name: "gnutella-rtr"},
+	{Port: 6347, Protocol: "udp", Name: "gnutella-rtr"},
+	{Port: 6379, Protocol: "tcp", Name: "redis"},
+	{Port: 6444, Protocol: "tcp", Name: "sge-qmaster"},
+	{Port: 6445, Protocol: "tcp", Name: "sge-execd"},
+	{Port: 6446, Protocol: "tcp", Name: "mysql-proxy"},
+	{Port: 6514, Protocol: "tcp", Name: "syslog-tls"},
+	{Port: 6566, Protocol: "tcp", Name: "sane-port"},
+	{Port: 6667, Protocol: "tcp", Name: "ircd"},
+	{Port: 6696, Protocol: "udp", Name: "babel"},
+	{Port: 6697, Protocol: "tcp", Name: "ircs-u"},
+	{Port: 7000, Protocol: "tcp", Name: "bbs"},
+	{Port: 7000, Protocol: "udp", Name: "afs3-fileserver"},
+	{Port: 7001, Protocol: "udp", Name: "afs3-callback"},
+	{Port: 7002, Protocol: "udp", Name: "afs3-prserver"},
+	{Port: 7003, Protocol: "udp", Name: "afs3-vlserver"},
+	{Port: 7004, Protocol: "udp", Name: "afs3-kaserver"},
+	{Port: 7005, Protocol: "udp", Name: "afs3-volser"},
+	{Port: 7007, Protocol: "udp", Name: "afs3-bos"},
+	{Port: 7008, Protocol: "udp", Name: "afs3-update"},
+	{Port: 7009, Protocol: "udp", Name: "afs3-rmtsys"},
+	{Port: 7100, Protocol: "tcp", Name: "font-service"},
+	{Port: 8021, Protocol: "tcp", Name: "zope-ftp"},
+	{Port: 8080, Protocol: "tcp", Name: "http-alt"},
+	{Port: 8081, Protocol: "tcp", Name: "tproxy"},
+	{Port: 8088, Protocol: "tcp", Name: "omniorb"},
+	{Port: 8140, Protocol: "tcp", Name: "puppet"},
+	{Port: 8990, Protocol: "tcp", Name: "clc-build-daemon"},
+	{Port: 9098, Protocol: "tcp", Name: "xinetd"},
+	{Port: 9101, Protocol: "tcp", Name: "bacula-dir"},
+	{Port: 9102, Protocol: "tcp", Name: "bacula-fd"},
+	{Port: 9103, Protocol: "tcp", Name: "bacula-sd"},
+	{Port: 9418, Protocol: "tcp", Name: "git"},
+	{Port: 9667, Protocol: "tcp", Name: "xmms2"},
+	{Port: 9673, Protocol: "tcp", Name: "zope"},
+	{Port: 10000, Protocol: "tcp", Name: "webmin"},
+	{Port: 10050, Protocol: "tcp", Name: "zabbix-agent"},
+	{Port: 10051, Protocol: "tcp", Name: "zabbix-trapper"},
+	{Port: 10080, Protocol: "tcp", Name: "amanda"},
+	{Port: 10081, Protocol: "tcp", Name: "kamanda"},
+	{Port: 10082, Protocol: "tcp", Name: "amandaidx"},
+	{Port: 10083, Protocol: "tcp", Name: "amidxtape"},
+	{Port: 10809, Protocol: "tcp", Name: "nbd"},
+	{Port: 11112, Protocol: "tcp", Name: "dicom"},
+	{Port: 11371, Protocol: "tcp", Name: "hkp"},
+	{Port: 17001, Protocol: "udp", Name: "sgi-cmsd"},
+	{Port: 17002, Protocol: "udp", Name: "sgi-crsd"},
+	{Port: 17003, Protocol: "udp", Name: "sgi-gcd"},
+	{Port: 17004, Protocol: "tcp", Name: "sgi-cad"},
+	{Port: 17500, Protocol: "tcp", Name: "db-lsp"},
+	{Port: 22125, Protocol: "tcp", Name: "dcap"},
+	{Port: 22128, Protocol: "tcp", Name: "gsidcap"},
+	{Port: 22273, Protocol: "tcp", Name: "wnn6"},
+	{Port: 24554, Protocol: "tcp", Name: "binkp"},
+	{Port: 27374, Protocol: "tcp", Name: "asp"},
+	{Port: 27374, Protocol: "udp", Name: "asp"},
+	{Port: 30865, Protocol: "tcp", Name: "csync2"},
+	{Port: 57000, Protocol: "tcp", Name: "dircproxy"},
+	{Port: 60177, Protocol: "tcp", Name: "tfido"},
+	{Port: 60179, Protocol: "tcp", Name: "fido"},
+}
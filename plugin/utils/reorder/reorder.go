@@ -0,0 +1,182 @@
+// Package reorder puts events from sources that deliver them out of order back into timestamp order,
+// for triggers whose downstream correlation expects it. Events are held for a delay before they're
+// emitted, long enough for stragglers to arrive, and the high watermark of what was emitted is kept so
+// anything arriving after its moment passed is recognised as late.
+//
+//	buf, err := reorder.New(30*time.Second, func(v interface{}) error { return t.Send(v) }, window.CacheCheckpoint("watermark"))
+//	...
+//	defer buf.Start(ctx)()
+//	for _, e := range events {
+//		if !buf.Add(e.Timestamp, e) {
+//			log.Warnf("Dropping late event %s", e.ID)
+//		}
+//	}
+package reorder
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+	"github.com/komand/plugin-sdk-go/plugin/utils/window"
+)
+
+// Buffer holds events for Delay and emits them in timestamp order. It's safe for concurrent use, but emit
+// is called with the buffer locked, so it mustn't call Add.
+type Buffer struct {
+	delay      time.Duration
+	emit       func(value interface{}) error
+	checkpoint window.Checkpoint
+
+	mu        sync.Mutex
+	events    eventHeap
+	watermark time.Time
+	seq       int
+	now       func() time.Time
+}
+
+type event struct {
+	ts      time.Time
+	arrived time.Time
+	seq     int // seq keeps events with the same timestamp in the order they arrived
+	value   interface{}
+}
+
+// New returns a buffer that holds events for delay before passing them to emit. If checkpoint is set the
+// watermark is saved to it after each emit, and loaded from it, so events emitted before a restart are
+// late after it.
+func New(delay time.Duration, emit func(value interface{}) error, checkpoint window.Checkpoint) (*Buffer, error) {
+	b := &Buffer{delay: delay, emit: emit, checkpoint: checkpoint, now: time.Now}
+	if checkpoint != nil {
+		watermark, ok, err := checkpoint.Load()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			b.watermark = watermark
+		}
+	}
+	return b, nil
+}
+
+// Add buffers an event with timestamp ts. It returns false, and doesn't buffer it, if the event is late:
+// an event after it was already emitted.
+func (b *Buffer) Add(ts time.Time, value interface{}) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ts.Before(b.watermark) {
+		return false
+	}
+	b.seq++
+	heap.Push(&b.events, &event{ts: ts, arrived: b.now(), seq: b.seq, value: value})
+	return true
+}
+
+// Watermark returns the timestamp of the last event emitted
+func (b *Buffer) Watermark() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.watermark
+}
+
+// Len returns the number of events held
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.events)
+}
+
+// Flush emits the events that have been held for the delay, along with every event timestamped before
+// them so the order holds. If emit fails, the event is kept and Flush returns the error.
+func (b *Buffer) Flush() error {
+	return b.flush(false)
+}
+
+// FlushAll emits every event held, regardless of the delay, ie: when shutting down
+func (b *Buffer) FlushAll() error {
+	return b.flush(true)
+}
+
+func (b *Buffer) flush(all bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Find the latest timestamp among the events that are due, everything up to it goes
+	var until time.Time
+	due := b.now().Add(-b.delay)
+	for _, e := range b.events {
+		if (all || !e.arrived.After(due)) && e.ts.After(until) {
+			until = e.ts
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	emitted := false
+	var err error
+	for len(b.events) > 0 && !b.events[0].ts.After(until) {
+		e := b.events[0]
+		if err = b.emit(e.value); err != nil {
+			break
+		}
+		heap.Pop(&b.events)
+		b.watermark = e.ts
+		emitted = true
+	}
+	if emitted && b.checkpoint != nil {
+		if saveErr := b.checkpoint.Save(b.watermark); err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// Start flushes the buffer periodically until the returned function is called, or ctx is done, at which
+// point everything still held is emitted
+func (b *Buffer) Start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	interval := b.delay / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := utils.NewTicker(ctx, interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := b.Flush(); err != nil {
+				log.Warnf("Unable to emit reordered events, retrying: %s", err)
+			}
+		}
+		if err := b.FlushAll(); err != nil {
+			log.Errorf("Unable to emit the last reordered events: %s", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// eventHeap orders events by timestamp, then arrival
+type eventHeap []*event
+
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].ts.Equal(h[j].ts) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].ts.Before(h[j].ts)
+}
+func (h eventHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *eventHeap) Push(x interface{}) { *h = append(*h, x.(*event)) }
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,93 @@
+package reorder
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type memCheckpoint struct {
+	position time.Time
+	saved    bool
+}
+
+func (m *memCheckpoint) Load() (time.Time, bool, error) { return m.position, m.saved, nil }
+func (m *memCheckpoint) Save(t time.Time) error {
+	m.position, m.saved = t, true
+	return nil
+}
+
+func TestReorder(t *testing.T) {
+	base := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := base
+	var emitted []interface{}
+	fail := false
+	cp := &memCheckpoint{}
+	b, _ := New(10*time.Second, func(v interface{}) error {
+		if fail {
+			return errors.New("dispatcher down")
+		}
+		emitted = append(emitted, v)
+		return nil
+	}, cp)
+	b.now = func() time.Time { return clock }
+
+	b.Add(base.Add(3*time.Second), "c")
+	b.Add(base.Add(1*time.Second), "a")
+	clock = clock.Add(5 * time.Second)
+	b.Add(base.Add(2*time.Second), "b")
+	b.Add(base.Add(9*time.Second), "d")
+
+	// Nothing's been held long enough yet
+	if b.Flush(); len(emitted) != 0 {
+		t.Fatalf("Expected nothing to be emitted yet, got %v", emitted)
+	}
+	// c and a are due, and b comes before c so it goes too, but d has to wait
+	clock = clock.Add(6 * time.Second)
+	b.Flush()
+	if !reflect.DeepEqual(emitted, []interface{}{"a", "b", "c"}) {
+		t.Fatalf("Expected a, b and c in order, got %v", emitted)
+	}
+	if !cp.position.Equal(base.Add(3 * time.Second)) {
+		t.Errorf("Expected the watermark to be checkpointed, got %s", cp.position)
+	}
+	if b.Add(base.Add(2500*time.Millisecond), "late") {
+		t.Error("Expected an event before the watermark to be late")
+	}
+
+	// A failed emit keeps the event for the next flush
+	clock = clock.Add(time.Minute)
+	fail = true
+	if err := b.Flush(); err == nil || b.Len() != 1 {
+		t.Fatalf("Expected the emit to fail and the event to be kept, got %v", err)
+	}
+	fail = false
+	b.Flush()
+	if len(emitted) != 4 || emitted[3] != "d" {
+		t.Errorf("Expected d to be emitted on retry, got %v", emitted)
+	}
+
+	// A new buffer picks the watermark up from the checkpoint
+	b, _ = New(time.Second, nil, cp)
+	if b.Add(base.Add(time.Second), "replayed") {
+		t.Error("Expected events emitted before a restart to be late after it")
+	}
+}
+
+func TestStartFlushesOnStop(t *testing.T) {
+	var emitted []interface{}
+	b, _ := New(time.Hour, func(v interface{}) error {
+		emitted = append(emitted, v)
+		return nil
+	}, nil)
+	stop := b.Start(context.Background())
+	now := time.Now()
+	b.Add(now.Add(time.Second), 2)
+	b.Add(now, 1)
+	stop()
+	if !reflect.DeepEqual(emitted, []interface{}{1, 2}) {
+		t.Errorf("Expected everything held to be emitted in order when stopped, got %v", emitted)
+	}
+}
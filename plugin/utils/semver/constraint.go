@@ -0,0 +1,143 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of ranges a version can be in. Ranges are comparisons separated by commas or spaces,
+// that must all hold, and ranges are separated by ||, ie: ">= 1.2, < 2 || >= 3". The operators are =, !=,
+// >, >=, <, <=, ~ (patch updates, ~1.2.3 is >= 1.2.3, < 1.3.0) and ^ (compatible updates, ^1.2.3 is
+// >= 1.2.3, < 2.0.0). A version with no operator is =.
+type Constraint struct {
+	text   string
+	ranges [][]comparison
+}
+
+// comparison is an operator and the version it compares against
+type comparison struct {
+	op      string
+	version Version
+}
+
+// operators are those comparisons may start with, longest first
+var operators = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+// ParseConstraint parses s as a Constraint
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	for _, r := range strings.Split(s, "||") {
+		var comparisons []comparison
+		fields := strings.Fields(strings.Replace(r, ",", " ", -1))
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			op := "="
+			for _, o := range operators {
+				if strings.HasPrefix(field, o) {
+					op, field = o, field[len(o):]
+					break
+				}
+			}
+			if field == "" {
+				// the operator was spaced from its version, ie: ">= 1.2"
+				if i++; i == len(fields) {
+					return Constraint{}, fmt.Errorf("Invalid constraint %q: %s has no version", s, op)
+				}
+				field = fields[i]
+			}
+			v, err := Parse(field)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("Invalid constraint %q: %s", s, err)
+			}
+			comparisons = append(comparisons, expand(op, v)...)
+		}
+		if len(comparisons) == 0 {
+			return Constraint{}, fmt.Errorf("Invalid constraint %q: empty range", s)
+		}
+		c.ranges = append(c.ranges, comparisons)
+	}
+	return c, nil
+}
+
+// MustConstraint is ParseConstraint, panicking if s isn't a constraint, for constraints known at compile time
+func MustConstraint(s string) Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// expand turns ~ and ^ into the comparisons they stand for
+func expand(op string, v Version) []comparison {
+	var upper Version
+	switch op {
+	case "~":
+		upper = Version{Major: v.Major, Minor: v.Minor + 1}
+	case "^":
+		switch {
+		case v.Major > 0:
+			upper = Version{Major: v.Major + 1}
+		case v.Minor > 0:
+			upper = Version{Minor: v.Minor + 1}
+		default:
+			upper = Version{Patch: v.Patch + 1}
+		}
+	default:
+		return []comparison{{op: op, version: v}}
+	}
+	return []comparison{{op: ">=", version: v}, {op: "<", version: upper}}
+}
+
+// Check returns whether v is in any of the constraint's ranges
+func (c Constraint) Check(v Version) bool {
+	for _, r := range c.ranges {
+		ok := true
+		for _, comparison := range r {
+			if !comparison.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as it was parsed
+func (c Constraint) String() string {
+	return c.text
+}
+
+func (c comparison) check(v Version) bool {
+	n := v.Compare(c.version)
+	switch c.op {
+	case "!=":
+		return n != 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	default:
+		return n == 0
+	}
+}
+
+// Satisfies parses version and constraint, and returns whether the version satisfies the constraint
+func Satisfies(version, constraint string) (bool, error) {
+	v, err := Parse(version)
+	if err != nil {
+		return false, err
+	}
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(v), nil
+}
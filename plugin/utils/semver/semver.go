@@ -0,0 +1,165 @@
+// Package semver parses and compares semantic versions, of plugins, of the APIs they talk to, and of the
+// vendor products they manage, and checks them against constraints:
+//
+//	v, err := semver.Parse(product.Version)
+//	...
+//	if semver.MustConstraint(">= 7.2, < 9").Check(v) {
+//		// use the bulk endpoint
+//	}
+//
+// Vendor versions are often less strict than semver.org, so a leading v, and a missing minor or patch
+// version, ie: "v10.1", are accepted.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          []string // Prerelease are the dot separated identifiers after a -, ie: rc.1
+	Build               string   // Build is the metadata after a +, it's ignored when comparing
+}
+
+// Parse parses s as a semantic version
+func Parse(s string) (Version, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		rest, v.Build = rest[:i], rest[i+1:]
+		if !validIdentifiers(v.Build) {
+			return Version{}, fmt.Errorf("Invalid version %q: invalid build metadata", s)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		var prerelease string
+		rest, prerelease = rest[:i], rest[i+1:]
+		if !validIdentifiers(prerelease) {
+			return Version{}, fmt.Errorf("Invalid version %q: invalid prerelease", s)
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("Invalid version %q: too many parts", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part[0] == '+' {
+			return Version{}, fmt.Errorf("Invalid version %q: %q isn't a number", s, part)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// MustParse is Parse, panicking if s isn't a version, for versions known at compile time
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the version as major.minor.patch, followed by its prerelease and build metadata
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1 if v is before o, 1 if it's after, and 0 if they're the same version, following the
+// precedence of semver.org: a prerelease comes before its release, and build metadata is ignored
+func (v Version) Compare(o Version) int {
+	if c := compareInts(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifiers(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.Prerelease), len(o.Prerelease))
+}
+
+// LessThan returns whether v is before o
+func (v Version) LessThan(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// Compare parses and compares a and b, see Version.Compare
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares prerelease identifiers, numerically if both are numbers, numbers coming before
+// anything else
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,75 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v1.2.3-rc.1+build.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Major != 1 || v.Minor != 2 || v.Patch != 3 || len(v.Prerelease) != 2 || v.Build != "build.5" {
+		t.Fatalf("Unexpected version %+v", v)
+	}
+	if s := v.String(); s != "1.2.3-rc.1+build.5" {
+		t.Fatalf("Expected 1.2.3-rc.1+build.5, got %s", s)
+	}
+	if v = MustParse("10.1"); v.String() != "10.1.0" {
+		t.Fatalf("Expected 10.1.0, got %s", v)
+	}
+	for _, s := range []string{"", "1.x", "1.2.3.4", "1.-2", "1.2.3-", "1.2.3-rc..1", "1.2.3+b_1"} {
+		if _, err = Parse(s); err == nil {
+			t.Errorf("Expected %q to be refused", s)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		if n, err := Compare(ordered[i-1], ordered[i]); err != nil || n != -1 {
+			t.Errorf("Expected %s before %s, got %d %v", ordered[i-1], ordered[i], n, err)
+		}
+		if n, _ := Compare(ordered[i], ordered[i-1]); n != 1 {
+			t.Errorf("Expected %s after %s", ordered[i], ordered[i-1])
+		}
+	}
+	if n, _ := Compare("1.0.0+a", "v1.0"); n != 0 {
+		t.Errorf("Expected build metadata to be ignored, got %d", n)
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{">= 1.2, < 2", "1.5.0", true},
+		{">= 1.2, < 2", "2.0.0", false},
+		{">=1.2 <2", "1.1.9", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^0.2.3", "0.3.0", false},
+		{"1.2.3", "1.2.3", true},
+		{"!= 1.2.3", "1.2.3", false},
+		{"< 7 || >= 9", "8.1", false},
+		{"< 7 || >= 9", "9.0.1", true},
+	}
+	for _, test := range tests {
+		ok, err := Satisfies(test.version, test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.expected {
+			t.Errorf("Expected %s satisfying %q to be %t", test.version, test.constraint, test.expected)
+		}
+	}
+	for _, s := range []string{"", ">=", ">= 1.x", "1 ||"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("Expected constraint %q to be refused", s)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package shutdown runs cleanup before the plugin exits, whether its task returned or it was sent SIGINT
+// or SIGTERM, so state held in memory for speed, like a checkpoint saved in the background, is persisted
+// rather than lost:
+//
+//	unregister := shutdown.Register("checkpoint", cp.Flush)
+//	defer unregister()
+//
+// The SDK runs the hooks once a trigger or action finishes, and on those signals when run from the CLI.
+package shutdown
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type hook struct {
+	name string
+	fn   func() error
+}
+
+var (
+	mu    sync.Mutex
+	hooks []*hook
+)
+
+// exit is replaced in tests
+var exit = os.Exit
+
+// Register adds a hook run by Run, named in the log if it fails. The returned function removes it, ie:
+// once whatever it cleans up was closed some other way.
+func Register(name string, fn func() error) (unregister func()) {
+	h := &hook{name: name, fn: fn}
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, registered := range hooks {
+			if registered == h {
+				hooks = append(hooks[:i], hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Run runs the registered hooks, the last registered first, and removes them so each only ever runs once.
+// A hook that fails is logged, and the rest still run.
+func Run() {
+	mu.Lock()
+	run := hooks
+	hooks = nil
+	mu.Unlock()
+	for i := len(run) - 1; i >= 0; i-- {
+		if err := run[i].fn(); err != nil {
+			log.Errorf("Shutdown hook %s failed: %s", run[i].name, err)
+		}
+	}
+}
+
+// HandleSignals runs the hooks when the process is sent SIGINT or SIGTERM, then exits with the shell's
+// code for the signal, 128 plus its number. It stops handling them once the returned function is called.
+func HandleSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Infof("Received %s, shutting down", sig)
+			Run()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			exit(code)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
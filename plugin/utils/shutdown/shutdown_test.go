@@ -0,0 +1,37 @@
+package shutdown
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var order []string
+	Register("first", func() error {
+		order = append(order, "first")
+		return nil
+	})
+	unregister := Register("removed", func() error {
+		order = append(order, "removed")
+		return nil
+	})
+	Register("failing", func() error {
+		order = append(order, "failing")
+		return errors.New("failed")
+	})
+	Register("last", func() error {
+		order = append(order, "last")
+		return nil
+	})
+	unregister()
+
+	Run()
+	if expected := []string{"last", "failing", "first"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected hooks to run in reverse, despite failing, got %v", order)
+	}
+	Run()
+	if len(order) != 3 {
+		t.Errorf("Expected hooks to only run once, got %v", order)
+	}
+}
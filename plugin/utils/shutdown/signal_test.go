@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package shutdown
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() { exit = os.Exit }()
+
+	flushed := false
+	Register("flush", func() error {
+		flushed = true
+		return nil
+	})
+	stop := HandleSignals()
+	defer stop()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-exited:
+		if code != 143 {
+			t.Errorf("Expected to exit with 143 for SIGTERM, got %d", code)
+		}
+		if !flushed {
+			t.Error("Expected the hooks to run before exiting")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected SIGTERM to run the hooks and exit")
+	}
+}
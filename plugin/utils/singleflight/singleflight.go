@@ -0,0 +1,121 @@
+// Package singleflight collapses concurrent calls for the same key into one, for expensive vendor calls
+// that concurrent actions would otherwise all make at once, like fetching a token or discovering a schema:
+//
+//	var tokens singleflight.Group
+//	...
+//	token, _, err := tokens.Do(ctx, "token", func(ctx context.Context) (interface{}, error) {
+//		return client.FetchToken(ctx)
+//	})
+//
+// Unlike a lock around the call, a caller that gives up, because its own context is done, doesn't fail
+// the others waiting on it. The call is only cancelled once every caller has given up, or its timeout passed.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Group collapses calls by key. The zero value is ready to use.
+type Group struct {
+	// Timeout bounds each call made by Do, through its context. 0 is no timeout.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is a call in flight
+type call struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// PanicError is returned when the function called panicked
+type PanicError struct {
+	Key   string
+	Value interface{}
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: call for %s panicked: %v", e.Key, e.Value)
+}
+
+// Do calls fn for key, unless a call for it is already in flight, in which case it waits for that call's
+// result. shared is true if the result went to more than one caller. fn's context isn't ctx: it's done
+// once every caller waiting on it gave up, or after the Group's Timeout.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (value interface{}, shared bool, err error) {
+	return g.DoTimeout(ctx, key, g.Timeout, fn)
+}
+
+// DoTimeout is Do with a timeout for this key, rather than the Group's
+func (g *Group) DoTimeout(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c, inflight := g.calls[key]
+	if !inflight {
+		c = &call{done: make(chan struct{})}
+		var callCtx context.Context
+		if timeout > 0 {
+			callCtx, c.cancel = context.WithTimeout(context.Background(), timeout)
+		} else {
+			callCtx, c.cancel = context.WithCancel(context.Background())
+		}
+		g.calls[key] = c
+		go g.call(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared = c.waiters > 1
+		g.mu.Unlock()
+		return c.value, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// nobody's waiting for it, so the next caller makes a new call rather than join a cancelled one
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, false, ctx.Err()
+	}
+}
+
+func (g *Group) call(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = &PanicError{Key: key, Value: r}
+		}
+		c.cancel()
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn(ctx)
+}
+
+// Forget has the next Do for key make a new call, rather than wait on the one in flight, ie: once its
+// result is known to be stale
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
@@ -0,0 +1,120 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "token", nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, shared, err := g.Do(context.Background(), "token", fn)
+			if err != nil || v != "token" {
+				t.Errorf("Expected token, got %v, %v", v, err)
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Expected concurrent calls to collapse into 1, got %d", calls)
+	}
+	if sharedCount != 10 {
+		t.Errorf("Expected every caller to see the result as shared, got %d", sharedCount)
+	}
+}
+
+func TestCallerGivesUp(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "token", nil
+		case <-ctx.Done():
+			close(cancelled)
+			return nil, ctx.Err()
+		}
+	}
+
+	patient := make(chan interface{})
+	go func() {
+		v, _, _ := g.Do(context.Background(), "token", fn)
+		patient <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := g.Do(ctx, "token", fn); err != context.DeadlineExceeded {
+		t.Errorf("Expected the impatient caller's own error, got %v", err)
+	}
+	close(release)
+	if v := <-patient; v != "token" {
+		t.Errorf("Expected the patient caller to get the result, got %v", v)
+	}
+
+	// once every caller's given up, the call is cancelled
+	release = make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	g.Do(ctx, "again", fn)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the call to be cancelled once nobody waited on it")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	g := Group{Timeout: 10 * time.Millisecond}
+	_, _, err := g.Do(context.Background(), "slow", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the call to time out, got %v", err)
+	}
+	_, _, err = g.DoTimeout(context.Background(), "slow", time.Second, func(ctx context.Context) (interface{}, error) {
+		if deadline, ok := ctx.Deadline(); !ok || deadline.Sub(time.Now()) < 500*time.Millisecond {
+			t.Errorf("Expected the key's own timeout, got a deadline of %s", deadline)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var g Group
+	_, _, err := g.Do(context.Background(), "boom", func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if p, ok := err.(*PanicError); !ok || p.Value != "boom" {
+		t.Errorf("Expected a PanicError, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SleepCtx pauses the current goroutine for d, or until ctx is done, whichever comes first.
+// It returns ctx.Err() if the sleep was cut short, so callers can tell they should give up.
+func SleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ticker is a time.Ticker that stops when its context is done. C is closed once it stops, so
+// a plain range over C ends on cancellation instead of blocking forever.
+type Ticker struct {
+	C <-chan time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewTicker returns a Ticker delivering ticks every d until ctx is done or Stop is called
+func NewTicker(ctx context.Context, d time.Duration) *Ticker {
+	c := make(chan time.Time, 1)
+	t := &Ticker{C: c, stop: make(chan struct{})}
+	ticker := time.NewTicker(d)
+	go func() {
+		defer close(c)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.stop:
+				return
+			case tick := <-ticker.C:
+				// Like time.Ticker, drop ticks for slow receivers rather than queueing them
+				select {
+				case c <- tick:
+				default:
+				}
+			}
+		}
+	}()
+	return t
+}
+
+// Stop turns off the ticker and closes C. It's safe to call more than once.
+func (t *Ticker) Stop() {
+	t.once.Do(func() { close(t.stop) })
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleepCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := SleepCtx(ctx, time.Minute); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled but got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Expected SleepCtx to return as soon as the context was canceled")
+	}
+	if err := SleepCtx(context.Background(), time.Millisecond); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := NewTicker(ctx, time.Millisecond)
+	<-ticker.C
+	cancel()
+	for range ticker.C {
+		// drain until closed
+	}
+	ticker.Stop()
+}
@@ -0,0 +1,116 @@
+// Package taskgroup runs tasks concurrently and waits for them, for actions that fan out over several
+// calls instead of starting goroutines by hand. Like errgroup, the first task to fail cancels the others
+// and is the error Wait returns. On top of that, at most limit tasks run at once, each can be given a
+// timeout, and a task that panics fails the group with a supervisor.PanicError rather than crashing the
+// plugin:
+//
+//	g := taskgroup.New(ctx, 4)
+//	g.Timeout = 30 * time.Second
+//	for _, host := range hosts {
+//		host := host
+//		g.Go(func(ctx context.Context) error {
+//			return scan(ctx, host)
+//		})
+//	}
+//	if err := g.Wait(); err != nil {
+//		return err
+//	}
+package taskgroup
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+)
+
+// maxPanicStack bounds the stack kept from a panic
+const maxPanicStack = 16 << 10
+
+// Group runs tasks, see New
+type Group struct {
+	// Timeout bounds each task started by Go, through its context. 0 is no timeout.
+	Timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// New returns a group running at most limit tasks at once, 0 being no limit. The tasks' contexts are
+// derived from ctx, and cancelled once a task fails.
+func New(ctx context.Context, limit int) *Group {
+	g := &Group{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if limit > 0 {
+		g.slots = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// Go runs task once fewer than the limit are running, waiting until then. If the group is cancelled
+// first, because a task failed or ctx is done, task isn't run.
+func (g *Group) Go(task func(ctx context.Context) error) {
+	g.GoTimeout(g.Timeout, task)
+}
+
+// GoTimeout is Go with a timeout for this task, rather than the group's
+func (g *Group) GoTimeout(timeout time.Duration, task func(ctx context.Context) error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(g.ctx.Err())
+			return
+		}
+	} else if g.ctx.Err() != nil {
+		g.fail(g.ctx.Err())
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.slots != nil {
+			defer func() { <-g.slots }()
+		}
+		ctx, cancel := g.ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(g.ctx, timeout)
+		}
+		defer cancel()
+		if err := run(ctx, task); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait waits for the tasks started, and returns the first error. The group is done with once it returns.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+// fail records the group's first error and cancels the rest
+func (g *Group) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+func run(ctx context.Context, task func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			stack := make([]byte, maxPanicStack)
+			err = &supervisor.PanicError{Value: v, Stack: stack[:runtime.Stack(stack, false)]}
+		}
+	}()
+	return task(ctx)
+}
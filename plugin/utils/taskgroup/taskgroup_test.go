@@ -0,0 +1,105 @@
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/supervisor"
+)
+
+func TestLimit(t *testing.T) {
+	g := New(context.Background(), 3)
+	var running, most int32
+	for i := 0; i < 20; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if most != 3 {
+		t.Errorf("Expected at most 3 tasks running at once, got %d", most)
+	}
+}
+
+func TestFirstErrorCancels(t *testing.T) {
+	g := New(context.Background(), 0)
+	failed := errors.New("failed")
+	cancelled := make(chan struct{})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	g.Go(func(ctx context.Context) error {
+		return failed
+	})
+	if err := g.Wait(); err != failed {
+		t.Errorf("Expected the first error, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("Expected the other task to be cancelled")
+	}
+
+	ran := false
+	g.Go(func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	g.Wait()
+	if ran {
+		t.Error("Expected tasks started after a failure not to run")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	g := New(context.Background(), 0)
+	g.Timeout = 10 * time.Millisecond
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := g.Wait(); err != context.DeadlineExceeded {
+		t.Errorf("Expected the task to time out, got %v", err)
+	}
+
+	g = New(context.Background(), 0)
+	g.Timeout = 10 * time.Millisecond
+	g.GoTimeout(time.Second, func(ctx context.Context) error {
+		select {
+		case <-time.After(30 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err := g.Wait(); err != nil {
+		t.Errorf("Expected the task's own timeout, got %v", err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	g := New(context.Background(), 2)
+	g.Go(func(ctx context.Context) error {
+		panic("boom")
+	})
+	err := g.Wait()
+	if p, ok := err.(*supervisor.PanicError); !ok || p.Value != "boom" || len(p.Stack) == 0 {
+		t.Errorf("Expected a PanicError with the stack, got %v", err)
+	}
+}
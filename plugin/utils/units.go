@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Byte size multipliers. The K/M/G/T/P suffixes are decimal, the Ki/Mi/Gi/Ti/Pi suffixes are binary.
+const (
+	KB = 1000
+	MB = 1000 * KB
+	GB = 1000 * MB
+	TB = 1000 * GB
+	PB = 1000 * TB
+
+	KiB = 1024
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+	PiB = 1024 * TiB
+)
+
+var byteSuffixes = map[string]float64{
+	"": 1, "b": 1, "byte": 1, "bytes": 1,
+	"k": KB, "kb": KB, "m": MB, "mb": MB, "g": GB, "gb": GB, "t": TB, "tb": TB, "p": PB, "pb": PB,
+	"ki": KiB, "kib": KiB, "mi": MiB, "mib": MiB, "gi": GiB, "gib": GiB, "ti": TiB, "tib": TiB, "pi": PiB, "pib": PiB,
+}
+
+// ParseBytes leniently parses a human readable byte size such as "1.5GB", "512 kib" or "100".
+// Suffixes are case insensitive, and a bare number is taken as bytes.
+func ParseBytes(s string) (int64, error) {
+	number, suffix := splitNumber(s)
+	if number == "" {
+		return 0, fmt.Errorf("Invalid byte size: %q", s)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid byte size: %q", s)
+	}
+	multiplier, ok := byteSuffixes[strings.ToLower(suffix)]
+	if !ok {
+		return 0, fmt.Errorf("Unknown byte size unit %q in %q", suffix, s)
+	}
+	value *= multiplier
+	// math.MaxInt64 rounds up to 2^63 as a float64, which doesn't fit
+	if value >= math.MaxInt64 {
+		return 0, fmt.Errorf("Byte size %q is too large", s)
+	}
+	return int64(value), nil
+}
+
+// FormatBytes formats n using decimal units, ie: 1500000 is "1.5 MB"
+func FormatBytes(n int64) string {
+	return formatBytes(n, 1000, []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"})
+}
+
+// FormatBytesIEC formats n using binary units, ie: 1572864 is "1.5 MiB"
+func FormatBytesIEC(n int64) string {
+	return formatBytes(n, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"})
+}
+
+func formatBytes(n int64, base float64, units []string) string {
+	value := float64(n)
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	i := 0
+	for value >= base && i < len(units)-1 {
+		value /= base
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%s%d %s", sign, int64(value), units[i])
+	}
+	return sign + strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + " " + units[i]
+}
+
+var durationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"ms": time.Millisecond, "us": time.Microsecond, "ns": time.Nanosecond,
+}
+
+// ParseDuration leniently parses a duration. It accepts everything time.ParseDuration does, plus
+// days and weeks ("1d12h", "2w"), spelled out units ("2 hours 30 minutes") and a bare number of seconds.
+// Negative durations and durations too long for a time.Duration are refused.
+func ParseDuration(s string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(s)
+	if d, err := time.ParseDuration(trimmed); err == nil {
+		if d < 0 {
+			return 0, fmt.Errorf("Invalid duration: %q can't be negative", s)
+		}
+		return d, nil
+	}
+	if secs, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		d, ok := durationOf(secs, time.Second)
+		if !ok {
+			return 0, fmt.Errorf("Invalid duration: %q", s)
+		}
+		return d, nil
+	}
+
+	var total time.Duration
+	rest := strings.ToLower(trimmed)
+	for rest != "" {
+		var number, unit string
+		number, rest = splitNumber(rest)
+		unit, rest = splitUnit(rest)
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration: %q", s)
+		}
+		multiplier, ok := durationUnits[unit]
+		if !ok {
+			return 0, fmt.Errorf("Unknown duration unit %q in %q", unit, s)
+		}
+		d, ok := durationOf(value, multiplier)
+		if !ok || total > math.MaxInt64-d {
+			return 0, fmt.Errorf("Invalid duration: %q", s)
+		}
+		total += d
+		rest = strings.TrimLeft(rest, " ,")
+		rest = strings.TrimPrefix(rest, "and ")
+	}
+	if total == 0 && trimmed == "" {
+		return 0, fmt.Errorf("Invalid duration: %q", s)
+	}
+	return total, nil
+}
+
+// durationOf multiplies value by unit, reporting false if value isn't a finite, non negative number
+// or the result doesn't fit a time.Duration
+func durationOf(value float64, unit time.Duration) (time.Duration, bool) {
+	if math.IsNaN(value) || value < 0 {
+		return 0, false
+	}
+	// math.MaxInt64 rounds up to 2^63 as a float64, which doesn't fit, and infinity is larger still
+	d := value * float64(unit)
+	if d >= math.MaxInt64 {
+		return 0, false
+	}
+	return time.Duration(d), true
+}
+
+// FormatDuration formats d compactly, dropping zero units, ie: "2h30m" rather than "2h30m0s",
+// and "1d2h" for durations of a day or more
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	if d < time.Second {
+		return sign + d.String()
+	}
+	// rounded to the second by hand, Duration.Round needs Go 1.9
+	d = (d + time.Second/2) / time.Second * time.Second
+
+	var parts []string
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}} {
+		if n := d / unit.size; n > 0 {
+			parts = append(parts, strconv.FormatInt(int64(n), 10)+unit.suffix)
+			d -= n * unit.size
+		}
+	}
+	return sign + strings.Join(parts, "")
+}
+
+// Rate is a number of events per period, ie: 100 requests per second
+type Rate struct {
+	Count float64
+	Per   time.Duration
+}
+
+// ParseRate leniently parses a rate such as "100/s", "5000/hour", "10 per minute" or "1/5m"
+func ParseRate(s string) (Rate, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	sep := strings.Index(lower, "/")
+	skip := 1
+	if sep < 0 {
+		sep = strings.Index(lower, " per ")
+		skip = len(" per ")
+	}
+	if sep < 0 {
+		return Rate{}, fmt.Errorf("Invalid rate %q, expected something like 100/s", s)
+	}
+	count, err := strconv.ParseFloat(strings.TrimSpace(lower[:sep]), 64)
+	if err != nil || math.IsNaN(count) || math.IsInf(count, 0) || count < 0 {
+		return Rate{}, fmt.Errorf("Invalid rate %q, expected something like 100/s", s)
+	}
+	period := strings.TrimSpace(lower[sep+skip:])
+	per, ok := durationUnits[period]
+	if !ok {
+		if per, err = ParseDuration(period); err != nil || per <= 0 {
+			return Rate{}, fmt.Errorf("Invalid rate period in %q", s)
+		}
+	}
+	return Rate{Count: count, Per: per}, nil
+}
+
+// PerSecond normalizes the rate to events per second
+func (r Rate) PerSecond() float64 {
+	if r.Per <= 0 {
+		return 0
+	}
+	return r.Count / r.Per.Seconds()
+}
+
+// Interval is the average time between events at this rate
+func (r Rate) Interval() time.Duration {
+	if r.Count <= 0 {
+		return 0
+	}
+	return time.Duration(float64(r.Per) / r.Count)
+}
+
+// String formats the rate like "100/s" or "5000/1h"
+func (r Rate) String() string {
+	count := strconv.FormatFloat(r.Count, 'f', -1, 64)
+	switch r.Per {
+	case time.Second:
+		return count + "/s"
+	case time.Minute:
+		return count + "/m"
+	case time.Hour:
+		return count + "/h"
+	}
+	return count + "/" + FormatDuration(r.Per)
+}
+
+// splitNumber splits a leading number (with optional decimal point) from the rest of s
+func splitNumber(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// splitUnit splits leading letters from the rest of s
+func splitUnit(s string) (string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
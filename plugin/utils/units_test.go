@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{"100": 100, "1.5GB": 1500000000, "512 kib": 524288, "2M": 2000000}
+	for in, expected := range cases {
+		n, err := ParseBytes(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Fatalf("Expected %s to be %d but got %d", in, expected, n)
+		}
+	}
+	if _, err := ParseBytes("12 parsecs"); err == nil {
+		t.Fatal("Expected an error for an unknown unit")
+	}
+	if _, err := ParseBytes("8192PiB"); err == nil {
+		t.Fatal("Expected an error for a size that overflows")
+	}
+	if s := FormatBytes(1500000); s != "1.5 MB" {
+		t.Fatalf("Expected 1.5 MB but got %s", s)
+	}
+	if s := FormatBytesIEC(1024); s != "1 KiB" {
+		t.Fatalf("Expected 1 KiB but got %s", s)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"2h30m":              150 * time.Minute,
+		"90":                 90 * time.Second,
+		"1d12h":              36 * time.Hour,
+		"2 hours 30 minutes": 150 * time.Minute,
+	}
+	for in, expected := range cases {
+		d, err := ParseDuration(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != expected {
+			t.Fatalf("Expected %s to be %s but got %s", in, expected, d)
+		}
+	}
+	for _, in := range []string{"", "inf", "+Inf", "NaN", "-5", "-5s", "1e12", "200000w", "100000d 100000d", "2 fortnights"} {
+		if d, err := ParseDuration(in); err == nil {
+			t.Fatalf("Expected an error parsing %q but got %s", in, d)
+		}
+	}
+	if s := FormatDuration(26*time.Hour + 30*time.Minute); s != "1d2h30m" {
+		t.Fatalf("Expected 1d2h30m but got %s", s)
+	}
+	if s := FormatDuration(90*time.Second + 600*time.Millisecond); s != "1m31s" {
+		t.Fatalf("Expected 1m31s but got %s", s)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	r, err := ParseRate("100/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.PerSecond() != 100 || r.String() != "100/s" {
+		t.Fatalf("Unexpected rate %s", r)
+	}
+	r, err = ParseRate("10 per minute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Interval() != 6*time.Second {
+		t.Fatalf("Expected an interval of 6s but got %s", r.Interval())
+	}
+	for _, in := range []string{"100", "inf/s", "NaN/s", "-5/s", "1e400/s", "5/-1s", "5/0s", "5/200000w"} {
+		if r, err := ParseRate(in); err == nil {
+			t.Fatalf("Expected an error parsing %q but got %s", in, r)
+		}
+	}
+}
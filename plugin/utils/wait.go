@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/httpclient"
+)
+
+// Backoff between attempts of WaitFor
+const (
+	waitBackoff    = 100 * time.Millisecond
+	waitMaxBackoff = 5 * time.Second
+	waitAttempt    = 5 * time.Second // waitAttempt bounds each attempt of a check
+)
+
+// Check is a readiness check for WaitFor, returning nil once what it checks is ready
+type Check func(ctx context.Context) error
+
+// WaitFor runs each check until it passes, backing off between attempts, for plugins whose containers start
+// before their sidecars or that should ride out a brief network blip before failing a connection test.
+// It returns the last failure once ctx is done, so bound the wait with a deadline. An attempt cut short
+// because ctx was done doesn't count, its failure is only the deadline's.
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	err := utils.WaitFor(ctx, utils.TCPCheck("localhost:5432"), utils.HTTPCheck("http://localhost:8200/v1/sys/health"))
+func WaitFor(ctx context.Context, checks ...Check) error {
+	for _, check := range checks {
+		backoff := waitBackoff
+		var last error
+		for {
+			attempt, cancel := context.WithTimeout(ctx, waitAttempt)
+			err := check(attempt)
+			cancel()
+			if err == nil {
+				break
+			}
+			interrupted := waitOver(ctx)
+			if !interrupted || last == nil {
+				last = err
+			}
+			if interrupted || SleepCtx(ctx, Jitter(backoff, 0.2)) != nil {
+				return fmt.Errorf("Gave up waiting: %s", last)
+			}
+			if backoff *= 2; backoff > waitMaxBackoff {
+				backoff = waitMaxBackoff
+			}
+		}
+	}
+	return nil
+}
+
+// waitOver reports whether ctx is done or its deadline passed. A dial times out on the deadline itself,
+// which can be a moment before ctx says it's done.
+func waitOver(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// TCPCheck passes once a TCP connection to addr (host:port) succeeds
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		conn, err := httpclient.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPCheck passes once a GET of url returns a 2xx status
+func HTTPCheck(url string) Check {
+	client := httpclient.New(httpclient.Options{})
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// DNSCheck passes once host resolves to at least one address
+func DNSCheck(host string) Check {
+	return func(ctx context.Context) error {
+		// The lookup can't be cancelled, so give up on it when ctx is done and let it finish on its own
+		result := make(chan error, 1)
+		go func() {
+			addrs, err := net.LookupHost(host)
+			if err == nil && len(addrs) == 0 {
+				err = fmt.Errorf("%s has no addresses", host)
+			}
+			result <- err
+		}()
+		select {
+		case err := <-result:
+			return err
+		case <-ctx.Done():
+			return fmt.Errorf("Looking up %s: %s", host, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitFor(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Not ready for the first couple of requests, like a sidecar that's still starting
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := WaitFor(ctx, TCPCheck(server.Listener.Addr().String()), HTTPCheck(server.URL), DNSCheck("localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("Expected the HTTP check to be retried until it passed, got %d requests", requests)
+	}
+}
+
+func TestWaitForGivesUp(t *testing.T) {
+	// Grab a free port, and close it so nothing is listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = WaitFor(ctx, TCPCheck(addr))
+	if err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("Expected to give up with the last failure, got %v", err)
+	}
+}
+
+func TestWaitForReportsTheLastRealFailure(t *testing.T) {
+	var attempts int32
+	check := func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return errors.New("connection refused")
+		}
+		// the next attempt is still going when the wait's deadline passes
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := WaitFor(ctx, check)
+	if err == nil || err.Error() != "Gave up waiting: connection refused" {
+		t.Errorf("Expected to give up with the failure before the deadline, got %v", err)
+	}
+}
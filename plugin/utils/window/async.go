@@ -0,0 +1,122 @@
+package window
+
+import (
+	"sync"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultMaxStaleness is how far behind an AsyncCheckpoint's saved position lags at most, if it's not set
+const DefaultMaxStaleness = 5 * time.Second
+
+// AsyncCheckpoint saves positions to Checkpoint in the background, for hot loops that advance their
+// position with every event. Only the latest position is saved, at most MaxStaleness after it was reached,
+// so a crash redelivers up to MaxStaleness of events rather than every event costing a write. The position
+// is also saved when the plugin shuts down, see package shutdown, and by Flush and Close.
+type AsyncCheckpoint struct {
+	Checkpoint   Checkpoint
+	MaxStaleness time.Duration
+
+	mu         sync.Mutex
+	latest     time.Time
+	has        bool // has is set once there's a latest position
+	dirty      bool // dirty is set while the latest position isn't saved
+	timer      *time.Timer
+	err        error // err is the last background save's, returned by the next Save
+	closed     bool
+	unregister func()
+
+	saveMu sync.Mutex // saveMu orders saves, so an older position never lands after a newer one
+}
+
+// NewAsyncCheckpoint saves positions to c at most maxStaleness after they're reached, and when the plugin
+// shuts down
+func NewAsyncCheckpoint(c Checkpoint, maxStaleness time.Duration) *AsyncCheckpoint {
+	a := &AsyncCheckpoint{Checkpoint: c, MaxStaleness: maxStaleness}
+	a.unregister = shutdown.Register("checkpoint", a.Flush)
+	return a
+}
+
+// Load implements Checkpoint, returning the latest position even if it's not saved yet
+func (a *AsyncCheckpoint) Load() (time.Time, bool, error) {
+	a.mu.Lock()
+	latest, has := a.latest, a.has
+	a.mu.Unlock()
+	if has {
+		return latest, true, nil
+	}
+	return a.Checkpoint.Load()
+}
+
+// Save implements Checkpoint, holding position to be saved in the background. It returns the error of a
+// background save that failed since the last call, the position is tried again with the next.
+func (a *AsyncCheckpoint) Save(position time.Time) error {
+	a.mu.Lock()
+	a.latest, a.has, a.dirty = position, true, true
+	if a.closed {
+		a.mu.Unlock()
+		return a.Flush()
+	}
+	if a.timer == nil {
+		staleness := a.MaxStaleness
+		if staleness <= 0 {
+			staleness = DefaultMaxStaleness
+		}
+		a.timer = time.AfterFunc(staleness, a.saveInBackground)
+	}
+	err := a.err
+	a.err = nil
+	a.mu.Unlock()
+	return err
+}
+
+func (a *AsyncCheckpoint) saveInBackground() {
+	if err := a.Flush(); err != nil {
+		log.Errorf("Unable to save checkpoint: %s", err)
+		a.mu.Lock()
+		a.err = err
+		a.mu.Unlock()
+	}
+}
+
+// Flush saves the latest position now, if it isn't already
+func (a *AsyncCheckpoint) Flush() error {
+	a.saveMu.Lock()
+	defer a.saveMu.Unlock()
+
+	a.mu.Lock()
+	position, dirty := a.latest, a.dirty
+	a.dirty = false
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	err := a.Checkpoint.Save(position)
+	if err != nil {
+		// saved again with the next position, or by the next flush
+		a.mu.Lock()
+		a.dirty = true
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// Close saves the latest position and stops saving in the background. Later positions are saved straight
+// away.
+func (a *AsyncCheckpoint) Close() error {
+	if a.unregister != nil {
+		a.unregister()
+	}
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	return a.Flush()
+}
@@ -0,0 +1,78 @@
+package window
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/utils/shutdown"
+)
+
+// countingCheckpoint counts saves, and is safe to save to in the background
+type countingCheckpoint struct {
+	mu       sync.Mutex
+	position time.Time
+	saves    int
+}
+
+func (c *countingCheckpoint) Load() (time.Time, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.position, c.saves > 0, nil
+}
+
+func (c *countingCheckpoint) Save(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.position = t
+	c.saves++
+	return nil
+}
+
+func (c *countingCheckpoint) get() (time.Time, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.position, c.saves
+}
+
+func TestAsyncCheckpoint(t *testing.T) {
+	under := &countingCheckpoint{}
+	cp := NewAsyncCheckpoint(under, 50*time.Millisecond)
+	defer cp.Close()
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		if err := cp.Save(start.Add(time.Duration(i) * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := start.Add(999 * time.Second)
+	if p, ok, _ := cp.Load(); !ok || !p.Equal(last) {
+		t.Errorf("Expected the latest position to load before it's saved, got %s", p)
+	}
+	if _, saves := under.get(); saves != 0 {
+		t.Errorf("Expected nothing saved yet, got %d saves", saves)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if p, saves := under.get(); saves != 1 || !p.Equal(last) {
+		t.Errorf("Expected the latest position saved once within the staleness, got %d saves of %s", saves, p)
+	}
+}
+
+func TestAsyncCheckpointShutdown(t *testing.T) {
+	under := &countingCheckpoint{}
+	cp := NewAsyncCheckpoint(under, time.Hour)
+	position := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cp.Save(position)
+
+	shutdown.Run()
+	if p, saves := under.get(); saves != 1 || !p.Equal(position) {
+		t.Errorf("Expected shutting down to save the position, got %d saves of %s", saves, p)
+	}
+
+	cp.Close()
+	cp.Save(position.Add(time.Second))
+	if p, _ := under.get(); !p.Equal(position.Add(time.Second)) {
+		t.Errorf("Expected positions saved after closing to be saved straight away, got %s", p)
+	}
+}
@@ -0,0 +1,175 @@
+// Package window splits a time range into bounded windows, for triggers that backfill historical data on
+// their first run. Asking an API for a year of events in one query times out or gets truncated; asking
+// for a day at a time, and remembering which days are done, doesn't.
+//
+//	it, err := window.NewIterator(start, time.Now(), 24*time.Hour, time.Minute, window.CacheCheckpoint("backfill"))
+//	...
+//	for w, ok := it.Next(); ok; w, ok = it.Next() {
+//		if err := fetch(w.Start, w.End); err != nil {
+//			return err // the next run picks up from this window
+//		}
+//		if err := it.Done(w); err != nil {
+//			return err
+//		}
+//	}
+package window
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/cache"
+)
+
+// Window is a range of time, from Start inclusive to End exclusive
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// String formats the window as an RFC 3339 interval, start/end
+func (w Window) String() string {
+	return w.Start.Format(time.RFC3339) + "/" + w.End.Format(time.RFC3339)
+}
+
+// Duration returns the length of the window
+func (w Window) Duration() time.Duration {
+	return w.End.Sub(w.Start)
+}
+
+// Parse parses a window formatted as start/end in RFC 3339
+func Parse(s string) (Window, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Window{}, fmt.Errorf("Invalid window %q, expected start/end", s)
+	}
+	start, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Window{}, fmt.Errorf("Invalid window start: %s", err)
+	}
+	end, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Window{}, fmt.Errorf("Invalid window end: %s", err)
+	}
+	if !end.After(start) {
+		return Window{}, fmt.Errorf("Invalid window %q, it ends before it starts", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+// Checkpoint persists how far an iterator got, so a backfill that's interrupted carries on where it left off
+type Checkpoint interface {
+	Load() (time.Time, bool, error) // Load returns the saved position, and false if there isn't one
+	Save(position time.Time) error
+}
+
+// CacheCheckpoint is a Checkpoint stored in the named file in the plugin cache
+type CacheCheckpoint string
+
+// Load implements Checkpoint
+func (c CacheCheckpoint) Load() (time.Time, bool, error) {
+	b, err := cache.Get(string(c))
+	if err == cache.ErrNotFound || (err == nil && len(b) == 0) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("Invalid checkpoint in %s: %s", string(c), err)
+	}
+	return t, true, nil
+}
+
+// Save implements Checkpoint. The cache's backends never leave an entry half written.
+func (c CacheCheckpoint) Save(position time.Time) error {
+	return cache.Put(string(c), []byte(position.Format(time.RFC3339Nano)))
+}
+
+// Iterator walks a time range in windows of Step, each overlapping the previous by Overlap so events
+// stamped right on a boundary, or a little late, aren't missed. Expect to see events in the overlap
+// twice, and deduplicate them.
+type Iterator struct {
+	Start   time.Time
+	End     time.Time
+	Step    time.Duration
+	Overlap time.Duration
+	// Checkpoint, if set, saves the position after each window is done, and is where iteration resumes
+	Checkpoint Checkpoint
+	// Report, if set, is called with the position after each window is done, ie: a trigger's Checkpoint
+	// method, so heartbeats show how far the backfill got
+	Report func(position interface{})
+
+	next time.Time
+}
+
+// NewIterator returns an iterator from start to end, resuming from checkpoint if it has a position within
+// the range. checkpoint may be nil.
+func NewIterator(start, end time.Time, step, overlap time.Duration, checkpoint Checkpoint) (*Iterator, error) {
+	if step <= 0 {
+		return nil, errors.New("The window step must be positive")
+	}
+	if overlap < 0 || overlap >= step {
+		return nil, fmt.Errorf("The window overlap must be between 0 and the step of %s, got %s", step, overlap)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("The range ends at %s, before it starts at %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	it := &Iterator{Start: start, End: end, Step: step, Overlap: overlap, Checkpoint: checkpoint, next: start}
+	if checkpoint != nil {
+		position, ok, err := checkpoint.Load()
+		if err != nil {
+			return nil, err
+		}
+		if ok && position.After(start) {
+			it.next = position
+		}
+	}
+	return it, nil
+}
+
+// Next returns the next window, or false once the range is done
+func (it *Iterator) Next() (Window, bool) {
+	if !it.next.Before(it.End) {
+		return Window{}, false
+	}
+	w := Window{Start: it.next.Add(-it.Overlap), End: it.next.Add(it.Step)}
+	if w.Start.Before(it.Start) {
+		w.Start = it.Start
+	}
+	if w.End.After(it.End) {
+		w.End = it.End
+	}
+	return w, true
+}
+
+// Done marks a window finished, moving the iterator on and saving the checkpoint. A window that isn't
+// marked done is returned again by Next, and after a restart.
+func (it *Iterator) Done(w Window) error {
+	if w.End.After(it.next) {
+		it.next = w.End
+	}
+	if it.Report != nil {
+		it.Report(it.next.Format(time.RFC3339))
+	}
+	if it.Checkpoint != nil {
+		return it.Checkpoint.Save(it.next)
+	}
+	return nil
+}
+
+// Position returns where the next window starts, before the overlap
+func (it *Iterator) Position() time.Time {
+	return it.next
+}
+
+// Remaining returns how much of the range is left
+func (it *Iterator) Remaining() time.Duration {
+	if !it.next.Before(it.End) {
+		return 0
+	}
+	return it.End.Sub(it.next)
+}
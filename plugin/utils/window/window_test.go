@@ -0,0 +1,79 @@
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+type memCheckpoint struct {
+	position time.Time
+	saved    bool
+}
+
+func (m *memCheckpoint) Load() (time.Time, bool, error) { return m.position, m.saved, nil }
+func (m *memCheckpoint) Save(t time.Time) error {
+	m.position, m.saved = t, true
+	return nil
+}
+
+func TestIterator(t *testing.T) {
+	w, err := Parse("2017-01-01T00:00:00Z/2017-01-03T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &memCheckpoint{}
+	var reported []interface{}
+	it, err := NewIterator(w.Start, w.End, 24*time.Hour, time.Minute, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it.Report = func(p interface{}) { reported = append(reported, p) }
+
+	expected := []string{
+		"2017-01-01T00:00:00Z/2017-01-02T00:00:00Z",
+		"2017-01-01T23:59:00Z/2017-01-03T00:00:00Z",
+		"2017-01-02T23:59:00Z/2017-01-03T12:00:00Z",
+	}
+	var got []string
+	for w, ok := it.Next(); ok; w, ok = it.Next() {
+		got = append(got, w.String())
+		if len(got) == 2 {
+			break // interrupted, without finishing the second window
+		}
+		it.Done(w)
+	}
+	if len(reported) != 1 || reported[0] != "2017-01-02T00:00:00Z" {
+		t.Errorf("Expected the position to be reported, got %v", reported)
+	}
+
+	// A new iterator resumes from the checkpoint, repeating the unfinished window
+	it, _ = NewIterator(w.Start, w.End, 24*time.Hour, time.Minute, cp)
+	got = got[:1]
+	for w, ok := it.Next(); ok; w, ok = it.Next() {
+		got = append(got, w.String())
+		it.Done(w)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Window %d: expected %s, got %s", i, expected[i], got[i])
+		}
+	}
+	if it.Remaining() != 0 || !cp.position.Equal(w.End) {
+		t.Errorf("Expected the iterator to finish at the end, checkpoint is at %s", cp.position)
+	}
+}
+
+func TestInvalidWindows(t *testing.T) {
+	for _, s := range []string{"2017-01-01T00:00:00Z", "2017-01-02T00:00:00Z/2017-01-01T00:00:00Z", "yesterday/today"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Expected %s not to parse", s)
+		}
+	}
+	now := time.Now()
+	if _, err := NewIterator(now, now.Add(time.Hour), time.Minute, time.Minute, nil); err == nil {
+		t.Error("Expected an overlap as long as the step to be invalid")
+	}
+}
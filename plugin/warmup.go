@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/komand/plugin-sdk-go/plugin/secrets"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// warmup is set by SetWarmup
+var warmup *warmupOptions
+
+type warmupOptions struct {
+	connection json.RawMessage
+	test       bool
+}
+
+// warmed are the actions connected ahead of time, with the connection parameters they were connected with
+var (
+	warmedMu sync.Mutex
+	warmed   = map[Actionable]string{}
+)
+
+// SetWarmup connects every action to connection as soon as the plugin starts serving, in HTTP or keep-alive
+// mode, rather than when the first start message arrives. Actions started with the same connection then
+// skip connecting. With test, each action that's Testable is also tested. Warming up is best effort, a
+// failure is logged and the action connects when it's started as usual.
+//
+// It's set from PLUGIN_WARM_CONNECTION, holding the connection's JSON, and PLUGIN_WARM_TEST.
+func (p Plugin) SetWarmup(connection json.RawMessage, test bool) {
+	warmup = &warmupOptions{connection: connection, test: test}
+}
+
+// warm connects the actions, if SetWarmup was called
+func (p *Plugin) warm() {
+	if warmup == nil {
+		return
+	}
+	p.declareEgress()
+	resolved, err := secrets.ResolveJSON(warmup.connection)
+	if err != nil {
+		log.Errorf("Unable to warm up connections: %s", err)
+		return
+	}
+	for name, action := range p.actions {
+		if err := warmAction(action, resolved, warmup.test); err != nil {
+			log.Warnf("Unable to warm up %s, it will connect when started: %s", name, err)
+		}
+	}
+}
+
+func warmAction(action Actionable, params json.RawMessage, test bool) error {
+	connectable, ok := action.(Connectable)
+	if !ok {
+		return nil
+	}
+	connection := connectable.Connection()
+	if err := json.Unmarshal(params, connection); err != nil {
+		return fmt.Errorf("Unable to parse connection config: %s", err)
+	}
+	if err := clean(connection.Validate()); err != nil {
+		return fmt.Errorf("Connection validation failed: %s", joinErrors(err))
+	}
+	if err := connection.Connect(); err != nil {
+		return err
+	}
+	if testable, ok := action.(Testable); ok && test {
+		if _, err := testable.Test(); err != nil {
+			return fmt.Errorf("Test failed: %s", err)
+		}
+	}
+	warmedMu.Lock()
+	defer warmedMu.Unlock()
+	warmed[action] = canonicalJSON(params)
+	return nil
+}
+
+// isWarm checks action was warmed up with params, and forgets it was if it wasn't, as it's connected again
+func isWarm(action Actionable, params json.RawMessage) bool {
+	warmedMu.Lock()
+	defer warmedMu.Unlock()
+	warm, ok := warmed[action]
+	if !ok {
+		return false
+	}
+	if warm == canonicalJSON(params) {
+		return true
+	}
+	delete(warmed, action)
+	return false
+}
+
+// canonicalJSON re-marshals data so the same parameters compare equal whatever their spacing or order
+func canonicalJSON(data json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	return string(b)
+}
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type CountingConnection struct {
+	HelloConnection
+	connects int
+}
+
+func (c *CountingConnection) Connect() error {
+	c.connects++
+	return nil
+}
+
+type WarmAction struct {
+	HelloAction
+	connection CountingConnection
+}
+
+func (w *WarmAction) Connection() Connection {
+	return &w.connection
+}
+
+func TestWarmupConnectsAheadOfTime(t *testing.T) {
+	defer func() { warmup = nil }()
+	p := New()
+	action := &WarmAction{}
+	p.AddAction(action)
+	p.SetWarmup(json.RawMessage(`{"thing": "one"}`), false)
+
+	start := strings.Replace(actionStartMessage, "hello_action", action.Name(), 1)
+	other := strings.Replace(start, `"thing": "one"`, `"thing": "two"`, 1)
+	var out bytes.Buffer
+	if err := p.RunKeepAlive(strings.NewReader(start+start+other), &out, 0); err != nil {
+		t.Fatal(err)
+	}
+	// connected ahead of time, then again for the different connection
+	if action.connection.connects != 2 || action.connection.Thing != "two" {
+		t.Errorf("Expected 2 connects, the last to two, got %d connects to %s", action.connection.connects, action.connection.Thing)
+	}
+}
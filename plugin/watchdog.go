@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/komand/plugin-sdk-go/plugin/message"
+	"github.com/komand/plugin-sdk-go/plugin/utils"
+)
+
+// watchdog is set by SetWatchdog
+var watchdog *watchdogConfig
+
+// watchdogBackoff is the wait before the first restart of a stuck trigger, doubling for each restart after
+var watchdogBackoff = time.Second
+
+// watchdogGrace is how long a stuck trigger has to return once it's cancelled, before the process exits
+var watchdogGrace = 10 * time.Second
+
+// watchdogExit is called when a stuck trigger can't be restarted in process
+var watchdogExit = func() { os.Exit(1) }
+
+// maxDiagnosticStack bounds the goroutine dump sent with a diagnostic event
+const maxDiagnosticStack = 64 << 10
+
+type watchdogConfig struct {
+	threshold  time.Duration
+	maxBackoff time.Duration
+}
+
+// SetWatchdog restarts a running trigger that hasn't made progress for threshold, waiting with a backoff
+// of up to maxBackoff between restarts, 0 being no limit. Progress is reported by the trigger calling Trigger.Progress,
+// Polled or Checkpoint, or dispatching an event. Each restart sends a diagnostic event to the trigger's
+// dispatcher, with a dump of what every goroutine was doing. Triggers are restarted in process if they
+// implement ContextTriggerable and return once cancelled; otherwise, the process exits for the
+// orchestrator to restart it.
+func (p Plugin) SetWatchdog(threshold, maxBackoff time.Duration) error {
+	if threshold <= 0 {
+		return fmt.Errorf("Watchdog threshold must be positive, got %s", threshold)
+	}
+	if maxBackoff < 0 {
+		return fmt.Errorf("Watchdog backoff must not be negative, got %s", maxBackoff)
+	}
+	watchdog = &watchdogConfig{threshold: threshold, maxBackoff: maxBackoff}
+	return nil
+}
+
+// runTrigger runs the trigger until it returns, or until ctx is done if it can be stopped
+func runTrigger(ctx context.Context, trigger Triggerable) error {
+	if c, ok := trigger.(ContextTriggerable); ok {
+		return c.RunTriggerContext(ctx)
+	}
+	return trigger.RunTrigger()
+}
+
+// runWatched runs the trigger, restarting it whenever it gets stuck
+func runWatched(start *message.TriggerStart, trigger Triggerable, dispatcher Dispatcher, config watchdogConfig) error {
+	_, stoppable := trigger.(ContextTriggerable)
+	backoff := watchdogBackoff
+	for restarts := 0; ; restarts++ {
+		began := time.Now()
+		ctx, cancel := context.WithCancel(context.Background())
+		exited := make(chan error, 1)
+		go func() {
+			exited <- runTrigger(ctx, trigger)
+		}()
+
+		last, err := watchUntilStuck(trigger, began, exited, config.threshold)
+		if err != errStuck {
+			cancel()
+			return err
+		}
+		reason := fmt.Sprintf("Trigger made no progress for more than %s", config.threshold)
+		log.Errorf("%s, restarting it", reason)
+		sendDiagnostic(start, dispatcher, reason, restarts, last)
+
+		cancel()
+		if !stoppable {
+			log.Errorf("Trigger %s can't be stopped, exiting for it to be restarted", start.Trigger)
+			watchdogExit()
+			return errStuck
+		}
+		select {
+		case <-exited:
+		case <-time.After(watchdogGrace):
+			log.Errorf("Trigger %s didn't stop within %s of being cancelled, exiting for it to be restarted", start.Trigger, watchdogGrace)
+			watchdogExit()
+			return errStuck
+		}
+
+		// A trigger that made some progress before getting stuck starts over with the shortest backoff
+		if last.After(began) {
+			backoff = watchdogBackoff
+		}
+		time.Sleep(utils.Jitter(backoff, 0.2))
+		if backoff *= 2; config.maxBackoff > 0 && backoff > config.maxBackoff {
+			backoff = config.maxBackoff
+		}
+	}
+}
+
+var errStuck = errors.New("trigger is stuck")
+
+// watchUntilStuck waits for the trigger to exit, returning its error, or errStuck and when it last made
+// progress if it doesn't for threshold
+func watchUntilStuck(trigger Triggerable, began time.Time, exited <-chan error, threshold time.Duration) (time.Time, error) {
+	interval := threshold / 4
+	if interval <= 0 {
+		interval = threshold
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			return time.Time{}, err
+		case <-ticker.C:
+		}
+		// the tick and the exit can be ready together, a trigger that has exited isn't stuck
+		select {
+		case err := <-exited:
+			return time.Time{}, err
+		default:
+		}
+		last := began
+		if p, ok := trigger.(progressable); ok && p.lastActive().After(last) {
+			last = p.lastActive()
+		}
+		if event := time.Unix(0, atomic.LoadInt64(&lastEvent)); event.After(last) {
+			last = event
+		}
+		if time.Since(last) > threshold {
+			return last, errStuck
+		}
+	}
+}
+
+func sendDiagnostic(start *message.TriggerStart, dispatcher Dispatcher, reason string, restarts int, last time.Time) {
+	stack := make([]byte, maxDiagnosticStack)
+	stack = stack[:runtime.Stack(stack, true)]
+	m := &message.Message{
+		Header: message.Header{
+			Version: message.Version,
+			Type:    "trigger_diagnostic",
+		},
+	}
+	m.Body.Contents = &message.TriggerDiagnostic{
+		Meta:         start.Meta,
+		Trigger:      start.Trigger,
+		Time:         time.Now(),
+		Reason:       reason,
+		Restarts:     restarts,
+		LastProgress: last,
+		Stack:        string(stack),
+	}
+	if err := dispatcher.Send(m); err != nil {
+		log.Warnf("Unable to send diagnostic event: %s", err)
+	}
+}
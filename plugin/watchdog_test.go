@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komand/plugin-sdk-go/plugin/message"
+)
+
+// HangingTrigger hangs without progress on its first run, and finishes on the next
+type HangingTrigger struct {
+	Trigger
+	runs int
+}
+
+func (t *HangingTrigger) Name() string        { return "hanging_trigger" }
+func (t *HangingTrigger) Description() string { return "hangs once" }
+func (t *HangingTrigger) RunTrigger() error   { return t.RunTriggerContext(context.Background()) }
+
+func (t *HangingTrigger) RunTriggerContext(ctx context.Context) error {
+	t.runs++
+	if t.runs == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	t.Progress()
+	return nil
+}
+
+func TestWatchdogRestartsStuckTrigger(t *testing.T) {
+	defer func(b time.Duration) { watchdogBackoff = b }(watchdogBackoff)
+	watchdogBackoff = time.Millisecond
+
+	trigger := &HangingTrigger{}
+	dispatcher := &capturingDispatcher{}
+	start := &message.TriggerStart{Trigger: trigger.Name()}
+	err := runWatched(start, trigger, dispatcher, watchdogConfig{threshold: 40 * time.Millisecond, maxBackoff: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trigger.runs != 2 {
+		t.Errorf("Expected the trigger to be restarted once, it ran %d times", trigger.runs)
+	}
+	if len(dispatcher.messages) != 1 || !strings.Contains(dispatcher.messages[0], `"type":"trigger_diagnostic"`) {
+		t.Errorf("Expected a diagnostic event, got %v", dispatcher.messages)
+	}
+	if !strings.Contains(dispatcher.messages[0], "RunTriggerContext") {
+		t.Error("Expected the diagnostic to include a goroutine dump showing where the trigger was stuck")
+	}
+}
+
+func TestSetWatchdogRejectsBadThresholds(t *testing.T) {
+	defer func() { watchdog = nil }()
+	p := Plugin{}
+	for _, threshold := range []time.Duration{0, -time.Second} {
+		if err := p.SetWatchdog(threshold, time.Minute); err == nil {
+			t.Errorf("Expected a threshold of %s to be refused", threshold)
+		}
+	}
+	if err := p.SetWatchdog(time.Minute, -time.Second); err == nil {
+		t.Error("Expected a negative backoff to be refused")
+	}
+	if err := p.SetWatchdog(3, 0); err != nil || watchdog == nil {
+		t.Fatalf("Expected a threshold of 3ns to be set, got %v", err)
+	}
+	// too short to divide, it's still watched: a trigger that exited isn't stuck, one that didn't is
+	exited := make(chan error, 1)
+	exited <- nil
+	if _, err := watchUntilStuck(&HangingTrigger{}, time.Now(), exited, 3); err != nil {
+		t.Fatalf("Expected the trigger to be seen to exit, got %v", err)
+	}
+	if _, err := watchUntilStuck(&HangingTrigger{}, time.Now(), make(chan error), 3); err != errStuck {
+		t.Fatalf("Expected the trigger to be stuck, got %v", err)
+	}
+}
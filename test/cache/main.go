@@ -51,23 +51,20 @@ func main() {
 			timesRan := 0
 			for timesRan < 500 {
 				// Try to lock the cache`
-				ok, err := cache.LockCacheFile("locker.lock")
+				lock, err := cache.LockCacheFile("locker.lock")
 				// If there is an error, it fails hard - shouldn't be an error
 				if err != nil {
 					log.Fatalf("%d\t:\t\t%s", grID, err)
 				}
-				// If we got the lock, then pretend to do some work and unlock it
-				if ok {
-					// Grabbing and Releasing the counter will be our "work"
-					// If 2 things enter work block, the Grab call will log fatal if it's a proper race
-					// They could still sneak in between eachother, but if the file lock is working properly, that can't happen
-					// until AFTER cache.Unlock is called
-					// What can I say, race conditions are hard to induce in a vacuum
-					c.Grab(grID)
-					c.Release(grID)
-					dur := time.Millisecond * 1
-					cache.UnlockCacheFile("locker.lock", &dur)
-				}
+				// We got the lock, so pretend to do some work and unlock it
+				// Grabbing and Releasing the counter will be our "work"
+				// If 2 things enter work block, the Grab call will log fatal if it's a proper race
+				// They could still sneak in between eachother, but if the file lock is working properly, that can't happen
+				// until AFTER lock.Unlock is called
+				// What can I say, race conditions are hard to induce in a vacuum
+				c.Grab(grID)
+				c.Release(grID)
+				lock.UnlockAfter(time.Millisecond * 1)
 				timesRan++
 			}
 			wg.Done()